@@ -1,61 +1,1794 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
+	"image"
+	"image/png"
 	"io"
+	"io/fs"
+	"log/slog"
+	"math"
+	"net"
+	"net/http"
 	"os"
+	"os/signal"
+	"os/user"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
 
 	"github.com/mdmcconnell/pdfcomp/pdfcomp"
+	"github.com/mdmcconnell/pdfcomp/server"
+	"google.golang.org/grpc"
+	"gopkg.in/yaml.v2"
 )
 
+// The subcommands, each with flags of its own
+var commands = map[string]func(args []string) int{
+	"compare": compareCommand,
+	"report":  reportCommand,
+	"batch":   batchCommand,
+	"render":  renderCommand,
+	"serve":   serveCommand,
+	"approve": approve,
+	"verify":  verify,
+}
+
 func main() {
-	iP := flag.Bool("images", false, "generate comparison images of pages that are different")
-	pP := flag.Bool("pdf", false, "generate comparison images of pages that are different")
-	rP := flag.Int("resolution", 300, "dpi resolution for comparison bitmaps")
-	ratP := flag.Int("ratio", 30, "divide resolution by this to determine the radius for difference outline circles")
-	dP := flag.Bool("debug", false, "write verbose debug output to stderr")
-	flag.Parse()
-	fileArgs := flag.Args()
-	images := *iP
-	resolution := *rP
-	ratio := *ratP
-	pdf := *pP
-	pdfcomp.GlobDebug = *dP
-
-	if len(fileArgs) != 2 {
-		fmt.Fprintf(os.Stderr, "Wrong number of files give, need 2, received %d\n", len(fileArgs))
+	if len(os.Args) > 1 && os.Args[1] == "help" {
 		printUse()
-		os.Exit(2)
+		os.Exit(0)
+	}
+	setupLogging(false, false)
+	legacyExitCodes = slices.ContainsFunc(os.Args[1:], isLegacyExitCodes)
+	if err := setupRenderer(); err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", err.Error())
+		os.Exit(exitCodeOf(err))
+	}
+	if len(os.Args) > 1 {
+		if cmd, ok := commands[os.Args[1]]; ok {
+			os.Exit(cmd(os.Args[2:]))
+		}
+	}
+	// Without a subcommand the arguments are those of compare, as they were
+	// before there were subcommands
+	os.Exit(compareCommand(os.Args[1:]))
+}
+
+// True for the -legacy-exit-codes flag, which is looked for before the
+// arguments are parsed when the renderer cannot be set up
+func isLegacyExitCodes(arg string) bool {
+	switch strings.TrimLeft(arg, "-") {
+	case "legacy-exit-codes", "legacy-exit-codes=true", "legacy-exit-codes=1":
+		return strings.HasPrefix(arg, "-")
+	}
+	return false
+}
+
+// Log to stderr, for the program and the package: warnings by default, each
+// step when verbose, and only errors when quiet
+func setupLogging(verbose, quiet bool) {
+	level := slog.LevelWarn
+	if verbose {
+		level = slog.LevelDebug
+	} else if quiet {
+		level = slog.LevelError
+	}
+	l := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: level}))
+	slog.SetDefault(l)
+	pdfcomp.SetLogger(l)
+}
+
+// In a bundled build, or with renderer pins named by PDFCOMP_RENDERER_PINS,
+// use the pinned renderer when pdftoppm is not installed, fetching it the
+// first time
+func setupRenderer() error {
+	pins := pdfcomp.BundledPins()
+	if name := os.Getenv(pdfcomp.RendererPinsEnv); name != "" {
+		var err error
+		if pins, err = pdfcomp.ReadRendererPins(name); err != nil {
+			return err
+		}
+	}
+	if len(pins) > 0 {
+		dir, err := pdfcomp.DefaultRendererDir()
+		if err != nil {
+			return err
+		}
+		path, err := pdfcomp.LocateRenderer(pins, dir)
+		if err != nil {
+			return err
+		}
+		pdfcomp.UseRenderer(path)
+	}
+	return nil
+}
+
+// Use the renderer at path if it is not empty, and check that there is a
+// renderer, so that a missing one is reported with how to install it before
+// any work is done
+func checkRenderer(path string) error {
+	if path != "" {
+		pdfcomp.UseRenderer(path)
+	}
+	_, err := pdfcomp.ProbeRenderer()
+	return err
+}
+
+// The flags of the commands that compare files: compare, report and batch.
+// Each command only has the flags that mean something to it.
+type compareFlags struct {
+	fs *flag.FlagSet
+	// Flags given explicitly or in a config file, which override any preset
+	set map[string]bool
+
+	images, pdf, html, annotateCopies                      bool
+	pdfOut, layout, blink                                  string
+	resolution, ratio                                      int
+	singleProcess, portfolios, renderToDisk                bool
+	colorMode, renderFormat, rendererPath                  string
+	rendererArgs                                           rendererArgFlags
+	diffStyle, highlightColor, highlightStyle              string
+	highlightGraded                                        bool
+	highlightOpacity, grid, detailZoom, detailMargin       float64
+	gridUnit, joinDirection, joinAlign, joinBackground     string
+	outDir, nameTemplate                                   string
+	sample, stopAfter, maxPages                            int
+	sampleMethod                                           string
+	seed                                                   uint64
+	resumeDir, auditLog, operator, review                  string
+	annotations, signatures, maskSignatures, fonts, layers bool
+	layerVisibility                                        layerFlags
+	pageLabels, links, classify                            bool
+	preset                                                 string
+	maxArtifactBytes, renderCPUSeconds                     int
+	renderMemoryMB, renderOutputMB, memoryMB               int64
+	renderTimeout                                          time.Duration
+	contentShortcut                                        bool
+	contentPrecision, prescreen                            int
+	rescale, matchSize, cropToContent, align, parts        bool
+	compareRotation                                        bool
+	fit                                                    string
+	tolerance                                              int
+	maxDiffPercent, deltaE                                 float64
+	ignore                                                 ignoreFlags
+	configFile, cacheDir                                   string
+	cacheMB, cacheDirMB                                    int64
+	debug, verbose, quiet, progress, failFast              bool
+	summaryTo                                              string
+	legacyExitCodes                                        bool
+	porcelain                                              string
+	manifest                                               string
+	profiles                                               profileFlags
+	verifyRedaction, accessibility, compareContent         bool
+	verifyAuditLog, fingerprint                            string
+	compareText, compareVisual, compareStructure           bool
+
+	// What was found, for -summary
+	summary summary
+	// Where the outcome is printed with -porcelain, and where everything
+	// else is printed: stdout, or stderr with -porcelain
+	stdout, out io.Writer
+}
+
+// Define the flags of a comparing command on a flag set of its own
+func newCompareFlags(name string) *compareFlags {
+	f := &compareFlags{fs: flag.NewFlagSet(name, flag.ExitOnError), layerVisibility: layerFlags{}}
+	fs := f.fs
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: pdf-comp %s\n", commandUsage[name])
+		fs.PrintDefaults()
+	}
+	fs.BoolVar(&f.images, "images", false, "generate comparison images of pages that are different")
+	fs.BoolVar(&f.annotateCopies, "annotate-copies", false, "write copies of both files with an annotation over each region that differs")
+	fs.StringVar(&f.blink, "blink", "", "generate an animated image of each page that is different, blinking between the two files: gif or apng")
+	if name != "batch" {
+		fs.BoolVar(&f.pdf, "pdf", false, "generate a pdf bundling the comparison images of pages that are different")
+		fs.StringVar(&f.pdfOut, "pdf-out", "", "write the difference pdf to this file, or - for stdout (implies -pdf)")
+		fs.BoolVar(&f.html, "html", false, "generate an html report with interactive comparisons of differing pages")
+	}
+	fs.IntVar(&f.resolution, "resolution", 300, "dpi resolution for comparison bitmaps")
+	fs.IntVar(&f.ratio, "ratio", 30, "divide resolution by this to determine the radius for difference outline circles")
+	fs.BoolVar(&f.singleProcess, "single-process", false, "render each file with one pdftoppm process instead of one per page")
+	fs.StringVar(&f.colorMode, "color-mode", "rgb", "render and compare pages in rgb, gray or mono (black and white)")
+	fs.StringVar(&f.renderFormat, "render-format", "auto", "what the renderer writes pages as: png, ppm, or auto for png if it can")
+	fs.StringVar(&f.rendererPath, "renderer-path", "", "run the pdftoppm at this path instead of the one on the PATH")
+	fs.BoolVar(&f.renderToDisk, "render-to-disk", false, "have the renderer write each page to a temporary file rather than holding it in memory")
+	fs.Var(&f.rendererArgs, "renderer-arg", "pass these arguments to the renderer, such as \"-aa no\"; may be repeated")
+	fs.BoolVar(&f.portfolios, "portfolios", false, "also compare the documents embedded in pdf portfolios, pairing them by name")
+	fs.StringVar(&f.diffStyle, "diff-style", "circles", "how to show differences: circles, heatmap or boxes")
+	fs.StringVar(&f.layout, "layout", "side-by-side", "how the difference pdf shows each page: side-by-side, three-pane or three-pages")
+	fs.StringVar(&f.highlightColor, "highlight-color", "yellow", "highlight colour: yellow, magenta, cyan, orange, blue, red or #rrggbb")
+	fs.Float64Var(&f.highlightOpacity, "highlight-opacity", 0.5, "how strongly the highlight colour is blended in, from 0 to 1")
+	fs.BoolVar(&f.highlightGraded, "highlight-graded", false, "blend the highlight in more strongly the more the pixels differ, so slight differences are faint")
+	fs.StringVar(&f.highlightStyle, "highlight-style", "", "fill or outline; by default circles are filled and boxes outlined")
+	fs.Float64Var(&f.grid, "grid", 0, "draw a grid with lines this far apart, and rulers, over difference images")
+	fs.StringVar(&f.gridUnit, "grid-unit", "pt", "unit of -grid and the rulers: pt or mm")
+	fs.Float64Var(&f.detailZoom, "detail-zoom", 0, "show each region of differences close up in the html report and the pdf, this many times larger")
+	fs.Float64Var(&f.detailMargin, "detail-margin", pdfcomp.DefaultDetailMargin, "points of the page shown around each region close up")
+	fs.StringVar(&f.joinDirection, "join-direction", "horizontal", "how difference images put the two pages together: horizontal, vertical, or auto to stack landscape pages")
+	fs.StringVar(&f.joinAlign, "join-align", "top", "where the smaller page goes in difference images of pages of different sizes: top or center")
+	fs.StringVar(&f.joinBackground, "join-background", "white", "colour the smaller page is padded with: white, black or #rrggbb")
+	fs.StringVar(&f.outDir, "out-dir", "", "directory for output files, by default the directory of file1")
+	fs.StringVar(&f.nameTemplate, "name-template", "", "name for difference images, using {file1}, {file2}, {base1}, {base2} and {page}")
+	fs.IntVar(&f.sample, "sample", 0, "compare only this many pages and estimate how many of the rest differ")
+	fs.StringVar(&f.sampleMethod, "sample-method", "stratified", "how sampled pages are chosen: stratified or random")
+	fs.IntVar(&f.stopAfter, "stop-after", 0, "stop rendering after this many pages differ and estimate from their content how many of the rest do")
+	fs.IntVar(&f.maxPages, "max-pages", 0, "refuse to compare files with more pages than this")
+	fs.BoolVar(&f.failFast, "fail-fast", false, "stop at the first differing page, even when writing images or reports; -fail-fast=false compares every page")
+	fs.Uint64Var(&f.seed, "seed", 1, "random seed for choosing sampled pages; the same seed chooses the same pages")
+	fs.BoolVar(&f.annotations, "annotations", false, "also compare page annotations such as links, comments and stamps")
+	fs.BoolVar(&f.signatures, "signatures", false, "also compare signature fields: which are signed, by whom and when")
+	fs.BoolVar(&f.maskSignatures, "mask-signatures", false, "leave the areas where signatures appear out of the visual comparison")
+	fs.BoolVar(&f.fonts, "fonts", false, "note differing pages where a font was substituted in one file but not the other")
+	fs.BoolVar(&f.classify, "classify", false, "label each differing page with the probable cause of its differences")
+	fs.BoolVar(&f.layers, "layers", false, "also compare the layers of the documents and whether each is shown")
+	fs.Var(f.layerVisibility, "layer", "show or hide a layer by name before rendering, as name=on or name=off; may be repeated")
+	fs.BoolVar(&f.pageLabels, "page-labels", false, "also compare page labels, the page numbering viewers show")
+	fs.BoolVar(&f.links, "links", false, "also compare where the links on each page lead")
+	fs.StringVar(&f.preset, "preset", "", "start from a preset: strict, print or screen; other flags given override it")
+	fs.IntVar(&f.maxArtifactBytes, "max-artifact-bytes", 0, "keep each difference image within this many bytes, by scaling it down or switching to jpeg")
+	fs.IntVar(&f.renderCPUSeconds, "render-cpu-seconds", 0, "limit the processor time the renderer may spend on each page")
+	fs.Int64Var(&f.renderMemoryMB, "render-memory-mb", 0, "limit the memory the renderer may use, in megabytes (not on Windows)")
+	fs.Int64Var(&f.renderOutputMB, "render-output-mb", 0, "limit the size of each rendered page, in megabytes")
+	fs.DurationVar(&f.renderTimeout, "render-timeout", pdfcomp.DefaultRenderTimeout, "stop the renderer if it takes longer than this over a page, such as 90s or 10m; 0 for no limit")
+	fs.Int64Var(&f.memoryMB, "memory-mb", 0, "keep the memory the comparison takes up to about this many megabytes, rendering and comparing a page at a time and reusing its buffers")
+	fs.BoolVar(&f.contentShortcut, "content-shortcut", false, "skip rendering pages whose drawing commands and resources are unchanged")
+	fs.IntVar(&f.prescreen, "prescreen", 0, "render pages at this lower dpi resolution first, and only pages that differ at it at -resolution")
+	fs.IntVar(&f.contentPrecision, "content-precision", pdfcomp.DefaultContentPrecision, "decimal places numbers are rounded to when comparing drawing commands")
+	fs.BoolVar(&f.rescale, "rescale", false, "compare pages that render at a whole multiple of each other's size by reducing the larger")
+	fs.BoolVar(&f.compareRotation, "compare-rotation", false, "count pages rotated differently in each file as different, even if they look the same turned the same way")
+	fs.BoolVar(&f.matchSize, "match-size", false, "render pages that are a different size in each file, such as Letter against A4, at the same number of pixels")
+	fs.BoolVar(&f.cropToContent, "crop-to-content", false, "crop each page to its content and compare the content wherever it is, for receipts and pages whose length varies")
+	fs.StringVar(&f.fit, "fit", "", "compare pages that render at different sizes: pad both to the larger, crop both to the smaller, or scale file2 to file1's size")
+	fs.BoolVar(&f.align, "align", false, "line up pages that are offset by a few pixels before comparing them, and report how far they were moved")
+	fs.IntVar(&f.tolerance, "tolerance", 0, "count pixels whose colour channels differ by no more than this, out of 255, as the same")
+	fs.Float64Var(&f.deltaE, "delta-e", 0, "count pixels whose colours are no more than this far apart in CIE Lab as the same")
+	fs.Float64Var(&f.maxDiffPercent, "max-diff-percent", 0, "count pages where no more than this percentage of the area differs as the same")
+	fs.Var(&f.ignore, "ignore", "leave an area out of the comparison, as [page:]x,y,width,height in points from the top left; may be repeated")
+	fs.StringVar(&f.configFile, "config", "", "read default settings from this file instead of .pdfcomp.yaml in the current directory or a parent")
+	fs.StringVar(&f.cacheDir, "cache-dir", "", "keep rendered pages in this directory, and reuse them for files compared again")
+	fs.Int64Var(&f.cacheDirMB, "cache-dir-mb", 0, "evict the least recently used pages from -cache-dir once they take up more than this many megabytes")
+	fs.Int64Var(&f.cacheMB, "cache-mb", 0, "keep up to this many megabytes of rendered pages in memory, and reuse them for files compared again")
+	fs.BoolVar(&f.verbose, "verbose", false, "log each step of the comparison to stderr")
+	fs.BoolVar(&f.quiet, "quiet", false, "log only errors to stderr, leaving out warnings")
+	fs.BoolVar(&f.debug, "debug", false, "the same as -verbose")
+	fs.StringVar(&f.summaryTo, "summary", "", "write a json summary of the outcome to this file, or to a file descriptor given as fd:3")
+	fs.StringVar(&f.porcelain, "porcelain", "", "print only the outcome to stdout, as text (same or different) or json, and everything else to stderr")
+	fs.BoolVar(&f.legacyExitCodes, "legacy-exit-codes", false, "exit with 2 for every error, as before there were codes for each kind of failure")
+	if name != "batch" {
+		fs.StringVar(&f.resumeDir, "resume-dir", "", "record progress in this directory, and carry on from it if an earlier run was interrupted")
+		fs.StringVar(&f.auditLog, "audit-log", "", "append a tamper-evident record of the comparison to this log")
+		fs.StringVar(&f.operator, "operator", defaultOperator(), "who ran the comparison, for the audit log")
+		fs.StringVar(&f.review, "review", "", "decisions exported from an html report: leave accepted regions out, and fail on rejected ones")
+		fs.BoolVar(&f.progress, "progress", false, "show a progress bar on stderr, with the pages found to differ so far")
+		fs.BoolVar(&f.parts, "parts", false, "treat file1 and file2 each as a list of files, separated by "+string(filepath.ListSeparator)+", whose pages make up one document in order")
+	}
+	if name != "report" {
+		fs.StringVar(&f.manifest, "manifest", "", "compare the pairs of files listed in this csv or json manifest instead of two files")
+		fs.Var(&f.profiles, "profile", "when comparing directories, use a preset for matching files, as pattern=preset; may be repeated")
+	}
+	if name == "compare" {
+		fs.BoolVar(&f.verifyRedaction, "verify-redaction", false, "check that file2 is a properly redacted version of file1")
+		fs.BoolVar(&f.accessibility, "accessibility", false, "compare tagging, language, reading order and alternative text instead of appearance")
+		fs.StringVar(&f.verifyAuditLog, "verify-audit-log", "", "check that this audit log has not been altered, instead of comparing")
+		fs.StringVar(&f.fingerprint, "fingerprint", "", "instead of comparing, print a fingerprint of each page, using sha256, phash or content")
+		fs.BoolVar(&f.compareContent, "compare-content", false, "instead of rendering, compare the normalised drawing commands of each page")
+		fs.BoolVar(&f.compareText, "compare-text", false, "compare the words on each page; with -compare-visual and -compare-structure, chooses which comparisons run")
+		fs.BoolVar(&f.compareVisual, "compare-visual", false, "compare how the pages look; with -compare-text and -compare-structure, chooses which comparisons run")
+		fs.BoolVar(&f.compareStructure, "compare-structure", false, "compare the structure trees; with -compare-text and -compare-visual, chooses which comparisons run")
+	}
+	return f
+}
+
+// Parse the arguments of a command, and then apply any config file to the
+// flags not given on the command line
+func (f *compareFlags) parse(args []string) error {
+	f.fs.Parse(args)
+	given := map[string]bool{}
+	f.fs.Visit(func(fl *flag.Flag) { given[fl.Name] = true })
+	if err := applyConfig(f.fs, f.configFile, given); err != nil {
+		return err
+	}
+	f.set = map[string]bool{}
+	f.fs.Visit(func(fl *flag.Flag) { f.set[fl.Name] = true })
+	if f.pdfOut != "" {
+		f.pdf = true
+	}
+	setupLogging(f.verbose || f.debug, f.quiet)
+	legacyExitCodes = f.legacyExitCodes
+	return f.setupPorcelain()
+}
+
+// Check for the renderer before a comparison that renders pages, printing
+// how to install it if it is missing.  Returns the exit code if it is.
+func (f *compareFlags) checkRenderer() (int, bool) {
+	if err := checkRenderer(f.rendererPath); err != nil {
+		f.summary.Error = err.Error()
+		fmt.Fprintf(os.Stderr, "%s\n", err.Error())
+		return exitCodeOf(err), false
+	}
+	return 0, true
+}
+
+// With -porcelain, keep stdout for the outcome and send whatever else would
+// be printed there to stderr, so that scripts can read stdout as it is
+func (f *compareFlags) setupPorcelain() error {
+	f.stdout, f.out = os.Stdout, os.Stdout
+	switch f.porcelain {
+	case "":
+		return nil
+	case porcelainText, porcelainJSON:
+	default:
+		return fmt.Errorf("invalid -porcelain %q: must be text or json", f.porcelain)
+	}
+	for _, other := range []struct {
+		given bool
+		flag  string
+	}{
+		{f.pdfOut == "-", "-pdf-out=-"},
+		{f.fingerprint != "", "-fingerprint"},
+		{f.verifyAuditLog != "", "-verify-audit-log"},
+		{f.verifyRedaction, "-verify-redaction"},
+	} {
+		if other.given {
+			return fmt.Errorf("-porcelain cannot be used with %s", other.flag)
+		}
+	}
+	f.out = os.Stderr
+	return nil
+}
+
+// The config the flags describe.  Settings a preset also makes are left out
+// unless given, so that the preset's apply; in a batch the preset is left to
+// the profiles instead.  Writing the difference pdf to stdout is left to the
+// caller.
+func (f *compareFlags) config(batch bool) pdfcomp.Config {
+	cfg := pdfcomp.Config{
+		SingleProcess: f.singleProcess, ColorMode: f.colorMode, RenderFormat: f.renderFormat, RendererArg: f.rendererArgs, RenderToDisk: f.renderToDisk, Layer: f.layerVisibility,
+		RenderCPUSeconds: f.renderCPUSeconds, RenderMemoryMB: f.renderMemoryMB, RenderOutputMB: f.renderOutputMB, RenderTimeout: f.renderTimeout.String(), MemoryMB: f.memoryMB,
+		Tolerance: f.tolerance, DeltaE: f.deltaE, MaxDiffPercent: f.maxDiffPercent, Rescale: f.rescale, CompareRotation: f.compareRotation, MatchSize: f.matchSize, CropToContent: f.cropToContent, Fit: f.fit, Align: f.align, ContentShortcut: f.contentShortcut, ContentPrecision: &f.contentPrecision, Prescreen: f.prescreen,
+		Sample: f.sample, SampleMethod: f.sampleMethod, Seed: f.seed, StopAfter: f.stopAfter, MaxPages: f.maxPages,
+		Signatures: f.signatures, Fonts: f.fonts, Classify: f.classify, Layers: f.layers, PageLabels: f.pageLabels, Links: f.links, Portfolios: f.portfolios,
+		MaskSignatures: f.maskSignatures, Review: f.review,
+		DiffStyle: f.diffStyle, HighlightColor: f.highlightColor, HighlightOpacity: &f.highlightOpacity, HighlightStyle: f.highlightStyle, HighlightGraded: f.highlightGraded,
+		Grid: f.grid, GridUnit: f.gridUnit, DetailZoom: f.detailZoom, DetailMargin: &f.detailMargin, JoinDirection: f.joinDirection, JoinAlign: f.joinAlign, JoinBackground: f.joinBackground,
+		Images: f.images, Blink: f.blink, AnnotateCopies: f.annotateCopies, PDF: f.pdf, Layout: f.layout, HTML: f.html, OutDir: f.outDir, NameTemplate: f.nameTemplate, MaxArtifactBytes: f.maxArtifactBytes,
+		AuditLog: f.auditLog, Operator: f.operator,
+		CacheDir: f.cacheDir, CacheDirMB: f.cacheDirMB, CacheMB: f.cacheMB, ResumeDir: f.resumeDir,
+	}
+	if !batch {
+		cfg.Preset = f.preset
+	}
+	if f.pdfOut == "-" {
+		cfg.PDF = false
+	} else {
+		cfg.PDFOut = f.pdfOut
+	}
+	if f.set["resolution"] {
+		cfg.Resolution = f.resolution
+	}
+	if f.set["ratio"] {
+		cfg.Ratio = f.ratio
+	}
+	if f.set["annotations"] {
+		cfg.Annotations = &f.annotations
+	}
+	if f.set["fail-fast"] {
+		cfg.FailFast = &f.failFast
+	}
+	for _, r := range f.ignore {
+		cfg.Ignore = append(cfg.Ignore, r.String())
+	}
+	return cfg
+}
+
+// The comparer the flags ask for, and for batches, the profiles.  A preset
+// applies to every file, or in a batch, to those no profile matches.
+func (f *compareFlags) comparer(batch bool) (*pdfcomp.Comparer, []pdfcomp.Profile, error) {
+	c, err := pdfcomp.FromConfig(f.config(batch))
+	if err != nil {
+		return nil, nil, err
+	}
+	profiles := f.profiles
+	if batch && f.preset != "" {
+		preset, err := pdfcomp.LookupPreset(f.preset)
+		if err != nil {
+			return nil, nil, err
+		}
+		// Profiles come first, so the preset is the fallback for files no
+		// profile matches
+		profiles = append(profiles, pdfcomp.Profile{Preset: preset})
+	}
+	return c, profiles, nil
+}
+
+// True if the arguments name two directories or glob patterns, or there are
+// none and a manifest names the pairs
+func (f *compareFlags) isBatch() bool {
+	if f.manifest != "" {
+		return true
+	}
+	if f.fs.NArg() != 2 {
+		return false
+	}
+	file1, file2 := f.fs.Arg(0), f.fs.Arg(1)
+	return pdfcomp.IsGlob(file1) || pdfcomp.IsGlob(file2) || (isDir(file1) && isDir(file2))
+}
+
+// Compare two files, or with directories, patterns or a manifest, run a
+// batch.  Also runs the comparisons that are not of appearance.  Returns the
+// exit code.
+func compareCommand(args []string) (code int) {
+	f := newCompareFlags("compare")
+	if err := f.parse(args); err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", err.Error())
+		return exitCodeOf(err)
+	}
+	defer func() { code = f.finish(code) }()
+	if f.verifyAuditLog != "" {
+		n, err := pdfcomp.VerifyAuditLog(f.verifyAuditLog)
+		if errors.Is(err, pdfcomp.ErrAuditLogAltered) {
+			fmt.Fprintf(os.Stderr, "%s\n", err.Error())
+			return 1
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s\n", err.Error())
+			return exitCodeOf(err)
+		}
+		fmt.Fprintf(f.out, "%s: %d entries, chain intact\n", f.verifyAuditLog, n)
+		return 0
+	}
+	if f.isBatch() {
+		return runBatch(f)
+	}
+	if f.fs.NArg() != 2 {
+		fmt.Fprintf(os.Stderr, "Wrong number of files give, need 2, received %d\n", f.fs.NArg())
+		printCommandUse(f.fs.Name())
+		return 2
+	}
+	file1, file2 := f.fs.Arg(0), f.fs.Arg(1)
+	if f.verifyRedaction {
+		if code, ok := f.checkRenderer(); !ok {
+			return code
+		}
+		return verifyRedaction(file1, file2, f.resolution, f.ratio)
+	}
+	if f.accessibility {
+		return compareAccessibility(f.out, file1, file2)
+	}
+	if f.compareContent {
+		return compareContent(f.out, file1, file2, f.contentPrecision)
+	}
+	if f.fingerprint != "" {
+		if code, ok := f.checkRenderer(); !ok {
+			return code
+		}
+		return compareFingerprints(file1, file2, f.fingerprint, f.resolution)
+	}
+	// Comparisons chosen explicitly, each reported separately
+	if (f.compareText || f.compareStructure) && !f.compareVisual {
+		return compareDimensions(f.out, file1, file2, nil, f.compareText, f.compareStructure)
+	}
+	return runCompare(f, file1, file2)
+}
+
+// Compare two files and write the difference pdf and html report, both
+// unless one is asked for, and return the exit code
+func reportCommand(args []string) (code int) {
+	f := newCompareFlags("report")
+	if err := f.parse(args); err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", err.Error())
+		return exitCodeOf(err)
+	}
+	defer func() { code = f.finish(code) }()
+	if f.fs.NArg() != 2 {
+		fmt.Fprintf(os.Stderr, "Wrong number of files give, need 2, received %d\n", f.fs.NArg())
+		printCommandUse(f.fs.Name())
+		return 2
+	}
+	if !f.pdf && !f.html && !f.images {
+		f.pdf, f.html = true, true
+	}
+	return runCompare(f, f.fs.Arg(0), f.fs.Arg(1))
+}
+
+// Compare two directory trees, the files matching two patterns or the pairs
+// in a manifest, and return the exit code
+func batchCommand(args []string) (code int) {
+	f := newCompareFlags("batch")
+	if err := f.parse(args); err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", err.Error())
+		return exitCodeOf(err)
+	}
+	defer func() { code = f.finish(code) }()
+	if !f.isBatch() {
+		fmt.Fprintf(os.Stderr, "batch needs two directories, two patterns or a -manifest\n")
+		printCommandUse(f.fs.Name())
+		return 2
+	}
+	return runBatch(f)
+}
+
+// Run a batch comparison for compare or batch, and return the exit code
+func runBatch(f *compareFlags) int {
+	if f.manifest != "" && f.fs.NArg() != 0 {
+		fmt.Fprintf(os.Stderr, "No files are given with -manifest, received %d\n", f.fs.NArg())
+		printCommandUse(f.fs.Name())
+		return 2
+	}
+	if f.pdf || f.html {
+		fmt.Fprintf(os.Stderr, "-pdf and -html are not supported when comparing directories, manifests or patterns\n")
+		return 2
+	}
+	if code, ok := f.checkRenderer(); !ok {
+		return code
+	}
+	c, profiles, err := f.comparer(true)
+	if err != nil {
+		f.summary.Error = err.Error()
+		fmt.Fprintf(os.Stderr, "%s\n", err.Error())
+		printCommandUse(f.fs.Name())
+		return exitCodeOf(err)
+	}
+	ctx, stop := interruptContext()
+	defer stop()
+	return compareDirs(f.out, f.fs.Arg(0), f.fs.Arg(1), f.manifest, profiles, append(c.Options(), pdfcomp.WithContext(ctx)), &f.summary)
+}
+
+// A context done once the program is interrupted or asked to terminate, so
+// that a comparison stops its renderers and removes its temporary files
+// before the program exits.  A second interrupt exits at once.
+func interruptContext() (context.Context, context.CancelFunc) {
+	return signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+}
+
+// Compare two files for compare or report, printing what differs beyond the
+// pages themselves, and return the exit code
+func runCompare(f *compareFlags, file1, file2 string) int {
+	if code, ok := f.checkRenderer(); !ok {
+		return code
 	}
-	file1 := fileArgs[0]
-	file2 := fileArgs[1]
-	if pdfcomp.GlobDebug {
-		fmt.Printf("arguments received were images=%t, pdf=%t, radius=%d, resolution=%d, file1=%s, file2=%s\n", images, pdf, ratio, resolution, file1, file2)
+	c, _, err := f.comparer(false)
+	if err != nil {
+		f.summary.Error = err.Error()
+		fmt.Fprintf(os.Stderr, "%s\n", err.Error())
+		printCommandUse(f.fs.Name())
+		return exitCodeOf(err)
+	}
+	slog.Debug("comparing", "file1", file1, "file2", file2, "images", f.images, "pdf", f.pdf, "resolution", f.resolution, "ratio", f.ratio)
+
+	var opts []pdfcomp.Option
+	if f.pdfOut == "-" {
+		// Nothing else may be written to stdout in this mode
+		opts = append(opts, pdfcomp.WithPDF(os.Stdout))
+	}
+	ctx, stop := interruptContext()
+	defer stop()
+	opts = append(opts, pdfcomp.WithContext(ctx))
+	var bar *progressBar
+	if f.progress {
+		bar = &progressBar{w: os.Stderr}
+		opts = append(opts, pdfcomp.WithProgress(bar.update))
+	}
+	var res *pdfcomp.Result
+	if f.parts {
+		res, err = c.CompareParts(filepath.SplitList(file1), filepath.SplitList(file2), opts...)
+	} else {
+		res, err = c.Compare(file1, file2, opts...)
+	}
+	if bar != nil {
+		bar.finish()
+	}
+	f.summary.record(file1, file2, res, err)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s", err.Error())
+		return exitCodeOf(err)
+	}
+	out := f.out
+	if f.pdfOut == "-" {
+		out = os.Stderr
+	}
+	for _, s := range res.SignaturesRemoved {
+		fmt.Fprintf(out, "signature: - %s\n", s)
+	}
+	for _, s := range res.SignaturesAdded {
+		fmt.Fprintf(out, "signature: + %s\n", s)
+	}
+	for _, l := range res.LayersRemoved {
+		fmt.Fprintf(out, "layer: - %s\n", l)
+	}
+	for _, l := range res.LayersAdded {
+		fmt.Fprintf(out, "layer: + %s\n", l)
 	}
+	for _, l := range res.LabelsRemoved {
+		fmt.Fprintf(out, "page labels: - %s\n", l)
+	}
+	for _, l := range res.LabelsAdded {
+		fmt.Fprintf(out, "page labels: + %s\n", l)
+	}
+	for _, p := range res.Pages {
+		for _, a := range p.AnnotationsRemoved {
+			fmt.Fprintf(out, "page %d: - %s\n", p.Page, a)
+		}
+		for _, a := range p.AnnotationsAdded {
+			fmt.Fprintf(out, "page %d: + %s\n", p.Page, a)
+		}
+		for _, l := range p.LinksRemoved {
+			fmt.Fprintf(out, "page %d: - %s\n", p.Page, l)
+		}
+		for _, l := range p.LinksAdded {
+			fmt.Fprintf(out, "page %d: + %s\n", p.Page, l)
+		}
+	}
+	for _, d := range res.Rejected {
+		fmt.Fprintf(out, "rejected in review: %s\n", d)
+	}
+	for _, w := range res.SizeWarnings() {
+		fmt.Fprintln(out, w)
+	}
+	for _, p := range res.Pages {
+		if f.parts && !p.Equal {
+			part1, page1 := res.PartPage(1, p.Page)
+			part2, page2 := res.PartPage(2, p.Page)
+			if part1 != "" && part2 != "" {
+				fmt.Fprintf(out, "page %d: page %d of %s, page %d of %s\n", p.Page, page1, part1, page2, part2)
+			}
+		}
+		if p.Error != "" {
+			fmt.Fprintf(out, "page %d: %s\n", p.Page, p.Error)
+		}
+		if p.DiffPixels > 0 {
+			within := ""
+			if p.Equal {
+				within = ", within -max-diff-percent"
+			}
+			fmt.Fprintf(out, "page %d: %d pixels differ, %.3g%% of the page%s\n", p.Page, p.DiffPixels, p.DiffPercent, within)
+		}
+		if p.Artifact != nil {
+			fmt.Fprintf(out, "page %d: difference image %s\n", p.Page, p.Artifact)
+		}
+		if p.Rotation != nil {
+			fmt.Fprintf(out, "page %d: %s\n", p.Page, p.Rotation)
+		}
+		if p.Rescale != nil {
+			fmt.Fprintf(out, "page %d: %s\n", p.Page, p.Rescale)
+		}
+		if p.Matched != nil {
+			fmt.Fprintf(out, "page %d: %s\n", p.Page, p.Matched)
+		}
+		if p.Crop != nil && !p.Equal {
+			fmt.Fprintf(out, "page %d: %s\n", p.Page, p.Crop)
+		}
+		if p.Mismatch != nil {
+			fmt.Fprintf(out, "page %d: %s\n", p.Page, p.Mismatch)
+		}
+		if p.Offset != nil {
+			fmt.Fprintf(out, "page %d: %s\n", p.Page, p.Offset)
+		}
+		if p.Cause != "" {
+			fmt.Fprintf(out, "page %d: probable cause: %s\n", p.Page, p.Cause)
+		}
+		for _, note := range p.Notes {
+			fmt.Fprintf(out, "page %d: %s\n", p.Page, note)
+		}
+		if p.PossiblyEnvironmental() {
+			fmt.Fprintf(out, "page %d: possibly environmental, %s\n", p.Page, p.Fonts)
+		}
+	}
+	if res.Sample != nil {
+		printSample(out, res.Sample)
+	}
+	if res.Estimate != nil {
+		printEstimate(out, res.Estimate)
+	}
+	if len(res.Embedded) > 0 {
+		printEmbedded(out, res.Embedded, "")
+	}
+	if f.compareVisual {
+		return compareDimensions(out, file1, file2, res, f.compareText, f.compareStructure)
+	}
+	if res.Equal {
+		return 0
+	}
+	if !legacyExitCodes && res.PageCountErr() != nil {
+		return exitPageCount
+	}
+	return 1
+}
+
+// Exit codes for each kind of failure, so that scripts can tell them apart.
+// None is a multiple of 4, so as not to clash with the sums of 4, 8 and 16
+// that -compare-visual and the others exit with.
+const (
+	// Anything else that went wrong, and every error with -legacy-exit-codes
+	exitError = 2
+	// pdftoppm could not be found
+	exitRendererNotFound = 3
+	// A file is damaged or not a pdf
+	exitInvalidPDF = 5
+	// A file needs a password to be opened
+	exitEncrypted = 6
+	// The files differ, and have different numbers of pages
+	exitPageCount = 7
+	// A file could not be read or written
+	exitIO = 9
+)
+
+// Whether every error exits with 2, as it did before there were codes for
+// each kind of failure.  Set by -legacy-exit-codes, which every command
+// takes, and looked for in the arguments before they are parsed.
+var legacyExitCodes bool
+
+// The exit code for an error, by what kind of failure it is, or 2 for all of
+// them with -legacy-exit-codes
+func exitCodeOf(err error) int {
+	if legacyExitCodes {
+		return exitError
+	}
+	return errorExitCode(err)
+}
+
+// The exit code for a kind of failure
+func errorExitCode(err error) int {
+	var pathErr *fs.PathError
+	switch {
+	case errors.Is(err, pdfcomp.ErrRendererNotFound):
+		return exitRendererNotFound
+	case errors.Is(err, pdfcomp.ErrEncrypted):
+		return exitEncrypted
+	case errors.Is(err, pdfcomp.ErrInvalidPDF):
+		return exitInvalidPDF
+	case errors.Is(err, pdfcomp.ErrPageCountMismatch):
+		return exitPageCount
+	case errors.As(err, &pathErr):
+		return exitIO
+	}
+	return exitError
+}
 
-	var w io.Writer
-	if pdf {
-		f, err := os.OpenFile(file1+"-diff.pdf", os.O_TRUNC|os.O_CREATE|os.O_WRONLY, 0644)
+// The outcome of a command for -summary, for scripts to read instead of the
+// command's output
+type summary struct {
+	Equal    bool   `json:"equal"`
+	ExitCode int    `json:"exitCode"`
+	Error    string `json:"error,omitempty"`
+	// For two files
+	File1     string          `json:"file1,omitempty"`
+	File2     string          `json:"file2,omitempty"`
+	Pages1    int             `json:"pages1,omitempty"`
+	Pages2    int             `json:"pages2,omitempty"`
+	DiffPages []int           `json:"diffPages,omitempty"`
+	Result    *pdfcomp.Result `json:"result,omitempty"`
+	// For a batch
+	Pairs []pairSummary `json:"pairs,omitempty"`
+}
+
+// One pair of files of a batch
+type pairSummary struct {
+	Path      string `json:"path"`
+	File1     string `json:"file1"`
+	File2     string `json:"file2"`
+	Status    string `json:"status"`
+	Equal     bool   `json:"equal"`
+	DiffPages []int  `json:"diffPages,omitempty"`
+	Error     string `json:"error,omitempty"`
+}
+
+func newPairSummary(p pdfcomp.BatchPair, status string) pairSummary {
+	ps := pairSummary{Path: p.Path, File1: p.File1, File2: p.File2, Status: status}
+	if p.Err != nil {
+		ps.Error = p.Err.Error()
+	}
+	if p.Result != nil {
+		ps.Equal = p.Result.Equal && p.InDir1 && p.InDir2
+		for _, pr := range p.Result.DiffPages() {
+			ps.DiffPages = append(ps.DiffPages, pr.Page)
+		}
+	}
+	return ps
+}
+
+// Record the outcome of comparing two files
+func (s *summary) record(file1, file2 string, res *pdfcomp.Result, err error) {
+	s.File1, s.File2 = file1, file2
+	if err != nil {
+		s.Error = err.Error()
+		return
+	}
+	s.Pages1, s.Pages2, s.Result = res.Pages1, res.Pages2, res
+	s.DiffPages = []int{}
+	for _, pr := range res.DiffPages() {
+		s.DiffPages = append(s.DiffPages, pr.Page)
+	}
+}
+
+// How -porcelain prints the outcome
+const (
+	porcelainText = "text"
+	porcelainJSON = "json"
+)
+
+// Print the outcome with -porcelain, write the summary if one was asked for,
+// and return the exit code, which is 2 if the summary could not be written
+func (f *compareFlags) finish(code int) int {
+	f.summary.Equal, f.summary.ExitCode = code == 0, code
+	switch f.porcelain {
+	case porcelainText:
+		if outcome := porcelainOutcome(code); outcome != "" {
+			fmt.Fprintln(f.stdout, outcome)
+		}
+	case porcelainJSON:
+		data, err := json.Marshal(&f.summary)
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "%s", err.Error())
-			os.Exit(2)
+			fmt.Fprintf(os.Stderr, "error writing outcome: %s\n", err.Error())
+			return exitCodeOf(err)
+		}
+		fmt.Fprintf(f.stdout, "%s\n", data)
+	}
+	if f.summaryTo == "" {
+		return code
+	}
+	if err := writeSummary(f.summaryTo, &f.summary); err != nil {
+		fmt.Fprintf(os.Stderr, "error writing summary: %s\n", err.Error())
+		return exitCodeOf(err)
+	}
+	return code
+}
+
+// What -porcelain=text prints for an exit code: same, different, or nothing
+// if the files could not be compared
+func porcelainOutcome(code int) string {
+	switch {
+	case code == 0:
+		return "same"
+	case code == 1 || code == exitPageCount || code%4 == 0:
+		// Or the sums -compare-visual and the others exit with
+		return "different"
+	}
+	return ""
+}
+
+// Write a summary as json to a file, or to an open file descriptor given as
+// fd:n, such as one a wrapping script redirected with 3>summary.json
+func writeSummary(to string, s *summary) error {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+	if fd, ok := strings.CutPrefix(to, "fd:"); ok {
+		n, err := strconv.Atoi(fd)
+		if err != nil || n < 0 {
+			return fmt.Errorf("invalid file descriptor %q", fd)
+		}
+		f := os.NewFile(uintptr(n), to)
+		_, err = f.Write(data)
+		return err
+	}
+	return os.WriteFile(to, data, 0644)
+}
+
+// Width of the progress bar in characters
+const progressWidth = 30
+
+// A progress bar redrawn on one line as pages are compared
+type progressBar struct {
+	w           io.Writer
+	done, total int
+	// Pages found to differ, and the last of them
+	differ, last int
+	drawn        bool
+}
+
+func (b *progressBar) update(page, total int, equal bool) {
+	b.done, b.total = b.done+1, total
+	if !equal {
+		b.differ, b.last = b.differ+1, page
+	}
+	filled := progressWidth * b.done / max(1, b.total)
+	line := fmt.Sprintf("\r[%s%s] %d/%d pages", strings.Repeat("#", filled), strings.Repeat(".", progressWidth-filled), b.done, b.total)
+	if b.differ > 0 {
+		line += fmt.Sprintf(", %d different, last page %d", b.differ, b.last)
+	}
+	fmt.Fprint(b.w, line)
+	b.drawn = true
+}
+
+// End the line the bar is drawn on, which may not be full if comparing
+// stopped early
+func (b *progressBar) finish() {
+	if b.drawn {
+		fmt.Fprintln(b.w)
+	}
+}
+
+// Check a redacted file against its original, printing a line for each
+// redaction, and return the exit code
+func verifyRedaction(original, redacted string, resolution, ratio int) int {
+	report, err := pdfcomp.VerifyRedaction(original, redacted, pdfcomp.WithResolution(resolution), pdfcomp.WithRatio(ratio))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s", err.Error())
+		return exitCodeOf(err)
+	}
+	for _, p := range report.Pages {
+		for _, r := range p.Regions {
+			status := "ok"
+			if !r.Covered {
+				status = "NOT COVERED"
+			} else if !r.OK() {
+				status = "LEAKS"
+			}
+			fmt.Printf("page %d, %dx%d at %d,%d: %s, %.0f%% covered", p.Page, r.Width, r.Height, r.X, r.Y, status, r.Coverage*100)
+			for _, t := range r.LeakedText {
+				fmt.Printf(", text %q", t)
+			}
+			for _, img := range r.LeakedImages {
+				fmt.Printf(", image %s", img)
+			}
+			fmt.Println()
 		}
-		w = f
-		defer f.Close()
 	}
+	if report.OK {
+		return 0
+	}
+	return 1
+}
 
-	same, err := pdfcomp.EqualPDFs(file1, file2, images, w, resolution, ratio)
+// Compare the accessibility features of two files, printing each difference
+// to out, and return the exit code
+func compareAccessibility(out io.Writer, file1, file2 string) int {
+	report, err := pdfcomp.CompareAccessibility(file1, file2)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "%s", err.Error())
-		os.Exit(2)
+		return exitCodeOf(err)
 	}
-	if same {
-		os.Exit(0)
+	printAccessibility(out, file1, file2, report)
+	if report.Equal() {
+		return 0
+	}
+	return 1
+}
+
+// Print the accessibility features of both files and each difference
+func printAccessibility(out io.Writer, file1, file2 string, report *pdfcomp.AccessibilityReport) {
+	for _, d := range []struct {
+		file string
+		acc  pdfcomp.Accessibility
+	}{{file1, report.Doc1}, {file2, report.Doc2}} {
+		fmt.Fprintf(out, "%s: tagged %t, language %q, %d structure elements, %d figures without alternative text\n",
+			d.file, d.acc.Tagged, d.acc.Lang, len(d.acc.Tags), d.acc.MissingAlt)
+	}
+	for _, issue := range report.Issues {
+		fmt.Fprintln(out, issue)
 	}
-	os.Exit(1)
+	if len(report.TagChanges) > 0 {
+		fmt.Fprintln(out, "structure tree:")
+		for _, l := range report.TagChanges {
+			fmt.Fprintln(out, l)
+		}
+	}
+	if len(report.AltTextChanges) > 0 {
+		fmt.Fprintln(out, "alternative text:")
+		for _, l := range report.AltTextChanges {
+			fmt.Fprintln(out, l)
+		}
+	}
+	if len(report.ActualTextChanges) > 0 {
+		fmt.Fprintln(out, "replacement text:")
+		for _, l := range report.ActualTextChanges {
+			fmt.Fprintln(out, l)
+		}
+	}
+}
+
+// Exit code bits for each comparison that found differences, when they are
+// chosen with -compare-visual, -compare-text and -compare-structure
+const (
+	exitVisual    = 4
+	exitText      = 8
+	exitStructure = 16
+)
+
+// Report each chosen comparison separately, running the text and structure
+// comparisons and summarising the visual one if it was run, and return the
+// exit code
+func compareDimensions(out io.Writer, file1, file2 string, visual *pdfcomp.Result, text, structure bool) int {
+	code := 0
+	if visual != nil {
+		if visual.Equal {
+			fmt.Fprintln(out, "visual: same")
+		} else {
+			code |= exitVisual
+			s := "visual: different"
+			if visual.Pages1 != visual.Pages2 {
+				s += fmt.Sprintf(", %d pages against %d", visual.Pages1, visual.Pages2)
+			}
+			var pages []string
+			for _, p := range visual.DiffPages() {
+				pages = append(pages, strconv.Itoa(p.Page))
+			}
+			if len(visual.Pages) < min(visual.Pages1, visual.Pages2) && len(pages) > 0 {
+				// Comparing stops at the first difference unless images are made
+				s += ", first at page " + pages[0]
+			} else if len(pages) > 0 {
+				s += ", pages " + strings.Join(pages, ", ")
+			}
+			fmt.Fprintln(out, s)
+		}
+	}
+	if text {
+		report, err := pdfcomp.CompareText(file1, file2)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s\n", err.Error())
+			return exitCodeOf(err)
+		}
+		if report.Equal {
+			fmt.Fprintln(out, "text: same")
+		} else {
+			code |= exitText
+			if report.Pages1 != report.Pages2 {
+				fmt.Fprintf(out, "text: different, %d pages against %d\n", report.Pages1, report.Pages2)
+			} else {
+				fmt.Fprintln(out, "text: different")
+			}
+			for _, p := range report.Pages {
+				for _, c := range p.Changes {
+					fmt.Fprintf(out, "  page %d: %s\n", p.Page, c)
+				}
+			}
+		}
+	}
+	if structure {
+		report, err := pdfcomp.CompareAccessibility(file1, file2)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s\n", err.Error())
+			return exitCodeOf(err)
+		}
+		if report.Equal() {
+			fmt.Fprintln(out, "structure: same")
+		} else {
+			code |= exitStructure
+			fmt.Fprintln(out, "structure: different")
+			printAccessibility(out, file1, file2, report)
+		}
+	}
+	return code
+}
+
+// Compare the normalised content streams of two files, printing the changes
+// to each page to out, and return the exit code
+func compareContent(out io.Writer, file1, file2 string, precision int) int {
+	report, err := pdfcomp.CompareContent(file1, file2, pdfcomp.WithContentPrecision(precision))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s", err.Error())
+		return exitCodeOf(err)
+	}
+	if report.Pages1 != report.Pages2 {
+		fmt.Fprintf(out, "%s has %d pages, %s has %d\n", file1, report.Pages1, file2, report.Pages2)
+	}
+	for _, p := range report.Pages {
+		if p.Equal {
+			continue
+		}
+		fmt.Fprintf(out, "page %d:\n", p.Page)
+		if p.ResourcesChanged {
+			fmt.Fprintln(out, "  fonts, images, annotations or page size changed")
+		}
+		for _, c := range p.Changes {
+			fmt.Fprintf(out, "  %s\n", c)
+		}
+	}
+	if report.Equal {
+		return 0
+	}
+	return 1
+}
+
+// Print the fingerprint of every page of both files, marking pages whose
+// fingerprints do not match, and return the exit code
+func compareFingerprints(file1, file2, name string, resolution int) int {
+	fp, err := pdfcomp.ParseFingerprinter(name)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", err.Error())
+		return exitCodeOf(err)
+	}
+	prints1, err := pdfcomp.FingerprintPages(file1, fp, pdfcomp.WithResolution(resolution))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s", err.Error())
+		return exitCodeOf(err)
+	}
+	prints2, err := pdfcomp.FingerprintPages(file2, fp, pdfcomp.WithResolution(resolution))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s", err.Error())
+		return exitCodeOf(err)
+	}
+	code := 0
+	if len(prints1) != len(prints2) {
+		code = 1
+	}
+	for i := range max(len(prints1), len(prints2)) {
+		p1, p2 := "-", "-"
+		if i < len(prints1) {
+			p1 = prints1[i]
+		}
+		if i < len(prints2) {
+			p2 = prints2[i]
+		}
+		status := "same"
+		if i >= len(prints1) || i >= len(prints2) || !fp.Match(p1, p2) {
+			status = "different"
+			code = 1
+		}
+		fmt.Printf("page %d: %s %s %s\n", i+1, p1, p2, status)
+	}
+	return code
+}
+
+// Render pages of a file to png images, for the render subcommand, so that
+// what is compared can be seen, and return the exit code
+func renderCommand(args []string) int {
+	fs := flag.NewFlagSet("render", flag.ExitOnError)
+	fs.BoolVar(&legacyExitCodes, "legacy-exit-codes", legacyExitCodes, "exit with 2 for every error, as before there were codes for each kind of failure")
+	rP := fs.Int("resolution", 300, "dpi resolution pages are rendered at")
+	pP := fs.String("pages", "", "pages to render, as a list such as 1,3-5; all of them by default")
+	odP := fs.String("out-dir", "", "directory for the images, by default the directory of the pdf")
+	cdP := fs.String("cache-dir", "", "keep rendered pages in this directory, and reuse them")
+	cdmP := fs.Int64("cache-dir-mb", 0, "evict the least recently used pages from -cache-dir once they take up more than this many megabytes")
+	rpP := fs.String("renderer-path", "", "run the pdftoppm at this path instead of the one on the PATH")
+	var rendererArgs rendererArgFlags
+	fs.Var(&rendererArgs, "renderer-arg", "pass these arguments to the renderer, such as \"-aa no\"; may be repeated")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		printCommandUse("render")
+		return 2
+	}
+	if err := checkRenderer(*rpP); err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", err.Error())
+		return exitCodeOf(err)
+	}
+	file := fs.Arg(0)
+	count, err := pdfcomp.PageCount(file)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", err.Error())
+		return exitCodeOf(err)
+	}
+	pages, err := parsePages(*pP, count)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", err.Error())
+		return exitCodeOf(err)
+	}
+	opts := []pdfcomp.Option{pdfcomp.WithResolution(*rP), pdfcomp.WithRendererArgs(rendererArgs...)}
+	if *cdP != "" && *cdmP > 0 {
+		opts = append(opts, pdfcomp.WithCache(pdfcomp.NewBoundedDiskCache(*cdP, *cdmP<<20)))
+	} else if *cdP != "" {
+		opts = append(opts, pdfcomp.WithCache(pdfcomp.NewDiskCache(*cdP)))
+	}
+	dir := *odP
+	if dir == "" {
+		dir = filepath.Dir(file)
+	} else if err := os.MkdirAll(dir, 0755); err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", err.Error())
+		return exitCodeOf(err)
+	}
+	for _, page := range pages {
+		img, err := pdfcomp.RenderPage(file, page, opts...)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s\n", err.Error())
+			return exitCodeOf(err)
+		}
+		name := filepath.Join(dir, fmt.Sprintf("%s-%d.png", filepath.Base(file), page))
+		if err := writePNG(name, img); err != nil {
+			fmt.Fprintf(os.Stderr, "%s\n", err.Error())
+			return exitCodeOf(err)
+		}
+		fmt.Println(name)
+	}
+	return 0
+}
+
+// Page numbers from a list such as 1,3-5, or every page if it is empty
+func parsePages(list string, count int) ([]int, error) {
+	var pages []int
+	if list == "" {
+		for p := 1; p <= count; p++ {
+			pages = append(pages, p)
+		}
+		return pages, nil
+	}
+	for _, part := range strings.Split(list, ",") {
+		first, last, isRange := strings.Cut(strings.TrimSpace(part), "-")
+		lo, err := strconv.Atoi(first)
+		hi := lo
+		if err == nil && isRange {
+			hi, err = strconv.Atoi(last)
+		}
+		if err != nil || lo < 1 || hi < lo || hi > count {
+			return nil, fmt.Errorf("invalid pages %q for a file of %d pages", part, count)
+		}
+		for p := lo; p <= hi; p++ {
+			pages = append(pages, p)
+		}
+	}
+	return pages, nil
+}
+
+func writePNG(name string, img image.Image) error {
+	file, err := os.Create(name)
+	if err != nil {
+		return err
+	}
+	if err := png.Encode(file, img); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// Run an http server comparing uploaded files, for the serve subcommand, and
+// return the exit code once it fails
+func serveCommand(args []string) int {
+	fs := flag.NewFlagSet("serve", flag.ExitOnError)
+	fs.BoolVar(&legacyExitCodes, "legacy-exit-codes", legacyExitCodes, "exit with 2 for every error, as before there were codes for each kind of failure")
+	aP := fs.String("addr", ":8080", "address to listen on")
+	gaP := fs.String("grpc-addr", "", "also serve the gRPC comparison service on this address")
+	iwP := fs.Int("interactive-workers", 2, "comparisons reserved for interactive requests")
+	bwP := fs.Int("batch-workers", 1, "comparisons reserved for batch requests, which interactive requests may borrow while they are idle")
+	muP := fs.Int64("max-upload-mb", server.DefaultMaxUpload>>20, "largest request accepted, both files together, in megabytes")
+	cdP := fs.String("cache-dir", "", "keep rendered pages in this directory, and reuse them for files compared again")
+	cdmP := fs.Int64("cache-dir-mb", 0, "evict the least recently used pages from -cache-dir once they take up more than this many megabytes")
+	cmP := fs.Int64("cache-mb", 0, "keep up to this many megabytes of rendered pages in memory, shared by all requests")
+	rcP := fs.Int("render-cpu-seconds", 0, "limit the processor time the renderer may spend on each page")
+	rmP := fs.Int64("render-memory-mb", 0, "limit the memory the renderer may use, in megabytes (not on Windows)")
+	roP := fs.Int64("render-output-mb", 0, "limit the size of each rendered page, in megabytes")
+	rtP := fs.Duration("render-timeout", pdfcomp.DefaultRenderTimeout, "stop the renderer if it takes longer than this over a page; 0 for no limit")
+	mmP := fs.Int64("memory-mb", 0, "keep the memory each comparison takes up to about this many megabytes")
+	mpP := fs.Int("max-pages", 0, "refuse to compare files with more pages than this")
+	rfP := fs.String("render-format", "auto", "what the renderer writes pages as: png, ppm, or auto for png if it can")
+	rdP := fs.Bool("render-to-disk", false, "have the renderer write each page to a temporary file rather than holding it in memory")
+	rpP := fs.String("renderer-path", "", "run the pdftoppm at this path instead of the one on the PATH")
+	cfP := fs.String("config", "", "settings for every comparison, in a file of config keys, which requests may override")
+	vP := fs.Bool("verbose", false, "log each step of every comparison to stderr")
+	qP := fs.Bool("quiet", false, "log only errors to stderr, leaving out warnings")
+	fs.Parse(args)
+	setupLogging(*vP, *qP)
+	if fs.NArg() != 0 {
+		printCommandUse("serve")
+		return 2
+	}
+	if err := checkRenderer(*rpP); err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", err.Error())
+		return exitCodeOf(err)
+	}
+	var cfg pdfcomp.Config
+	if *cfP != "" {
+		var err error
+		if cfg, err = pdfcomp.LoadConfig(*cfP); err != nil {
+			fmt.Fprintf(os.Stderr, "%s\n", err.Error())
+			return exitCodeOf(err)
+		}
+	}
+	// Flags given override the config file
+	fs.Visit(func(fl *flag.Flag) {
+		switch fl.Name {
+		case "cache-dir":
+			cfg.CacheDir = *cdP
+		case "cache-dir-mb":
+			cfg.CacheDirMB = *cdmP
+		case "cache-mb":
+			cfg.CacheMB = *cmP
+		case "render-cpu-seconds":
+			cfg.RenderCPUSeconds = *rcP
+		case "render-memory-mb":
+			cfg.RenderMemoryMB = *rmP
+		case "render-output-mb":
+			cfg.RenderOutputMB = *roP
+		case "render-timeout":
+			cfg.RenderTimeout = rtP.String()
+		case "memory-mb":
+			cfg.MemoryMB = *mmP
+		case "max-pages":
+			cfg.MaxPages = *mpP
+		case "render-format":
+			cfg.RenderFormat = *rfP
+		case "render-to-disk":
+			cfg.RenderToDisk = *rdP
+		}
+	})
+	if _, err := pdfcomp.FromConfig(cfg); err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", err.Error())
+		return exitCodeOf(err)
+	}
+	queue, err := server.NewQueue(map[server.Priority]int{server.Interactive: *iwP, server.Batch: *bwP})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", err.Error())
+		return exitCodeOf(err)
+	}
+	srv := server.NewServer(queue, cfg)
+	srv.MaxUpload = *muP << 20
+	if *gaP != "" {
+		lis, err := net.Listen("tcp", *gaP)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s\n", err.Error())
+			return exitCodeOf(err)
+		}
+		// Files come whole in the request, as large as an upload may be
+		gs := grpc.NewServer(grpc.MaxRecvMsgSize(int(srv.MaxUpload) + 1<<20))
+		server.NewGRPCServer(queue, cfg).Register(gs)
+		fmt.Fprintf(os.Stderr, "serving gRPC on %s\n", *gaP)
+		go func() {
+			err := gs.Serve(lis)
+			fmt.Fprintf(os.Stderr, "%s\n", err.Error())
+			os.Exit(exitCodeOf(err))
+		}()
+	}
+	fmt.Fprintf(os.Stderr, "listening on %s\n", *aP)
+	err = http.ListenAndServe(*aP, srv)
+	fmt.Fprintf(os.Stderr, "%s\n", err.Error())
+	return exitCodeOf(err)
+}
+
+// Record a baseline of how a file looks, for the approve subcommand, and
+// return the exit code
+func approve(args []string) int {
+	fs := flag.NewFlagSet("approve", flag.ExitOnError)
+	fs.BoolVar(&legacyExitCodes, "legacy-exit-codes", legacyExitCodes, "exit with 2 for every error, as before there were codes for each kind of failure")
+	bP := fs.String("baseline", "", "file to write the baseline to, by default the pdf's name with .baseline.json")
+	rpP := fs.String("renderer-path", "", "run the pdftoppm at this path instead of the one on the PATH")
+	fpP := fs.String("fingerprint", "sha256", "how pages are fingerprinted: sha256, phash or content")
+	rP := fs.Int("resolution", 300, "dpi resolution pages are rendered at")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		printCommandUse("approve")
+		return 2
+	}
+	if err := checkRenderer(*rpP); err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", err.Error())
+		return exitCodeOf(err)
+	}
+	file := fs.Arg(0)
+	fp, err := pdfcomp.ParseFingerprinter(*fpP)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", err.Error())
+		return exitCodeOf(err)
+	}
+	b, err := pdfcomp.NewBaseline(file, fp, pdfcomp.WithResolution(*rP))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", err.Error())
+		return exitCodeOf(err)
+	}
+	name := *bP
+	if name == "" {
+		name = pdfcomp.BaselineName(file)
+	}
+	if err := pdfcomp.WriteBaseline(name, b); err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", err.Error())
+		return exitCodeOf(err)
+	}
+	fmt.Printf("%s: %d pages approved in %s\n", file, len(b.Pages), name)
+	return 0
+}
+
+// Check a file against its baseline, for the verify subcommand, printing
+// each difference, and return the exit code.  With -update the baseline is
+// replaced so that the differences are accepted.
+func verify(args []string) int {
+	fs := flag.NewFlagSet("verify", flag.ExitOnError)
+	fs.BoolVar(&legacyExitCodes, "legacy-exit-codes", legacyExitCodes, "exit with 2 for every error, as before there were codes for each kind of failure")
+	bP := fs.String("baseline", "", "baseline to check against, by default the pdf's name with .baseline.json")
+	rpP := fs.String("renderer-path", "", "run the pdftoppm at this path instead of the one on the PATH")
+	uP := fs.Bool("update", false, "accept any differences by replacing the baseline")
+	rvP := fs.String("review", "", "decisions exported from the html report comparing the approved file with this one; accept the differences if every differing page was accepted")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		printCommandUse("verify")
+		return 2
+	}
+	if err := checkRenderer(*rpP); err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", err.Error())
+		return exitCodeOf(err)
+	}
+	file := fs.Arg(0)
+	name := *bP
+	if name == "" {
+		name = pdfcomp.BaselineName(file)
+	}
+	b, err := pdfcomp.ReadBaseline(name)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", err.Error())
+		return exitCodeOf(err)
+	}
+	report, err := pdfcomp.VerifyBaseline(file, b)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", err.Error())
+		return exitCodeOf(err)
+	}
+	for _, c := range report.Changes {
+		fmt.Println(c)
+	}
+	for _, p := range report.DiffPages {
+		fmt.Printf("page %d: different\n", p)
+	}
+	if report.Equal {
+		fmt.Printf("%s: matches %s\n", file, name)
+		return 0
+	}
+	update := *uP
+	if *rvP != "" {
+		ok, err := reviewAccepts(*rvP, file, report)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s\n", err.Error())
+			return exitCodeOf(err)
+		}
+		update = update || ok
+	}
+	if update {
+		if err := pdfcomp.WriteBaseline(name, report.Current); err != nil {
+			fmt.Fprintf(os.Stderr, "%s\n", err.Error())
+			return exitCodeOf(err)
+		}
+		fmt.Printf("%s: changes accepted, %s updated\n", file, name)
+		return 0
+	}
+	return 1
+}
+
+// True if a review of file, as the second file of a comparison, accepts all
+// the pages that differ from the baseline, rejects nothing, and there are no
+// other changes.  Rejections
+// and pages left undecided are printed.
+func reviewAccepts(reviewFile, file string, report *pdfcomp.BaselineReport) (bool, error) {
+	review, err := pdfcomp.ReadReview(reviewFile)
+	if err != nil {
+		return false, err
+	}
+	sum, err := pdfcomp.Checksum(file)
+	if err != nil {
+		return false, err
+	}
+	if sum != review.Checksum2 {
+		fmt.Printf("%s: %s is a review of another version\n", file, reviewFile)
+		return false, nil
+	}
+	// Changes to sizes, labels and page counts are not reviewed in reports
+	ok := len(report.Changes) == 0
+	for _, d := range review.Decided(pdfcomp.ReviewRejected) {
+		fmt.Printf("rejected in review: %s\n", d)
+		ok = false
+	}
+	for _, p := range report.DiffPages {
+		if !review.AcceptsPage(p) {
+			fmt.Printf("page %d: not accepted in review\n", p)
+			ok = false
+		}
+	}
+	return ok, nil
+}
+
+// Compare every pdf in two directory trees, the files matching two glob
+// patterns, or the pairs listed in a manifest, printing a line for each file
+// to out, and return the exit code
+func compareDirs(out io.Writer, dir1, dir2, manifest string, profiles []pdfcomp.Profile, opts []pdfcomp.Option, sum *summary) int {
+	var res *pdfcomp.BatchResult
+	var err error
+	switch {
+	case manifest != "":
+		res, err = pdfcomp.CompareManifest(manifest, profiles, opts...)
+	case pdfcomp.IsGlob(dir1) || pdfcomp.IsGlob(dir2):
+		res, err = pdfcomp.CompareGlobs(dir1, dir2, profiles, opts...)
+	default:
+		res, err = pdfcomp.CompareDirs(dir1, dir2, profiles, opts...)
+	}
+	if err != nil {
+		sum.Error = err.Error()
+		fmt.Fprintf(os.Stderr, "%s", err.Error())
+		return exitCodeOf(err)
+	}
+	code := 0
+	sum.Pairs = []pairSummary{}
+	for _, p := range res.Pairs {
+		status := "same"
+		switch {
+		case manifest != "" && (!p.InDir1 || !p.InDir2):
+			missing := p.File1
+			if p.InDir1 {
+				missing = p.File2
+			}
+			status = missing + " not found"
+		case !p.InDir2:
+			status = "only in " + dir1
+		case !p.InDir1:
+			status = "only in " + dir2
+		case p.Err != nil:
+			status = "error: " + p.Err.Error()
+			if code == 0 {
+				code = exitCodeOf(p.Err)
+			}
+		case !p.Result.Equal:
+			status = "different"
+		}
+		if p.Preset != "" {
+			status += " (" + p.Preset + ")"
+		}
+		name := p.Path
+		if manifest != "" {
+			// The files of a pair may have nothing in common
+			name = p.File1 + " " + p.File2
+		}
+		fmt.Fprintf(out, "%s: %s\n", name, status)
+		sum.Pairs = append(sum.Pairs, newPairSummary(p, status))
+	}
+	if code == 0 && !res.Equal() {
+		code = 1
+	}
+	return code
+}
+
+// Collects repeated -profile flags
+type profileFlags []pdfcomp.Profile
+
+func (f *profileFlags) String() string {
+	var s []string
+	for _, p := range *f {
+		s = append(s, p.Pattern+"="+p.Preset.Name)
+	}
+	return strings.Join(s, ",")
+}
+
+func (f *profileFlags) Set(v string) error {
+	p, err := pdfcomp.ParseProfile(v)
+	if err != nil {
+		return err
+	}
+	*f = append(*f, p)
+	return nil
+}
+
+// Collects repeated -renderer-arg flags, each of which may hold several
+// arguments separated by spaces
+type rendererArgFlags []string
+
+func (f *rendererArgFlags) String() string {
+	return strings.Join(*f, " ")
+}
+
+func (f *rendererArgFlags) Set(v string) error {
+	*f = append(*f, strings.Fields(v)...)
+	return nil
+}
+
+// Collects repeated -ignore flags
+type ignoreFlags []pdfcomp.IgnoreRegion
+
+func (f *ignoreFlags) String() string {
+	var s []string
+	for _, r := range *f {
+		s = append(s, r.String())
+	}
+	return strings.Join(s, " ")
+}
+
+func (f *ignoreFlags) Set(v string) error {
+	r, err := pdfcomp.ParseIgnoreRegion(v)
+	if err != nil {
+		return err
+	}
+	*f = append(*f, r)
+	return nil
+}
+
+// Names of the config file looked for in the current directory and then in
+// each of its parents, so that one at the top of a repository applies
+// throughout it
+var configNames = []string{".pdfcomp.yaml", ".pdfcomp.yml"}
+
+// Set the flags not given on the command line from a config file, if there
+// is one.  Keys are flag names, and values are what would follow the flag.
+// Flags that may be repeated take a list, or for -layer and -profile, a map,
+// as in
+//
+//	resolution: 150
+//	out-dir: build/diffs
+//	ignore: ["1:400,20,150,30"]
+//	layer: {Watermark: off}
+func applyConfig(fs *flag.FlagSet, name string, given map[string]bool) error {
+	if name == "" {
+		if name = findConfig(); name == "" {
+			return nil
+		}
+	}
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return err
+	}
+	var settings map[string]interface{}
+	if err := yaml.Unmarshal(data, &settings); err != nil {
+		return fmt.Errorf("error reading %s: %w", name, err)
+	}
+	keys := make([]string, 0, len(settings))
+	for k := range settings {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	// The file may hold settings for flags that only some commands have
+	all := newCompareFlags("compare").fs
+	for _, key := range keys {
+		if key == "config" || all.Lookup(key) == nil {
+			return fmt.Errorf("%s: unknown setting %q", name, key)
+		}
+		if given[key] || fs.Lookup(key) == nil {
+			continue
+		}
+		var values []string
+		switch v := settings[key].(type) {
+		case []interface{}:
+			for _, item := range v {
+				values = append(values, fmt.Sprint(item))
+			}
+		case map[interface{}]interface{}:
+			for k, item := range v {
+				// yaml reads on and off as booleans
+				if b, ok := item.(bool); ok {
+					item = map[bool]string{true: "on", false: "off"}[b]
+				}
+				values = append(values, fmt.Sprintf("%v=%v", k, item))
+			}
+			slices.Sort(values)
+		default:
+			values = []string{fmt.Sprint(v)}
+		}
+		for _, v := range values {
+			if err := fs.Set(key, v); err != nil {
+				return fmt.Errorf("%s: %s: %w", name, key, err)
+			}
+		}
+	}
+	return nil
+}
+
+// The nearest config file in the current directory or above it, or "" if
+// there is none
+func findConfig() string {
+	dir, err := os.Getwd()
+	if err != nil {
+		return ""
+	}
+	for {
+		for _, n := range configNames {
+			if name := filepath.Join(dir, n); isFile(name) {
+				return name
+			}
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return ""
+		}
+		dir = parent
+	}
+}
+
+// Collects repeated -layer flags, as whether each named layer is shown
+type layerFlags map[string]bool
+
+func (f layerFlags) String() string {
+	var s []string
+	for name, on := range f {
+		if on {
+			s = append(s, name+"=on")
+		} else {
+			s = append(s, name+"=off")
+		}
+	}
+	slices.Sort(s)
+	return strings.Join(s, ",")
+}
+
+func (f layerFlags) Set(v string) error {
+	// Layer names may contain =, the state cannot
+	i := strings.LastIndex(v, "=")
+	if i < 0 || (v[i+1:] != "on" && v[i+1:] != "off") {
+		return fmt.Errorf("invalid layer %q, expected name=on or name=off", v)
+	}
+	f[v[:i]] = v[i+1:] == "on"
+	return nil
+}
+
+func isDir(name string) bool {
+	fi, err := os.Stat(name)
+	return err == nil && fi.IsDir()
+}
+
+func isFile(name string) bool {
+	fi, err := os.Stat(name)
+	return err == nil && fi.Mode().IsRegular()
+}
+
+// Print which pages were sampled and what they suggest about the rest
+func printSample(w io.Writer, s *pdfcomp.SampleResult) {
+	pages := make([]string, len(s.Pages))
+	for i, p := range s.Pages {
+		pages[i] = strconv.Itoa(p)
+	}
+	fmt.Fprintf(w, "sampled %d of %d pages (%s, seed %d): %s\n", len(s.Pages), s.Total, s.Method, s.Seed, strings.Join(pages, ", "))
+	fmt.Fprintf(w, "%d sampled pages different, an estimated %.1f%% of all pages (%.0f%% confidence: %.1f%% to %.1f%%, about %d to %d pages)\n",
+		s.Different, s.Rate*100, s.Confidence*100, s.RateLow*100, s.RateHigh*100,
+		int(math.Floor(s.RateLow*float64(s.Total))), int(math.Ceil(s.RateHigh*float64(s.Total))))
+}
+
+// Print how many of the pages left unrendered are thought to differ
+func printEstimate(w io.Writer, e *pdfcomp.EstimateResult) {
+	pages := make([]string, len(e.Suspect))
+	for i, p := range e.Suspect {
+		pages[i] = strconv.Itoa(p)
+	}
+	fmt.Fprintf(w, "stopped with %d pages not rendered, %d of them with changed content", len(e.Pages), len(e.Suspect))
+	if len(pages) > 0 {
+		fmt.Fprintf(w, ": %s", strings.Join(pages, ", "))
+	}
+	fmt.Fprintf(w, "\nan estimated %d more pages different (%d of %d rendered pages with changed content looked different)\n",
+		e.Different, e.Confirmed, e.Calibration)
+}
+
+// Print the comparison of each embedded document, indenting nested portfolios
+func printEmbedded(w io.Writer, embedded []pdfcomp.EmbeddedResult, indent string) {
+	for _, e := range embedded {
+		status := "same"
+		switch {
+		case !e.InFile2:
+			status = "only in file 1"
+		case !e.InFile1:
+			status = "only in file 2"
+		case !e.Equal():
+			status = "different"
+		}
+		fmt.Fprintf(w, "%s%s: %s\n", indent, e.Name, status)
+		if e.Result != nil {
+			printEmbedded(w, e.Result.Embedded, indent+"  ")
+		}
+	}
+}
+
+// The login name of the current user, for recording in audit logs
+func defaultOperator() string {
+	if u, err := user.Current(); err == nil {
+		return u.Username
+	}
+	return os.Getenv("USER")
+}
+
+// The arguments each subcommand takes
+var commandUsage = map[string]string{
+	"compare": "compare [options] file1.pdf file2.pdf",
+	"report":  "report [options] file1.pdf file2.pdf",
+	"batch":   "batch [options] dir1 dir2 | pattern1 pattern2 | -manifest=file",
+	"render":  "render [-resolution=n -pages=list -out-dir=dir] file.pdf",
+	"serve":   "serve [-addr=host:port -grpc-addr=host:port -interactive-workers=n -batch-workers=n] [options]",
+	"approve": "approve [-baseline=file -fingerprint=name -resolution=n] file.pdf",
+	"verify":  "verify [-baseline=file -update] file.pdf",
+}
+
+// The order subcommands are listed in
+var commandOrder = []string{"compare", "report", "batch", "render", "serve", "approve", "verify"}
+
+// Print the arguments a subcommand takes, after an error in them
+func printCommandUse(name string) {
+	fmt.Fprintf(os.Stderr, "usage: pdf-comp %s\n", commandUsage[name])
 }
 
 func printUse() {
-	fmt.Fprintf(os.Stderr, "usage: pdf-comp [-images -overwrite -radius=n -resolution=n] file1.pdf file2.pdf")
+	for i, name := range commandOrder {
+		prefix := "usage:"
+		if i > 0 {
+			prefix = "      "
+		}
+		fmt.Fprintf(os.Stderr, "%s pdf-comp %s\n", prefix, commandUsage[name])
+	}
+	fmt.Fprintf(os.Stderr, "Without a subcommand, pdf-comp compares.  Use pdf-comp <subcommand> -h for its options.\n")
 }
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/mdmcconnell/pdfcomp/pdfcomp"
+)
+
+func TestErrorExitCode(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want int
+	}{
+		{"renderer not found", pdfcomp.ErrRendererNotFound, exitRendererNotFound},
+		{"wrapped renderer not found", fmt.Errorf("rendering a.pdf: %w", pdfcomp.ErrRendererNotFound), exitRendererNotFound},
+		{"encrypted", fmt.Errorf("a.pdf: %w", pdfcomp.ErrEncrypted), exitEncrypted},
+		{"invalid pdf", fmt.Errorf("a.pdf: %w", pdfcomp.ErrInvalidPDF), exitInvalidPDF},
+		{"page count mismatch", fmt.Errorf("3 vs 4: %w", pdfcomp.ErrPageCountMismatch), exitPageCount},
+		{"missing file", &fs.PathError{Op: "open", Path: "a.pdf", Err: fs.ErrNotExist}, exitIO},
+		{"wrapped path error", fmt.Errorf("reading: %w", &fs.PathError{Op: "read", Path: "a.pdf", Err: os.ErrPermission}), exitIO},
+		{"other", errors.New("something else"), exitError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := errorExitCode(tt.err); got != tt.want {
+				t.Errorf("errorExitCode(%v) = %d, want %d", tt.err, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPorcelainJSON(t *testing.T) {
+	tests := []struct {
+		name    string
+		code    int
+		summary summary
+	}{
+		{"same", 0, summary{File1: "a.pdf", File2: "b.pdf", Pages1: 3, Pages2: 3}},
+		{"different", 1, summary{File1: "a.pdf", File2: "b.pdf", Pages1: 3, Pages2: 3, DiffPages: []int{2, 3}}},
+		{"error", exitInvalidPDF, summary{File1: "a.pdf", File2: "b.pdf", Error: "a.pdf: invalid pdf"}},
+		{"batch", 1, summary{Pairs: []pairSummary{
+			{Path: "x.pdf", File1: "p1/x.pdf", File2: "p2/x.pdf", Status: "same", Equal: true},
+			{Path: "y.pdf", File1: "p1/y.pdf", File2: "p2/y.pdf", Status: "different", DiffPages: []int{1}},
+		}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			f := &compareFlags{porcelain: porcelainJSON, summary: tt.summary, stdout: &buf}
+			if got := f.finish(tt.code); got != tt.code {
+				t.Fatalf("finish(%d) = %d", tt.code, got)
+			}
+			var got summary
+			if err := json.Unmarshal(buf.Bytes(), &got); err != nil {
+				t.Fatalf("output %q is not json: %v", buf.String(), err)
+			}
+			want := tt.summary
+			want.Equal, want.ExitCode = tt.code == 0, tt.code
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("read back %+v, want %+v", got, want)
+			}
+		})
+	}
+}
+
+func TestPorcelainText(t *testing.T) {
+	tests := []struct {
+		code int
+		want string
+	}{
+		{0, "same\n"},
+		{1, "different\n"},
+		{exitPageCount, "different\n"},
+		{exitVisual, "different\n"},
+		{exitVisual + exitText + exitStructure, "different\n"},
+		{exitError, ""},
+		{exitRendererNotFound, ""},
+		{exitInvalidPDF, ""},
+		{exitEncrypted, ""},
+		{exitIO, ""},
+	}
+	for _, tt := range tests {
+		var buf bytes.Buffer
+		f := &compareFlags{porcelain: porcelainText, stdout: &buf}
+		f.finish(tt.code)
+		if got := buf.String(); got != tt.want {
+			t.Errorf("exit code %d printed %q, want %q", tt.code, got, tt.want)
+		}
+	}
+}
+
+func TestModesWithoutRenderer(t *testing.T) {
+	// No renderer can be found on an empty PATH
+	t.Setenv("PATH", "")
+	for _, mode := range []string{"-compare-content", "-accessibility", "-compare-text", "-compare-structure"} {
+		t.Run(mode, func(t *testing.T) {
+			code := compareCommand([]string{"-quiet", mode, "assets/lorem.pdf", "assets/lorem_copy.pdf"})
+			if code != 0 && code != 1 {
+				t.Errorf("exit code %d, want 0 or 1", code)
+			}
+		})
+	}
+	if code := compareCommand([]string{"-quiet", "assets/lorem.pdf", "assets/lorem_copy.pdf"}); code != exitRendererNotFound {
+		t.Errorf("comparing pages exited with %d, want %d", code, exitRendererNotFound)
+	}
+}
@@ -2,7 +2,13 @@ module github.com/mdmcconnell/pdfcomp
 
 go 1.23.0
 
-require github.com/pdfcpu/pdfcpu v0.9.1
+require (
+	github.com/pdfcpu/pdfcpu v0.9.1
+	golang.org/x/image v0.21.0
+	google.golang.org/grpc v1.73.0
+	google.golang.org/protobuf v1.36.6
+	gopkg.in/yaml.v2 v2.4.0
+)
 
 require (
 	github.com/hhrutter/lzw v1.0.0 // indirect
@@ -10,7 +16,8 @@ require (
 	github.com/mattn/go-runewidth v0.0.16 // indirect
 	github.com/pkg/errors v0.9.1 // indirect
 	github.com/rivo/uniseg v0.4.7 // indirect
-	golang.org/x/image v0.21.0 // indirect
-	golang.org/x/text v0.19.0 // indirect
-	gopkg.in/yaml.v2 v2.4.0 // indirect
+	golang.org/x/net v0.38.0 // indirect
+	golang.org/x/sys v0.31.0 // indirect
+	golang.org/x/text v0.23.0 // indirect
+	google.golang.org/genproto/googleapis/rpc v0.0.0-20250324211829-b45e905df463 // indirect
 )
@@ -0,0 +1,201 @@
+package pdfcomp
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/model"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/types"
+)
+
+// Structure trees nested deeper than this are assumed to be broken
+const maxStructDepth = 100
+
+// The accessibility features of one document
+type Accessibility struct {
+	// True if the document declares itself tagged, with /MarkInfo /Marked
+	Tagged bool
+	// Natural language of the document, from the catalog's /Lang
+	Lang string
+	// Structure elements in reading order, indented by their depth in the
+	// structure tree, for example "  P", followed by any language of their own
+	// as in "  P [fr-CA]"
+	Tags []string
+	// Number of figures without alternative text
+	MissingAlt int
+	// Alternative text of every element that has it, as "Figure: a chart"
+	AltText []string
+	// Replacement text (/ActualText) and expansions of abbreviations (/E) of
+	// every element that has them, as "Span: 1st" or "Span expansion: first"
+	ActualText []string
+}
+
+// Differences in accessibility features between two documents
+type AccessibilityReport struct {
+	File1 string
+	File2 string
+	Doc1  Accessibility
+	Doc2  Accessibility
+	// Changes to the structure tree and reading order, as lines prefixed with
+	// "- " for elements only in file1 and "+ " for elements only in file2
+	TagChanges []string
+	// Changes to alternative text, in the same form
+	AltTextChanges []string
+	// Changes to replacement text and expansions, in the same form
+	ActualTextChanges []string
+	// Short descriptions of each difference found
+	Issues []string
+}
+
+// True if no accessibility differences were found
+func (r *AccessibilityReport) Equal() bool {
+	return len(r.Issues) == 0
+}
+
+// Compare the features of two documents that matter for accessibility: whether
+// they are tagged, their language, their structure trees and so their reading
+// order, and the alternative text of their figures.  Nothing is rendered.
+func CompareAccessibility(file1, file2 string) (*AccessibilityReport, error) {
+	r := &AccessibilityReport{File1: file1, File2: file2}
+	for _, d := range []struct {
+		file string
+		acc  *Accessibility
+	}{{file1, &r.Doc1}, {file2, &r.Doc2}} {
+		ctx, err := readContext(d.file)
+		if err != nil {
+			return nil, fmt.Errorf("error reading %s: %w", d.file, err)
+		}
+		*d.acc, err = readAccessibility(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("error reading structure of %s: %w", d.file, err)
+		}
+	}
+
+	if r.Doc1.Tagged != r.Doc2.Tagged {
+		r.Issues = append(r.Issues, fmt.Sprintf("tagged changed from %t to %t", r.Doc1.Tagged, r.Doc2.Tagged))
+	}
+	if r.Doc1.Lang != r.Doc2.Lang {
+		r.Issues = append(r.Issues, fmt.Sprintf("language changed from %q to %q", r.Doc1.Lang, r.Doc2.Lang))
+	}
+	if r.Doc2.MissingAlt > r.Doc1.MissingAlt {
+		r.Issues = append(r.Issues, fmt.Sprintf("figures without alternative text increased from %d to %d", r.Doc1.MissingAlt, r.Doc2.MissingAlt))
+	}
+	r.TagChanges = diffSequences(r.Doc1.Tags, r.Doc2.Tags)
+	if len(r.TagChanges) > 0 {
+		r.Issues = append(r.Issues, fmt.Sprintf("structure tree or reading order changed (%d lines)", len(r.TagChanges)))
+	}
+	r.AltTextChanges = diffSequences(r.Doc1.AltText, r.Doc2.AltText)
+	if len(r.AltTextChanges) > 0 {
+		r.Issues = append(r.Issues, fmt.Sprintf("alternative text changed (%d lines)", len(r.AltTextChanges)))
+	}
+	r.ActualTextChanges = diffSequences(r.Doc1.ActualText, r.Doc2.ActualText)
+	if len(r.ActualTextChanges) > 0 {
+		r.Issues = append(r.Issues, fmt.Sprintf("replacement text changed (%d lines)", len(r.ActualTextChanges)))
+	}
+	return r, nil
+}
+
+// Gather the accessibility features of a document
+func readAccessibility(ctx *model.Context) (Accessibility, error) {
+	var acc Accessibility
+	root, err := ctx.Catalog()
+	if err != nil {
+		return acc, err
+	}
+	if markInfo, ok := dictEntry(ctx, root, "MarkInfo").(types.Dict); ok {
+		if marked, ok := dictEntry(ctx, markInfo, "Marked").(types.Boolean); ok {
+			acc.Tagged = marked.Value()
+		}
+	}
+	if lang := dictEntry(ctx, root, "Lang"); lang != nil {
+		acc.Lang, _ = model.Text(lang)
+	}
+
+	treeRoot, ok := dictEntry(ctx, root, "StructTreeRoot").(types.Dict)
+	if !ok {
+		return acc, nil
+	}
+	w := structWalker{ctx: ctx, seen: map[int]bool{}, acc: &acc}
+	w.roleMap, _ = dictEntry(ctx, treeRoot, "RoleMap").(types.Dict)
+	w.kids(treeRoot, 0)
+	return acc, nil
+}
+
+// Walks a structure tree depth first, which is its logical reading order
+type structWalker struct {
+	ctx     *model.Context
+	roleMap types.Dict
+	// Object numbers already visited, to survive cycles in broken files
+	seen map[int]bool
+	acc  *Accessibility
+}
+
+// Visit the children of a structure element or of the tree root
+func (w *structWalker) kids(elem types.Dict, depth int) {
+	if depth > maxStructDepth {
+		return
+	}
+	k, found := elem.Find("K")
+	if !found {
+		return
+	}
+	if arr, ok := k.(types.Array); ok {
+		for _, kid := range arr {
+			w.elem(kid, depth)
+		}
+		return
+	}
+	w.elem(k, depth)
+}
+
+// Visit one structure element, ignoring marked content and object references
+func (w *structWalker) elem(o types.Object, depth int) {
+	if ref, ok := o.(types.IndirectRef); ok {
+		if w.seen[ref.ObjectNumber.Value()] {
+			return
+		}
+		w.seen[ref.ObjectNumber.Value()] = true
+	}
+	o, err := w.ctx.Dereference(o)
+	if err != nil {
+		return
+	}
+	d, ok := o.(types.Dict)
+	if !ok {
+		return
+	}
+	s, ok := dictEntry(w.ctx, d, "S").(types.Name)
+	if !ok {
+		// Marked content or object reference
+		return
+	}
+	tag := s.Value()
+	if mapped, ok := dictEntry(w.ctx, w.roleMap, tag).(types.Name); ok {
+		tag += " (" + mapped.Value() + ")"
+	}
+	// Screen readers switch voice for a language that differs from the document's
+	if l := dictEntry(w.ctx, d, "Lang"); l != nil {
+		if lang, _ := model.Text(l); lang != "" {
+			tag += " [" + lang + "]"
+		}
+	}
+	w.acc.Tags = append(w.acc.Tags, strings.Repeat("  ", depth)+tag)
+
+	alt := ""
+	if a := dictEntry(w.ctx, d, "Alt"); a != nil {
+		alt, _ = model.Text(a)
+	}
+	if alt != "" {
+		w.acc.AltText = append(w.acc.AltText, s.Value()+": "+alt)
+	} else if s.Value() == "Figure" {
+		w.acc.MissingAlt++
+	}
+	for _, t := range []struct{ key, label string }{{"ActualText", ""}, {"E", " expansion"}} {
+		if a := dictEntry(w.ctx, d, t.key); a != nil {
+			if text, _ := model.Text(a); text != "" {
+				w.acc.ActualText = append(w.acc.ActualText, s.Value()+t.label+": "+text)
+			}
+		}
+	}
+	w.kids(d, depth+1)
+}
@@ -0,0 +1,197 @@
+package pdfcomp
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// A tagged one page pdf whose structure tree is a Document element with the
+// given children, each the entries of an element's dictionary such as
+// "/S /P /Lang (fr)".  catalog is added to the catalog's entries.
+func taggedPDF(t *testing.T, catalog string, elems ...string) string {
+	t.Helper()
+	var kids []string
+	for i := range elems {
+		kids = append(kids, fmt.Sprintf("%d 0 R", 6+i))
+	}
+	objs := []string{
+		"<< /Type /Catalog /Pages 2 0 R /StructTreeRoot 4 0 R " + catalog + " >>",
+		"<< /Type /Pages /Kids [3 0 R] /Count 1 >>",
+		"<< /Type /Page /Parent 2 0 R /MediaBox [0 0 200 200] >>",
+		"<< /Type /StructTreeRoot /K [5 0 R] /RoleMap << /Heading /H1 >> >>",
+		"<< /S /Document /P 4 0 R /K [" + strings.Join(kids, " ") + "] >>",
+	}
+	for _, e := range elems {
+		objs = append(objs, "<< "+e+" /P 5 0 R >>")
+	}
+	var b strings.Builder
+	b.WriteString("%PDF-1.7\n")
+	offsets := make([]int, len(objs))
+	for i, o := range objs {
+		offsets[i] = b.Len()
+		fmt.Fprintf(&b, "%d 0 obj\n%s\nendobj\n", i+1, o)
+	}
+	xref := b.Len()
+	fmt.Fprintf(&b, "xref\n0 %d\n0000000000 65535 f \n", len(objs)+1)
+	for _, off := range offsets {
+		fmt.Fprintf(&b, "%010d 00000 n \n", off)
+	}
+	fmt.Fprintf(&b, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(objs)+1, xref)
+
+	file := filepath.Join(t.TempDir(), "tagged.pdf")
+	if err := os.WriteFile(file, []byte(b.String()), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return file
+}
+
+const taggedCatalog = "/MarkInfo << /Marked true >> /Lang (en-GB)"
+
+// The structure tree most cases change one thing in
+var baseElems = []string{
+	"/S /Heading",
+	"/S /P",
+	"/S /Figure /Alt (A chart of sales)",
+	"/S /Span /ActualText (1st) /E (first)",
+}
+
+// A copy of baseElems with element i replaced
+func withElem(i int, elem string) []string {
+	elems := append([]string(nil), baseElems...)
+	elems[i] = elem
+	return elems
+}
+
+func TestReadAccessibility(t *testing.T) {
+	file := taggedPDF(t, taggedCatalog, withElem(1, "/S /P /Lang (fr-CA)")...)
+	ctx, err := readContext(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	acc, err := readAccessibility(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Accessibility{
+		Tagged:     true,
+		Lang:       "en-GB",
+		Tags:       []string{"Document", "  Heading (H1)", "  P [fr-CA]", "  Figure", "  Span"},
+		AltText:    []string{"Figure: A chart of sales"},
+		ActualText: []string{"Span: 1st", "Span expansion: first"},
+	}
+	if !reflect.DeepEqual(acc, want) {
+		t.Errorf("got %+v\nwant %+v", acc, want)
+	}
+}
+
+func TestCompareAccessibility(t *testing.T) {
+	tests := []struct {
+		name    string
+		catalog string
+		elems   []string
+		// The first words of each issue expected
+		issues     []string
+		tags       []string
+		altText    []string
+		actualText []string
+	}{
+		{name: "same", catalog: taggedCatalog, elems: baseElems},
+		{
+			name: "untagged", catalog: "/Lang (en-GB)", elems: baseElems,
+			issues: []string{"tagged changed"},
+		},
+		{
+			name: "document language", catalog: "/MarkInfo << /Marked true >> /Lang (en-US)", elems: baseElems,
+			issues: []string{"language changed"},
+		},
+		{
+			name: "reading order", catalog: taggedCatalog,
+			elems:  []string{baseElems[1], baseElems[0], baseElems[2], baseElems[3]},
+			issues: []string{"structure tree"},
+			tags:   []string{"-   Heading (H1)", "+   Heading (H1)"},
+		},
+		{
+			name: "element language", catalog: taggedCatalog, elems: withElem(1, "/S /P /Lang (fr-CA)"),
+			issues: []string{"structure tree"},
+			tags:   []string{"-   P", "+   P [fr-CA]"},
+		},
+		{
+			name: "alternative text removed", catalog: taggedCatalog, elems: withElem(2, "/S /Figure"),
+			issues:  []string{"figures without alternative text", "alternative text changed"},
+			altText: []string{"- Figure: A chart of sales"},
+		},
+		{
+			name: "replacement text", catalog: taggedCatalog, elems: withElem(3, "/S /Span /ActualText (2nd) /E (first)"),
+			issues:     []string{"replacement text changed"},
+			actualText: []string{"- Span: 1st", "+ Span: 2nd"},
+		},
+	}
+	file1 := taggedPDF(t, taggedCatalog, baseElems...)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := CompareAccessibility(file1, taggedPDF(t, tt.catalog, tt.elems...))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if r.Equal() != (len(tt.issues) == 0) {
+				t.Errorf("Equal() = %v with issues %q", r.Equal(), r.Issues)
+			}
+			if len(r.Issues) != len(tt.issues) {
+				t.Fatalf("issues %q, want %d starting %q", r.Issues, len(tt.issues), tt.issues)
+			}
+			for i, issue := range r.Issues {
+				if !strings.HasPrefix(issue, tt.issues[i]) {
+					t.Errorf("issue %q, want one starting %q", issue, tt.issues[i])
+				}
+			}
+			for _, c := range []struct {
+				name      string
+				got, want []string
+			}{{"tag", r.TagChanges, tt.tags}, {"alternative text", r.AltTextChanges, tt.altText}, {"replacement text", r.ActualTextChanges, tt.actualText}} {
+				if !sameSet(c.got, c.want) {
+					t.Errorf("%s changes %q, want %q", c.name, c.got, c.want)
+				}
+			}
+		})
+	}
+}
+
+// A structure tree that refers back to itself must not be followed forever
+func TestAccessibilityCycle(t *testing.T) {
+	file := taggedPDF(t, taggedCatalog, "/S /Sect /K [5 0 R 6 0 R]")
+	ctx, err := readContext(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	acc, err := readAccessibility(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"Document", "  Sect"}; !reflect.DeepEqual(acc.Tags, want) {
+		t.Errorf("tags %q, want %q", acc.Tags, want)
+	}
+}
+
+// Whether a and b hold the same lines, in any order
+func sameSet(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	count := map[string]int{}
+	for _, s := range a {
+		count[s]++
+	}
+	for _, s := range b {
+		count[s]--
+	}
+	for _, n := range count {
+		if n != 0 {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,177 @@
+package pdfcomp
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// How file2's rendering of a page was moved to line it up with file1's before
+// comparing, as when the pages come from sources with slightly different
+// crops or margins
+type Offset struct {
+	// Pixels moved right and down, at the resolution the pages were compared
+	// at.  Negative values move it left and up.
+	X int
+	Y int
+	// The same in points, so that a page whose content was only moved can be
+	// told from one whose content changed
+	XPoints float64
+	YPoints float64
+}
+
+func (o *Offset) String() string {
+	var moves []string
+	if o.XPoints > 0 {
+		moves = append(moves, fmt.Sprintf("%.3gpt right", o.XPoints))
+	} else if o.XPoints < 0 {
+		moves = append(moves, fmt.Sprintf("%.3gpt left", -o.XPoints))
+	}
+	if o.YPoints > 0 {
+		moves = append(moves, fmt.Sprintf("%.3gpt down", o.YPoints))
+	} else if o.YPoints < 0 {
+		moves = append(moves, fmt.Sprintf("%.3gpt up", -o.YPoints))
+	}
+	return fmt.Sprintf("file2 moved %s (%d,%d pixels) to line up with file1", strings.Join(moves, " and "), o.X, o.Y)
+}
+
+// The largest shift searched for, in points
+const alignMaxPoints = 18
+
+// The size the search for a shift starts at, halving the pages until they
+// are no larger than this in either direction
+const alignCoarseSize = 256
+
+// Find the shift of img2, up to alignMaxPoints in each direction, that best
+// lines it up with img1, rendered at dpi, and return img2 moved by it.  Pages
+// of different sizes, and pages best left where they are, are returned as
+// they are with a nil Offset.
+func alignPages(img1, img2 *Image, dpi float64) (*Image, *Offset) {
+	if img1.H == 0 || img1.H != img2.H || img1.W != img2.W || img1.Channels != img2.Channels {
+		return img2, nil
+	}
+	if same, _, err := equalImages(img1, img2, false); err != nil || same {
+		return img2, nil
+	}
+	maxShift := int(dpi) * alignMaxPoints / 72
+	x, y := findOffset(newInkMap(img1), newInkMap(img2), maxShift)
+	if x == 0 && y == 0 {
+		return img2, nil
+	}
+	return shiftImage(img2, x, y), &Offset{X: x, Y: y, XPoints: float64(x) * 72 / dpi, YPoints: float64(y) * 72 / dpi}
+}
+
+// Find the best shift from the coarsest of a pyramid of halved pages, where
+// every shift in range is tried, and refine it at each finer level by trying
+// the shifts next to twice the one found at the level above
+func findOffset(m1, m2 inkMap, maxShift int) (int, int) {
+	levels := [][2]inkMap{{m1, m2}}
+	for max(m1.w, m1.h) > alignCoarseSize && maxShift>>len(levels) > 1 {
+		m1, m2 = m1.half(), m2.half()
+		levels = append(levels, [2]inkMap{m1, m2})
+	}
+	slices.Reverse(levels)
+
+	r := (maxShift >> (len(levels) - 1)) + 1
+	x, y := bestShift(levels[0][0], levels[0][1], 0, 0, r, 1)
+	for i, l := range levels[1:] {
+		// Every other row is enough at full size, where rows are many
+		step := 1
+		if i == len(levels)-2 {
+			step = 2
+		}
+		x, y = bestShift(l[0], l[1], 2*x, 2*y, 1, step)
+	}
+	return min(max(x, -maxShift), maxShift), min(max(y, -maxShift), maxShift)
+}
+
+// The shift within r of x, y in each direction with the smallest difference,
+// preferring x, y itself on a tie
+func bestShift(m1, m2 inkMap, x, y, r, step int) (int, int) {
+	bx, by := x, y
+	best := m1.distance(m2, x, y, step)
+	for dy := y - r; dy <= y+r; dy++ {
+		for dx := x - r; dx <= x+r; dx++ {
+			if d := m1.distance(m2, dx, dy, step); d < best {
+				best, bx, by = d, dx, dy
+			}
+		}
+	}
+	return bx, by
+}
+
+// How dark each pixel of a page is, from 0 for white to 255 for black, one
+// byte per pixel
+type inkMap struct {
+	w, h int
+	ink  []byte
+}
+
+func newInkMap(img *Image) inkMap {
+	m := inkMap{w: img.W, h: img.H}
+	m.ink = make([]byte, m.w*m.h)
+	for y := range img.H {
+		row := img.Row(y)
+		for x := range m.w {
+			m.ink[y*m.w+x] = byte(255 - lightness(row, x, img.Channels))
+		}
+	}
+	return m
+}
+
+// The map at half the size, each pixel the average of four
+func (m inkMap) half() inkMap {
+	h := inkMap{w: max(1, m.w/2), h: max(1, m.h/2)}
+	h.ink = make([]byte, h.w*h.h)
+	for y := range h.h {
+		for x := range h.w {
+			sum, n := 0, 0
+			for _, p := range [][2]int{{2 * x, 2 * y}, {2*x + 1, 2 * y}, {2 * x, 2*y + 1}, {2*x + 1, 2*y + 1}} {
+				if p[0] < m.w && p[1] < m.h {
+					sum += int(m.ink[p[1]*m.w+p[0]])
+					n++
+				}
+			}
+			h.ink[y*h.w+x] = byte(sum / n)
+		}
+	}
+	return h
+}
+
+// The mean difference in ink between m and o moved dx, dy, over the area
+// where they overlap, looking at every step-th row
+func (m inkMap) distance(o inkMap, dx, dy, step int) float64 {
+	x0, x1 := max(0, dx), min(m.w, o.w+dx)
+	y0, y1 := max(0, dy), min(m.h, o.h+dy)
+	if x1-x0 < m.w/2 || y1-y0 < m.h/2 {
+		// Too little overlap to judge by
+		return 1 << 30
+	}
+	var sum, n int
+	for y := y0; y < y1; y += step {
+		row1 := m.ink[y*m.w : (y+1)*m.w]
+		row2 := o.ink[(y-dy)*o.w : (y-dy+1)*o.w]
+		for x := x0; x < x1; x++ {
+			sum += abs(int(row1[x]) - int(row2[x-dx]))
+		}
+		n += x1 - x0
+	}
+	return float64(sum) / float64(n)
+}
+
+// A copy of an image with its contents moved dx pixels right and dy down,
+// filling the area uncovered with white
+func shiftImage(img *Image, dx, dy int) *Image {
+	out := NewImage(img.W, img.H, img.Channels)
+	for y := range img.H {
+		if sy := y - dy; sy >= 0 && sy < img.H {
+			row, src := out.Row(y), img.Row(sy)
+			if dx >= 0 {
+				copy(row[min(dx*img.Channels, len(row)):], src)
+			} else {
+				copy(row, src[min(-dx*img.Channels, len(src)):])
+			}
+		}
+	}
+	return out
+}
@@ -0,0 +1,102 @@
+package pdfcomp
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/pdfcpu/pdfcpu/pkg/api"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/color"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/model"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/types"
+)
+
+// Points the square marking a region is drawn outside it, so that its
+// border does not hide what differs
+const annotationMargin = 2.0
+
+// Write copies of the two files with a square annotation over each region of
+// the pages that differ, in the highlight colour, so that reviewers see the
+// differences in the documents themselves rather than in renderings of them.
+// Nothing is written if no page has regions.  Returns the names of the copies.
+func annotateFiles(res *Result, file1, file2 string, o Options) (string, string, error) {
+	anns1, anns2 := map[int][]model.AnnotationRenderer{}, map[int][]model.AnnotationRenderer{}
+	now := types.DateString(time.Now())
+	for _, pr := range res.Pages {
+		if pr.Equal {
+			continue
+		}
+		for i := range min(len(pr.UserSpace1), len(pr.UserSpace2)) {
+			id := fmt.Sprintf("pdfcomp-%d-%d", pr.Page, i+1)
+			anns1[pr.Page] = append(anns1[pr.Page], diffAnnotation(pr.UserSpace1[i], id, now, o.Highlight,
+				fmt.Sprintf("Differs from page %d of %s", pr.Page, res.File2)))
+			anns2[pr.Page] = append(anns2[pr.Page], diffAnnotation(pr.UserSpace2[i], id, now, o.Highlight,
+				fmt.Sprintf("Differs from page %d of %s", pr.Page, res.File1)))
+		}
+	}
+	if len(anns1) == 0 {
+		return "", "", nil
+	}
+	name1, name2 := o.annotatedNames(file1, file2)
+	if err := annotateFile(file1, name1, anns1); err != nil {
+		return "", "", err
+	}
+	if err := annotateFile(file2, name2, anns2); err != nil {
+		return "", "", err
+	}
+	return name1, name2, nil
+}
+
+// A square annotation around a region that differs, explained by contents
+func diffAnnotation(r PDFRect, id, date string, hl Highlight, contents string) model.AnnotationRenderer {
+	rect := types.Rectangle{
+		LL: types.Point{X: r.LLX - annotationMargin, Y: r.LLY - annotationMargin},
+		UR: types.Point{X: r.URX + annotationMargin, Y: r.URY + annotationMargin},
+	}
+	col := &color.SimpleColor{R: float32(hl.Color.R) / 255, G: float32(hl.Color.G) / 255, B: float32(hl.Color.B) / 255}
+	return model.NewSquareAnnotation(rect, contents, id, date, model.AnnPrint, col, "pdf-comp", nil, nil, "", "Difference",
+		nil, 0, 0, 0, 0, 1.5, model.BSSolid, false, 0)
+}
+
+// Write a copy of a file with annotations added to its pages
+func annotateFile(filename, out string, anns map[int][]model.AnnotationRenderer) error {
+	f, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if err := os.MkdirAll(filepath.Dir(out), 0755); err != nil {
+		return err
+	}
+	w, err := os.Create(out)
+	if err != nil {
+		return err
+	}
+	if err := api.AddAnnotationsMap(f, w, anns, model.NewDefaultConfiguration()); err != nil {
+		w.Close()
+		os.Remove(out)
+		return fmt.Errorf("error annotating %s: %w", filename, err)
+	}
+	return w.Close()
+}
+
+// The filenames for the annotated copies of the two files: each file's name
+// ending -annotated.pdf, in OutDir or else beside the file.  If they would be
+// the same, file2's ends -annotated-2.pdf.
+func (o *Options) annotatedNames(file1, file2 string) (string, string) {
+	name := func(file string) string {
+		dir := o.OutDir
+		if dir == "" {
+			dir = filepath.Dir(file)
+		}
+		base := filepath.Base(file)
+		return filepath.Join(dir, strings.TrimSuffix(base, filepath.Ext(base))+"-annotated.pdf")
+	}
+	name1, name2 := name(file1), name(file2)
+	if name1 == name2 {
+		name2 = strings.TrimSuffix(name2, ".pdf") + "-2.pdf"
+	}
+	return name1, name2
+}
@@ -0,0 +1,118 @@
+package pdfcomp
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/model"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/types"
+)
+
+// An annotation on a page: a link, highlight, comment, stamp and so on.
+// pdftoppm does not draw all of these, so they are compared separately.
+type Annotation struct {
+	// Subtype, such as Link, Highlight, Text or Stamp
+	Type string
+	// Position on the page in user space, rounded to whole points
+	Rect [4]float64
+	// Text of the annotation, if any
+	Contents string
+}
+
+func (a Annotation) String() string {
+	s := fmt.Sprintf("%s [%g %g %g %g]", a.Type, a.Rect[0], a.Rect[1], a.Rect[2], a.Rect[3])
+	if a.Contents != "" {
+		s += fmt.Sprintf(" %q", a.Contents)
+	}
+	return s
+}
+
+// The annotations of every page of a file, indexed by page number
+func fileAnnotations(filename string) (map[int][]Annotation, error) {
+	ctx, err := readContext(filename)
+	if err != nil {
+		return nil, err
+	}
+	annots := map[int][]Annotation{}
+	for page := 1; page <= ctx.PageCount; page++ {
+		annots[page], err = pageAnnotations(ctx, page)
+		if err != nil {
+			return nil, fmt.Errorf("error reading annotations of page %d of %s: %w", page, filename, err)
+		}
+	}
+	return annots, nil
+}
+
+// The annotations of a page, in the order the page lists them
+func pageAnnotations(ctx *model.Context, page int) ([]Annotation, error) {
+	d, _, _, err := ctx.PageDict(page, false)
+	if err != nil {
+		return nil, err
+	}
+	arr, ok := dictEntry(ctx, d, "Annots").(types.Array)
+	if !ok {
+		return nil, nil
+	}
+	var annots []Annotation
+	for _, o := range arr {
+		o, err := ctx.Dereference(o)
+		if err != nil {
+			continue
+		}
+		ad, ok := o.(types.Dict)
+		if !ok {
+			continue
+		}
+		var a Annotation
+		if subtype, ok := dictEntry(ctx, ad, "Subtype").(types.Name); ok {
+			a.Type = subtype.Value()
+		}
+		if a.Type == "Popup" {
+			// Just the window showing another annotation's text
+			continue
+		}
+		a.Rect = annotationRect(ctx, ad)
+		if contents := dictEntry(ctx, ad, "Contents"); contents != nil {
+			a.Contents, _ = model.Text(contents)
+		}
+		annots = append(annots, a)
+	}
+	return annots, nil
+}
+
+// The rectangle of an annotation, rounded to whole points
+func annotationRect(ctx *model.Context, ad types.Dict) [4]float64 {
+	var r [4]float64
+	rect, ok := dictEntry(ctx, ad, "Rect").(types.Array)
+	if !ok || len(rect) != 4 {
+		return r
+	}
+	for i, v := range rect {
+		v, _ := ctx.Dereference(v)
+		switch n := v.(type) {
+		case types.Integer:
+			r[i] = float64(n.Value())
+		case types.Float:
+			r[i] = math.Round(n.Value())
+		}
+	}
+	return r
+}
+
+// Annotations only on the first page and only on the second, keeping the
+// order they appear in
+func diffAnnotations(a1, a2 []Annotation) (removed, added []Annotation) {
+	return diffItems(a1, a2)
+}
+
+// Record the annotations that differ between the two versions of the page,
+// which makes the page different.  Does nothing if annotations were not read.
+func (pr *PageResult) compareAnnotations(annots1, annots2 map[int][]Annotation) {
+	if annots1 == nil || annots2 == nil {
+		return
+	}
+	pr.AnnotationsRemoved, pr.AnnotationsAdded = diffAnnotations(annots1[pr.Page], annots2[pr.Page])
+	if len(pr.AnnotationsRemoved) > 0 || len(pr.AnnotationsAdded) > 0 {
+		pr.Equal = false
+	}
+}
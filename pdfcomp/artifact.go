@@ -0,0 +1,142 @@
+package pdfcomp
+
+import (
+	"bytes"
+	"fmt"
+	"image/jpeg"
+	"image/png"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Difference images are scaled down by this factor at each attempt to fit
+// the artifact size budget, and never below minArtifactScale
+const (
+	artifactScaleStep   = 0.7
+	minArtifactScale    = 0.1
+	artifactJPEGQuality = 85
+)
+
+// How a difference image was changed to fit within Options.MaxArtifactBytes
+type ArtifactAdjustment struct {
+	// png or jpeg
+	Format string
+	// Size relative to the full resolution image
+	Scale float64
+	Bytes int
+	// False if even the smallest version tried was over the budget, in which
+	// case that version was written anyway
+	Fits bool
+}
+
+func (a ArtifactAdjustment) String() string {
+	s := fmt.Sprintf("reduced to %.0f%% as %s, %d bytes", a.Scale*100, a.Format, a.Bytes)
+	if !a.Fits {
+		s += ", still over budget"
+	}
+	return s
+}
+
+// Write a difference image, keeping it within budget bytes if budget is more
+// than zero by scaling it down or switching to jpeg.  Returns the name of the
+// file written, which has a .jpg extension if it was switched to jpeg, and
+// the adjustment made if any.
+func writeArtifact(filename string, img *Image, budget int) (string, *ArtifactAdjustment, error) {
+	if budget <= 0 {
+		return filename, nil, writePNG(filename, img)
+	}
+	data, adj, err := encodeArtifact(img, budget)
+	if err != nil {
+		return "", nil, fmt.Errorf("error encoding %s: %w", filename, err)
+	}
+	if adj != nil && adj.Format == "jpeg" {
+		filename = strings.TrimSuffix(filename, filepath.Ext(filename)) + ".jpg"
+	}
+	if err := os.MkdirAll(filepath.Dir(filename), 0755); err != nil {
+		return "", nil, err
+	}
+	return filename, adj, os.WriteFile(filename, data, 0644)
+}
+
+// Encode a difference image as writeArtifact writes it, for keeping in
+// memory rather than on disk
+func encodeImage(img *Image, budget int) ([]byte, *ArtifactAdjustment, error) {
+	if budget > 0 {
+		return encodeArtifact(img, budget)
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, rgbToPNG(img)); err != nil {
+		return nil, nil, err
+	}
+	return buf.Bytes(), nil, nil
+}
+
+// Encode an image as png, or if that is over budget, try successively smaller
+// versions as png and then jpeg until one fits
+func encodeArtifact(full *Image, budget int) ([]byte, *ArtifactAdjustment, error) {
+	var buf bytes.Buffer
+	var adj *ArtifactAdjustment
+	for scale := 1.0; scale >= minArtifactScale; scale *= artifactScaleStep {
+		scaled := full
+		if scale < 1 {
+			scaled = scaleImage(full, scale)
+		}
+		img := rgbToPNG(scaled)
+		for _, format := range []string{"png", "jpeg"} {
+			buf.Reset()
+			var err error
+			if format == "png" {
+				err = png.Encode(&buf, img)
+			} else {
+				err = jpeg.Encode(&buf, img, &jpeg.Options{Quality: artifactJPEGQuality})
+			}
+			if err != nil {
+				return nil, nil, err
+			}
+			if scale == 1 && format == "png" && buf.Len() <= budget {
+				return buf.Bytes(), nil, nil
+			}
+			adj = &ArtifactAdjustment{Format: format, Scale: scale, Bytes: buf.Len(), Fits: buf.Len() <= budget}
+			if adj.Fits {
+				return buf.Bytes(), adj, nil
+			}
+		}
+	}
+	// Nothing fitted, so settle for the smallest tried
+	return buf.Bytes(), adj, nil
+}
+
+// Scale an image down, averaging the pixels each output pixel covers
+func scaleImage(img *Image, scale float64) *Image {
+	return resizeImage(img, max(1, int(float64(img.H)*scale)), max(1, int(float64(img.W)*scale)))
+}
+
+// Resize an image to h rows of w pixels, averaging the pixels each output
+// pixel covers
+func resizeImage(img *Image, h, w int) *Image {
+	height, width, channels := img.H, img.W, img.Channels
+	out := newImage(w, h, channels)
+	for y := range h {
+		dst := out.Row(y)
+		y0, y1 := y*height/h, max((y+1)*height/h, y*height/h+1)
+		for x := range w {
+			x0, x1 := x*width/w, max((x+1)*width/w, x*width/w+1)
+			var sum [3]int
+			n := 0
+			for sy := y0; sy < y1; sy++ {
+				row := img.Row(sy)
+				for sx := x0; sx < x1; sx++ {
+					for c := range channels {
+						sum[c] += int(row[sx*channels+c])
+					}
+					n++
+				}
+			}
+			for c := range channels {
+				dst[x*channels+c] = byte(sum[c] / n)
+			}
+		}
+	}
+	return out
+}
@@ -0,0 +1,169 @@
+package pdfcomp
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// Verdicts recorded in audit log entries
+const (
+	VerdictSame      = "same"
+	VerdictDifferent = "different"
+	VerdictError     = "error"
+)
+
+// One comparison in an audit log.  Each entry holds the hash of the one
+// before it, so that changing, removing or reordering entries breaks the
+// chain and is detected by VerifyAuditLog.
+type AuditEntry struct {
+	Time      time.Time
+	Operator  string
+	File1     string
+	File2     string
+	Checksum1 string
+	Checksum2 string
+	Settings  Settings
+	Verdict   string
+	// Pages found to be different, if the verdict is different
+	DiffPages []int `json:",omitempty"`
+	// What went wrong, if the verdict is error
+	Error string `json:",omitempty"`
+	// Hash of the previous entry, empty for the first entry in a log
+	PrevHash string
+	// Hash of this entry, computed with Hash empty
+	Hash string
+}
+
+// Serialises appends from this process, so entries are never interleaved
+var auditMu sync.Mutex
+
+// Build an audit entry for a comparison, with the checksums of both files.
+// Pass the error from Compare, if any, instead of a result, and the same
+// options that were passed to Compare.
+func NewAuditEntry(file1, file2, operator string, res *Result, err error, opts ...Option) AuditEntry {
+	o := DefaultOptions()
+	for _, opt := range opts {
+		opt(&o)
+	}
+	e := AuditEntry{
+		Time:     time.Now().UTC(),
+		Operator: operator,
+		File1:    file1,
+		File2:    file2,
+		Settings: o.Settings(),
+	}
+	e.Checksum1, _ = Checksum(file1)
+	e.Checksum2, _ = Checksum(file2)
+	switch {
+	case err != nil:
+		e.Verdict = VerdictError
+		e.Error = err.Error()
+	case res.Equal:
+		e.Verdict = VerdictSame
+	default:
+		e.Verdict = VerdictDifferent
+		for _, p := range res.DiffPages() {
+			e.DiffPages = append(e.DiffPages, p.Page)
+		}
+	}
+	return e
+}
+
+// Append an entry to an audit log, creating the log if needed and chaining
+// the entry to the last one already there.  The log is only ever appended
+// to, and each entry is flushed to disk before returning.
+func AppendAudit(logfile string, e AuditEntry) (AuditEntry, error) {
+	auditMu.Lock()
+	defer auditMu.Unlock()
+
+	prev, _, err := readAuditLog(logfile)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return e, err
+	}
+	e.PrevHash = prev
+	e.Hash, err = e.computeHash()
+	if err != nil {
+		return e, err
+	}
+	line, err := json.Marshal(e)
+	if err != nil {
+		return e, err
+	}
+
+	f, err := os.OpenFile(logfile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return e, err
+	}
+	defer f.Close()
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		return e, err
+	}
+	return e, f.Sync()
+}
+
+// Check every entry of an audit log against its hash and the hash of the
+// entry before it, returning the number of entries.  If the log was tampered
+// with, the error wraps ErrAuditLogAltered and says which entry is the first.
+func VerifyAuditLog(logfile string) (int, error) {
+	_, n, err := readAuditLog(logfile)
+	return n, err
+}
+
+// Read an audit log, checking the chain, and return the hash of its last
+// entry and the number of entries
+func readAuditLog(logfile string) (string, int, error) {
+	f, err := os.Open(logfile)
+	if err != nil {
+		return "", 0, err
+	}
+	defer f.Close()
+
+	prev := ""
+	n := 0
+	sc := bufio.NewScanner(f)
+	sc.Buffer(nil, 16*1024*1024)
+	for sc.Scan() {
+		n++
+		if len(bytes.TrimSpace(sc.Bytes())) == 0 {
+			return "", n, fmt.Errorf("%w: %s: entry %d is empty", ErrAuditLogAltered, logfile, n)
+		}
+		var e AuditEntry
+		if err := json.Unmarshal(sc.Bytes(), &e); err != nil {
+			return "", n, fmt.Errorf("%w: %s: entry %d: %w", ErrAuditLogAltered, logfile, n, err)
+		}
+		if e.PrevHash != prev {
+			return "", n, fmt.Errorf("%w: %s: entry %d does not follow entry %d", ErrAuditLogAltered, logfile, n, n-1)
+		}
+		hash, err := e.computeHash()
+		if err != nil {
+			return "", n, err
+		}
+		if hash != e.Hash {
+			return "", n, fmt.Errorf("%w: %s: entry %d has been altered", ErrAuditLogAltered, logfile, n)
+		}
+		prev = e.Hash
+	}
+	if err := sc.Err(); err != nil {
+		return "", n, err
+	}
+	return prev, n, nil
+}
+
+// The sha256 of the entry as json, with the Hash field empty
+func (e AuditEntry) computeHash() (string, error) {
+	e.Hash = ""
+	data, err := json.Marshal(e)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
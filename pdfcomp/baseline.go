@@ -0,0 +1,207 @@
+package pdfcomp
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/model"
+)
+
+// Document information entries recorded in baselines.  Producer and the dates
+// are left out as they change every time a file is generated.
+var baselineInfoKeys = []string{"Title", "Author", "Subject", "Keywords"}
+
+// A record of how an approved version of a document looks, small enough to
+// keep in a repository in place of the document itself.  Later versions are
+// checked against it with VerifyBaseline.
+type Baseline struct {
+	// The file approved, for reference only
+	File     string
+	Checksum string
+	Approved time.Time
+	// Name of the fingerprint of each page, as accepted by
+	// ParseFingerprinter, and the resolution pages were rendered at
+	Fingerprint string
+	Resolution  int
+	Pages       []BaselinePage
+	// Document information entries, such as the title
+	Info map[string]string `json:",omitempty"`
+}
+
+// One page of a baseline
+type BaselinePage struct {
+	Fingerprint string
+	// Size of the area rendered, in points
+	Width  float64
+	Height float64
+	// Page label, as a viewer shows it in place of the page number
+	Label string
+}
+
+// How a file differs from a baseline
+type BaselineReport struct {
+	Equal bool
+	// Pages in the baseline and in the file
+	Pages1 int
+	Pages2 int
+	// Pages present in both whose fingerprints do not match
+	DiffPages []int
+	// Differences in page sizes, labels and document information, as
+	// readable lines
+	Changes []string
+	// A baseline of the file, with the same fingerprint and resolution, to
+	// write in place of the old one to accept the changes
+	Current *Baseline
+}
+
+// Record a baseline of a file, fingerprinting each page with fp at the
+// resolution in the options
+func NewBaseline(filename string, fp Fingerprinter, opts ...Option) (*Baseline, error) {
+	o := DefaultOptions()
+	for _, opt := range opts {
+		opt(&o)
+	}
+	b := &Baseline{
+		File:        filepath.Base(filename),
+		Approved:    time.Now().UTC(),
+		Fingerprint: fp.Name(),
+		Resolution:  o.Resolution,
+	}
+	var err error
+	if b.Checksum, err = Checksum(filename); err != nil {
+		return nil, err
+	}
+	ctx, err := readContext(filename)
+	if err != nil {
+		return nil, fmt.Errorf("error reading %s: %w", filename, err)
+	}
+	prints, err := FingerprintPages(filename, fp, opts...)
+	if err != nil {
+		return nil, err
+	}
+	labels := pageLabels(ctx)
+	for i, p := range prints {
+		_, _, inh, err := ctx.PageDict(i+1, false)
+		if err != nil {
+			return nil, fmt.Errorf("error reading page %d of %s: %w", i+1, filename, err)
+		}
+		box := renderedBox(inh)
+		b.Pages = append(b.Pages, BaselinePage{
+			Fingerprint: p,
+			Width:       roundPoints(box.Width()),
+			Height:      roundPoints(box.Height()),
+			Label:       labels[i],
+		})
+	}
+	b.Info = documentInfo(ctx)
+	return b, nil
+}
+
+// Sizes are kept to a hundredth of a point, so that rounding in different
+// writers does not count as a change
+func roundPoints(v float64) float64 {
+	return math.Round(v*100) / 100
+}
+
+// The document information entries kept in baselines that a file has
+func documentInfo(ctx *model.Context) map[string]string {
+	if ctx.Info == nil {
+		return nil
+	}
+	d, err := ctx.DereferenceDict(*ctx.Info)
+	if err != nil || d == nil {
+		return nil
+	}
+	var info map[string]string
+	for _, key := range baselineInfoKeys {
+		o := dictEntry(ctx, d, key)
+		if o == nil {
+			continue
+		}
+		if s, err := model.Text(o); err == nil && s != "" {
+			if info == nil {
+				info = map[string]string{}
+			}
+			info[key] = s
+		}
+	}
+	return info
+}
+
+// Read a baseline written by WriteBaseline
+func ReadBaseline(filename string) (*Baseline, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	var b Baseline
+	if err := json.Unmarshal(data, &b); err != nil {
+		return nil, fmt.Errorf("error reading baseline %s: %w", filename, err)
+	}
+	return &b, nil
+}
+
+// Write a baseline as indented json, so that changes to it read well in
+// version control
+func WriteBaseline(filename string, b *Baseline) error {
+	data, err := json.MarshalIndent(b, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(filename), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(filename, append(data, '\n'), 0644)
+}
+
+// Check a file against a baseline, fingerprinting its pages the same way
+// the baseline's were.  Any resolution in the options is overridden by the
+// baseline's.
+func VerifyBaseline(filename string, b *Baseline, opts ...Option) (*BaselineReport, error) {
+	fp, err := ParseFingerprinter(b.Fingerprint)
+	if err != nil {
+		return nil, err
+	}
+	cur, err := NewBaseline(filename, fp, append(opts, WithResolution(b.Resolution))...)
+	if err != nil {
+		return nil, err
+	}
+	r := &BaselineReport{Pages1: len(b.Pages), Pages2: len(cur.Pages), Current: cur}
+	if r.Pages1 != r.Pages2 {
+		r.Changes = append(r.Changes, fmt.Sprintf("%d pages instead of %d", r.Pages2, r.Pages1))
+	}
+	for i := range min(r.Pages1, r.Pages2) {
+		p1, p2 := b.Pages[i], cur.Pages[i]
+		if !fp.Match(p1.Fingerprint, p2.Fingerprint) {
+			r.DiffPages = append(r.DiffPages, i+1)
+		}
+		if p1.Width != p2.Width || p1.Height != p2.Height {
+			r.Changes = append(r.Changes, fmt.Sprintf("page %d: size %gx%g instead of %gx%g",
+				i+1, p2.Width, p2.Height, p1.Width, p1.Height))
+		}
+		if p1.Label != p2.Label {
+			r.Changes = append(r.Changes, fmt.Sprintf("page %d: label %q instead of %q", i+1, p2.Label, p1.Label))
+		}
+	}
+	for _, key := range baselineInfoKeys {
+		if v1, v2 := b.Info[key], cur.Info[key]; v1 != v2 {
+			r.Changes = append(r.Changes, fmt.Sprintf("%s %q instead of %q", key, v2, v1))
+		}
+	}
+	r.Equal = len(r.DiffPages) == 0 && len(r.Changes) == 0
+	return r, nil
+}
+
+// The name a baseline of a file is kept under by default: the file's name
+// with .pdf replaced by .baseline.json
+func BaselineName(filename string) string {
+	ext := filepath.Ext(filename)
+	if ext != ".pdf" && ext != ".PDF" {
+		ext = ""
+	}
+	return filename[:len(filename)-len(ext)] + ".baseline.json"
+}
@@ -0,0 +1,115 @@
+package pdfcomp
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestBaselineApproveVerifyUpdate(t *testing.T) {
+	for _, name := range []string{"content", "sha256"} {
+		t.Run(name, func(t *testing.T) {
+			fp, err := ParseFingerprinter(name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if name != "content" {
+				if _, err := ProbeRenderer(); err != nil {
+					t.Skip(err)
+				}
+			}
+			b, err := NewBaseline("../assets/lorem.pdf", fp, WithResolution(30))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if b.Fingerprint != name || b.Resolution != 30 || len(b.Pages) == 0 {
+				t.Fatalf("baseline of %s at %d dpi with %d pages, want %s at 30 with some", b.Fingerprint, b.Resolution, len(b.Pages), name)
+			}
+
+			// Approve: the baseline is kept as a file
+			file := filepath.Join(t.TempDir(), "lorem.baseline.json")
+			if err := WriteBaseline(file, b); err != nil {
+				t.Fatal(err)
+			}
+			if b, err = ReadBaseline(file); err != nil {
+				t.Fatal(err)
+			}
+
+			// Verify: a copy of the file matches, whatever resolution is asked for
+			r, err := VerifyBaseline("../assets/lorem_copy.pdf", b, WithResolution(300))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !r.Equal {
+				t.Errorf("copy differs from the baseline: pages %v, changes %v", r.DiffPages, r.Changes)
+			}
+			if r.Current.Resolution != 30 {
+				t.Errorf("verified at %d dpi, want the baseline's 30", r.Current.Resolution)
+			}
+
+			// A different file does not
+			r, err = VerifyBaseline("../assets/lorem2.pdf", b)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if r.Equal || len(r.DiffPages)+len(r.Changes) == 0 {
+				t.Fatalf("changed file matches the baseline")
+			}
+
+			// Update: its current baseline is accepted in place of the old
+			if err := WriteBaseline(file, r.Current); err != nil {
+				t.Fatal(err)
+			}
+			if b, err = ReadBaseline(file); err != nil {
+				t.Fatal(err)
+			}
+			if r, err = VerifyBaseline("../assets/lorem2.pdf", b); err != nil {
+				t.Fatal(err)
+			}
+			if !r.Equal {
+				t.Errorf("changed file differs from the updated baseline: pages %v, changes %v", r.DiffPages, r.Changes)
+			}
+		})
+	}
+}
+
+func TestBaselineChanges(t *testing.T) {
+	b, err := NewBaseline("../assets/lorem.pdf", ContentFingerprint{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	b.Pages[0].Width++
+	b.Pages[0].Label = "i"
+	b.Info = map[string]string{"Title": "Old title"}
+	b.Pages = append(b.Pages, b.Pages[0])
+	r, err := VerifyBaseline("../assets/lorem_copy.pdf", b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Equal {
+		t.Fatal("file matches a baseline with different sizes, labels, title and page count")
+	}
+	if r.Pages1 != len(b.Pages) || r.Pages2 != len(b.Pages)-1 {
+		t.Errorf("pages %d and %d, want %d and %d", r.Pages1, r.Pages2, len(b.Pages), len(b.Pages)-1)
+	}
+	// Page count, size, label and title
+	if len(r.Changes) != 4 {
+		t.Errorf("changes %q, want one each for the page count, size, label and title", r.Changes)
+	}
+	if len(r.DiffPages) != 0 {
+		t.Errorf("pages %v differ, want none as their content is the same", r.DiffPages)
+	}
+}
+
+func TestBaselineName(t *testing.T) {
+	tests := []struct{ file, want string }{
+		{"report.pdf", "report.baseline.json"},
+		{"out/Report.PDF", "out/Report.baseline.json"},
+		{"notes", "notes.baseline.json"},
+		{"archive.tar.gz", "archive.tar.gz.baseline.json"},
+	}
+	for _, tt := range tests {
+		if got := BaselineName(tt.file); got != tt.want {
+			t.Errorf("BaselineName(%q) = %q, want %q", tt.file, got, tt.want)
+		}
+	}
+}
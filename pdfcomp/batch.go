@@ -0,0 +1,162 @@
+package pdfcomp
+
+import (
+	"io/fs"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// The outcome of comparing every PDF in one directory tree with the file at
+// the same path in another, or of comparing the pairs of files listed in a
+// manifest or matched by glob patterns
+type BatchResult struct {
+	// The directories, or the patterns, the files came from.  Empty for a
+	// manifest.
+	Dir1  string
+	Dir2  string
+	Pairs []BatchPair
+}
+
+// One file of a directory comparison, or one pair from a manifest or glob
+// patterns
+type BatchPair struct {
+	// Path relative to both directories, with / between directories.  For a
+	// manifest, the first file as the manifest names it.
+	Path string
+	// The files compared
+	File1 string
+	File2 string
+	// Whether each file exists
+	InDir1 bool
+	InDir2 bool
+	// Name of the preset the matching profile applied, if any
+	Preset string
+	// Nil if the file is missing from one side or could not be compared
+	Result *Result
+	Err    error
+}
+
+// True if the file is in both directories and the two are the same
+func (p BatchPair) Equal() bool {
+	return p.InDir1 && p.InDir2 && p.Err == nil && p.Result != nil && p.Result.Equal
+}
+
+// True if every file is in both directories and all the pairs are the same
+func (r *BatchResult) Equal() bool {
+	for _, p := range r.Pairs {
+		if !p.Equal() {
+			return false
+		}
+	}
+	return true
+}
+
+// Compare every PDF under dir1 with the file at the same relative path under
+// dir2.  Each pair uses the preset of the first profile whose pattern matches
+// its path, followed by opts, so that opts always take precedence.  A pair
+// that fails to compare is recorded in its BatchPair rather than stopping
+// the batch.
+func CompareDirs(dir1, dir2 string, profiles []Profile, opts ...Option) (*BatchResult, error) {
+	files1, err := pdfFiles(dir1)
+	if err != nil {
+		return nil, err
+	}
+	files2, err := pdfFiles(dir2)
+	if err != nil {
+		return nil, err
+	}
+
+	res := &BatchResult{Dir1: dir1, Dir2: dir2}
+	for _, rel := range mergeNames(files1, files2) {
+		res.Pairs = append(res.Pairs, BatchPair{
+			Path:   rel,
+			File1:  filepath.Join(dir1, filepath.FromSlash(rel)),
+			File2:  filepath.Join(dir2, filepath.FromSlash(rel)),
+			InDir1: slices.Contains(files1, rel),
+			InDir2: slices.Contains(files2, rel),
+		})
+	}
+	res.compare(profiles, opts)
+	return res, nil
+}
+
+// The memory a batch keeps rendered pages of files it compares more than
+// once in, unless the options give a cache: about 20 pages at 300dpi
+const batchCacheBytes = 512 << 20
+
+// Compare every pair whose files both exist.  If a file is in more than one
+// pair, such as a reference every other file is compared with, pages are
+// kept in memory for the batch unless a cache is given, so that each of its
+// pages is rendered once.
+func (r *BatchResult) compare(profiles []Profile, opts []Option) {
+	var shared Cache
+	if r.recurring() {
+		shared = NewMemoryCache(batchCacheBytes)
+	}
+	for i := range r.Pairs {
+		pair := &r.Pairs[i]
+		if !pair.InDir1 || !pair.InDir2 {
+			continue
+		}
+		o := DefaultOptions()
+		if p, ok := matchProfile(profiles, pair.Path); ok {
+			pair.Preset = p.Preset.Name
+			for _, opt := range p.Preset.Options {
+				opt(&o)
+			}
+		}
+		for _, opt := range opts {
+			opt(&o)
+		}
+		if o.Cache == nil && shared != nil {
+			o.Cache = shared
+		}
+		pair.Result, pair.Err = compare(pair.File1, pair.File2, o)
+	}
+}
+
+// True if a file is in more than one of the pairs to compare
+func (r *BatchResult) recurring() bool {
+	seen := map[string]bool{}
+	for _, p := range r.Pairs {
+		if !p.InDir1 || !p.InDir2 {
+			continue
+		}
+		for _, f := range []string{filepath.Clean(p.File1), filepath.Clean(p.File2)} {
+			if seen[f] {
+				return true
+			}
+			seen[f] = true
+		}
+	}
+	return false
+}
+
+// Paths of the PDF files under dir, relative to it with / separators, sorted
+func pdfFiles(dir string) ([]string, error) {
+	var files []string
+	err := filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || !strings.EqualFold(filepath.Ext(p), ".pdf") {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+		files = append(files, filepath.ToSlash(rel))
+		return nil
+	})
+	slices.Sort(files)
+	return files, err
+}
+
+// The sorted union of two sorted lists of names
+func mergeNames(a, b []string) []string {
+	names := slices.Concat(a, b)
+	slices.Sort(names)
+	return slices.Compact(names)
+}
@@ -0,0 +1,202 @@
+package pdfcomp
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/color/palette"
+	"image/gif"
+	"image/png"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// How long each rendering is shown in blink images, in hundredths of a second
+const blinkDelay = 50
+
+// Write an animated image showing the renderings of a page in the two files
+// in turn, over and over, so that whatever moves or changes between them
+// catches the eye.  The renderings are the same size.
+func writeBlink(filename string, img1, img2 *Image, format BlinkFormat) error {
+	var buf bytes.Buffer
+	var err error
+	if format == BlinkAPNG {
+		err = encodeAPNG(&buf, img1, img2)
+	} else {
+		err = encodeBlinkGIF(&buf, img1, img2)
+	}
+	if err != nil {
+		return fmt.Errorf("error encoding %s: %w", filename, err)
+	}
+	if err := os.MkdirAll(filepath.Dir(filename), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(filename, buf.Bytes(), 0644)
+}
+
+// Encode two frames as a looping gif.  Both share one palette, so that pixels
+// the same in both renderings stay the same colour and only the differences
+// flicker: the colours of the pages if there are few enough, as there are
+// for most documents, or else a fixed palette without dithering.
+func encodeBlinkGIF(w io.Writer, img1, img2 *Image) error {
+	frames := []*Image{img1, img2}
+	pal := blinkPalette(frames)
+	// Colours already looked up in the palette
+	index := map[color.RGBA]uint8{}
+	anim := &gif.GIF{}
+	for _, frame := range frames {
+		p := image.NewPaletted(image.Rect(0, 0, frame.W, frame.H), pal)
+		for y := range frame.H {
+			row, dst := frame.Row(y), p.Pix[y*p.Stride:]
+			for x := range frame.W {
+				c := pixelColor(row, x, frame.Channels)
+				i, ok := index[c]
+				if !ok {
+					i = uint8(pal.Index(c))
+					index[c] = i
+				}
+				dst[x] = i
+			}
+		}
+		anim.Image = append(anim.Image, p)
+		anim.Delay = append(anim.Delay, blinkDelay)
+	}
+	return gif.EncodeAll(w, anim)
+}
+
+// The colours of the frames if there are no more than a gif can hold, and
+// otherwise a general purpose palette
+func blinkPalette(frames []*Image) color.Palette {
+	seen := map[color.RGBA]bool{}
+	var pal color.Palette
+	for _, frame := range frames {
+		for y := range frame.H {
+			row := frame.Row(y)
+			for x := range frame.W {
+				c := pixelColor(row, x, frame.Channels)
+				if seen[c] {
+					continue
+				}
+				if len(pal) == 256 {
+					return palette.Plan9
+				}
+				seen[c] = true
+				pal = append(pal, c)
+			}
+		}
+	}
+	return pal
+}
+
+// The colour of pixel x of a row of gray or RGB bytes
+func pixelColor(row []byte, x, channels int) color.RGBA {
+	if channels == 1 {
+		return color.RGBA{row[x], row[x], row[x], 255}
+	}
+	return color.RGBA{row[x*3], row[x*3+1], row[x*3+2], 255}
+}
+
+// Encode two frames as a looping animated png, which keeps every colour of
+// the renderings.  Each frame is encoded as a png by the standard library,
+// and its image data moved into the animation.
+func encodeAPNG(w io.Writer, img1, img2 *Image) error {
+	var ihdr []byte
+	var frames [][][]byte
+	for _, img := range []*Image{img1, img2} {
+		var buf bytes.Buffer
+		if err := png.Encode(&buf, rgbToPNG(img)); err != nil {
+			return err
+		}
+		header, data, err := pngChunks(buf.Bytes())
+		if err != nil {
+			return err
+		}
+		ihdr = header
+		frames = append(frames, data)
+	}
+
+	if _, err := io.WriteString(w, pngSignature); err != nil {
+		return err
+	}
+	chunks := []pngChunk{
+		{"IHDR", ihdr},
+		// Two frames, played forever
+		{"acTL", binary.BigEndian.AppendUint32(binary.BigEndian.AppendUint32(nil, 2), 0)},
+	}
+	var seq uint32
+	for n, data := range frames {
+		// Frame control: the sequence number, the whole image at the top
+		// left, the delay as a fraction of a second, and no disposal or
+		// blending, since each frame covers the last
+		fc := binary.BigEndian.AppendUint32(nil, seq)
+		fc = binary.BigEndian.AppendUint32(fc, uint32(img1.W))
+		fc = binary.BigEndian.AppendUint32(fc, uint32(img1.H))
+		fc = binary.BigEndian.AppendUint32(fc, 0)
+		fc = binary.BigEndian.AppendUint32(fc, 0)
+		fc = binary.BigEndian.AppendUint16(fc, blinkDelay)
+		fc = binary.BigEndian.AppendUint16(fc, 100)
+		fc = append(fc, 0, 0)
+		seq++
+		chunks = append(chunks, pngChunk{"fcTL", fc})
+		for _, d := range data {
+			if n == 0 {
+				// The first frame is also the image shown by programs that
+				// do not animate pngs
+				chunks = append(chunks, pngChunk{"IDAT", d})
+				continue
+			}
+			chunks = append(chunks, pngChunk{"fdAT", append(binary.BigEndian.AppendUint32(nil, seq), d...)})
+			seq++
+		}
+	}
+	chunks = append(chunks, pngChunk{"IEND", nil})
+	for _, c := range chunks {
+		if err := c.write(w); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+const pngSignature = "\x89PNG\r\n\x1a\n"
+
+// A chunk of a png file, by its four letter type
+type pngChunk struct {
+	kind string
+	data []byte
+}
+
+// The header and image data chunks of an encoded png
+func pngChunks(data []byte) (ihdr []byte, idat [][]byte, err error) {
+	if !bytes.HasPrefix(data, []byte(pngSignature)) {
+		return nil, nil, fmt.Errorf("not a png")
+	}
+	for rest := data[len(pngSignature):]; len(rest) >= 12; {
+		n := int(binary.BigEndian.Uint32(rest))
+		if len(rest) < 12+n {
+			return nil, nil, fmt.Errorf("truncated png chunk")
+		}
+		switch string(rest[4:8]) {
+		case "IHDR":
+			ihdr = rest[8 : 8+n]
+		case "IDAT":
+			idat = append(idat, rest[8:8+n])
+		}
+		rest = rest[12+n:]
+	}
+	return ihdr, idat, nil
+}
+
+// Write the chunk as it is stored: its length, type, data and checksum
+func (c pngChunk) write(w io.Writer) error {
+	chunk := binary.BigEndian.AppendUint32(nil, uint32(len(c.data)))
+	chunk = append(chunk, c.kind...)
+	chunk = append(chunk, c.data...)
+	chunk = binary.BigEndian.AppendUint32(chunk, crc32.ChecksumIEEE(chunk[4:]))
+	_, err := w.Write(chunk)
+	return err
+}
@@ -0,0 +1,141 @@
+package pdfcomp
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"image/color"
+	"image/color/palette"
+	"image/gif"
+	"image/png"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// Two renderings of a 3x2 page, the same but for one pixel
+func blinkFrames() (*Image, *Image) {
+	img1 := NewImage(3, 2, 3)
+	img2 := NewImage(3, 2, 3)
+	copy(img1.Row(1)[3:], []byte{200, 0, 0})
+	copy(img2.Row(1)[3:], []byte{0, 0, 200})
+	return img1, img2
+}
+
+func TestBlinkGIF(t *testing.T) {
+	img1, img2 := blinkFrames()
+	name := filepath.Join(t.TempDir(), "images", "page-1.gif")
+	if err := writeBlink(name, img1, img2, BlinkGIF); err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.Open(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	anim, err := gif.DecodeAll(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(anim.Image) != 2 {
+		t.Fatalf("%d frames, want 2", len(anim.Image))
+	}
+	if anim.LoopCount != 0 {
+		t.Errorf("loop count %d, want 0 for forever", anim.LoopCount)
+	}
+	for i, frame := range []*Image{img1, img2} {
+		if anim.Delay[i] != blinkDelay {
+			t.Errorf("frame %d shown for %d, want %d", i, anim.Delay[i], blinkDelay)
+		}
+		for y := range frame.H {
+			for x := range frame.W {
+				want := pixelColor(frame.Row(y), x, frame.Channels)
+				if got := color.RGBAModel.Convert(anim.Image[i].At(x, y)); got != want {
+					t.Errorf("frame %d pixel %d,%d is %v, want %v", i, x, y, got, want)
+				}
+			}
+		}
+	}
+	// The frames share a palette, so only the changed pixel flickers
+	for y := range img1.H {
+		for x := range img1.W {
+			same := anim.Image[0].ColorIndexAt(x, y) == anim.Image[1].ColorIndexAt(x, y)
+			if changed := x == 1 && y == 1; same == changed {
+				t.Errorf("pixel %d,%d changed %v between frames, but its palette index did not match that", x, y, changed)
+			}
+		}
+	}
+}
+
+func TestBlinkPaletteTooManyColours(t *testing.T) {
+	img := newImage(300, 1, 1)
+	for x := range img.W {
+		img.Pix[x] = byte(x % 256)
+	}
+	rgb := newImage(300, 1, 3)
+	for x := range rgb.W {
+		copy(rgb.Pix[3*x:], []byte{byte(x), byte(x / 2), 0})
+	}
+	if pal := blinkPalette([]*Image{img}); len(pal) != 256 || reflect.DeepEqual(pal, color.Palette(palette.Plan9)) {
+		t.Errorf("256 grays gave a palette of %d colours, want them all", len(pal))
+	}
+	if pal := blinkPalette([]*Image{img, rgb}); !reflect.DeepEqual(pal, color.Palette(palette.Plan9)) {
+		t.Errorf("too many colours gave a palette of %d, want the fixed palette", len(pal))
+	}
+}
+
+func TestBlinkAPNG(t *testing.T) {
+	img1, img2 := blinkFrames()
+	name := filepath.Join(t.TempDir(), "page-1.png")
+	if err := writeBlink(name, img1, img2, BlinkAPNG); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Programs that do not animate pngs show the first frame
+	still, err := png.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := color.RGBAModel.Convert(still.At(1, 1)), (color.RGBA{200, 0, 0, 255}); got != want {
+		t.Errorf("still image pixel 1,1 is %v, want %v", got, want)
+	}
+
+	var kinds []string
+	var seq []uint32
+	for rest := data[len(pngSignature):]; len(rest) > 0; {
+		n := int(binary.BigEndian.Uint32(rest))
+		kind, body := string(rest[4:8]), rest[8:8+n]
+		if sum := binary.BigEndian.Uint32(rest[8+n:]); sum != crc32.ChecksumIEEE(rest[4:8+n]) {
+			t.Errorf("%s chunk has a bad checksum", kind)
+		}
+		kinds = append(kinds, kind)
+		switch kind {
+		case "acTL":
+			if frames, plays := binary.BigEndian.Uint32(body), binary.BigEndian.Uint32(body[4:]); frames != 2 || plays != 0 {
+				t.Errorf("animation of %d frames played %d times, want 2 played forever", frames, plays)
+			}
+		case "fcTL":
+			seq = append(seq, binary.BigEndian.Uint32(body))
+			if delay := binary.BigEndian.Uint16(body[20:]); delay != blinkDelay {
+				t.Errorf("frame shown for %d, want %d", delay, blinkDelay)
+			}
+		case "fdAT":
+			seq = append(seq, binary.BigEndian.Uint32(body))
+		}
+		rest = rest[12+n:]
+	}
+	if kinds[0] != "IHDR" || kinds[1] != "acTL" || kinds[2] != "fcTL" || kinds[len(kinds)-1] != "IEND" {
+		t.Errorf("chunks %v, want IHDR, acTL and fcTL first and IEND last", kinds)
+	}
+	for i, s := range seq {
+		if s != uint32(i) {
+			t.Errorf("sequence numbers %v, want 0, 1, 2 and so on", seq)
+			break
+		}
+	}
+}
@@ -0,0 +1,20 @@
+//go:build bundled
+
+package pdfcomp
+
+import (
+	_ "embed"
+	"encoding/json"
+)
+
+// The renderer builds pinned for each platform, which a distribution fills
+// in before building with -tags bundled
+//
+//go:embed renderers.json
+var bundledPinsJSON []byte
+
+func init() {
+	if err := json.Unmarshal(bundledPinsJSON, &bundledPins); err != nil {
+		panic("pdfcomp: invalid renderers.json: " + err.Error())
+	}
+}
@@ -0,0 +1,574 @@
+package pdfcomp
+
+import (
+	"bufio"
+	"container/list"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"image"
+	"io"
+	"io/fs"
+	"net"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// A Cache keeps rendered pages and page fingerprints, so that pages seen
+// before need not be rendered again, by this process or, with a shared
+// backend, by others.  Keys are built from the checksums of the files, the
+// version of the renderer and the settings that affect the value, so entries
+// never go stale and backends may evict any of them at any time.
+// Implementations must be safe for concurrent use.
+type Cache interface {
+	// The value stored under key, if there is one.  Failures count as misses.
+	Get(key string) ([]byte, bool)
+	// Store a value.  Failures are ignored, as the value can be computed again.
+	Put(key string, value []byte)
+}
+
+// Keeps values in memory, evicting the least recently used once they take up
+// more than a given number of bytes
+type MemoryCache struct {
+	mu       sync.Mutex
+	maxBytes int64
+	size     int64
+	order    *list.List
+	entries  map[string]*list.Element
+}
+
+type memoryEntry struct {
+	key   string
+	value []byte
+}
+
+// A memory cache holding at most maxBytes of values.  A page rendered at
+// 300dpi takes about 26MB.
+func NewMemoryCache(maxBytes int64) *MemoryCache {
+	return &MemoryCache{maxBytes: maxBytes, order: list.New(), entries: map[string]*list.Element{}}
+}
+
+func (c *MemoryCache) Get(key string) ([]byte, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	c.order.MoveToFront(e)
+	return e.Value.(*memoryEntry).value, true
+}
+
+func (c *MemoryCache) Put(key string, value []byte) {
+	if int64(len(value)) > c.maxBytes {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if e, ok := c.entries[key]; ok {
+		c.size -= int64(len(e.Value.(*memoryEntry).value))
+		c.order.Remove(e)
+	}
+	c.entries[key] = c.order.PushFront(&memoryEntry{key, value})
+	c.size += int64(len(value))
+	for c.size > c.maxBytes {
+		oldest := c.order.Back()
+		entry := oldest.Value.(*memoryEntry)
+		c.order.Remove(oldest)
+		delete(c.entries, entry.key)
+		c.size -= int64(len(entry.value))
+	}
+}
+
+// Keeps values in a fast cache in front of a slow one, such as a MemoryCache
+// in front of a DiskCache or RedisCache.  Values found only in the slow cache
+// are copied into the fast one.
+type TieredCache struct {
+	fast, slow Cache
+}
+
+func NewTieredCache(fast, slow Cache) *TieredCache {
+	return &TieredCache{fast: fast, slow: slow}
+}
+
+func (c *TieredCache) Get(key string) ([]byte, bool) {
+	if value, ok := c.fast.Get(key); ok {
+		return value, true
+	}
+	value, ok := c.slow.Get(key)
+	if ok {
+		c.fast.Put(key, value)
+	}
+	return value, ok
+}
+
+func (c *TieredCache) Put(key string, value []byte) {
+	c.fast.Put(key, value)
+	c.slow.Put(key, value)
+}
+
+// Keeps values as files in a directory, which processes on the same machine,
+// or sharing a file system, can use together.  Unless it was given a size,
+// nothing is ever evicted, but the directory can be cleared at any time.
+type DiskCache struct {
+	dir string
+	// The most the files may take up, or zero for no limit
+	maxBytes int64
+
+	mu sync.Mutex
+	// What the files take up, as last counted and added to since, or -1 if
+	// they have not been counted yet
+	size int64
+}
+
+func NewDiskCache(dir string) *DiskCache {
+	return &DiskCache{dir: dir}
+}
+
+// A disk cache whose files take up at most about maxBytes, evicting those
+// least recently used once they take up more.  Other processes sharing the
+// directory are only seen when the files are counted, so together they may
+// go over the limit until one of them next evicts.
+func NewBoundedDiskCache(dir string, maxBytes int64) *DiskCache {
+	return &DiskCache{dir: dir, maxBytes: maxBytes, size: -1}
+}
+
+// Eviction removes files until they take up no more than this fraction of
+// the limit, so that the directory is not counted again on every Put
+const diskCacheLowWater = 0.9
+
+// Keys may hold any characters, so files are named by a hash of the key
+func (c *DiskCache) path(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	name := hex.EncodeToString(sum[:])
+	return filepath.Join(c.dir, name[:2], name)
+}
+
+func (c *DiskCache) Get(key string) ([]byte, bool) {
+	name := c.path(key)
+	data, err := os.ReadFile(name)
+	if err == nil && c.maxBytes > 0 {
+		// Files are evicted oldest first, so a file read is made new again
+		now := time.Now()
+		os.Chtimes(name, now, now)
+	}
+	return data, err == nil
+}
+
+func (c *DiskCache) Put(key string, value []byte) {
+	if c.maxBytes > 0 && int64(len(value)) > c.maxBytes {
+		return
+	}
+	name := c.path(key)
+	if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+		return
+	}
+	// Written under another name and renamed, so that other processes never
+	// read part of a value
+	f, err := os.CreateTemp(filepath.Dir(name), ".tmp-*")
+	if err != nil {
+		return
+	}
+	_, err = f.Write(value)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), name)
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return
+	}
+	if c.maxBytes > 0 {
+		c.added(int64(len(value)))
+	}
+}
+
+// Count a file added, evicting files least recently used if they then take
+// up more than the limit
+func (c *DiskCache) added(n int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.size >= 0 {
+		c.size += n
+		if c.size <= c.maxBytes {
+			return
+		}
+	}
+	type cached struct {
+		path    string
+		size    int64
+		modTime time.Time
+	}
+	var files []cached
+	var total int64
+	filepath.WalkDir(c.dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() || strings.HasPrefix(d.Name(), ".tmp-") {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+		files = append(files, cached{path, info.Size(), info.ModTime()})
+		total += info.Size()
+		return nil
+	})
+	if total > c.maxBytes {
+		slices.SortFunc(files, func(a, b cached) int { return a.modTime.Compare(b.modTime) })
+		lowWater := int64(float64(c.maxBytes) * diskCacheLowWater)
+		for _, f := range files {
+			if total <= lowWater {
+				break
+			}
+			if err := os.Remove(f.path); err == nil || errors.Is(err, fs.ErrNotExist) {
+				total -= f.size
+			}
+		}
+		log().Debug("disk cache evicted", "dir", c.dir, "bytes", total)
+	}
+	c.size = total
+}
+
+// Keeps values in a Redis server, so that processes on different machines can
+// share them.  Speaks just enough of the Redis protocol for AUTH, SELECT, GET
+// and SET, over one connection at a time, which is reopened if it fails.
+// Connections are not encrypted.
+type RedisCache struct {
+	addr string
+	// Sent with AUTH on connecting if password is not empty, and the
+	// database chosen with SELECT if it is not 0
+	user, password string
+	db             int
+	// Why the address given could not be used, returned by every command
+	err error
+	// Prepended to every key, to keep them apart from other users of the server
+	prefix string
+	// How long values are kept, or zero to leave eviction to the server
+	ttl time.Duration
+
+	mu   sync.Mutex
+	conn net.Conn
+	rd   *bufio.Reader
+}
+
+// A cache in the Redis server at addr, keeping values for ttl.  addr is
+// host:port, or a URL such as redis://:password@host:port/2 for a server that
+// needs a password, or a user and password, and to use a database other than
+// 0.
+func NewRedisCache(addr string, ttl time.Duration) *RedisCache {
+	c := &RedisCache{addr: addr, prefix: "pdfcomp:", ttl: ttl}
+	if !strings.HasPrefix(addr, "redis://") {
+		return c
+	}
+	// The address is logged, so it must not hold the password
+	c.addr = ""
+	u, err := url.Parse(addr)
+	if err != nil {
+		// Nor may the error, which quotes the URL
+		var uerr *url.Error
+		if errors.As(err, &uerr) {
+			err = uerr.Err
+		}
+		c.err = fmt.Errorf("invalid redis URL: %w", err)
+		return c
+	}
+	c.addr = u.Host
+	if u.Port() == "" {
+		c.addr = net.JoinHostPort(u.Hostname(), "6379")
+	}
+	if u.User != nil {
+		c.user = u.User.Username()
+		c.password, _ = u.User.Password()
+	}
+	if db := strings.Trim(u.Path, "/"); db != "" {
+		if c.db, err = strconv.Atoi(db); err != nil || c.db < 0 {
+			c.err = fmt.Errorf("invalid redis database %q in %s", db, u.Redacted())
+		}
+	}
+	return c
+}
+
+// Redis connections are not waited on for longer than this
+const redisTimeout = 5 * time.Second
+
+func (c *RedisCache) Get(key string) ([]byte, bool) {
+	reply, err := c.do("GET", c.prefix+key)
+	if err != nil {
+		log().Warn("redis cache get failed", "addr", c.addr, "err", err)
+		return nil, false
+	}
+	return reply, reply != nil
+}
+
+func (c *RedisCache) Put(key string, value []byte) {
+	args := []string{"SET", c.prefix + key, string(value)}
+	if c.ttl > 0 {
+		args = append(args, "PX", strconv.FormatInt(c.ttl.Milliseconds(), 10))
+	}
+	if _, err := c.do(args...); err != nil {
+		log().Warn("redis cache put failed", "addr", c.addr, "err", err)
+	}
+}
+
+// Send a command and read its reply, which is nil for a missing value
+func (c *RedisCache) do(args ...string) ([]byte, error) {
+	if c.err != nil {
+		return nil, c.err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.conn == nil {
+		if err := c.connect(); err != nil {
+			return nil, err
+		}
+	}
+	c.conn.SetDeadline(time.Now().Add(redisTimeout))
+	reply, err := c.roundTrip(args)
+	if err != nil {
+		// The connection may be part way through a reply, so start afresh
+		c.conn.Close()
+		c.conn = nil
+	}
+	return reply, err
+}
+
+// Open a connection, logging in and choosing the database if need be.  Must be
+// called with c.mu held.
+func (c *RedisCache) connect() error {
+	conn, err := net.DialTimeout("tcp", c.addr, redisTimeout)
+	if err != nil {
+		return err
+	}
+	c.conn, c.rd = conn, bufio.NewReader(conn)
+	c.conn.SetDeadline(time.Now().Add(redisTimeout))
+	var setup [][]string
+	switch {
+	case c.user != "":
+		setup = append(setup, []string{"AUTH", c.user, c.password})
+	case c.password != "":
+		setup = append(setup, []string{"AUTH", c.password})
+	}
+	if c.db != 0 {
+		setup = append(setup, []string{"SELECT", strconv.Itoa(c.db)})
+	}
+	for _, args := range setup {
+		if _, err := c.roundTrip(args); err != nil {
+			c.conn.Close()
+			c.conn = nil
+			return fmt.Errorf("redis %s: %w", args[0], err)
+		}
+	}
+	return nil
+}
+
+func (c *RedisCache) roundTrip(args []string) ([]byte, error) {
+	w := bufio.NewWriter(c.conn)
+	fmt.Fprintf(w, "*%d\r\n", len(args))
+	for _, a := range args {
+		fmt.Fprintf(w, "$%d\r\n%s\r\n", len(a), a)
+	}
+	if err := w.Flush(); err != nil {
+		return nil, err
+	}
+	line, err := c.rd.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	if len(line) < 3 {
+		return nil, errors.New("short reply from redis")
+	}
+	body := line[1 : len(line)-2]
+	switch line[0] {
+	case '+':
+		return []byte(body), nil
+	case '-':
+		return nil, errors.New("redis: " + body)
+	case '$':
+		n, err := strconv.Atoi(body)
+		if err != nil {
+			return nil, err
+		}
+		if n < 0 {
+			return nil, nil
+		}
+		data := make([]byte, n+2)
+		if _, err := io.ReadFull(c.rd, data); err != nil {
+			return nil, err
+		}
+		return data[:n], nil
+	}
+	return nil, fmt.Errorf("unexpected reply from redis: %q", line)
+}
+
+// Cache key of a rendered page
+func rasterKey(checksum string, o Options, page int) string {
+	key := fmt.Sprintf("raster/%s/%s/%d/%d", rendererKey(), checksum, o.Resolution, page)
+	if o.Color != ColorRGB {
+		key += "/" + string(o.Color)
+	}
+	if len(o.LayerVisibility) > 0 {
+		key += "/" + layerKey(o.LayerVisibility)
+	}
+	if len(o.RendererArgs) > 0 {
+		key += "/" + strings.Join(o.RendererArgs, " ")
+	}
+	return key
+}
+
+// Cache key of a page fingerprint
+func fingerprintKey(checksum string, fp Fingerprinter, resolution, page int) string {
+	return fmt.Sprintf("fingerprint/%s/%s/%s/%d/%d", fp.Name(), rendererKey(), checksum, resolution, page)
+}
+
+// The version of each renderer command, as rendererKey found it
+var rendererVersions sync.Map
+
+// The renderer as it is named in cache keys: the first line pdftoppm -v
+// prints, such as "pdftoppm version 24.02.0", so that pages one version
+// rendered are not used for another, or the command if it prints nothing.
+// Found once for each command.
+func rendererKey() string {
+	cmd := pdftoppmCommand()
+	if v, ok := rendererVersions.Load(cmd); ok {
+		return v.(string)
+	}
+	version := cmd
+	out, _ := exec.Command(cmd, "-v").CombinedOutput()
+	if line, _, _ := strings.Cut(strings.TrimSpace(string(out)), "\n"); line != "" {
+		version = line
+	}
+	v, _ := rendererVersions.LoadOrStore(cmd, version)
+	return v.(string)
+}
+
+// Pages being rendered into a cache, each closing its channel once done, so
+// that comparisons running at the same time that need the same page, such as
+// a batch or server comparing many files with one reference, render it once
+var rendering = struct {
+	sync.Mutex
+	pages map[string]chan struct{}
+}{pages: map[string]chan struct{}{}}
+
+// Layer visibility as a string that is the same for the same settings
+func layerKey(visibility map[string]bool) string {
+	return fmt.Sprint(visibility)
+}
+
+// Serves pages from a cache, rendering and storing those it does not have
+type cachedSource struct {
+	pageSource
+	cache    Cache
+	checksum string
+	o        Options
+	// The pixel size pages are rendered at instead of the resolution, if any
+	scaleTo func(page int) image.Point
+	// Renderer messages for the last page, which are cached with it
+	stderr string
+}
+
+func (s *cachedSource) page(n int) (*Image, error) {
+	key := rasterKey(s.checksum, s.o, n)
+	if s.scaleTo != nil {
+		if size := s.scaleTo(n); size != (image.Point{}) {
+			key += fmt.Sprintf("/%dx%d", size.X, size.Y)
+		}
+	}
+	if img, ok := s.cached(key); ok {
+		return img, nil
+	}
+	// Wait for anyone already rendering the page, and look again once they
+	// are done, since the cache may not have kept it
+	var done chan struct{}
+	for {
+		rendering.Lock()
+		wait, busy := rendering.pages[key]
+		if !busy {
+			done = make(chan struct{})
+			rendering.pages[key] = done
+			rendering.Unlock()
+			break
+		}
+		rendering.Unlock()
+		<-wait
+		if img, ok := s.cached(key); ok {
+			return img, nil
+		}
+	}
+	defer func() {
+		rendering.Lock()
+		delete(rendering.pages, key)
+		rendering.Unlock()
+		close(done)
+	}()
+
+	img, err := s.pageSource.page(n)
+	s.stderr = s.pageSource.messages()
+	if err != nil {
+		return nil, err
+	}
+	s.cache.Put(key, encodeRaster(img, s.stderr))
+	return img, nil
+}
+
+// The page stored under key, if the cache has it
+func (s *cachedSource) cached(key string) (*Image, bool) {
+	data, ok := s.cache.Get(key)
+	if !ok {
+		return nil, false
+	}
+	img, stderr, err := decodeRaster(data, s.o.Color.channels())
+	if err != nil {
+		return nil, false
+	}
+	s.stderr = stderr
+	return img, true
+}
+
+func (s *cachedSource) messages() string {
+	return s.stderr
+}
+
+// Encode a rendered page and the renderer's messages as its height, width and
+// the length of the messages, followed by the messages and the pixels
+func encodeRaster(img *Image, stderr string) []byte {
+	data := make([]byte, 12, 12+len(stderr)+img.H*img.W*img.Channels)
+	binary.BigEndian.PutUint32(data, uint32(img.H))
+	binary.BigEndian.PutUint32(data[4:], uint32(img.W))
+	binary.BigEndian.PutUint32(data[8:], uint32(len(stderr)))
+	data = append(data, stderr...)
+	for y := range img.H {
+		data = append(data, img.Row(y)...)
+	}
+	return data
+}
+
+// Decode a page encoded by encodeRaster as an image of channels bytes to a
+// pixel, with the renderer's messages
+func decodeRaster(data []byte, channels int) (*Image, string, error) {
+	if len(data) < 12 {
+		return nil, "", errors.New("cached page too short")
+	}
+	height := int(binary.BigEndian.Uint32(data))
+	width := int(binary.BigEndian.Uint32(data[4:]))
+	n := int(binary.BigEndian.Uint32(data[8:]))
+	data = data[12:]
+	if n > len(data) || len(data)-n != height*width*channels {
+		return nil, "", errors.New("cached page has the wrong size")
+	}
+	stderr := string(data[:n])
+	// Copied, since the comparison may change the pixels in place
+	pix := getPix(height * width * channels)
+	copy(pix, data[n:])
+	return &Image{Pix: pix, Stride: width * channels, W: width, H: height, Channels: channels}, stderr, nil
+}
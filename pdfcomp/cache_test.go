@@ -0,0 +1,189 @@
+package pdfcomp
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Just enough of a Redis server to answer RedisCache, which records the
+// commands it is sent and requires AUTH with password if it is not empty
+type fakeRedis struct {
+	password string
+
+	mu       sync.Mutex
+	commands []string
+	values   map[string]string
+}
+
+// Serve connections on a new port until the test ends, returning its address
+func (s *fakeRedis) start(t *testing.T) string {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+	s.values = map[string]string{}
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+	return l.Addr().String()
+}
+
+func (s *fakeRedis) serve(conn net.Conn) {
+	defer conn.Close()
+	rd := bufio.NewReader(conn)
+	authed := s.password == ""
+	for {
+		args, err := readCommand(rd)
+		if err != nil {
+			return
+		}
+		s.mu.Lock()
+		s.commands = append(s.commands, strings.Join(args, " "))
+		reply := "+OK\r\n"
+		switch {
+		case args[0] == "AUTH":
+			if authed = args[len(args)-1] == s.password; !authed {
+				reply = "-WRONGPASS invalid password\r\n"
+			}
+		case !authed:
+			reply = "-NOAUTH Authentication required.\r\n"
+		case args[0] == "GET":
+			if v, ok := s.values[args[1]]; ok {
+				reply = fmt.Sprintf("$%d\r\n%s\r\n", len(v), v)
+			} else {
+				reply = "$-1\r\n"
+			}
+		case args[0] == "SET":
+			s.values[args[1]] = args[2]
+		}
+		s.mu.Unlock()
+		io.WriteString(conn, reply)
+	}
+}
+
+// Read a command sent as an array of bulk strings
+func readCommand(rd *bufio.Reader) ([]string, error) {
+	line, err := rd.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(strings.TrimPrefix(line, "*")))
+	if err != nil {
+		return nil, err
+	}
+	args := make([]string, n)
+	for i := range args {
+		line, err := rd.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		size, err := strconv.Atoi(strings.TrimSpace(strings.TrimPrefix(line, "$")))
+		if err != nil {
+			return nil, err
+		}
+		data := make([]byte, size+2)
+		if _, err := io.ReadFull(rd, data); err != nil {
+			return nil, err
+		}
+		args[i] = string(data[:size])
+	}
+	return args, nil
+}
+
+func (s *fakeRedis) sent() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.commands...)
+}
+
+func TestRedisCache(t *testing.T) {
+	tests := []struct {
+		name     string
+		password string
+		// The address given, with %s for the server's host:port
+		addr string
+		// The commands sent before GET
+		setup []string
+	}{
+		{"host and port", "", "%s", nil},
+		{"url", "", "redis://%s", nil},
+		{"password", "secret", "redis://:secret@%s", []string{"AUTH secret"}},
+		{"user and password", "secret", "redis://cache:secret@%s", []string{"AUTH cache secret"}},
+		{"database", "", "redis://%s/2", []string{"SELECT 2"}},
+		{"password and database", "secret", "redis://:secret@%s/3", []string{"AUTH secret", "SELECT 3"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &fakeRedis{password: tt.password}
+			c := NewRedisCache(fmt.Sprintf(tt.addr, s.start(t)), time.Hour)
+			if _, ok := c.Get("missing"); ok {
+				t.Error("found a value never put")
+			}
+			c.Put("page", []byte("pixels"))
+			if v, ok := c.Get("page"); !ok || string(v) != "pixels" {
+				t.Errorf("got %q, %v, want the value put", v, ok)
+			}
+			want := append(append([]string(nil), tt.setup...), "GET pdfcomp:missing", "SET pdfcomp:page pixels PX 3600000", "GET pdfcomp:page")
+			if got := s.sent(); strings.Join(got, "\n") != strings.Join(want, "\n") {
+				t.Errorf("sent %q, want %q", got, want)
+			}
+		})
+	}
+}
+
+func TestRedisCacheReconnects(t *testing.T) {
+	s := &fakeRedis{password: "secret"}
+	c := NewRedisCache("redis://:secret@"+s.start(t)+"/1", 0)
+	c.Put("a", []byte("1"))
+	// The server drops the connection, and the next command logs in again
+	c.mu.Lock()
+	c.conn.Close()
+	c.mu.Unlock()
+	if _, ok := c.Get("a"); ok {
+		t.Error("got a value over a closed connection")
+	}
+	if v, ok := c.Get("a"); !ok || string(v) != "1" {
+		t.Errorf("got %q, %v after reconnecting, want the value put", v, ok)
+	}
+	want := []string{"AUTH secret", "SELECT 1", "SET pdfcomp:a 1", "AUTH secret", "SELECT 1", "GET pdfcomp:a"}
+	if got := s.sent(); strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("sent %q, want %q", got, want)
+	}
+}
+
+func TestRedisCacheBadAddress(t *testing.T) {
+	for _, addr := range []string{"redis://:secret@cache:6379/x", "redis://:secret@cache:port"} {
+		c := NewRedisCache(addr, 0)
+		_, err := c.do("GET", "a")
+		if err == nil {
+			t.Errorf("%s: no error", addr)
+			continue
+		}
+		if strings.Contains(err.Error(), "secret") || strings.Contains(c.addr, "secret") {
+			t.Errorf("%s: the password is given away by %q or %q", addr, err, c.addr)
+		}
+	}
+}
+
+func TestRedisCacheWrongPassword(t *testing.T) {
+	s := &fakeRedis{password: "secret"}
+	c := NewRedisCache("redis://:guess@"+s.start(t), 0)
+	if _, err := c.do("GET", "a"); err == nil || !strings.Contains(err.Error(), "WRONGPASS") {
+		t.Errorf("got %v, want the server's refusal", err)
+	}
+}
@@ -0,0 +1,35 @@
+package pdfcomp
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"os"
+)
+
+// Compute the hex encoded sha256 checksum of a file's contents
+func Checksum(filename string) (string, error) {
+	return ChecksumParts([]string{filename})
+}
+
+// Compute the hex encoded sha256 checksum of the contents of several files
+// one after another, as of a document split across them
+func ChecksumParts(filenames []string) (string, error) {
+	h := sha256.New()
+	for _, filename := range filenames {
+		if err := hashFile(h, filename); err != nil {
+			return "", err
+		}
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+func hashFile(w io.Writer, filename string) error {
+	f, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = io.Copy(w, f)
+	return err
+}
@@ -0,0 +1,179 @@
+package pdfcomp
+
+import (
+	"bytes"
+	"slices"
+
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/model"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/types"
+)
+
+// The probable cause of the differences on a page, guessed from the pattern
+// of the differences and what the files hold, so that reviewers can tell at
+// a glance which pages need a closer look
+type DiffCause string
+
+const (
+	// The words on the page changed, or nothing else explains the difference
+	CauseContentEdit DiffCause = "content edit"
+	// The page uses different fonts, or the renderer substituted a font in
+	// one file but not the other, with the same words
+	CauseFontSubstitution DiffCause = "font substitution"
+	// The content moved, and lining the pages up removes most of the
+	// difference
+	CauseLayoutShift DiffCause = "layout shift"
+	// The page's images are the same size but were encoded differently
+	CauseImageRecompression DiffCause = "image recompression"
+	// The colours changed slightly and evenly, as converting them through a
+	// different colour profile does, without the shapes on the page changing
+	CauseColorProfile DiffCause = "color profile change"
+)
+
+// Differences that a shift of the page reduces to no more than this fraction
+// of what they were are put down to the shift
+const shiftExplained = 0.1
+
+// Differing pixels whose lightness changes by no more than this, out of 255,
+// are faint enough to be a change of colour profile
+const faintLightness = 24
+
+// Guess why a page differs, from its text, fonts and images in each file and
+// the pattern of the differences between its renderings, taking the first of
+// content edit, font substitution, layout shift, image recompression and
+// colour profile change that fits
+func classifyDiff(ctx1, ctx2 *model.Context, st *PageState, fonts *FontSubstitution, dpi float64) DiffCause {
+	words1, err1 := pageWords(ctx1, st.Page)
+	words2, err2 := pageWords(ctx2, st.Page)
+	if err1 == nil && err2 == nil && !slices.Equal(words1, words2) {
+		return CauseContentEdit
+	}
+	if fonts.differs() || !slices.Equal(pageFontNames(ctx1, st.Page), pageFontNames(ctx2, st.Page)) {
+		return CauseFontSubstitution
+	}
+	if shiftExplains(st.Image1, st.Image2, st.Diff, dpi) {
+		return CauseLayoutShift
+	}
+	if recompressedImages(ctx1, ctx2, st.Page) {
+		return CauseImageRecompression
+	}
+	if faintDiff(st.Image1, st.Image2, st.Diff) {
+		return CauseColorProfile
+	}
+	return CauseContentEdit
+}
+
+// True if lining img2 up with img1 removes most of their differences
+func shiftExplains(img1, img2, diff *Image, dpi float64) bool {
+	before, _ := diffArea(diff)
+	if before == 0 {
+		return false
+	}
+	shifted, off := alignPages(img1, img2, dpi)
+	if off == nil {
+		return false
+	}
+	after, err := diffMatrix(img1, shifted)
+	if err != nil {
+		return false
+	}
+	pixels, _ := diffArea(after)
+	return float64(pixels) <= float64(before)*shiftExplained
+}
+
+// True if nearly every differing pixel keeps close to its lightness, so that
+// only the colours changed
+func faintDiff(img1, img2, diff *Image) bool {
+	differing, faint := 0, 0
+	for y := range diff.H {
+		row1, row2 := img1.Row(y), img2.Row(y)
+		for x, d := range diff.Row(y) {
+			if d == 0 {
+				continue
+			}
+			differing++
+			if abs(lightness(row1, x, img1.Channels)-lightness(row2, x, img2.Channels)) <= faintLightness {
+				faint++
+			}
+		}
+	}
+	return differing > 0 && faint*20 >= differing*19
+}
+
+// The lightness of pixel x of a row, from 0 for black to 255 for white
+func lightness(row []byte, x, channels int) int {
+	if channels == 1 {
+		return int(row[x])
+	}
+	i := x * 3
+	return (299*int(row[i]) + 587*int(row[i+1]) + 114*int(row[i+2])) / 1000
+}
+
+// The resources of a page, its own or those it inherits
+func pageResources(ctx *model.Context, page int) types.Dict {
+	d, _, inh, err := ctx.PageDict(page, false)
+	if err != nil || d == nil {
+		return nil
+	}
+	if res, ok := dictEntry(ctx, d, "Resources").(types.Dict); ok {
+		return res
+	}
+	if inh != nil {
+		return inh.Resources
+	}
+	return nil
+}
+
+// The base names of the fonts a page uses, sorted
+func pageFontNames(ctx *model.Context, page int) []string {
+	fonts, _ := dictEntry(ctx, pageResources(ctx, page), "Font").(types.Dict)
+	var names []string
+	for _, name := range sortedKeys(fonts) {
+		font, _ := dictEntry(ctx, fonts, name).(types.Dict)
+		if base, ok := dictEntry(ctx, font, "BaseFont").(types.Name); ok {
+			names = append(names, fontName(base.Value()))
+		}
+	}
+	slices.Sort(names)
+	return names
+}
+
+// The image XObjects of a page, in name order
+func imageStreams(ctx *model.Context, page int) []*types.StreamDict {
+	images, err := pageImages(ctx, page)
+	if err != nil {
+		return nil
+	}
+	xobjs, _ := dictEntry(ctx, pageResources(ctx, page), "XObject").(types.Dict)
+	var streams []*types.StreamDict
+	for _, name := range sortedKeys(xobjs) {
+		if !images[name] {
+			continue
+		}
+		if sd, _, err := ctx.DereferenceStreamDict(xobjs[name]); err == nil && sd != nil {
+			streams = append(streams, sd)
+		}
+	}
+	return streams
+}
+
+// True if a page has the same number of images in each file, each the same
+// size as its counterpart, and at least one is encoded differently
+func recompressedImages(ctx1, ctx2 *model.Context, page int) bool {
+	images1, images2 := imageStreams(ctx1, page), imageStreams(ctx2, page)
+	if len(images1) == 0 || len(images1) != len(images2) {
+		return false
+	}
+	changed := false
+	for i, sd1 := range images1 {
+		sd2 := images2[i]
+		w1, h1 := sd1.IntEntry("Width"), sd1.IntEntry("Height")
+		w2, h2 := sd2.IntEntry("Width"), sd2.IntEntry("Height")
+		if w1 == nil || h1 == nil || w2 == nil || h2 == nil || *w1 != *w2 || *h1 != *h2 {
+			return false
+		}
+		if !bytes.Equal(sd1.Raw, sd2.Raw) {
+			changed = true
+		}
+	}
+	return changed
+}
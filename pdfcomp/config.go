@@ -0,0 +1,537 @@
+package pdfcomp
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+// A declarative description of a comparison: how pages are rendered, what
+// counts as a difference, which areas are masked, which reports are written
+// and where rendered pages are kept.  Keys are the command line flag names,
+// so a .pdfcomp.yaml file can be read with LoadConfig, and FromConfig builds
+// a Comparer that behaves as the command line does.  Zero values leave the
+// default, or the preset's setting, in place.
+type Config struct {
+	// Applied before everything else: strict, print or screen
+	Preset string `yaml:"preset"`
+
+	// Rendering
+	Resolution       int             `yaml:"resolution"`
+	ColorMode        string          `yaml:"color-mode"`
+	RenderFormat     string          `yaml:"render-format"`
+	RendererArg      []string        `yaml:"renderer-arg"`
+	RenderToDisk     bool            `yaml:"render-to-disk"`
+	RenderTimeout    string          `yaml:"render-timeout"`
+	SingleProcess    bool            `yaml:"single-process"`
+	Layer            map[string]bool `yaml:"layer"`
+	RenderCPUSeconds int             `yaml:"render-cpu-seconds"`
+	RenderMemoryMB   int64           `yaml:"render-memory-mb"`
+	RenderOutputMB   int64           `yaml:"render-output-mb"`
+	MemoryMB         int64           `yaml:"memory-mb"`
+
+	// What counts as a difference, and what else is compared
+	Tolerance        int     `yaml:"tolerance"`
+	DeltaE           float64 `yaml:"delta-e"`
+	MaxDiffPercent   float64 `yaml:"max-diff-percent"`
+	Rescale          bool    `yaml:"rescale"`
+	CompareRotation  bool    `yaml:"compare-rotation"`
+	MatchSize        bool    `yaml:"match-size"`
+	CropToContent    bool    `yaml:"crop-to-content"`
+	Fit              string  `yaml:"fit"`
+	Align            bool    `yaml:"align"`
+	ContentShortcut  bool    `yaml:"content-shortcut"`
+	ContentPrecision *int    `yaml:"content-precision"`
+	Prescreen        int     `yaml:"prescreen"`
+	Sample           int     `yaml:"sample"`
+	SampleMethod     string  `yaml:"sample-method"`
+	Seed             uint64  `yaml:"seed"`
+	StopAfter        int     `yaml:"stop-after"`
+	MaxPages         int     `yaml:"max-pages"`
+	FailFast         *bool   `yaml:"fail-fast"`
+	Annotations      *bool   `yaml:"annotations"`
+	Signatures       bool    `yaml:"signatures"`
+	Fonts            bool    `yaml:"fonts"`
+	Classify         bool    `yaml:"classify"`
+	Layers           bool    `yaml:"layers"`
+	PageLabels       bool    `yaml:"page-labels"`
+	Links            bool    `yaml:"links"`
+	Portfolios       bool    `yaml:"portfolios"`
+
+	// Areas left out: regions as [page:]x,y,width,height in points, the
+	// areas of signatures, and the regions accepted in a review file
+	Ignore         []string `yaml:"ignore"`
+	MaskSignatures bool     `yaml:"mask-signatures"`
+	Review         string   `yaml:"review"`
+
+	// Reports
+	Ratio            int      `yaml:"ratio"`
+	DiffStyle        string   `yaml:"diff-style"`
+	Layout           string   `yaml:"layout"`
+	HighlightColor   string   `yaml:"highlight-color"`
+	HighlightOpacity *float64 `yaml:"highlight-opacity"`
+	HighlightStyle   string   `yaml:"highlight-style"`
+	HighlightGraded  bool     `yaml:"highlight-graded"`
+	Grid             float64  `yaml:"grid"`
+	GridUnit         string   `yaml:"grid-unit"`
+	DetailZoom       float64  `yaml:"detail-zoom"`
+	DetailMargin     *float64 `yaml:"detail-margin"`
+	JoinDirection    string   `yaml:"join-direction"`
+	JoinAlign        string   `yaml:"join-align"`
+	JoinBackground   string   `yaml:"join-background"`
+	Images           bool     `yaml:"images"`
+	Blink            string   `yaml:"blink"`
+	AnnotateCopies   bool     `yaml:"annotate-copies"`
+	PDF              bool     `yaml:"pdf"`
+	PDFOut           string   `yaml:"pdf-out"`
+	HTML             bool     `yaml:"html"`
+	OutDir           string   `yaml:"out-dir"`
+	NameTemplate     string   `yaml:"name-template"`
+	MaxArtifactBytes int      `yaml:"max-artifact-bytes"`
+	AuditLog         string   `yaml:"audit-log"`
+	Operator         string   `yaml:"operator"`
+
+	// Storage
+	CacheDir   string `yaml:"cache-dir"`
+	CacheDirMB int64  `yaml:"cache-dir-mb"`
+	CacheMB    int64  `yaml:"cache-mb"`
+	ResumeDir  string `yaml:"resume-dir"`
+}
+
+// Memory caches made for configs, one for each size, so that every comparer
+// built from a config with the same size in this process shares one, as the
+// comparisons a server runs do
+var configCaches = struct {
+	sync.Mutex
+	caches map[int64]*MemoryCache
+}{caches: map[int64]*MemoryCache{}}
+
+func configCache(maxBytes int64) *MemoryCache {
+	configCaches.Lock()
+	defer configCaches.Unlock()
+	c, ok := configCaches.caches[maxBytes]
+	if !ok {
+		c = NewMemoryCache(maxBytes)
+		configCaches.caches[maxBytes] = c
+	}
+	return c
+}
+
+// Disk caches made for configs with a size, one for each directory, so that
+// the comparisons of a process count what they add to the directory together
+var configDiskCaches = struct {
+	sync.Mutex
+	caches map[string]*DiskCache
+}{caches: map[string]*DiskCache{}}
+
+func configDiskCache(dir string, maxBytes int64) *DiskCache {
+	if maxBytes == 0 {
+		return NewDiskCache(dir)
+	}
+	configDiskCaches.Lock()
+	defer configDiskCaches.Unlock()
+	c, ok := configDiskCaches.caches[dir]
+	if !ok || c.maxBytes != maxBytes {
+		c = NewBoundedDiskCache(dir, maxBytes)
+		configDiskCaches.caches[dir] = c
+	}
+	return c
+}
+
+// Read a config from a yaml file whose keys are flag names, such as
+// .pdfcomp.yaml.  Unknown keys are an error.
+func LoadConfig(filename string) (Config, error) {
+	var cfg Config
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return cfg, err
+	}
+	if err := yaml.UnmarshalStrict(data, &cfg); err != nil {
+		return cfg, fmt.Errorf("error reading %s: %w", filename, err)
+	}
+	return cfg, nil
+}
+
+// Set one setting by its key, from its value as text, as a command line flag
+// would be.  Lists are appended to, and layers are given as name=on or
+// name=off.
+func (c *Config) Set(key, value string) error {
+	v := reflect.ValueOf(c).Elem()
+	t := v.Type()
+	for i := range t.NumField() {
+		if t.Field(i).Tag.Get("yaml") != key {
+			continue
+		}
+		if err := setField(v.Field(i), value); err != nil {
+			return fmt.Errorf("invalid %s %q", key, value)
+		}
+		return nil
+	}
+	return fmt.Errorf("unknown setting %q", key)
+}
+
+func setField(f reflect.Value, value string) error {
+	if f.Kind() == reflect.Pointer {
+		p := reflect.New(f.Type().Elem())
+		if err := setField(p.Elem(), value); err != nil {
+			return err
+		}
+		f.Set(p)
+		return nil
+	}
+	switch f.Kind() {
+	case reflect.String:
+		f.SetString(value)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+		f.SetBool(b)
+	case reflect.Int, reflect.Int64:
+		n, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return err
+		}
+		f.SetInt(n)
+	case reflect.Uint64:
+		n, err := strconv.ParseUint(value, 10, 64)
+		if err != nil {
+			return err
+		}
+		f.SetUint(n)
+	case reflect.Float64:
+		x, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return err
+		}
+		f.SetFloat(x)
+	case reflect.Slice:
+		f.Set(reflect.Append(f, reflect.ValueOf(value)))
+	case reflect.Map:
+		// Layer names may themselves hold an =
+		i := strings.LastIndex(value, "=")
+		if i < 0 {
+			return fmt.Errorf("expected name=on or name=off")
+		}
+		name, state := value[:i], value[i+1:]
+		if state != "on" && state != "off" {
+			return fmt.Errorf("expected name=on or name=off")
+		}
+		if f.IsNil() {
+			f.Set(reflect.MakeMap(f.Type()))
+		}
+		f.SetMapIndex(reflect.ValueOf(name), reflect.ValueOf(state == "on"))
+	default:
+		return fmt.Errorf("unsupported setting")
+	}
+	return nil
+}
+
+// Compares files as a Config describes, writing its reports and audit
+// entries.  Safe to use for any number of comparisons.
+type Comparer struct {
+	cfg  Config
+	opts []Option
+}
+
+// Check a config and build a Comparer from it
+func FromConfig(cfg Config) (*Comparer, error) {
+	var opts []Option
+	if cfg.Preset != "" {
+		preset, err := LookupPreset(cfg.Preset)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, preset.Options...)
+	}
+	if cfg.Resolution < 0 || cfg.Ratio < 0 {
+		return nil, fmt.Errorf("resolution and ratio must be positive")
+	}
+	if cfg.Prescreen < 0 {
+		return nil, fmt.Errorf("prescreen resolution must be positive, got %d", cfg.Prescreen)
+	}
+	if cfg.MaxPages < 0 {
+		return nil, fmt.Errorf("max pages must be positive, got %d", cfg.MaxPages)
+	}
+	if cfg.Resolution > 0 {
+		opts = append(opts, WithResolution(cfg.Resolution))
+	}
+	if cfg.Ratio > 0 {
+		opts = append(opts, WithRatio(cfg.Ratio))
+	}
+	if cfg.DeltaE < 0 {
+		return nil, fmt.Errorf("delta-e must be positive, got %g", cfg.DeltaE)
+	}
+	if cfg.MaxDiffPercent < 0 || cfg.MaxDiffPercent > 100 {
+		return nil, fmt.Errorf("max diff percent must be between 0 and 100, got %g", cfg.MaxDiffPercent)
+	}
+	if cfg.Annotations != nil {
+		opts = append(opts, WithAnnotations(*cfg.Annotations))
+	}
+	if cfg.FailFast != nil {
+		opts = append(opts, WithFailFast(*cfg.FailFast))
+	}
+	if cfg.ContentPrecision != nil {
+		opts = append(opts, WithContentPrecision(*cfg.ContentPrecision))
+	}
+
+	d := DefaultOptions()
+	if cfg.DiffStyle != "" {
+		style, err := ParseDiffStyle(cfg.DiffStyle)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, WithDiffStyle(style))
+	}
+	if cfg.Layout != "" {
+		layout, err := ParsePDFLayout(cfg.Layout)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, WithLayout(layout))
+	}
+	hl := d.Highlight
+	if cfg.HighlightColor != "" {
+		color, err := ParseColor(cfg.HighlightColor)
+		if err != nil {
+			return nil, err
+		}
+		hl.Color = color
+	}
+	if cfg.HighlightOpacity != nil {
+		if *cfg.HighlightOpacity < 0 || *cfg.HighlightOpacity > 1 {
+			return nil, fmt.Errorf("highlight opacity must be between 0 and 1, got %g", *cfg.HighlightOpacity)
+		}
+		hl.Opacity = *cfg.HighlightOpacity
+	}
+	var err error
+	if hl.Style, err = ParseHighlightStyle(cfg.HighlightStyle); err != nil {
+		return nil, err
+	}
+	hl.Graded = cfg.HighlightGraded
+	opts = append(opts, WithHighlight(hl))
+	blink, err := ParseBlinkFormat(cfg.Blink)
+	if err != nil {
+		return nil, err
+	}
+	opts = append(opts, WithBlink(blink), WithAnnotateCopies(cfg.AnnotateCopies))
+	if cfg.Grid < 0 {
+		return nil, fmt.Errorf("grid spacing must be positive, got %g", cfg.Grid)
+	}
+	if cfg.Grid > 0 {
+		unit := GridPoints
+		if cfg.GridUnit != "" {
+			if unit, err = ParseGridUnit(cfg.GridUnit); err != nil {
+				return nil, err
+			}
+		}
+		opts = append(opts, WithGrid(cfg.Grid, unit))
+	}
+	detail := d.Detail
+	if cfg.DetailZoom != 0 && cfg.DetailZoom < 1 {
+		return nil, fmt.Errorf("detail zoom must be at least 1, got %g", cfg.DetailZoom)
+	}
+	detail.Zoom = cfg.DetailZoom
+	if cfg.DetailMargin != nil {
+		if *cfg.DetailMargin < 0 {
+			return nil, fmt.Errorf("detail margin must not be negative, got %g", *cfg.DetailMargin)
+		}
+		detail.Margin = *cfg.DetailMargin
+	}
+	opts = append(opts, WithDetail(detail.Zoom, detail.Margin))
+	join := d.Join
+	if cfg.JoinDirection != "" {
+		if join.Direction, err = ParseJoinDirection(cfg.JoinDirection); err != nil {
+			return nil, err
+		}
+	}
+	if cfg.JoinAlign != "" {
+		if join.Align, err = ParseJoinAlign(cfg.JoinAlign); err != nil {
+			return nil, err
+		}
+	}
+	if cfg.JoinBackground != "" {
+		if join.Background, err = ParseColor(cfg.JoinBackground); err != nil {
+			return nil, err
+		}
+	}
+	opts = append(opts, WithJoin(join))
+
+	sampling, seed := d.SampleMethod, d.SampleSeed
+	if cfg.SampleMethod != "" {
+		if sampling, err = ParseSampling(cfg.SampleMethod); err != nil {
+			return nil, err
+		}
+	}
+	if cfg.Seed != 0 {
+		seed = cfg.Seed
+	}
+	if cfg.Sample > 0 {
+		opts = append(opts, WithSample(cfg.Sample, sampling, seed))
+	}
+
+	fit, err := ParseSizeFit(cfg.Fit)
+	if err != nil {
+		return nil, err
+	}
+	colorMode, err := ParseColorMode(cfg.ColorMode)
+	if err != nil {
+		return nil, err
+	}
+	renderFormat, err := ParseRenderFormat(cfg.RenderFormat)
+	if err != nil {
+		return nil, err
+	}
+
+	var ignore []IgnoreRegion
+	for _, s := range cfg.Ignore {
+		r, err := ParseIgnoreRegion(s)
+		if err != nil {
+			return nil, err
+		}
+		ignore = append(ignore, r)
+	}
+	if cfg.Review != "" {
+		review, err := ReadReview(cfg.Review)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, WithReview(review))
+	}
+	if cfg.CacheMB < 0 {
+		return nil, fmt.Errorf("cache size must be positive, got %d", cfg.CacheMB)
+	}
+	if cfg.MemoryMB < 0 {
+		return nil, fmt.Errorf("memory budget must be positive, got %d", cfg.MemoryMB)
+	}
+	if cfg.RenderTimeout != "" {
+		timeout, err := time.ParseDuration(cfg.RenderTimeout)
+		if err != nil || timeout < 0 {
+			return nil, fmt.Errorf("invalid render timeout %q, expected a duration such as 90s or 5m, or 0 for none", cfg.RenderTimeout)
+		}
+		opts = append(opts, WithRenderTimeout(timeout))
+	}
+	if cfg.CacheDirMB < 0 {
+		return nil, fmt.Errorf("cache directory size must be positive, got %d", cfg.CacheDirMB)
+	}
+	var disk *DiskCache
+	if cfg.CacheDir != "" {
+		disk = configDiskCache(cfg.CacheDir, cfg.CacheDirMB<<20)
+	}
+	switch {
+	case disk != nil && cfg.CacheMB > 0:
+		opts = append(opts, WithCache(NewTieredCache(configCache(cfg.CacheMB<<20), disk)))
+	case disk != nil:
+		opts = append(opts, WithCache(disk))
+	case cfg.CacheMB > 0:
+		opts = append(opts, WithCache(configCache(cfg.CacheMB<<20)))
+	}
+	if cfg.OutDir != "" {
+		if err := os.MkdirAll(cfg.OutDir, 0755); err != nil {
+			return nil, err
+		}
+	}
+
+	opts = append(opts, WithImages(cfg.Images), WithSingleProcess(cfg.SingleProcess), WithColor(colorMode), WithRenderFormat(renderFormat), WithRendererArgs(strings.Fields(strings.Join(cfg.RendererArg, " "))...), WithRenderToDisk(cfg.RenderToDisk),
+		WithPortfolios(cfg.Portfolios), WithOutDir(cfg.OutDir), WithNameTemplate(cfg.NameTemplate),
+		WithStopAfter(cfg.StopAfter), WithMaxPages(cfg.MaxPages), WithResumeDir(cfg.ResumeDir),
+		WithSignatures(cfg.Signatures), WithMaskSignatures(cfg.MaskSignatures), WithFontSubstitution(cfg.Fonts), WithClassify(cfg.Classify),
+		WithLayers(cfg.Layers), WithLayerVisibility(cfg.Layer),
+		WithPageLabels(cfg.PageLabels), WithLinks(cfg.Links), WithMaxArtifactBytes(cfg.MaxArtifactBytes),
+		WithContentShortcut(cfg.ContentShortcut), WithPrescreen(cfg.Prescreen), WithRescale(cfg.Rescale), WithCompareRotation(cfg.CompareRotation), WithMatchSize(cfg.MatchSize), WithCropToContent(cfg.CropToContent), WithFit(fit), WithAlign(cfg.Align),
+		WithTolerance(cfg.Tolerance), WithDeltaE(cfg.DeltaE), WithMaxDiffPercent(cfg.MaxDiffPercent), WithIgnore(ignore...),
+		WithLimits(RenderLimits{CPUSeconds: cfg.RenderCPUSeconds, MemoryBytes: cfg.RenderMemoryMB << 20, OutputBytes: cfg.RenderOutputMB << 20}),
+		WithMemoryBudget(cfg.MemoryMB<<20))
+	return &Comparer{cfg: cfg, opts: opts}, nil
+}
+
+// The config the comparer was built from
+func (c *Comparer) Config() Config {
+	return c.cfg
+}
+
+// The options the config sets, leaving out the reports written to files, to
+// pass to Compare or CompareDirs
+func (c *Comparer) Options() []Option {
+	return c.opts
+}
+
+// Where a report for a comparison of file1 is written: beside file1, or in
+// the output directory if there is one
+func (c *Comparer) ReportName(file1, suffix string) string {
+	if c.cfg.OutDir == "" {
+		return file1 + suffix
+	}
+	return filepath.Join(c.cfg.OutDir, filepath.Base(file1)+suffix)
+}
+
+// Compare two files, writing the difference pdf and html report the config
+// asks for, named after file1, and appending to its audit log.  Options
+// given here are applied after the config's.
+func (c *Comparer) Compare(file1, file2 string, opts ...Option) (*Result, error) {
+	return c.run(file1, opts, func(all []Option) (*Result, error) {
+		return Compare(file1, file2, all...)
+	}, func(res *Result, err error, all []Option) AuditEntry {
+		return NewAuditEntry(file1, file2, c.cfg.Operator, res, err, all...)
+	})
+}
+
+// Compare two documents each split across an ordered list of files, as
+// CompareParts does, writing reports named after the first part of the first
+// document.  The audit log records each document by the names of its parts
+// joined with + and the checksum of their contents in order.
+func (c *Comparer) CompareParts(parts1, parts2 []string, opts ...Option) (*Result, error) {
+	if len(parts1) == 0 || len(parts2) == 0 {
+		return nil, fmt.Errorf("expected at least one part of each document")
+	}
+	return c.run(parts1[0], opts, func(all []Option) (*Result, error) {
+		return CompareParts(parts1, parts2, all...)
+	}, func(res *Result, err error, all []Option) AuditEntry {
+		e := NewAuditEntry(strings.Join(parts1, "+"), strings.Join(parts2, "+"), c.cfg.Operator, res, err, all...)
+		e.Checksum1, _ = ChecksumParts(parts1)
+		e.Checksum2, _ = ChecksumParts(parts2)
+		return e
+	})
+}
+
+// Run a comparison with the config's options and reports, then options, and
+// append the entry audit makes of it to the audit log
+func (c *Comparer) run(file1 string, opts []Option, compare func([]Option) (*Result, error), audit func(*Result, error, []Option) AuditEntry) (*Result, error) {
+	all := append([]Option{}, c.opts...)
+	if c.cfg.PDF || c.cfg.PDFOut != "" {
+		name := c.cfg.PDFOut
+		if name == "" {
+			name = c.ReportName(file1, "-diff.pdf")
+		}
+		f, err := os.OpenFile(name, os.O_TRUNC|os.O_CREATE|os.O_WRONLY, 0644)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		all = append(all, WithPDF(f))
+	}
+	if c.cfg.HTML {
+		f, err := os.OpenFile(c.ReportName(file1, "-diff.html"), os.O_TRUNC|os.O_CREATE|os.O_WRONLY, 0644)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		all = append(all, WithHTML(f))
+	}
+	all = append(all, opts...)
+	res, err := compare(all)
+	if c.cfg.AuditLog != "" {
+		if _, aerr := AppendAudit(c.cfg.AuditLog, audit(res, err, all)); aerr != nil {
+			return nil, fmt.Errorf("error writing audit log: %w", aerr)
+		}
+	}
+	return res, err
+}
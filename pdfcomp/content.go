@@ -0,0 +1,293 @@
+package pdfcomp
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"strconv"
+
+	"github.com/pdfcpu/pdfcpu/pkg/api"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/model"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/types"
+)
+
+// Kinds of token found in a page content stream
+type tokenKind int
+
+const (
+	tokNumber tokenKind = iota
+	tokName
+	tokString
+	tokArrayStart
+	tokArrayEnd
+	tokDictStart
+	tokDictEnd
+	// Operators, and also true, false and null
+	tokKeyword
+	// The data of an inline image, from after ID up to EI
+	tokInlineData
+)
+
+type contentToken struct {
+	kind tokenKind
+	// Text of the token as written, or for strings the decoded bytes
+	text string
+}
+
+// One operator of a content stream with the operands that preceded it
+type contentOp struct {
+	op       string
+	operands []contentToken
+}
+
+// Read and validate a pdf file into a pdfcpu context
+func readContext(filename string) (*model.Context, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	conf := model.NewDefaultConfiguration()
+	conf.Cmd = model.VALIDATE
+	ctx, err := api.ReadAndValidate(f, conf)
+	return ctx, readError(err)
+}
+
+// The decoded content stream of a page, with the attributes it inherits
+func pageContent(ctx *model.Context, page int) ([]byte, *model.InheritedPageAttrs, error) {
+	d, _, inh, err := ctx.PageDict(page, false)
+	if err != nil {
+		return nil, nil, err
+	}
+	if d == nil {
+		return nil, nil, fmt.Errorf("page %d not found", page)
+	}
+	content, err := ctx.PageContent(d)
+	if err == model.ErrNoContent {
+		return nil, inh, nil
+	}
+	return content, inh, err
+}
+
+// Look up and dereference a dictionary entry, returning nil if it is missing
+// or broken
+func dictEntry(ctx *model.Context, d types.Dict, key string) types.Object {
+	if d == nil {
+		return nil
+	}
+	o, found := d.Find(key)
+	if !found || o == nil {
+		return nil
+	}
+	o, err := ctx.Dereference(o)
+	if err != nil {
+		return nil
+	}
+	return o
+}
+
+// Split a content stream into operators and their operands
+func parseContent(data []byte) ([]contentOp, error) {
+	tokens, err := lexContent(data)
+	if err != nil {
+		return nil, err
+	}
+	var ops []contentOp
+	var operands []contentToken
+	depth := 0
+	for _, t := range tokens {
+		switch t.kind {
+		case tokArrayStart, tokDictStart:
+			depth++
+		case tokArrayEnd, tokDictEnd:
+			depth--
+		}
+		if t.kind != tokKeyword || depth > 0 || t.text == "true" || t.text == "false" || t.text == "null" {
+			operands = append(operands, t)
+			continue
+		}
+		ops = append(ops, contentOp{op: t.text, operands: operands})
+		operands = nil
+	}
+	return ops, nil
+}
+
+func isWhite(c byte) bool {
+	return c == ' ' || c == '\n' || c == '\r' || c == '\t' || c == '\f' || c == 0
+}
+
+func isDelim(c byte) bool {
+	return bytes.IndexByte([]byte("()<>[]{}/%"), c) >= 0
+}
+
+// Break a content stream into tokens
+func lexContent(data []byte) ([]contentToken, error) {
+	var tokens []contentToken
+	i := 0
+	for i < len(data) {
+		c := data[i]
+		switch {
+		case isWhite(c):
+			i++
+		case c == '%':
+			for i < len(data) && data[i] != '\n' && data[i] != '\r' {
+				i++
+			}
+		case c == '/':
+			j := i + 1
+			for j < len(data) && !isWhite(data[j]) && !isDelim(data[j]) {
+				j++
+			}
+			tokens = append(tokens, contentToken{tokName, string(data[i:j])})
+			i = j
+		case c == '(':
+			s, n, err := lexLiteralString(data[i:])
+			if err != nil {
+				return nil, err
+			}
+			tokens = append(tokens, contentToken{tokString, s})
+			i += n
+		case c == '<' && i+1 < len(data) && data[i+1] == '<':
+			tokens = append(tokens, contentToken{tokDictStart, "<<"})
+			i += 2
+		case c == '>' && i+1 < len(data) && data[i+1] == '>':
+			tokens = append(tokens, contentToken{tokDictEnd, ">>"})
+			i += 2
+		case c == '<':
+			j := bytes.IndexByte(data[i:], '>')
+			if j < 0 {
+				return nil, fmt.Errorf("unterminated hex string at offset %d", i)
+			}
+			tokens = append(tokens, contentToken{tokString, decodeHexString(data[i+1 : i+j])})
+			i += j + 1
+		case c == '[':
+			tokens = append(tokens, contentToken{tokArrayStart, "["})
+			i++
+		case c == ']':
+			tokens = append(tokens, contentToken{tokArrayEnd, "]"})
+			i++
+		case c == '{' || c == '}':
+			// Only used in type 4 functions, never in page content
+			i++
+		default:
+			j := i
+			for j < len(data) && !isWhite(data[j]) && !isDelim(data[j]) {
+				j++
+			}
+			if j == i {
+				return nil, fmt.Errorf("unexpected %q at offset %d", c, i)
+			}
+			word := string(data[i:j])
+			i = j
+			if _, err := strconv.ParseFloat(word, 64); err == nil {
+				tokens = append(tokens, contentToken{tokNumber, word})
+				continue
+			}
+			tokens = append(tokens, contentToken{tokKeyword, word})
+			if word == "ID" {
+				// Inline image data runs up to the next EI surrounded by white space
+				start := i + 1
+				end := start
+				for end+2 <= len(data) {
+					if data[end] == 'E' && data[end+1] == 'I' && isWhite(data[end-1]) &&
+						(end+2 == len(data) || isWhite(data[end+2])) {
+						break
+					}
+					end++
+				}
+				if end+2 > len(data) {
+					return nil, fmt.Errorf("unterminated inline image at offset %d", start)
+				}
+				tokens = append(tokens, contentToken{tokInlineData, string(data[min(start, end):end])})
+				i = end
+			}
+		}
+	}
+	return tokens, nil
+}
+
+// Decode a literal string starting with the ( at data[0], returning the
+// string and the number of bytes it took up
+func lexLiteralString(data []byte) (string, int, error) {
+	var buf bytes.Buffer
+	depth := 0
+	for i := 0; i < len(data); i++ {
+		c := data[i]
+		switch c {
+		case '(':
+			if depth > 0 {
+				buf.WriteByte(c)
+			}
+			depth++
+		case ')':
+			depth--
+			if depth == 0 {
+				return buf.String(), i + 1, nil
+			}
+			buf.WriteByte(c)
+		case '\\':
+			i++
+			if i >= len(data) {
+				break
+			}
+			switch e := data[i]; e {
+			case 'n':
+				buf.WriteByte('\n')
+			case 'r':
+				buf.WriteByte('\r')
+			case 't':
+				buf.WriteByte('\t')
+			case 'b':
+				buf.WriteByte('\b')
+			case 'f':
+				buf.WriteByte('\f')
+			case '\r':
+				// Line continuation
+				if i+1 < len(data) && data[i+1] == '\n' {
+					i++
+				}
+			case '\n':
+			default:
+				if e >= '0' && e <= '7' {
+					v := 0
+					for n := 0; n < 3 && i < len(data) && data[i] >= '0' && data[i] <= '7'; n++ {
+						v = v*8 + int(data[i]-'0')
+						i++
+					}
+					i--
+					buf.WriteByte(byte(v))
+				} else {
+					buf.WriteByte(e)
+				}
+			}
+		default:
+			buf.WriteByte(c)
+		}
+	}
+	return "", 0, fmt.Errorf("unterminated string")
+}
+
+// Decode the contents of a hex string, ignoring white space
+func decodeHexString(hex []byte) string {
+	var digits []byte
+	for _, c := range hex {
+		if !isWhite(c) {
+			digits = append(digits, c)
+		}
+	}
+	if len(digits)%2 == 1 {
+		digits = append(digits, '0')
+	}
+	out := make([]byte, len(digits)/2)
+	for i := range out {
+		v, _ := strconv.ParseUint(string(digits[i*2:i*2+2]), 16, 8)
+		out[i] = byte(v)
+	}
+	return string(out)
+}
+
+func (t contentToken) number() float64 {
+	v, _ := strconv.ParseFloat(t.text, 64)
+	return v
+}
@@ -0,0 +1,75 @@
+package pdfcomp
+
+import "fmt"
+
+// Where the content of a page was found in each rendering, when the
+// renderings were cropped to their content before comparing, as for receipts
+// whose page length follows their content
+type ContentCrop struct {
+	// The smallest areas holding every pixel that is not white, in pixels at
+	// the rendering resolution.  Empty for a blank page.
+	Bounds1 Region
+	Bounds2 Region
+}
+
+func (c *ContentCrop) String() string {
+	return fmt.Sprintf("content at %d,%d %dx%d pixels in file1 and %d,%d %dx%d in file2",
+		c.Bounds1.X, c.Bounds1.Y, c.Bounds1.Width, c.Bounds1.Height,
+		c.Bounds2.X, c.Bounds2.Y, c.Bounds2.Width, c.Bounds2.Height)
+}
+
+// The darkest a channel may be for a pixel to count as blank rather than
+// content, leaving out the faint noise some renderers leave on white
+const contentThreshold = 250
+
+// Crop two renderings each to the smallest area holding its content, sharing
+// their buffers.  A blank page is cut down to its top left pixel.  Pages that
+// are both blank are returned as they are with a nil ContentCrop.
+func cropToContent(img1, img2 *Image) (*Image, *Image, *ContentCrop) {
+	if img1.H == 0 || img2.H == 0 {
+		return img1, img2, nil
+	}
+	c := &ContentCrop{Bounds1: contentBounds(img1), Bounds2: contentBounds(img2)}
+	if c.Bounds1.Width == 0 && c.Bounds2.Width == 0 {
+		return img1, img2, nil
+	}
+	return img1.sub(c.Bounds1.orCorner()), img2.sub(c.Bounds2.orCorner()), c
+}
+
+// The smallest area of an image holding every pixel darker than
+// contentThreshold in any channel
+func contentBounds(img *Image) Region {
+	x0, y0, x1, y1 := img.W, img.H, -1, -1
+	for y := range img.H {
+		for i, v := range img.Row(y) {
+			if v < contentThreshold {
+				x := i / img.Channels
+				x0, x1 = min(x0, x), max(x1, x)
+				y0, y1 = min(y0, y), max(y1, y)
+			}
+		}
+	}
+	if x1 < 0 {
+		return Region{}
+	}
+	return Region{X: x0, Y: y0, Width: x1 - x0 + 1, Height: y1 - y0 + 1}
+}
+
+// The area r, or the top left pixel if r is empty
+func (r Region) orCorner() Region {
+	if r.Width == 0 {
+		return Region{Width: 1, Height: 1}
+	}
+	return r
+}
+
+// Regions of the page moved to where they fall in a rendering cropped to b
+func (b Region) relative(regions []Region) []Region {
+	out := make([]Region, len(regions))
+	for i, r := range regions {
+		r.X -= b.X
+		r.Y -= b.Y
+		out[i] = r
+	}
+	return out
+}
@@ -0,0 +1,71 @@
+package pdfcomp
+
+import "math"
+
+// The linear light of each sRGB channel value
+var srgbLinear = func() [256]float64 {
+	var t [256]float64
+	for i := range t {
+		c := float64(i) / 255
+		if c <= 0.04045 {
+			t[i] = c / 12.92
+		} else {
+			t[i] = math.Pow((c+0.055)/1.055, 2.4)
+		}
+	}
+	return t
+}()
+
+// An sRGB colour in CIE L*a*b*, relative to the D65 white point, taken as
+// the XYZ of sRGB white so that white comes out neutral
+func srgbToLab(r, g, b byte) (float64, float64, float64) {
+	lr, lg, lb := srgbLinear[r], srgbLinear[g], srgbLinear[b]
+	x := (0.4124*lr + 0.3576*lg + 0.1805*lb) / 0.9505
+	y := 0.2126*lr + 0.7152*lg + 0.0722*lb
+	z := (0.0193*lr + 0.1192*lg + 0.9505*lb) / 1.089
+	fx, fy, fz := labF(x), labF(y), labF(z)
+	return 116*fy - 16, 500 * (fx - fy), 200 * (fy - fz)
+}
+
+func labF(t float64) float64 {
+	if t > 216.0/24389 {
+		return math.Cbrt(t)
+	}
+	return (24389.0/27*t + 16) / 116
+}
+
+// The CIE76 Delta-E between two sRGB colours: their distance in L*a*b*
+func deltaE(r1, g1, b1, r2, g2, b2 byte) float64 {
+	l1, a1, bb1 := srgbToLab(r1, g1, b1)
+	l2, a2, bb2 := srgbToLab(r2, g2, b2)
+	return math.Sqrt((l1-l2)*(l1-l2) + (a1-a2)*(a1-a2) + (bb1-bb2)*(bb1-bb2))
+}
+
+// Clear the entries of a difference image for pixels of two images whose
+// colours are no more than threshold apart in Delta-E, returning true if none
+// are left.  Only pixels that differ are converted, so pages that mostly
+// match cost little more than without.
+func applyDeltaE(diff, img1, img2 *Image, threshold float64) bool {
+	same := true
+	for y := range diff.H {
+		row, row1, row2 := diff.Row(y), img1.Row(y), img2.Row(y)
+		for x, d := range row {
+			if d == 0 {
+				continue
+			}
+			var e float64
+			if img1.Channels == 1 {
+				e = deltaE(row1[x], row1[x], row1[x], row2[x], row2[x], row2[x])
+			} else {
+				i := x * 3
+				e = deltaE(row1[i], row1[i+1], row1[i+2], row2[i], row2[i+1], row2[i+2])
+			}
+			if e <= threshold {
+				row[x] = 0
+			} else {
+				same = false
+			}
+		}
+	}
+	return same
+}
@@ -0,0 +1,74 @@
+package pdfcomp
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+)
+
+// Close-up views of the regions of differences on a page, cropped from the
+// highlighted renderings and enlarged, for the html report and the
+// difference pdf
+type Detail struct {
+	// How many times larger than the rendering close-ups are drawn.  Zero
+	// draws none.
+	Zoom float64
+	// How much of the page around each region is shown, in points
+	Margin float64
+}
+
+// At most this many regions of a page are shown close up
+const maxDetails = 8
+
+// The default points of the page shown around a region close up
+const DefaultDetailMargin = 18.0
+
+// The regions of a page to show close up: those with the most differing
+// pixels, in the order they were found, leaving out any that would be drawn
+// larger than the page, where a close-up shows no more than the page does
+func detailRegions(regions []Region, d Detail, width, height, dpi int) []Region {
+	if d.Zoom <= 0 {
+		return nil
+	}
+	var fit []int
+	for i, r := range regions {
+		x0, y0, x1, y1 := detailBounds(r, d, width, height, dpi)
+		if float64(x1-x0)*d.Zoom <= float64(width) && float64(y1-y0)*d.Zoom <= float64(height) {
+			fit = append(fit, i)
+		}
+	}
+	if len(fit) > maxDetails {
+		slices.SortStableFunc(fit, func(a, b int) int { return cmp.Compare(regions[b].Pixels, regions[a].Pixels) })
+		fit = fit[:maxDetails]
+		slices.Sort(fit)
+	}
+	var out []Region
+	for _, i := range fit {
+		out = append(out, regions[i])
+	}
+	return out
+}
+
+// The pixels of a page shown around a region close up, from x0, y0 up to
+// but not including x1, y1
+func detailBounds(r Region, d Detail, width, height, dpi int) (x0, y0, x1, y1 int) {
+	margin := int(d.Margin * float64(dpi) / 72)
+	return max(0, r.X-margin), max(0, r.Y-margin),
+		min(width, r.X+r.Width+margin), min(height, r.Y+r.Height+margin)
+}
+
+// A close-up of a region: the same part of the two highlighted renderings,
+// enlarged and joined as difference images are
+func detailImage(img1, img2 *Image, r Region, d Detail, dpi int, join Join) *Image {
+	x0, y0, x1, y1 := detailBounds(r, d, img1.W, img1.H, dpi)
+	w, h := int(float64(x1-x0)*d.Zoom), int(float64(y1-y0)*d.Zoom)
+	zoom := func(img *Image) *Image {
+		return resizeImage(img.sub(Region{X: x0, Y: y0, Width: x1 - x0, Height: y1 - y0}), h, w)
+	}
+	return joinImages(zoom(img1), zoom(img2), 5, join)
+}
+
+// How a region shown close up is described
+func detailCaption(r Region) string {
+	return fmt.Sprintf("close-up of %dx%d at %d,%d", r.Width, r.Height, r.X, r.Y)
+}
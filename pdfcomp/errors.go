@@ -0,0 +1,59 @@
+package pdfcomp
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os/exec"
+
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu"
+)
+
+// Errors that callers can check for with errors.Is.  The errors returned
+// wrap them with the file and the underlying cause.
+var (
+	// pdftoppm is not on the PATH, or the renderer given to UseRenderer does
+	// not exist
+	ErrRendererNotFound = errors.New("renderer not found")
+	// Two files that must have the same number of pages do not.  Compare
+	// reports this in its Result instead, as PageCountErr.
+	ErrPageCountMismatch = errors.New("page counts differ")
+	// A file is encrypted with a password it needs to be opened
+	ErrEncrypted = errors.New("pdf is encrypted")
+	// A file cannot be read as a pdf: it is damaged, or not a pdf at all
+	ErrInvalidPDF = errors.New("invalid pdf")
+	// The renderer's output is not a PPM or PNG image that can be read
+	ErrInvalidPPM = errors.New("invalid ppm")
+	// The renderer took longer than RenderTimeout over a page, and was
+	// stopped.  The *RenderError wrapping it names the page.
+	ErrRenderTimeout = errors.New("render timed out")
+	// A file has more pages than MaxPages allows
+	ErrTooManyPages = errors.New("too many pages")
+	// A page renders at different sizes in the two files, and no Fit was
+	// given to bring them to the same size
+	ErrSizeMismatch = errors.New("pages render at different sizes")
+	// An entry of an audit log was altered, removed or reordered, or
+	// another was inserted, since it was written
+	ErrAuditLogAltered = errors.New("audit log altered")
+)
+
+// Describe a failure to start the renderer, as ErrRendererNotFound if it is
+// not there
+func startError(err error, stderr string) error {
+	if errors.Is(err, exec.ErrNotFound) || errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("%w: %w.  %s", ErrRendererNotFound, err, installHint())
+	}
+	return fmt.Errorf("pdftoppm start failed: %w, stderr: %s", err, stderr)
+}
+
+// Describe a failure to read a pdf, as ErrEncrypted if it needs a password
+// and otherwise as ErrInvalidPDF
+func readError(err error) error {
+	if err == nil {
+		return nil
+	}
+	if errors.Is(err, pdfcpu.ErrWrongPassword) {
+		return fmt.Errorf("%w: %w", ErrEncrypted, err)
+	}
+	return fmt.Errorf("%w: %w", ErrInvalidPDF, err)
+}
@@ -0,0 +1,59 @@
+package pdfcomp
+
+import (
+	"math"
+
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/model"
+)
+
+// What the content of the pages left unrendered suggests about them, when
+// rendering stopped after StopAfter differing pages
+type EstimateResult struct {
+	// The pages not rendered, in order
+	Pages []int
+	// Those whose content streams or resources differ, which may look
+	// different.  The others must look the same.
+	Suspect []int
+	// Rendered pages whose content differed, and how many of them looked
+	// different, which is how often a change in content shows
+	Calibration int
+	Confirmed   int
+	// Estimated number of the pages not rendered that look different: the
+	// suspects, scaled by how often a change in content showed
+	Different int
+}
+
+// Check the pages not rendered by their content, calibrating against the
+// rendered pages how often a change in content makes a visible difference
+func estimateRest(ctx1, ctx2 *model.Context, rendered []PageResult, rest []int, precision int) (*EstimateResult, error) {
+	e := &EstimateResult{Pages: rest}
+	for _, page := range rest {
+		same, err := samePageContent(ctx1, ctx2, page, precision)
+		if err != nil {
+			return nil, err
+		}
+		if !same {
+			e.Suspect = append(e.Suspect, page)
+		}
+	}
+	for _, pr := range rendered {
+		if pr.Error != "" {
+			continue
+		}
+		same, err := samePageContent(ctx1, ctx2, pr.Page, precision)
+		if err != nil {
+			return nil, err
+		}
+		if !same {
+			e.Calibration++
+			if !pr.Equal {
+				e.Confirmed++
+			}
+		}
+	}
+	e.Different = len(e.Suspect)
+	if e.Calibration > 0 {
+		e.Different = int(math.Round(float64(len(e.Suspect)*e.Confirmed) / float64(e.Calibration)))
+	}
+	return e, nil
+}
@@ -0,0 +1,330 @@
+package pdfcomp
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// Environment variable naming a file of renderer pins, for fetching the
+// renderer without a bundled build
+const RendererPinsEnv = "PDFCOMP_RENDERER_PINS"
+
+// Environment variable naming the directory fetched renderers are kept in,
+// instead of pdfcomp/renderers in the user's cache directory
+const RendererDirEnv = "PDFCOMP_RENDERER_DIR"
+
+// A pinned build of the renderer for one platform: an archive holding
+// pdftoppm and the libraries it needs, and the checksum it must have
+type RendererPin struct {
+	GOOS   string `json:"goos"`
+	GOARCH string `json:"goarch"`
+	// A .zip, .tar.gz or .tgz archive
+	URL string `json:"url"`
+	// Hex encoded sha256 of the archive
+	SHA256 string `json:"sha256"`
+	// Path of pdftoppm within the archive, with forward slashes
+	Binary string `json:"binary"`
+}
+
+// Pins built into the binary with the bundled build tag
+var bundledPins []RendererPin
+
+// The renderer to run instead of pdftoppm from the PATH, if set
+var rendererPath string
+
+// The pins built into this binary, which are only present in a build with
+// the bundled tag
+func BundledPins() []RendererPin {
+	return bundledPins
+}
+
+// Run the pdftoppm at path instead of the one on the PATH
+func UseRenderer(path string) {
+	rendererPath = path
+}
+
+// Read renderer pins from a json file holding a list of them
+func ReadRendererPins(filename string) ([]RendererPin, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	var pins []RendererPin
+	if err := json.Unmarshal(data, &pins); err != nil {
+		return nil, fmt.Errorf("error reading renderer pins %s: %w", filename, err)
+	}
+	return pins, nil
+}
+
+// The directory fetched renderers are kept in by default
+func DefaultRendererDir() (string, error) {
+	if dir := os.Getenv(RendererDirEnv); dir != "" {
+		return dir, nil
+	}
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "pdfcomp", "renderers"), nil
+}
+
+// Find the renderer: pdftoppm on the PATH if it is there, and otherwise the
+// pinned build for this platform, fetched into dir if it is not already
+// there.  Returns the path of the renderer.
+func LocateRenderer(pins []RendererPin, dir string) (string, error) {
+	if path, err := exec.LookPath(pdftoppmCommand()); err == nil {
+		return path, nil
+	}
+	if len(pins) == 0 {
+		return "", fmt.Errorf("%w: %s is not on the PATH, and no renderer is pinned to fetch", ErrRendererNotFound, pdftoppmCommand())
+	}
+	return FetchRenderer(pins, dir)
+}
+
+// Fetch the pinned build of the renderer for this platform into dir, or use
+// the one fetched before, checking its checksum either way.  Returns the path
+// of the renderer.
+func FetchRenderer(pins []RendererPin, dir string) (string, error) {
+	pin, err := pinFor(pins, runtime.GOOS, runtime.GOARCH)
+	if err != nil {
+		return "", err
+	}
+	// Each build has a directory of its own, named by its checksum
+	home := filepath.Join(dir, pin.SHA256)
+	bin := filepath.Join(home, filepath.FromSlash(pin.Binary))
+	if _, err := os.Stat(bin); err == nil {
+		if err := verifyRenderer(home, bin); err != nil {
+			return "", err
+		}
+		return bin, nil
+	}
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+	archive, err := downloadPinned(pin, dir)
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(archive)
+	// Extract beside the final directory and rename it into place, so that
+	// an interrupted fetch never leaves a partial renderer to be used
+	tmp, err := os.MkdirTemp(dir, "extract-*")
+	if err != nil {
+		return "", err
+	}
+	defer os.RemoveAll(tmp)
+	if err := extractArchive(archive, pin.URL, tmp); err != nil {
+		return "", fmt.Errorf("error extracting %s: %w", pin.URL, err)
+	}
+	tmpBin := filepath.Join(tmp, filepath.FromSlash(pin.Binary))
+	sum, err := Checksum(tmpBin)
+	if err != nil {
+		return "", fmt.Errorf("%s not found in %s", pin.Binary, pin.URL)
+	}
+	if err := os.Chmod(tmpBin, 0755); err != nil {
+		return "", err
+	}
+	// The checksum of the binary is recorded, from the verified archive, so
+	// that it can be checked before each use without keeping the archive
+	if err := os.WriteFile(filepath.Join(tmp, rendererSumFile), []byte(sum+"\n"), 0644); err != nil {
+		return "", err
+	}
+	if err := os.Rename(tmp, home); err != nil {
+		// Another process may have fetched it at the same time
+		if _, serr := os.Stat(bin); serr != nil {
+			return "", err
+		}
+	}
+	if err := verifyRenderer(home, bin); err != nil {
+		return "", err
+	}
+	return bin, nil
+}
+
+// Name of the file recording the checksum of a fetched renderer
+const rendererSumFile = "pdftoppm.sha256"
+
+func pinFor(pins []RendererPin, goos, goarch string) (RendererPin, error) {
+	for _, p := range pins {
+		if p.GOOS == goos && p.GOARCH == goarch {
+			if len(p.SHA256) != sha256.Size*2 || p.URL == "" || p.Binary == "" {
+				return p, fmt.Errorf("renderer pin for %s/%s needs a url, a sha256 and a binary", goos, goarch)
+			}
+			return p, nil
+		}
+	}
+	return RendererPin{}, fmt.Errorf("no renderer is pinned for %s/%s", goos, goarch)
+}
+
+// Check a fetched renderer against the checksum recorded when it was fetched
+func verifyRenderer(home, bin string) error {
+	want, err := os.ReadFile(filepath.Join(home, rendererSumFile))
+	if err != nil {
+		return fmt.Errorf("renderer in %s has no recorded checksum: %w", home, err)
+	}
+	sum, err := Checksum(bin)
+	if err != nil {
+		return err
+	}
+	if sum != strings.TrimSpace(string(want)) {
+		return fmt.Errorf("renderer %s does not match its checksum; remove %s to fetch it again", bin, home)
+	}
+	return nil
+}
+
+// Download a pinned archive into dir, checking its checksum, and return the
+// name of the file
+func downloadPinned(pin RendererPin, dir string) (string, error) {
+	client := &http.Client{Timeout: 10 * time.Minute}
+	resp, err := client.Get(pin.URL)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("error fetching %s: %s", pin.URL, resp.Status)
+	}
+	f, err := os.CreateTemp(dir, "download-*")
+	if err != nil {
+		return "", err
+	}
+	h := sha256.New()
+	_, err = io.Copy(io.MultiWriter(f, h), resp.Body)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		if sum := hex.EncodeToString(h.Sum(nil)); !strings.EqualFold(sum, pin.SHA256) {
+			err = fmt.Errorf("%s has checksum %s, expected %s", pin.URL, sum, pin.SHA256)
+		}
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return "", err
+	}
+	return f.Name(), nil
+}
+
+// Extract a zip or gzipped tar archive into dir, refusing entries that would
+// land outside it
+func extractArchive(archive, url, dir string) error {
+	switch {
+	case strings.HasSuffix(url, ".zip"):
+		return extractZip(archive, dir)
+	case strings.HasSuffix(url, ".tar.gz"), strings.HasSuffix(url, ".tgz"):
+		return extractTarGz(archive, dir)
+	}
+	return fmt.Errorf("unsupported archive type")
+}
+
+// Where an archive entry goes within dir
+func entryPath(dir, name string) (string, error) {
+	path := filepath.Join(dir, filepath.FromSlash(name))
+	if !strings.HasPrefix(path, filepath.Clean(dir)+string(filepath.Separator)) {
+		return "", fmt.Errorf("entry %q is outside the archive", name)
+	}
+	return path, nil
+}
+
+func extractZip(archive, dir string) error {
+	r, err := zip.OpenReader(archive)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	for _, zf := range r.File {
+		path, err := entryPath(dir, zf.Name)
+		if err != nil {
+			return err
+		}
+		if zf.FileInfo().IsDir() {
+			if err := os.MkdirAll(path, 0755); err != nil {
+				return err
+			}
+			continue
+		}
+		src, err := zf.Open()
+		if err != nil {
+			return err
+		}
+		err = writeEntry(path, src, zf.Mode())
+		src.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func extractTarGz(archive, dir string) error {
+	f, err := os.Open(archive)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return err
+	}
+	tr := tar.NewReader(gz)
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		path, err := entryPath(dir, hdr.Name)
+		if err != nil {
+			return err
+		}
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			err = os.MkdirAll(path, 0755)
+		case tar.TypeReg:
+			err = writeEntry(path, tr, hdr.FileInfo().Mode())
+		case tar.TypeSymlink:
+			// Libraries are often linked to by their short names
+			if _, lerr := entryPath(dir, filepath.Join(filepath.Dir(hdr.Name), hdr.Linkname)); lerr != nil || filepath.IsAbs(hdr.Linkname) {
+				return fmt.Errorf("link %q leads outside the archive", hdr.Name)
+			}
+			if err = os.MkdirAll(filepath.Dir(path), 0755); err == nil {
+				err = os.Symlink(hdr.Linkname, path)
+			}
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func writeEntry(path string, r io.Reader, mode os.FileMode) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, mode.Perm()|0600)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(f, r); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,285 @@
+package pdfcomp
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"image"
+	"math"
+	"math/bits"
+	"slices"
+	"strconv"
+
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/model"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/types"
+)
+
+// A Fingerprinter summarises a page as a short string, so that pages can be
+// recognised again without comparing them pixel by pixel, for example in
+// baseline manifests.  Fingerprints differ in what counts as the same page:
+// RasterFingerprint is the strictest, PerceptualFingerprint tolerates small
+// rendering differences and ContentFingerprint ignores rendering altogether.
+type Fingerprinter interface {
+	// Short name, as accepted by ParseFingerprinter
+	Name() string
+	Fingerprint(p FingerprintPage) (string, error)
+	// True if two fingerprints should be taken as the same page
+	Match(a, b string) bool
+}
+
+// A page to fingerprint.  Rendering and reading the content are only done if
+// the fingerprint asks for them.
+type FingerprintPage struct {
+	File string
+	Page int
+	// The page rendered at the comparison resolution
+	Render func() (image.Image, error)
+	// The page's content stream followed by its boxes, and the fonts,
+	// XObjects and annotation appearances it uses
+	Content func() ([]byte, error)
+}
+
+// SHA-256 of the rendered pixels, matching only identical renderings
+type RasterFingerprint struct{}
+
+func (RasterFingerprint) Name() string { return "sha256" }
+
+func (RasterFingerprint) Fingerprint(p FingerprintPage) (string, error) {
+	img, err := p.Render()
+	if err != nil {
+		return "", err
+	}
+	h := sha256.New()
+	b := img.Bounds()
+	binary.Write(h, binary.BigEndian, [2]int32{int32(b.Dx()), int32(b.Dy())})
+	row := make([]byte, 0, b.Dx()*3)
+	rgba, _ := img.(*image.RGBA)
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		row = row[:0]
+		if rgba != nil {
+			// Avoid a call per pixel for what rendering produces
+			pix := rgba.Pix[rgba.PixOffset(b.Min.X, y):]
+			for x := range b.Dx() {
+				row = append(row, pix[x*4:x*4+3]...)
+			}
+		} else {
+			for x := b.Min.X; x < b.Max.X; x++ {
+				r, g, b, _ := img.At(x, y).RGBA()
+				row = append(row, byte(r>>8), byte(g>>8), byte(b>>8))
+			}
+		}
+		h.Write(row)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+func (RasterFingerprint) Match(a, b string) bool { return a == b }
+
+// Perceptual hash of the rendered page, from the low frequencies of its
+// discrete cosine transform, which survives anti-aliasing, small shifts and
+// slight colour changes
+type PerceptualFingerprint struct {
+	// Fingerprints match if they differ in at most this many of their 64 bits
+	MaxDistance int
+}
+
+// Size of the grayscale thumbnail transformed, and of the corner of low
+// frequencies kept from it
+const (
+	phashSize = 32
+	phashLow  = 8
+)
+
+func (PerceptualFingerprint) Name() string { return "phash" }
+
+func (PerceptualFingerprint) Fingerprint(p FingerprintPage) (string, error) {
+	img, err := p.Render()
+	if err != nil {
+		return "", err
+	}
+	thumb := grayThumbnail(img, phashSize)
+
+	// Only the lowest frequencies are needed, so compute just those
+	var coeffs []float64
+	for u := range phashLow {
+		for v := range phashLow {
+			sum := 0.0
+			for y := range phashSize {
+				for x := range phashSize {
+					sum += thumb[y][x] *
+						math.Cos(float64(2*y+1)*float64(u)*math.Pi/(2*phashSize)) *
+						math.Cos(float64(2*x+1)*float64(v)*math.Pi/(2*phashSize))
+				}
+			}
+			coeffs = append(coeffs, sum)
+		}
+	}
+	// The first coefficient is the average brightness, which says nothing
+	// about the layout
+	coeffs = coeffs[1:]
+	sorted := slices.Clone(coeffs)
+	slices.Sort(sorted)
+	median := sorted[len(sorted)/2]
+	var h uint64
+	for _, c := range coeffs {
+		h <<= 1
+		if c > median {
+			h |= 1
+		}
+	}
+	return fmt.Sprintf("%016x", h), nil
+}
+
+func (f PerceptualFingerprint) Match(a, b string) bool {
+	ha, err1 := strconv.ParseUint(a, 16, 64)
+	hb, err2 := strconv.ParseUint(b, 16, 64)
+	if err1 != nil || err2 != nil {
+		return a == b
+	}
+	return bits.OnesCount64(ha^hb) <= f.MaxDistance
+}
+
+// Average brightness of each cell of a size by size grid over the image
+func grayThumbnail(img image.Image, size int) [][]float64 {
+	b := img.Bounds()
+	sums := make([][]float64, size)
+	counts := make([][]int, size)
+	for i := range size {
+		sums[i] = make([]float64, size)
+		counts[i] = make([]int, size)
+	}
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		ty := (y - b.Min.Y) * size / b.Dy()
+		for x := b.Min.X; x < b.Max.X; x++ {
+			tx := (x - b.Min.X) * size / b.Dx()
+			r, g, bl, _ := img.At(x, y).RGBA()
+			sums[ty][tx] += 0.299*float64(r>>8) + 0.587*float64(g>>8) + 0.114*float64(bl>>8)
+			counts[ty][tx]++
+		}
+	}
+	for y := range size {
+		for x := range size {
+			if counts[y][x] > 0 {
+				sums[y][x] /= float64(counts[y][x])
+			}
+		}
+	}
+	return sums
+}
+
+// SHA-256 of what the page draws rather than how it renders: its content
+// stream and the fonts, XObjects and annotations it uses.  Needs no renderer, but treats
+// files written differently as different even if they look the same.
+type ContentFingerprint struct{}
+
+func (ContentFingerprint) Name() string { return "content" }
+
+func (ContentFingerprint) Fingerprint(p FingerprintPage) (string, error) {
+	content, err := p.Content()
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+func (ContentFingerprint) Match(a, b string) bool { return a == b }
+
+// Look up a fingerprint by name: sha256, phash or content
+func ParseFingerprinter(name string) (Fingerprinter, error) {
+	switch name {
+	case "sha256":
+		return RasterFingerprint{}, nil
+	case "phash":
+		return PerceptualFingerprint{MaxDistance: 6}, nil
+	case "content":
+		return ContentFingerprint{}, nil
+	}
+	return nil, fmt.Errorf("unknown fingerprint %q", name)
+}
+
+// Fingerprint every page of a file.  Pages are rendered at the resolution
+// in the options if the fingerprint needs them.
+func FingerprintPages(filename string, fp Fingerprinter, opts ...Option) ([]string, error) {
+	o := DefaultOptions()
+	for _, opt := range opts {
+		opt(&o)
+	}
+	pages, err := PageCount(filename)
+	if err != nil {
+		return nil, fmt.Errorf("error getting page count for %s: %w", filename, err)
+	}
+
+	var ctx *model.Context
+	var src pageSource = &perPageSource{filename: filename, resolution: o.Resolution, color: o.Color, format: o.RenderFormat, extra: o.RendererArgs, limits: o.Limits, timeout: o.RenderTimeout, ctx: o.Context}
+	checksum := ""
+	if o.Cache != nil {
+		if checksum, err = Checksum(filename); err != nil {
+			return nil, err
+		}
+		src = &cachedSource{pageSource: src, cache: o.Cache, checksum: checksum, o: o}
+	}
+	prints := make([]string, pages)
+	for i := range prints {
+		page := i + 1
+		if o.Cache != nil {
+			if p, ok := o.Cache.Get(fingerprintKey(checksum, fp, o.Resolution, page)); ok {
+				prints[i] = string(p)
+				continue
+			}
+		}
+		p := FingerprintPage{
+			File: filename,
+			Page: page,
+			Render: func() (image.Image, error) {
+				img, err := src.page(page)
+				if err != nil {
+					return nil, err
+				}
+				return rgbToPNG(img), nil
+			},
+			Content: func() ([]byte, error) {
+				if ctx == nil {
+					c, err := readContext(filename)
+					if err != nil {
+						return nil, err
+					}
+					ctx = c
+				}
+				return pageContentBytes(ctx, page)
+			},
+		}
+		prints[i], err = fp.Fingerprint(p)
+		if err != nil {
+			return nil, fmt.Errorf("error fingerprinting page %d of %s: %w", page, filename, err)
+		}
+		if o.Cache != nil {
+			o.Cache.Put(fingerprintKey(checksum, fp, o.Resolution, page), []byte(prints[i]))
+		}
+	}
+	return prints, nil
+}
+
+// The content stream of a page followed by everything else that affects how
+// it is drawn
+func pageContentBytes(ctx *model.Context, page int) ([]byte, error) {
+	content, _, err := pageContent(ctx, page)
+	if err != nil {
+		return nil, err
+	}
+	res, err := pageResourceBytes(ctx, page)
+	if err != nil {
+		return nil, err
+	}
+	return append(slices.Clone(content), res...), nil
+}
+
+func sortedKeys(d types.Dict) []string {
+	keys := make([]string, 0, len(d))
+	for k := range d {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	return keys
+}
@@ -0,0 +1,91 @@
+package pdfcomp
+
+import "fmt"
+
+// How renderings of a page that come out at different sizes, as pages with
+// different media boxes or rotations do, are brought to the same size to be
+// compared
+type SizeFit string
+
+const (
+	// Fail the comparison, as when no fit is given
+	FitNone SizeFit = ""
+	// Extend both renderings with white to the larger of each dimension
+	FitPad SizeFit = "pad"
+	// Cut both renderings down to the smaller of each dimension
+	FitCrop SizeFit = "crop"
+	// Stretch or shrink file2's rendering to the size of file1's
+	FitScale SizeFit = "scale"
+)
+
+// Convert a fit name, as given on the command line, to a SizeFit
+func ParseSizeFit(s string) (SizeFit, error) {
+	switch SizeFit(s) {
+	case FitNone, FitPad, FitCrop, FitScale:
+		return SizeFit(s), nil
+	}
+	return "", fmt.Errorf("unknown fit %q, expected pad, crop or scale", s)
+}
+
+// The sizes a page rendered at in each file, when they differ, and how they
+// were brought to the same size.  Padding and cropping keep the top left
+// corners of the pages together.
+type SizeMismatch struct {
+	Width1, Height1 int
+	Width2, Height2 int
+	Fit             SizeFit
+	// The size the renderings were compared at, in pixels
+	Width, Height int
+}
+
+func (m *SizeMismatch) String() string {
+	s := fmt.Sprintf("rendered at %dx%d pixels in file1 and %dx%d in file2", m.Width1, m.Height1, m.Width2, m.Height2)
+	switch m.Fit {
+	case FitPad:
+		return fmt.Sprintf("%s, padded to %dx%d", s, m.Width, m.Height)
+	case FitCrop:
+		return fmt.Sprintf("%s, cropped to %dx%d", s, m.Width, m.Height)
+	case FitScale:
+		return fmt.Sprintf("%s, file2 scaled to %dx%d", s, m.Width, m.Height)
+	}
+	return s
+}
+
+// Bring two renderings of different sizes to the same size as fit says.
+// Renderings of the same size are returned as they are with a nil
+// SizeMismatch, and with FitNone, so are renderings of different sizes.
+func fitPages(img1, img2 *Image, fit SizeFit) (*Image, *Image, *SizeMismatch) {
+	if img1.H == 0 || img2.H == 0 {
+		return img1, img2, nil
+	}
+	m := &SizeMismatch{Width1: img1.W, Height1: img1.H, Width2: img2.W, Height2: img2.H, Fit: fit}
+	if m.Width1 == m.Width2 && m.Height1 == m.Height2 {
+		return img1, img2, nil
+	}
+	switch fit {
+	case FitPad:
+		m.Width, m.Height = max(m.Width1, m.Width2), max(m.Height1, m.Height2)
+		return padImage(img1, m.Height, m.Width), padImage(img2, m.Height, m.Width), m
+	case FitCrop:
+		m.Width, m.Height = min(m.Width1, m.Width2), min(m.Height1, m.Height2)
+		top := Region{Width: m.Width, Height: m.Height}
+		return img1.sub(top), img2.sub(top), m
+	case FitScale:
+		m.Width, m.Height = m.Width1, m.Height1
+		return img1, resizeImage(img2, m.Height, m.Width), m
+	}
+	return img1, img2, m
+}
+
+// An image extended with white to h rows of w pixels.  An image that is
+// already that size is kept.
+func padImage(img *Image, h, w int) *Image {
+	if img.H == h && img.W == w {
+		return img
+	}
+	out := NewImage(w, h, img.Channels)
+	for y := range img.H {
+		copy(out.Row(y), img.Row(y))
+	}
+	return out
+}
@@ -0,0 +1,139 @@
+package pdfcomp
+
+import (
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/model"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/types"
+)
+
+// The fonts the renderer had to substitute on a page of each file, because
+// they were not embedded or it reported it could not use them.  What it
+// substitutes them with depends on the fonts installed where it runs.
+type FontSubstitution struct {
+	File1 []string
+	File2 []string
+}
+
+func (f *FontSubstitution) String() string {
+	list := func(fonts []string) string {
+		if len(fonts) == 0 {
+			return "none"
+		}
+		return strings.Join(fonts, ", ")
+	}
+	return "fonts substituted in file1: " + list(f.File1) + "; in file2: " + list(f.File2)
+}
+
+// True if a font was substituted in one file but not the other
+func (f *FontSubstitution) differs() bool {
+	return f != nil && !slices.Equal(f.File1, f.File2)
+}
+
+// True if the page differs and a font was substituted for one file but not
+// the other, so the difference may come from the fonts installed where the
+// page was rendered rather than from the files
+func (pr PageResult) PossiblyEnvironmental() bool {
+	return !pr.Equal && pr.Fonts.differs()
+}
+
+// The fonts substituted on a page of each file, from the font descriptors
+// and the messages the renderer gave, or nil if there were none
+func pageSubstitution(ctx1, ctx2 *model.Context, page int, messages1, messages2 string) *FontSubstitution {
+	f := &FontSubstitution{
+		File1: substitutedFonts(ctx1, page, messages1),
+		File2: substitutedFonts(ctx2, page, messages2),
+	}
+	if len(f.File1) == 0 && len(f.File2) == 0 {
+		return nil
+	}
+	return f
+}
+
+// Fonts of a page that are not embedded, together with any the renderer
+// complained about, sorted and without duplicates
+func substitutedFonts(ctx *model.Context, page int, messages string) []string {
+	fonts := rendererFontWarnings(messages)
+	d, _, inh, err := ctx.PageDict(page, false)
+	if err == nil {
+		res := inh.Resources
+		if res == nil {
+			res, _ = dictEntry(ctx, d, "Resources").(types.Dict)
+		}
+		fonts = append(fonts, unembeddedFonts(ctx, res, map[int]bool{}, 0)...)
+	}
+	slices.Sort(fonts)
+	return slices.Compact(fonts)
+}
+
+// Fonts used by resources, or by the forms they draw, that have no embedded
+// program.  Type 3 fonts are drawn from the document and need none.
+func unembeddedFonts(ctx *model.Context, res types.Dict, seen map[int]bool, depth int) []string {
+	if res == nil || depth > maxStructDepth {
+		return nil
+	}
+	var fonts []string
+	if fontDict, ok := dictEntry(ctx, res, "Font").(types.Dict); ok {
+		for _, name := range sortedKeys(fontDict) {
+			o, _ := ctx.Dereference(fontDict[name])
+			font := asDict(o)
+			if font == nil {
+				continue
+			}
+			if subtype, _ := dictEntry(ctx, font, "Subtype").(types.Name); subtype == "Type3" {
+				continue
+			}
+			if fontProgram(ctx, font) == nil {
+				if base, ok := dictEntry(ctx, font, "BaseFont").(types.Name); ok {
+					fonts = append(fonts, fontName(base.Value()))
+				}
+			}
+		}
+	}
+	if xobjs, ok := dictEntry(ctx, res, "XObject").(types.Dict); ok {
+		for _, name := range sortedKeys(xobjs) {
+			if ref, ok := xobjs[name].(types.IndirectRef); ok {
+				// Forms may draw each other
+				if seen[ref.ObjectNumber.Value()] {
+					continue
+				}
+				seen[ref.ObjectNumber.Value()] = true
+			}
+			sd, _, err := ctx.DereferenceStreamDict(xobjs[name])
+			if err != nil || sd == nil {
+				continue
+			}
+			if subtype, _ := dictEntry(ctx, sd.Dict, "Subtype").(types.Name); subtype != "Form" {
+				continue
+			}
+			formRes, _ := dictEntry(ctx, sd.Dict, "Resources").(types.Dict)
+			fonts = append(fonts, unembeddedFonts(ctx, formRes, seen, depth+1)...)
+		}
+	}
+	return fonts
+}
+
+// A quoted font name in a renderer message about fonts, as in xpdf's
+// "No display font for 'Arial'" or poppler's "Couldn't find a font for 'Arial'"
+var fontWarning = regexp.MustCompile(`(?i)font.*?['"]([^'"]+)['"]`)
+
+// The fonts named by renderer messages about fonts
+func rendererFontWarnings(messages string) []string {
+	var fonts []string
+	for _, line := range strings.Split(messages, "\n") {
+		if m := fontWarning.FindStringSubmatch(line); m != nil {
+			fonts = append(fonts, fontName(m[1]))
+		}
+	}
+	return fonts
+}
+
+// A font name without the tag that marks a subset, as in ABCDEF+Arial
+func fontName(name string) string {
+	if i := strings.IndexByte(name, '+'); i == 6 {
+		return name[i+1:]
+	}
+	return name
+}
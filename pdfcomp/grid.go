@@ -0,0 +1,115 @@
+package pdfcomp
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"strconv"
+
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/basicfont"
+	"golang.org/x/image/math/fixed"
+)
+
+// Colour of grid lines, ruler ticks and ruler numbers: a blue that stays
+// clear of the highlight colours most often used
+var gridColor = color.RGBA{0, 90, 160, 255}
+
+// How strongly grid lines are blended into the page, and how far the ruler
+// bands are faded to white behind their numbers
+const (
+	gridOpacity  = 0.3
+	rulerOpacity = 0.85
+)
+
+// Draw a grid over an RGB image rendered at dpi, with rulers along
+// its top and left edges numbered in the grid's unit from the top left corner
+// of the page.  Nothing is drawn if the lines would be too close to tell
+// apart.
+func drawGrid(img *Image, g Grid, dpi int) {
+	if g.Spacing <= 0 || img.H == 0 {
+		return
+	}
+	step := g.Spacing * g.Unit.points() * float64(dpi) / 72
+	if step < 4 {
+		return
+	}
+	height, width := img.H, img.W
+	// The built in font is small, so it is enlarged with the resolution to
+	// stay readable at about the same size on the page
+	scale := max(1, dpi/100)
+	thickness := max(1, dpi/150)
+	face := basicfont.Face7x13
+	lines := func(n int) int { return int(float64(n-1) / step) }
+
+	// Number every line if there is room, or every few lines if not
+	labels := make([]string, max(lines(width), lines(height))+1)
+	widest := 0
+	for i := range labels {
+		labels[i] = strconv.FormatFloat(float64(i)*g.Spacing, 'f', -1, 64)
+		widest = max(widest, font.MeasureString(face, labels[i]).Ceil()*scale)
+	}
+	every := int(math.Ceil(float64(widest+4*scale) / step))
+	top := face.Height*scale + 2*scale
+	left := max(widest, font.MeasureString(face, string(g.Unit)).Ceil()*scale) + 2*scale
+
+	grid := Highlight{Color: gridColor, Opacity: gridOpacity}
+	ruler := Highlight{Color: color.RGBA{255, 255, 255, 255}, Opacity: rulerOpacity}
+	for y := range height {
+		row := img.Row(y)
+		for x := range width {
+			hl := &grid
+			switch {
+			case y < top || x < left:
+				hl = &ruler
+			case int(math.Mod(float64(x), step)) >= thickness && int(math.Mod(float64(y), step)) >= thickness:
+				continue
+			}
+			i := x * 3
+			row[i], row[i+1], row[i+2] = highlightPixel(row[i], row[i+1], row[i+2], *hl)
+		}
+	}
+
+	for n := 1; n <= lines(width); n++ {
+		x := int(float64(n) * step)
+		fillRect(img, x, 0, thickness, top)
+		if n%every == 0 && x+scale+widest <= width {
+			drawLabel(img, labels[n], x+2*scale, scale, scale)
+		}
+	}
+	for n := 1; n <= lines(height); n++ {
+		y := int(float64(n) * step)
+		fillRect(img, 0, y, left, thickness)
+		if n%every == 0 && y+scale+top <= height {
+			drawLabel(img, labels[n], scale, y+scale, scale)
+		}
+	}
+	drawLabel(img, string(g.Unit), scale, scale, scale)
+}
+
+// Fill a rectangle of an RGB image with the grid colour, clipped to the image
+func fillRect(img *Image, x0, y0, width, height int) {
+	for y := max(y0, 0); y < y0+height && y < img.H; y++ {
+		row := img.Row(y)
+		for x := max(x0, 0); x < x0+width && x < img.W; x++ {
+			row[x*3], row[x*3+1], row[x*3+2] = gridColor.R, gridColor.G, gridColor.B
+		}
+	}
+}
+
+// Write text in the grid colour with its top left corner at x, y, enlarging
+// the built in font scale times
+func drawLabel(img *Image, text string, x, y, scale int) {
+	face := basicfont.Face7x13
+	mask := image.NewAlpha(image.Rect(0, 0, font.MeasureString(face, text).Ceil(), face.Height))
+	d := font.Drawer{Dst: mask, Src: image.Opaque, Face: face, Dot: fixed.P(0, face.Ascent)}
+	d.DrawString(text)
+	b := mask.Bounds()
+	for my := range b.Dy() {
+		for mx := range b.Dx() {
+			if mask.AlphaAt(mx, my).A != 0 {
+				fillRect(img, x+mx*scale, y+my*scale, scale, scale)
+			}
+		}
+	}
+}
@@ -0,0 +1,240 @@
+package pdfcomp
+
+import (
+	"bytes"
+	"encoding/base64"
+	"html/template"
+	"image/png"
+	"io"
+)
+
+// Data handed to the report template for each differing page
+type htmlPage struct {
+	Page   int
+	Left   template.URL
+	Right  template.URL
+	Before template.URL
+	After  template.URL
+	// The differing regions, which reviewers can accept or reject
+	Regions []htmlRegion
+	// Close-ups of the regions with the most differences
+	Details []htmlDetail
+	// What was done to the renderings to bring them together
+	Adjustments []string
+}
+
+// A differing region in the report, with where it is in points on the page
+// of each file if that is known
+type htmlRegion struct {
+	Region
+	Points1, Points2 string
+}
+
+// A close-up of a region of differences in the report
+type htmlDetail struct {
+	Caption string
+	Image   template.URL
+}
+
+// What the report's review export records about the comparison
+type htmlReview struct {
+	Checksum1  string
+	Checksum2  string
+	Resolution int
+}
+
+// Write a self-contained html report for a comparison.  Images are embedded as
+// data URIs so the report can be passed around as a single file.  Reviewers
+// can accept or reject each differing region and export their decisions for
+// ReadReview.
+func writeHTMLReport(w io.Writer, res *Result, file1, file2 string, resolution int) error {
+	review := htmlReview{Resolution: resolution}
+	var err error
+	if review.Checksum1, err = Checksum(file1); err != nil {
+		return err
+	}
+	if review.Checksum2, err = Checksum(file2); err != nil {
+		return err
+	}
+	var pages []htmlPage
+	for _, pr := range res.DiffPages() {
+		if pr.raw1 == nil {
+			// Only the annotations differ, so there is nothing to show
+			continue
+		}
+		hp := htmlPage{Page: pr.Page, Adjustments: pr.Adjustments()}
+		for i, r := range pr.Regions {
+			hr := htmlRegion{Region: r}
+			if i < len(pr.UserSpace1) && i < len(pr.UserSpace2) {
+				hr.Points1, hr.Points2 = pr.UserSpace1[i].String(), pr.UserSpace2[i].String()
+			}
+			hp.Regions = append(hp.Regions, hr)
+		}
+		for _, img := range []struct {
+			dst *template.URL
+			img *Image
+		}{
+			{&hp.Left, pr.hl1}, {&hp.Right, pr.hl2}, {&hp.Before, pr.raw1}, {&hp.After, pr.raw2},
+		} {
+			*img.dst, err = dataURI(img.img)
+			if err != nil {
+				return err
+			}
+		}
+		for i, img := range pr.details {
+			uri, err := dataURI(img)
+			if err != nil {
+				return err
+			}
+			hp.Details = append(hp.Details, htmlDetail{Caption: detailCaption(pr.Details[i]), Image: uri})
+		}
+		pages = append(pages, hp)
+	}
+
+	return reportTemplate.Execute(w, struct {
+		*Result
+		Diffs  []htmlPage
+		Review htmlReview
+	}{res, pages, review})
+}
+
+// Encode an image as a png data URI
+func dataURI(img *Image) (template.URL, error) {
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, rgbToPNG(img)); err != nil {
+		return "", err
+	}
+	return template.URL("data:image/png;base64," + base64.StdEncoding.EncodeToString(buf.Bytes())), nil
+}
+
+var reportTemplate = template.Must(template.New("report").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>pdfcomp: {{.File1}} vs {{.File2}}</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+table { border-collapse: collapse; }
+td, th { border: 1px solid #999; padding: 0.2em 0.8em; }
+.same { color: #070; }
+.different { color: #b00; font-weight: bold; }
+.thumbs img { width: 45%; border: 1px solid #999; margin-right: 1%; }
+.regions td { padding-right: 1em; }
+.details figure { display: inline-block; margin: 0.5em 1em 0.5em 0; }
+.details img { max-width: 100%; border: 1px solid #999; }
+.slider { position: relative; display: inline-block; max-width: 92%; border: 1px solid #999; }
+.slider img { display: block; max-width: 100%; }
+.slider img.after { position: absolute; top: 0; left: 0; clip-path: inset(0 0 0 50%); }
+</style>
+</head>
+<body>
+<h1>PDF comparison</h1>
+<table>
+<tr><th>File 1</th><td>{{.File1}}</td><td>{{.Pages1}} pages</td></tr>
+<tr><th>File 2</th><td>{{.File2}}</td><td>{{.Pages2}} pages</td></tr>
+<tr><th>Result</th><td colspan="2">{{if .Equal}}<span class="same">visually the same</span>{{else}}<span class="different">different</span>{{end}}</td></tr>
+{{if or .SignaturesRemoved .SignaturesAdded}}<tr><th>Signatures</th><td colspan="2">
+{{- range .SignaturesRemoved}}<span class="different">- {{.}}</span><br>{{end}}
+{{- range .SignaturesAdded}}<span class="different">+ {{.}}</span><br>{{end}}</td></tr>
+{{end}}{{if or .LayersRemoved .LayersAdded}}<tr><th>Layers</th><td colspan="2">
+{{- range .LayersRemoved}}<span class="different">- {{.}}</span><br>{{end}}
+{{- range .LayersAdded}}<span class="different">+ {{.}}</span><br>{{end}}</td></tr>
+{{end}}{{if or .LabelsRemoved .LabelsAdded}}<tr><th>Page labels</th><td colspan="2">
+{{- range .LabelsRemoved}}<span class="different">- {{.}}</span><br>{{end}}
+{{- range .LabelsAdded}}<span class="different">+ {{.}}</span><br>{{end}}</td></tr>
+{{end}}{{with .SizeWarnings}}<tr><th>Page sizes</th><td colspan="2">
+{{- range .}}<span class="different">{{.}}</span><br>{{end}}</td></tr>
+{{end}}</table>
+
+<h2>Summary</h2>
+<table>
+<tr><th>Page</th><th>Status</th></tr>
+{{range .Pages}}<tr><td>{{.Page}}</td><td>{{if .Equal}}<span class="same">same</span>{{else}}<a class="different" href="#page-{{.Page}}">different</a>{{with .Artifact}}, image {{.}}{{end}}{{with .Error}}: {{.}}{{end}}{{with .Cause}}, probably {{.}}{{end}}{{if .PossiblyEnvironmental}}, possibly environmental: {{.Fonts}}{{end}}{{end}}{{range .Adjustments}} ({{.}}){{end}}{{range .Notes}}<br>{{.}}{{end}}</td></tr>
+{{if or .AnnotationsRemoved .AnnotationsAdded}}<tr><td></td><td>annotations:
+{{range .AnnotationsRemoved}}<br><span class="different">- {{.}}</span>{{end}}
+{{range .AnnotationsAdded}}<br><span class="different">+ {{.}}</span>{{end}}</td></tr>
+{{end}}{{if or .LinksRemoved .LinksAdded}}<tr><td></td><td>links:
+{{range .LinksRemoved}}<br><span class="different">- {{.}}</span>{{end}}
+{{range .LinksAdded}}<br><span class="different">+ {{.}}</span>{{end}}</td></tr>
+{{end}}{{end}}</table>
+
+{{if .Embedded}}
+<h2>Embedded documents</h2>
+{{template "embedded" .Embedded}}
+{{end}}
+
+{{if .Diffs}}
+<h2>Review</h2>
+<p id="review" data-file1="{{.File1}}" data-file2="{{.File2}}" data-checksum1="{{.Review.Checksum1}}" data-checksum2="{{.Review.Checksum2}}" data-resolution="{{.Review.Resolution}}">
+Accept or reject each differing region below, then
+<button onclick="exportReview()">export decisions</button>
+<span id="review-count"></span></p>
+{{end}}
+{{range .Diffs}}
+<h2 id="page-{{.Page}}">Page {{.Page}}</h2>
+{{with .Adjustments}}<p>Before comparing: {{range $i, $a := .}}{{if $i}}; {{end}}{{$a}}{{end}}</p>
+{{end}}<div class="thumbs"><img src="{{.Left}}" alt="file 1, page {{.Page}}"><img src="{{.Right}}" alt="file 2, page {{.Page}}"></div>
+{{with .Details}}<div class="details">
+{{range .}}<figure><img src="{{.Image}}" alt="{{.Caption}}"><figcaption>{{.Caption}}</figcaption></figure>
+{{end}}</div>
+{{end}}{{$page := .Page}}{{with .Regions}}<table class="regions">
+{{range $i, $r := .}}<tr class="region" data-page="{{$page}}" data-x="{{$r.X}}" data-y="{{$r.Y}}" data-width="{{$r.Width}}" data-height="{{$r.Height}}" data-pixels="{{$r.Pixels}}">
+<td>{{$r.Width}}x{{$r.Height}} at {{$r.X}},{{$r.Y}}</td>
+<td>{{with $r.Points1}}{{.}} pt in file 1, {{$r.Points2}} in file 2{{end}}</td>
+<td><label><input type="radio" name="region-{{$page}}-{{$i}}" value="accepted" onchange="countReview()"> accept</label>
+<label><input type="radio" name="region-{{$page}}-{{$i}}" value="rejected" onchange="countReview()"> reject</label></td></tr>
+{{end}}</table>{{end}}
+<p>
+<select onchange="setMode({{.Page}}, this.value)"><option value="swipe">swipe</option><option value="onion">onion skin</option></select>
+<input type="range" min="0" max="100" value="50" id="range-{{.Page}}" oninput="update({{.Page}})">
+</p>
+<div class="slider"><img src="{{.Before}}" alt="file 1"><img class="after" id="after-{{.Page}}" src="{{.After}}" alt="file 2"></div>
+{{end}}
+
+<script>
+function decisions() {
+	var out = [];
+	document.querySelectorAll("tr.region").forEach(function(tr) {
+		var checked = tr.querySelector("input:checked");
+		if (!checked) {
+			return;
+		}
+		var d = tr.dataset;
+		out.push({Page: +d.page, X: +d.x, Y: +d.y, Width: +d.width, Height: +d.height, Pixels: +d.pixels, Status: checked.value});
+	});
+	return out;
+}
+function countReview() {
+	var n = document.querySelectorAll("tr.region").length;
+	document.getElementById("review-count").textContent = decisions().length + " of " + n + " regions decided";
+}
+function exportReview() {
+	var d = document.getElementById("review").dataset;
+	var review = {File1: d.file1, File2: d.file2, Checksum1: d.checksum1, Checksum2: d.checksum2,
+		Resolution: +d.resolution, Decisions: decisions()};
+	var a = document.createElement("a");
+	a.href = URL.createObjectURL(new Blob([JSON.stringify(review, null, 2)], {type: "application/json"}));
+	a.download = d.file1.split(/[\\/]/).pop() + "-review.json";
+	a.click();
+}
+var modes = {};
+function setMode(page, mode) { modes[page] = mode; update(page); }
+function update(page) {
+	var v = document.getElementById("range-" + page).value;
+	var img = document.getElementById("after-" + page);
+	if (modes[page] === "onion") {
+		img.style.clipPath = "none";
+		img.style.opacity = v / 100;
+	} else {
+		img.style.opacity = 1;
+		img.style.clipPath = "inset(0 0 0 " + v + "%)";
+	}
+}
+</script>
+</body>
+</html>
+{{define "embedded"}}<ul>
+{{range .}}<li>{{.Name}}: {{if not .InFile2}}<span class="different">only in file 1</span>{{else if not .InFile1}}<span class="different">only in file 2</span>{{else if .Equal}}<span class="same">same</span>{{else}}<span class="different">different{{with .Result.DiffPages}}, {{len .}} pages differ{{end}}</span>{{end}}
+{{if .Result}}{{with .Result.Embedded}}{{template "embedded" .}}{{end}}{{end}}</li>
+{{end}}</ul>{{end}}
+`))
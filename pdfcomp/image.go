@@ -0,0 +1,129 @@
+package pdfcomp
+
+import (
+	"image"
+	"sync"
+)
+
+// A rendered page, or an image made from one, held in a single buffer so
+// that whole rows can be compared and copied at once
+type Image struct {
+	// The pixels, row after row, Channels bytes to a pixel: red, green and
+	// blue, or gray
+	Pix []byte
+	// The bytes from the start of one row to the start of the next
+	Stride int
+	// The size in pixels
+	W, H int
+	// The bytes to a pixel, 3 or 1
+	Channels int
+	// Set if the pixels are part of another image's buffer
+	shared bool
+}
+
+// A white image of the given size in pixels
+func NewImage(w, h, channels int) *Image {
+	img := newImage(w, h, channels)
+	for i := range img.Pix {
+		img.Pix[i] = 255
+	}
+	return img
+}
+
+// An image of the given size in pixels with every byte zero, which for a
+// difference or mask means nothing is marked
+func newImage(w, h, channels int) *Image {
+	pix := getPix(w * h * channels)
+	clear(pix)
+	return &Image{Pix: pix, Stride: w * channels, W: w, H: h, Channels: channels}
+}
+
+// Buffers of pages whose comparison is over, for later pages to reuse when
+// there is a MemoryBudget.  The pages of a document are mostly the same
+// size, so most buffers fit the next page.
+var pixPool sync.Pool
+
+// A buffer of n bytes, which may hold anything
+func getPix(n int) []byte {
+	if p, ok := pixPool.Get().(*[]byte); ok && cap(*p) >= n {
+		return (*p)[:n]
+	}
+	return make([]byte, n)
+}
+
+// Give the buffers of images no longer needed back for reuse, each once
+// however many of the images share it.  Images cropped from another, which
+// hold only part of its buffer, are left to the garbage collector.  Nothing
+// may use the images afterwards.
+func releaseImages(imgs ...*Image) {
+	seen := map[*byte]bool{}
+	for _, img := range imgs {
+		if img == nil || img.shared || len(img.Pix) == 0 || seen[&img.Pix[0]] {
+			continue
+		}
+		seen[&img.Pix[0]] = true
+		pix := img.Pix
+		pixPool.Put(&pix)
+	}
+}
+
+// The pixels of row y
+func (img *Image) Row(y int) []byte {
+	start := y * img.Stride
+	return img.Pix[start : start+img.W*img.Channels]
+}
+
+// The area r of the image, sharing its buffer
+func (img *Image) sub(r Region) *Image {
+	start := r.Y*img.Stride + r.X*img.Channels
+	end := start + (r.Height-1)*img.Stride + r.Width*img.Channels
+	return &Image{Pix: img.Pix[start:end:end], Stride: img.Stride, W: r.Width, H: r.Height, Channels: img.Channels, shared: true}
+}
+
+// A copy of the image in a buffer of its own
+func (img *Image) clone() *Image {
+	out := newImage(img.W, img.H, img.Channels)
+	for y := range img.H {
+		copy(out.Row(y), img.Row(y))
+	}
+	return out
+}
+
+// A copy of a standard library image as an Image, gray if it is gray and
+// otherwise red, green and blue, leaving out any alpha
+func imageFrom(src image.Image) *Image {
+	b := src.Bounds()
+	switch src := src.(type) {
+	case *image.Gray:
+		img := newImage(b.Dx(), b.Dy(), 1)
+		for y := range img.H {
+			copy(img.Row(y), src.Pix[y*src.Stride:])
+		}
+		return img
+	case *image.RGBA:
+		return fromRGBA(src.Pix, src.Stride, b.Dx(), b.Dy())
+	case *image.NRGBA:
+		return fromRGBA(src.Pix, src.Stride, b.Dx(), b.Dy())
+	}
+	img := newImage(b.Dx(), b.Dy(), 3)
+	for y := range img.H {
+		row := img.Row(y)
+		for x := range img.W {
+			r, g, bl, _ := src.At(b.Min.X+x, b.Min.Y+y).RGBA()
+			row[3*x], row[3*x+1], row[3*x+2] = byte(r>>8), byte(g>>8), byte(bl>>8)
+		}
+	}
+	return img
+}
+
+// An Image of the red, green and blue of four byte pixels
+func fromRGBA(pix []byte, stride, w, h int) *Image {
+	img := newImage(w, h, 3)
+	for y := range h {
+		src, row := pix[y*stride:], img.Row(y)
+		for x := range w {
+			row[3*x], row[3*x+1], row[3*x+2] = src[4*x], src[4*x+1], src[4*x+2]
+		}
+	}
+	return img
+}
@@ -8,25 +8,42 @@ import (
 	"errors"
 	"fmt"
 	"image"
-	"image/color"
+	"image/png"
 	"io"
-	"os"
+	"runtime"
 	"strconv"
-	"strings"
+	"sync"
 )
 
-// Find out if two image matrices are identical.  If diff is set, create a
-// matrix of locations where there are differences.
-func equalImgMatrix(mat1 [][]byte, mat2 [][]byte, diff bool) (bool, [][]bool, error) {
-
-	// First, quick check with hashes
-	sha1, err := hash(mat1)
-	if err != nil {
-		return false, nil, err
+// Pages with more pixels than this are diffed by several goroutines, each
+// taking a band of rows.  Smaller pages are not worth the overhead.
+const parallelDiffPixels = 4_000_000
+
+// Rows are compared in chunks of 192 bytes, which is three 64-byte cache lines
+// and also a whole number of RGB or gray pixels, so a chunk never splits a
+// pixel.
+const chunkBytes = 192
+
+// Find out if two images are identical.  If diff is set, create a one
+// channel image of how much each pixel differs.
+func equalImages(img1, img2 *Image, diff bool) (bool, *Image, error) {
+
+	// First, quick check with hashes, computing both at once
+	var sha1, sha2 []byte
+	var err1, err2 error
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		sha1, err1 = hash(img1)
+	}()
+	sha2, err2 = hash(img2)
+	wg.Wait()
+	if err1 != nil {
+		return false, nil, err1
 	}
-	sha2, err := hash(mat2)
-	if err != nil {
-		return false, nil, err
+	if err2 != nil {
+		return false, nil, err2
 	}
 
 	if bytes.Equal(sha1, sha2) {
@@ -34,16 +51,12 @@ func equalImgMatrix(mat1 [][]byte, mat2 [][]byte, diff bool) (bool, [][]bool, er
 	}
 
 	if diff {
-		if GlobDebug {
-			fmt.Fprintf(os.Stderr, "generating difference files for matrices %dx%d\n", len(mat1), len(mat1[0]))
-		}
-		diff, err := diffMatrix(mat1, mat2)
-		if GlobDebug {
-			fmt.Fprintf(os.Stderr, "received difference matrix %dx%d\n", len(diff), len(diff[0]))
-		}
+		log().Debug("generating difference images", "height", img1.H, "width", img1.W)
+		diff, err := diffMatrix(img1, img2)
 		if err != nil {
 			return false, nil, err
 		}
+		log().Debug("received difference matrix", "height", diff.H, "width", diff.W)
 
 		return false, diff, nil
 	}
@@ -51,30 +64,101 @@ func equalImgMatrix(mat1 [][]byte, mat2 [][]byte, diff bool) (bool, [][]bool, er
 	return false, nil, nil
 }
 
-// Given two RGB matrices, return a matrix that is true for every different pixel
-func diffMatrix(mat1 [][]byte, mat2 [][]byte) ([][]bool, error) {
-	if len(mat1) != len(mat2) {
+// Given two images with the same number of channels, return a one channel
+// image giving for every pixel the largest difference in any of its
+// channels, so zero where the pixels are the same.  Large pages are split
+// into bands of rows which are diffed concurrently.
+func diffMatrix(img1, img2 *Image) (*Image, error) {
+	if img1.H != img2.H {
 		return nil, errors.New("diffMatrix: inputs do not have the same height")
 	}
+	if img1.W != img2.W || img1.Channels != img2.Channels {
+		return nil, errors.New("diffMatrix: inputs do not have the same width")
+	}
 
-	diff := make([][]bool, len(mat1))
-	for y := range mat1 {
-		if len(mat1[y]) != len(mat2[y]) {
-			return nil, errors.New("diffMatrix: inputs do not have the same width at row " + strconv.Itoa(y))
-		}
-		diff[y] = make([]bool, len(mat1[y])/3)
-		for x := range len(mat1[y]) / 3 {
-			diff[y][x] = !bytes.Equal(mat1[y][x*3:(x+1)*3], mat2[y][x*3:(x+1)*3])
+	diff := newImage(img1.W, img1.H, 1)
+	diffRows := func(start, end int) {
+		for y := start; y < end; y++ {
+			diffRow(diff.Row(y), img1.Row(y), img2.Row(y), img1.Channels)
 		}
 	}
+
+	if img1.W*img1.H < parallelDiffPixels {
+		diffRows(0, img1.H)
+		return diff, nil
+	}
+
+	workers := runtime.NumCPU()
+	band := (img1.H + workers - 1) / workers
+	var wg sync.WaitGroup
+	for start := 0; start < img1.H; start += band {
+		end := min(start+band, img1.H)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			diffRows(start, end)
+		}()
+	}
+	wg.Wait()
 	return diff, nil
 }
 
-// Compute the sha256 hash for a 2d byte matrix
-func hash(mat [][]byte) ([]byte, error) {
+// Diff a single row of channels bytes to a pixel into diff, which must be
+// zero.  Most rows of most pages are identical, so whole rows are compared
+// first with bytes.Equal, which is vectorised.  In rows that differ,
+// identical chunks are skipped with a word-wise comparison, and only chunks
+// that differ are examined pixel by pixel.
+func diffRow(diff, row1, row2 []byte, channels int) {
+	if bytes.Equal(row1, row2) {
+		return
+	}
+	for start := 0; start < len(row1); start += chunkBytes {
+		end := min(start+chunkBytes, len(row1))
+		if equalChunk(row1[start:end], row2[start:end]) {
+			continue
+		}
+		if channels == 1 {
+			for x := start; x < end; x++ {
+				diff[x] = absDiff(row1[x], row2[x])
+			}
+			continue
+		}
+		for x := start / 3; x < end/3; x++ {
+			i := x * 3
+			diff[x] = max(absDiff(row1[i], row2[i]), absDiff(row1[i+1], row2[i+1]), absDiff(row1[i+2], row2[i+2]))
+		}
+	}
+}
+
+func absDiff(a, b byte) byte {
+	if a > b {
+		return a - b
+	}
+	return b - a
+}
+
+// Compare two byte slices of the same length eight bytes at a time, by XORing
+// them as 64-bit words.
+func equalChunk(a, b []byte) bool {
+	i := 0
+	for ; i+8 <= len(a); i += 8 {
+		if binary.LittleEndian.Uint64(a[i:])^binary.LittleEndian.Uint64(b[i:]) != 0 {
+			return false
+		}
+	}
+	for ; i < len(a); i++ {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// Compute the sha256 hash of the pixels of an image
+func hash(img *Image) ([]byte, error) {
 	h := sha256.New()
-	for y := range mat {
-		_, err := h.Write(mat[y])
+	for y := range img.H {
+		_, err := h.Write(img.Row(y))
 		if err != nil {
 			return nil, err
 		}
@@ -82,212 +166,568 @@ func hash(mat [][]byte) ([]byte, error) {
 	return h.Sum(nil), nil
 }
 
-// Read a PPM file into a 2D byte matrix
-func ppmToMatrix(rd io.Reader) ([][]byte, error) {
-	reader := bufio.NewReader(rd)
+// Read a page the renderer wrote in format, which must be resolved, into an
+// image of channels bytes to a pixel
+func pageImage(rd io.Reader, format RenderFormat, channels int) (*Image, error) {
+	return readPage(bufio.NewReader(rd), format, channels)
+}
 
-	// Parse header
-	format, err := reader.ReadString('\n')
+// Decodes a sequence of images written one after another to the same stream,
+// as pdftoppm does when rendering a range of pages to stdout.
+type pageDecoder struct {
+	reader   *bufio.Reader
+	format   RenderFormat
+	channels int
+}
+
+func newPageDecoder(rd io.Reader, format RenderFormat, channels int) *pageDecoder {
+	return &pageDecoder{reader: bufio.NewReader(rd), format: format, channels: channels}
+}
+
+// Decode the next image in the stream, returning io.EOF once it is exhausted
+func (d *pageDecoder) next() (*Image, error) {
+	// Skip any whitespace left between images
+	for {
+		b, err := d.reader.Peek(1)
+		if err != nil {
+			return nil, err
+		}
+		if b[0] != ' ' && b[0] != '\n' && b[0] != '\t' && b[0] != '\r' {
+			break
+		}
+		d.reader.ReadByte()
+	}
+	return readPage(d.reader, d.format, d.channels)
+}
+
+// Read a single image in format from reader, leaving it positioned after the
+// image, as an image of channels bytes to a pixel
+func readPage(reader *bufio.Reader, format RenderFormat, channels int) (*Image, error) {
+	if format == RenderPNG {
+		return readPNG(reader, channels)
+	}
+	return readPPM(reader, channels)
+}
+
+// Read a single PNG image from reader, leaving it positioned after the image,
+// with channels bytes to a pixel whichever the image has.  Returns io.EOF if
+// reader has nothing left, and an error wrapping ErrInvalidPPM if what it has
+// is not a whole image.
+func readPNG(reader *bufio.Reader, channels int) (*Image, error) {
+	if _, err := reader.Peek(1); err != nil {
+		return nil, err
+	}
+	src, err := png.Decode(reader)
 	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidPPM, err)
+	}
+	return convertChannels(imageFrom(src), channels), nil
+}
+
+// Read a single PPM, PGM or PBM image from reader, leaving it positioned
+// after the image, with channels bytes to a pixel whichever the image has.
+// Returns io.EOF if reader has nothing left, and an error wrapping
+// ErrInvalidPPM if what it has is not a whole image.
+func readPPM(reader *bufio.Reader, channels int) (*Image, error) {
+	if _, err := reader.Peek(1); err != nil {
 		return nil, err
 	}
-	format = strings.TrimSpace(format)
+	img, err := decodePPM(reader)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidPPM, err)
+	}
+	return convertChannels(img, channels), nil
+}
+
+func decodePPM(reader *bufio.Reader) (*Image, error) {
+	// Parse header
+	magic := make([]byte, 2)
+	if _, err := io.ReadFull(reader, magic); err != nil {
+		return nil, err
+	}
+	format := string(magic)
+	// pdftoppm writes P6, or with -gray and -mono the one channel P5 and P4.
+	// Their plain forms P3, P2 and P1 are read too, for renderers that write
+	// those.
 	var isBinary bool
-	if format == "P3" {
+	channels := 3
+	switch format {
+	case "P3":
 		isBinary = false
-	} else if format == "P6" {
+	case "P6":
 		isBinary = true
-	} else {
-		return nil, fmt.Errorf("unsupported PPM format: %s", format)
+	case "P2", "P1":
+		isBinary = false
+		channels = 1
+	case "P5", "P4":
+		isBinary = true
+		channels = 1
+	default:
+		return nil, fmt.Errorf("unsupported PPM format: %q", format)
 	}
 
-	sizeStr, err := reader.ReadString('\n')
+	width, err := headerInt(reader)
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("invalid width: %w", err)
 	}
-	sizeParts := strings.Split(strings.TrimSpace(sizeStr), " ")
-	if len(sizeParts) != 2 {
-		return nil, fmt.Errorf("invalid size format: %s", sizeStr)
-	}
-	width, err := strconv.Atoi(sizeParts[0])
+	height, err := headerInt(reader)
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("invalid height: %w", err)
 	}
-	height, err := strconv.Atoi(sizeParts[1])
-	if err != nil {
-		return nil, err
+	if width == 0 || height == 0 {
+		return nil, fmt.Errorf("invalid size: %dx%d", width, height)
 	}
 
-	maxColorStr, err := reader.ReadString('\n')
-	if err != nil {
-		return nil, err
+	switch format {
+	case "P4":
+		return decodeBitmap(reader, width, height)
+	case "P1":
+		return decodePlainBitmap(reader, width, height)
 	}
-	maxColor, err := strconv.Atoi(strings.TrimSpace(maxColorStr))
+
+	maxColor, err := headerInt(reader)
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("invalid maximum color value: %w", err)
+	}
+	if maxColor <= 0 || maxColor > 65535 {
+		return nil, fmt.Errorf("unsupported maximum color value: %d", maxColor)
 	}
 
 	// Parse pixel data
-	if GlobDebug {
-		fmt.Fprintf(os.Stderr, "parsing pixel data, width=%d, height=%d, maxColor=%d, isBinary=%t\n", width, height, maxColor, isBinary)
+	log().Debug("parsing pixel data", "width", width, "height", height, "maxColor", maxColor, "binary", isBinary)
+	stride := width * channels
+	pix := getPix(height * stride)
+	switch {
+	case !isBinary:
+		for i := range pix {
+			a, err := readNextValue(reader)
+			if err != nil {
+				return nil, err
+			}
+			color, err := strconv.Atoi(a)
+			if err != nil {
+				return nil, err
+			}
+			pix[i] = scaleSample(min(color, maxColor), maxColor)
+		}
+	case maxColor > 255:
+		// Two bytes to a sample, most significant first, read a row at a
+		// time rather than holding twice the page
+		row := make([]byte, 2*stride)
+		for y := range height {
+			if _, err := io.ReadFull(reader, row); err != nil {
+				return nil, err
+			}
+			out := pix[y*stride : (y+1)*stride]
+			for i := range out {
+				out[i] = scaleSample(min(int(row[2*i])<<8|int(row[2*i+1]), maxColor), maxColor)
+			}
+		}
+	default:
+		if _, err := io.ReadFull(reader, pix); err != nil {
+			return nil, err
+		}
+		if maxColor != 255 {
+			for i, v := range pix {
+				pix[i] = scaleSample(min(int(v), maxColor), maxColor)
+			}
+		}
 	}
-	pixels := make([][]byte, height)
+	log().Debug("finished parsing pixel data")
+
+	return &Image{Pix: pix, Stride: stride, W: width, H: height, Channels: channels}, nil
+}
+
+// Scale a sample from 0 to maxColor to the nearest from 0 to 255
+func scaleSample(v, maxColor int) byte {
+	return byte((v*255 + maxColor/2) / maxColor)
+}
+
+// The largest number a Netpbm header may give, well beyond any page, so that
+// sizes multiplied together cannot overflow
+const maxHeaderInt = 1 << 20
+
+// Read the next number of a Netpbm header.  Numbers may be separated by any
+// whitespace, and a # starts a comment running to the end of the line,
+// wherever it appears.  The single whitespace character after the number is
+// consumed too, as the last one of a header ends it, and pixels follow.
+func headerInt(reader *bufio.Reader) (int, error) {
+	n, digits := 0, 0
+	for {
+		b, err := reader.ReadByte()
+		if err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return 0, err
+		}
+		switch {
+		case b >= '0' && b <= '9':
+			n = n*10 + int(b-'0')
+			digits++
+			if n > maxHeaderInt {
+				return 0, errors.New("number too large")
+			}
+		case b == '#':
+			if _, err := reader.ReadBytes('\n'); err != nil {
+				return 0, io.ErrUnexpectedEOF
+			}
+			if digits > 0 {
+				return n, nil
+			}
+		case b == ' ' || b == '\t' || b == '\n' || b == '\r' || b == '\v' || b == '\f':
+			if digits > 0 {
+				return n, nil
+			}
+		default:
+			return 0, fmt.Errorf("unexpected %q", b)
+		}
+	}
+}
+
+// Read the pixels of a binary PBM image, eight to a byte with each row padded
+// to a whole byte, into a one channel image of black 0 and white 255
+func decodeBitmap(reader *bufio.Reader, width, height int) (*Image, error) {
+	rowBytes := (width + 7) / 8
+	packed := make([]byte, rowBytes*height)
+	if _, err := io.ReadFull(reader, packed); err != nil {
+		return nil, err
+	}
+	pix := getPix(width * height)
+	clear(pix)
 	for y := range height {
-		pixels[y] = make([]byte, width*3)
-		for x := range width {
-			for i := range 3 {
-				var color int
-				if isBinary {
-					var b byte
-					err = binary.Read(reader, binary.BigEndian, &b)
-					if err != nil {
-						return nil, err
-					}
-					color = int(b)
-				} else {
-					a, err := readNextValue(reader)
-					if err != nil {
-						return nil, err
-					}
-					color, err = strconv.Atoi(a)
-					if err != nil {
-						return nil, err
-					}
-				}
-				pixels[y][x*3+i] = byte(color * 255 / maxColor)
+		row, out := packed[y*rowBytes:(y+1)*rowBytes], pix[y*width:(y+1)*width]
+		for x := range out {
+			if row[x/8]&(0x80>>(x%8)) == 0 {
+				out[x] = 255
 			}
 		}
 	}
-	if GlobDebug {
-		fmt.Fprintf(os.Stderr, "finished parsing pixel data\n")
+	return &Image{Pix: pix, Stride: width, W: width, H: height, Channels: 1}, nil
+}
+
+// Read the pixels of a plain PBM image, one digit to a pixel, 1 for black,
+// with any whitespace or none between them, into a one channel image of black
+// 0 and white 255
+func decodePlainBitmap(reader *bufio.Reader, width, height int) (*Image, error) {
+	pix := getPix(width * height)
+	for i := 0; i < len(pix); {
+		b, err := reader.ReadByte()
+		if err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return nil, err
+		}
+		switch b {
+		case '0':
+			pix[i] = 255
+			i++
+		case '1':
+			pix[i] = 0
+			i++
+		case ' ', '\t', '\n', '\r', '\v', '\f':
+		case '#':
+			if _, err := reader.ReadBytes('\n'); err != nil {
+				return nil, io.ErrUnexpectedEOF
+			}
+		default:
+			return nil, fmt.Errorf("unexpected %q in pixel data", b)
+		}
 	}
+	return &Image{Pix: pix, Stride: width, W: width, H: height, Channels: 1}, nil
+}
 
-	return pixels, nil
+// An image with the given bytes to a pixel, img itself if it has them.  Gray
+// is spread to red, green and blue alike, and colour is turned to gray by its
+// lightness.
+func convertChannels(img *Image, channels int) *Image {
+	if img.Channels == channels {
+		return img
+	}
+	out := newImage(img.W, img.H, channels)
+	for y := range img.H {
+		row, dst := img.Row(y), out.Row(y)
+		for x := range img.W {
+			if channels == 1 {
+				dst[x] = byte(lightness(row, x, img.Channels))
+			} else {
+				dst[3*x], dst[3*x+1], dst[3*x+2] = row[x], row[x], row[x]
+			}
+		}
+	}
+	return out
 }
 
-// Used in reading PPMs
+// Read the next sample of a plain PPM or PGM.  Like the numbers of the
+// header, samples may be separated by any whitespace and by comments, and the
+// last may end the file with nothing after it.
 func readNextValue(reader *bufio.Reader) (string, error) {
-	var value string
+	var value []byte
 	for {
 		char, err := reader.ReadByte()
 		if err != nil {
-			if err == io.EOF {
-				// If we've read some value before EOF, return it.
-				if value != "" {
-					return value, nil
-				}
-				return "", err // Return EOF if no value was read
+			if err == io.EOF && len(value) > 0 {
+				return string(value), nil
 			}
-			return "", err // Return any other error
+			return "", err
 		}
-		if char == ' ' || char == '\n' || char == '\t' {
-			if value != "" {
-				return value, nil
+		switch char {
+		case ' ', '\t', '\n', '\r', '\v', '\f':
+			if len(value) > 0 {
+				return string(value), nil
+			}
+		case '#':
+			if _, err := reader.ReadBytes('\n'); err != nil && len(value) == 0 {
+				return "", err
+			}
+			if len(value) > 0 {
+				return string(value), nil
 			}
-			// Skip leading whitespace
-		} else {
-			value += string(char)
+		default:
+			value = append(value, char)
 		}
 	}
 }
 
-// Create a 2D byte matrix that depicts a circle, with values 0 and 255.
-func circle(radius int) [][]byte {
+// Create a one channel image that depicts a circle, with values 0 and 255.
+func circle(radius int) *Image {
 	size := 2*radius + 1
-	stamp := make([][]byte, size)
-	for i := range stamp {
-		stamp[i] = make([]byte, size)
-	}
+	stamp := newImage(size, size, 1)
 
 	centerY := radius
 	centerX := radius
 	radiusSquared := radius * radius
 
 	for y := 0; y < size; y++ {
+		row := stamp.Row(y)
 		for x := 0; x < size; x++ {
 			dx := x - centerX
 			dy := y - centerY
 			if dx*dx+dy*dy <= radiusSquared {
-				stamp[y][x] = 255
+				row[x] = 255
 			}
 		}
 	}
 	return stamp
 }
 
-// Given a 2D byte matrix and a matrix of locations where it is to be
-// marked, highlight a circle of the given radius at each location.
-func diffImage(mat [][]byte, diff [][]bool, radius int) [][]byte {
-
-	newMat := make([][]byte, len(mat))
-	for y := range mat {
-		newMat[y] = make([]byte, len(mat[y]))
-		copy(newMat[y], mat[y])
-	}
-
+// Given an RGB image and a one channel image of where it is to be marked,
+// highlight a circle of the given radius at each marked pixel.  Graded
+// highlights are as strong as the largest difference each circle covers.
+func diffImage(img, diff *Image, radius int, hl Highlight) *Image {
+	mask := newMask(img)
 	stamp := circle(radius)
-	for y := range diff {
-		for x := range diff[y] {
-			if diff[y][x] {
-				highlightStamp(mat, newMat, stamp, x*3, y)
+	for y := range diff.H {
+		for x, d := range diff.Row(y) {
+			if d != 0 {
+				stampMask(mask, stamp, x, y, hl.strength(d))
 			}
 		}
 	}
-	return newMat
+	if hl.Style == HighlightOutline {
+		mask = outlineMask(mask, max(1, radius/3))
+	}
+	return highlightMask(img, mask, hl)
 }
 
-// Adds the highlight stamp into newImage, which should start out as
-// a copy of img since we do not want to double, triple, etc the effect
-func highlightStamp(img, newImage, stamp [][]byte, centerX, centerY int) {
-	stampRows := len(stamp)
-	stampCols := len(stamp[0])
-	rows := len(img)
-	cols := len(img[0])
+// Create a mask with one entry for every pixel of an image, which is how
+// strongly the pixel is highlighted, or 0 if it is not
+func newMask(img *Image) *Image {
+	return newImage(img.W, img.H, 1)
+}
 
-	for y := range stampRows {
-		matrixY := centerY - len(stamp)/2 + y
-		if matrixY < 0 || matrixY >= rows {
+// Raise the pixels of mask covered by stamp, centred on centerX, centerY, to
+// at least strength
+func stampMask(mask, stamp *Image, centerX, centerY int, strength byte) {
+	for y := range stamp.H {
+		maskY := centerY - stamp.H/2 + y
+		if maskY < 0 || maskY >= mask.H {
 			continue
 		}
-		for x := range stampCols {
-			matrixX := centerX - len(stamp[0])/2*3 + x*3
-			if matrixX < 0 || matrixX+2 >= cols {
+		row := mask.Row(maskY)
+		for x, s := range stamp.Row(y) {
+			maskX := centerX - stamp.W/2 + x
+			if maskX < 0 || maskX >= mask.W || s == 0 {
 				continue
 			}
-			if stamp[y][x] == 0 {
+			row[maskX] = max(row[maskX], strength)
+		}
+	}
+}
+
+// Reduce a mask to a band of the given thickness around the edges of the
+// areas it covers
+func outlineMask(mask *Image, thickness int) *Image {
+	w, h := mask.W, mask.H
+	inside := func(m []bool, x, y int) bool {
+		return y >= 0 && y < h && x >= 0 && x < w && m[y*w+x]
+	}
+	covered := make([]bool, w*h)
+	for y := range h {
+		for x, s := range mask.Row(y) {
+			covered[y*w+x] = s != 0
+		}
+	}
+	eroded := covered
+	for range thickness {
+		next := make([]bool, w*h)
+		for y := range h {
+			for x := range w {
+				next[y*w+x] = inside(eroded, x, y) && inside(eroded, x-1, y) && inside(eroded, x+1, y) &&
+					inside(eroded, x, y-1) && inside(eroded, x, y+1)
+			}
+		}
+		eroded = next
+	}
+	outline := newImage(w, h, 1)
+	for y := range h {
+		row, out := mask.Row(y), outline.Row(y)
+		for x := range w {
+			if !eroded[y*w+x] {
+				out[x] = row[x]
+			}
+		}
+	}
+	return outline
+}
+
+// Return a copy of an RGB image with the pixels set in mask highlighted,
+// with the opacity scaled by their strength for graded highlights
+func highlightMask(img, mask *Image, hl Highlight) *Image {
+	out := img.clone()
+	for y := range img.H {
+		src, dst := img.Row(y), out.Row(y)
+		for x, s := range mask.Row(y) {
+			if s == 0 {
 				continue
 			}
-			newImage[matrixY][matrixX], newImage[matrixY][matrixX+1], newImage[matrixY][matrixX+2] =
-				highlightPixel(img[matrixY][matrixX], img[matrixY][matrixX+1], img[matrixY][matrixX+2])
+			pixel := hl
+			if hl.Graded {
+				pixel.Opacity = hl.Opacity * float64(s) / 255
+			}
+			i := x * 3
+			dst[i], dst[i+1], dst[i+2] = highlightPixel(src[i], src[i+1], src[i+2], pixel)
 		}
 	}
+	return out
 }
 
-// Convert a 2D RGB byte matrix to a PNG Image.
-func rgbToPNG(matrix [][]byte) image.Image {
-	height := len(matrix)
-	width := len(matrix[0]) / 3
+// Gray that regions left out of the comparison are hatched with
+const excludedGray = 150
+
+// Hatch regions of an RGB image that were left out of the comparison with a
+// gray border and diagonal gray lines period pixels apart, so that what was
+// ignored can be seen in difference images
+func hatchRegions(img *Image, regions []Region, period int) {
+	period = max(4, period)
+	thickness := max(1, period/5)
+	for _, r := range regions {
+		for y := max(r.Y, 0); y < r.Y+r.Height && y < img.H; y++ {
+			row := img.Row(y)
+			for x := max(r.X, 0); x < r.X+r.Width && x < img.W; x++ {
+				edge := y-r.Y < thickness || r.Y+r.Height-1-y < thickness ||
+					x-r.X < thickness || r.X+r.Width-1-x < thickness
+				if edge || (x+y)%period < thickness {
+					row[x*3], row[x*3+1], row[x*3+2] = excludedGray, excludedGray, excludedGray
+				}
+			}
+		}
+	}
+}
 
-	img := image.NewRGBA(image.Rect(0, 0, width, height))
+// Render a heatmap of the differences over a faded grayscale copy of an RGB
+// image.  Differing pixels are coloured from blue for the smallest change to
+// red for the largest.
+func heatmapImage(img, diff *Image) *Image {
+	out := newImage(img.W, img.H, 3)
+	for y := range img.H {
+		src, dst := img.Row(y), out.Row(y)
+		var drow []byte
+		if y < diff.H {
+			drow = diff.Row(y)
+		}
+		for x := range img.W {
+			i := x * 3
+			var r, g, b byte
+			if x < len(drow) && drow[x] != 0 {
+				r, g, b = heatColor(drow[x])
+			} else {
+				// Luminance, faded most of the way to white
+				lum := lightness(src, x, 3)
+				r = byte(255 - (255-lum)*3/10)
+				g, b = r, r
+			}
+			dst[i], dst[i+1], dst[i+2] = r, g, b
+		}
+	}
+	return out
+}
 
-	for y := range height {
-		for x := range width {
-			r := matrix[y][x*3]
-			g := matrix[y][x*3+1]
-			b := matrix[y][x*3+2]
-			img.Set(x, y, color.RGBA{r, g, b, 255}) // Assuming full opacity (alpha=255)
+// Lay two RGB images of the same size over each other, taking the red
+// channel from the luminance of img2 and the others from that of img1, so
+// that ink only in img1 shows red, ink only in img2 shows cyan, and ink in
+// both shows gray to black
+func overlayImage(img1, img2 *Image) *Image {
+	out := newImage(img1.W, img1.H, 3)
+	for y := range img1.H {
+		row1, dst := img1.Row(y), out.Row(y)
+		var row2 []byte
+		if y < img2.H {
+			row2 = img2.Row(y)
+		}
+		for x := range img1.W {
+			i := x * 3
+			lum1, lum2 := lightness(row1, x, 3), 255
+			if i+2 < len(row2) {
+				lum2 = lightness(row2, x, 3)
+			}
+			dst[i], dst[i+1], dst[i+2] = byte(lum2), byte(lum1), byte(lum1)
 		}
 	}
-	return img
+	return out
 }
 
-// Add a yellow highlight to a single pixel, by blending with pure yellow
-func highlightPixel(r, g, b byte) (byte, byte, byte) {
-	blendFactor := 0.5
+// Map a difference magnitude from 1 to 255 onto a blue, cyan, green, yellow,
+// red colour scale
+func heatColor(d byte) (byte, byte, byte) {
+	t := int(d) * 4 // 0 to 1020, four segments of 255
+	switch {
+	case t < 256:
+		return 0, byte(t), 255
+	case t < 511:
+		return 0, 255, byte(510 - t)
+	case t < 766:
+		return byte(t - 510), 255, 0
+	default:
+		return 255, byte(max(0, 1020-t)), 0
+	}
+}
 
-	red := float64(r)*(1-blendFactor) + float64(255)*blendFactor
-	green := float64(g)*(1-blendFactor) + float64(255)*blendFactor
-	blue := float64(b) * (1 - blendFactor)
+// Convert an RGB or gray Image to one the image packages can encode.  A gray
+// image shares its pixels.
+func rgbToPNG(img *Image) image.Image {
+	rect := image.Rect(0, 0, img.W, img.H)
+	if img.Channels == 1 {
+		return &image.Gray{Pix: img.Pix, Stride: img.Stride, Rect: rect}
+	}
+	out := image.NewRGBA(rect)
+	for y := range img.H {
+		row, dst := img.Row(y), out.Pix[y*out.Stride:]
+		for x := range img.W {
+			dst[x*4], dst[x*4+1], dst[x*4+2], dst[x*4+3] = row[x*3], row[x*3+1], row[x*3+2], 255
+		}
+	}
+	return out
+}
+
+// Highlight a single pixel by blending it with the highlight colour
+func highlightPixel(r, g, b byte, hl Highlight) (byte, byte, byte) {
+	blendFactor := hl.Opacity
+
+	red := float64(r)*(1-blendFactor) + float64(hl.Color.R)*blendFactor
+	green := float64(g)*(1-blendFactor) + float64(hl.Color.G)*blendFactor
+	blue := float64(b)*(1-blendFactor) + float64(hl.Color.B)*blendFactor
 
 	if red > 255 {
 		red = 255
@@ -302,16 +742,53 @@ func highlightPixel(r, g, b byte) (byte, byte, byte) {
 	return byte(red), byte(green), byte(blue)
 }
 
-// Join two 2D matrices side-by-side, separating with a black line with width padding
-func joinImages(img1, img2 [][]byte, padding int) [][]byte {
-	height := len(img1)
-	width := len(img1[0]) + padding + len(img2[0])
-	newImg := make([][]byte, height)
-	for i := range newImg {
-		newImg[i] = make([]byte, width)
-		copy(newImg[i], img1[i])
-		// padding should be initialized to 0, so black
-		copy(newImg[i][len(img1[i])+padding+1:], img2[i])
+// Join two images with the same channels side-by-side, or one above the
+// other, separating them with a black line padding pixels wide.  The smaller
+// image, if either is, is padded to the size of the other across the join
+// with the join's background.
+func joinImages(img1, img2 *Image, padding int, join Join) *Image {
+	vertical := join.vertical(max(img1.W, img2.W), max(img1.H, img2.H))
+	w, h := img1.W+padding+img2.W, max(img1.H, img2.H)
+	if vertical {
+		w, h = max(img1.W, img2.W), img1.H+padding+img2.H
+	}
+	// New images are zero, so black
+	newImg := newImage(w, h, img1.Channels)
+	background := []byte{join.Background.R, join.Background.G, join.Background.B}
+	if img1.Channels == 1 {
+		background = []byte{byte((int(join.Background.R) + int(join.Background.G) + int(join.Background.B)) / 3)}
+	}
+	for y := range h {
+		if vertical && y >= img1.H && y < img1.H+padding {
+			continue
+		}
+		row := newImg.Row(y)
+		for x := range w {
+			if !vertical && x >= img1.W && x < img1.W+padding {
+				continue
+			}
+			copy(row[x*len(background):], background)
+		}
+	}
+
+	// Where an image of the given size starts across a join of the given size
+	across := func(size, room int) int {
+		if join.Align == JoinCenter {
+			return (room - size) / 2
+		}
+		return 0
+	}
+	place := func(img *Image, x, y int) {
+		for r := range img.H {
+			copy(newImg.Row(y + r)[x*img.Channels:], img.Row(r))
+		}
+	}
+	if vertical {
+		place(img1, across(img1.W, w), 0)
+		place(img2, across(img2.W, w), img1.H+padding)
+	} else {
+		place(img1, 0, across(img1.H, h))
+		place(img2, img1.W+padding, across(img2.H, h))
 	}
 	return newImg
 }
@@ -0,0 +1,112 @@
+package pdfcomp
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestDecodePPM(t *testing.T) {
+	tests := []struct {
+		name     string
+		in       string
+		w, h     int
+		channels int
+		pix      []byte
+	}{
+		// As pdftoppm writes them
+		{"pdftoppm P6", "P6\n2 1\n255\n\xff\x00\x00\x00\x00\xff", 2, 1, 3, []byte{255, 0, 0, 0, 0, 255}},
+		{"pdftoppm -gray P5", "P5\n3 1\n255\n\x00\x80\xff", 3, 1, 1, []byte{0, 128, 255}},
+		{"pdftoppm -mono P4", "P4\n10 1\n\xa0\x40", 10, 1, 1, []byte{0, 255, 0, 255, 255, 255, 255, 255, 255, 0}},
+		// Other ways of writing the header
+		{"comment after magic", "P6 # written by pdftoppm\n1 1 255\n\x01\x02\x03", 1, 1, 3, []byte{1, 2, 3}},
+		{"comment touching a number", "P5\n1# width\n1\n255\n\x07", 1, 1, 1, []byte{7}},
+		{"comments between every number", "P5\n# a\n1\n# b\n1\n# c\n255\n\x07", 1, 1, 1, []byte{7}},
+		{"one line header", "P5 2 1 255 \x01\x02", 2, 1, 1, []byte{1, 2}},
+		{"crlf header", "P5\r\n2 1\r\n255\n\x01\x02", 2, 1, 1, []byte{1, 2}},
+		{"tab, vertical tab and form feed", "P5\t2\v1\f255\n\x01\x02", 2, 1, 1, []byte{1, 2}},
+		// Other maximum values
+		{"maxval 15", "P5\n2 1\n15\n\x0f\x07", 2, 1, 1, []byte{255, 119}},
+		{"16 bit P6", "P6\n1 1\n65535\n\xff\xff\x00\x00\x80\x00", 1, 1, 3, []byte{255, 0, 128}},
+		{"16 bit P5", "P5\n2 1\n65535\n\x12\x34\xff\xff", 2, 1, 1, []byte{18, 255}},
+		// Plain formats
+		{"plain P3 with crlf and comments", "P3\r\n# made by a renderer\r\n2 1\r\n255\r\n255 0 0\r\n0 # inline\r\n0 255\r\n", 2, 1, 3, []byte{255, 0, 0, 0, 0, 255}},
+		{"plain P2 with odd whitespace", "P2\t2\v1\f255\n0\t128\r", 2, 1, 1, []byte{0, 128}},
+		{"plain P2 ending at the last sample", "P2 2 1 15 15 7", 2, 1, 1, []byte{255, 119}},
+		{"plain P2 with a comment touching a sample", "P2 2 1 255\n1# one\n2\n", 2, 1, 1, []byte{1, 2}},
+		{"plain P1", "P1\n# c\n3 2\n1 0 1\r\n010\n", 3, 2, 1, []byte{0, 255, 0, 255, 0, 255}},
+		{"plain P1 without whitespace", "P1 4 1 0110", 4, 1, 1, []byte{255, 0, 0, 255}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			img, err := decodePPM(bufio.NewReader(strings.NewReader(tt.in)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if img.W != tt.w || img.H != tt.h || img.Channels != tt.channels {
+				t.Errorf("got %dx%d with %d channels, want %dx%d with %d", img.W, img.H, img.Channels, tt.w, tt.h, tt.channels)
+			}
+			if !bytes.Equal(img.Pix, tt.pix) {
+				t.Errorf("got pixels %v, want %v", img.Pix, tt.pix)
+			}
+		})
+	}
+}
+
+func TestDecodePPMErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+	}{
+		{"empty", ""},
+		{"not netpbm", "%PDF-1.7\n"},
+		{"pam", "P7\nWIDTH 1\n"},
+		{"zero size", "P6\n0 1\n255\n"},
+		{"missing height", "P6\n1"},
+		{"letters in the header", "P6\n1 x\n255\n"},
+		{"huge width", "P6\n99999999 1\n255\n"},
+		{"zero maxval", "P5\n1 1\n0\n\x00"},
+		{"maxval too large", "P5\n1 1\n65536\n\x00\x00"},
+		{"short pixels", "P6\n2 1\n255\n\x00\x00\x00"},
+		{"short 16 bit pixels", "P5\n2 1\n65535\n\x00\x00\x00"},
+		{"short plain pixels", "P2 2 1 255 0"},
+		{"bad plain sample", "P2 1 1 255 x"},
+		{"bad plain bit", "P1 1 1 2"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if img, err := decodePPM(bufio.NewReader(strings.NewReader(tt.in))); err == nil {
+				t.Errorf("decoded %dx%d, want an error", img.W, img.H)
+			}
+		})
+	}
+}
+
+// pdftoppm writes every page to stdout one after another when asked to
+func TestReadPPMStream(t *testing.T) {
+	reader := bufio.NewReader(strings.NewReader("P6\n1 1\n255\n\x01\x02\x03P5 # gray\n1 1\n255\n\x09"))
+	first, err := readPPM(reader, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(first.Pix, []byte{1, 2, 3}) {
+		t.Errorf("first page %v, want [1 2 3]", first.Pix)
+	}
+	second, err := readPPM(reader, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(second.Pix, []byte{9, 9, 9}) {
+		t.Errorf("second page %v, want gray spread to [9 9 9]", second.Pix)
+	}
+	if _, err := readPPM(reader, 3); err != io.EOF {
+		t.Errorf("after the last page got %v, want %v", err, io.EOF)
+	}
+	_, err = readPPM(bufio.NewReader(strings.NewReader("P6\n1 1\n255\n\x01")), 3)
+	if !errors.Is(err, ErrInvalidPPM) {
+		t.Errorf("truncated page got %v, want %v", err, ErrInvalidPPM)
+	}
+}
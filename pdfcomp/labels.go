@@ -0,0 +1,179 @@
+package pdfcomp
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/model"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/types"
+)
+
+// A run of pages numbered the same way, from a document's /PageLabels, as
+// in roman numerals for a preface followed by decimal numbers restarting at
+// 1 for the body
+type LabelRange struct {
+	// First page of the run, counting from 1
+	Page int
+	// Numbering style: D for decimal, R and r for upper and lower case roman
+	// numerals, A and a for upper and lower case letters, or empty for
+	// labels that are only the prefix
+	Style  string
+	Prefix string
+	// Number of the first page of the run
+	Start int
+}
+
+var labelStyles = map[string]string{
+	"":  "no numbers",
+	"D": "decimal",
+	"R": "upper case roman",
+	"r": "lower case roman",
+	"A": "upper case letters",
+	"a": "lower case letters",
+}
+
+func (l LabelRange) String() string {
+	s := fmt.Sprintf("from page %d: %s", l.Page, labelStyles[l.Style])
+	if l.Style != "" && l.Start != 1 {
+		s += fmt.Sprintf(" starting at %d", l.Start)
+	}
+	if l.Prefix != "" {
+		s += fmt.Sprintf(" with prefix %q", l.Prefix)
+	}
+	return s + fmt.Sprintf(", first %q", l.label(l.Page))
+}
+
+// The label of a page in the run
+func (l LabelRange) label(page int) string {
+	n := l.Start + page - l.Page
+	switch l.Style {
+	case "D":
+		return l.Prefix + strconv.Itoa(n)
+	case "R":
+		return l.Prefix + strings.ToUpper(roman(n))
+	case "r":
+		return l.Prefix + roman(n)
+	case "A":
+		return l.Prefix + strings.ToUpper(letters(n))
+	case "a":
+		return l.Prefix + letters(n)
+	}
+	return l.Prefix
+}
+
+// Lower case roman numerals, as used for page labels
+func roman(n int) string {
+	if n <= 0 {
+		return strconv.Itoa(n)
+	}
+	var sb strings.Builder
+	for _, r := range []struct {
+		value  int
+		digits string
+	}{{1000, "m"}, {900, "cm"}, {500, "d"}, {400, "cd"}, {100, "c"}, {90, "xc"},
+		{50, "l"}, {40, "xl"}, {10, "x"}, {9, "ix"}, {5, "v"}, {4, "iv"}, {1, "i"}} {
+		for n >= r.value {
+			sb.WriteString(r.digits)
+			n -= r.value
+		}
+	}
+	return sb.String()
+}
+
+// Lower case letter labels: a to z, then aa to zz, and so on
+func letters(n int) string {
+	if n <= 0 {
+		return strconv.Itoa(n)
+	}
+	return strings.Repeat(string(rune('a'+(n-1)%26)), (n-1)/26+1)
+}
+
+// The label of every page of a file, as a viewer would show it in place of
+// the page number
+func PageLabels(filename string) ([]string, error) {
+	ctx, err := readContext(filename)
+	if err != nil {
+		return nil, err
+	}
+	return pageLabels(ctx), nil
+}
+
+func pageLabels(ctx *model.Context) []string {
+	ranges := fileLabelRanges(ctx)
+	labels := make([]string, ctx.PageCount)
+	for i := range labels {
+		page := i + 1
+		// The last run starting at or before the page
+		for _, r := range ranges {
+			if r.Page > page {
+				break
+			}
+			labels[i] = r.label(page)
+		}
+	}
+	return labels
+}
+
+// The runs of page labels of a document, in page order.  A document without
+// labels is numbered in decimal from 1, as viewers show it.
+func fileLabelRanges(ctx *model.Context) []LabelRange {
+	numbers := []LabelRange{{Page: 1, Style: "D", Start: 1}}
+	root, err := ctx.Catalog()
+	if err != nil {
+		return numbers
+	}
+	tree, ok := dictEntry(ctx, root, "PageLabels").(types.Dict)
+	if !ok {
+		return numbers
+	}
+	var ranges []LabelRange
+	var walk func(node types.Dict, depth int)
+	walk = func(node types.Dict, depth int) {
+		if depth > maxStructDepth {
+			return
+		}
+		// Pairs of a page index, counting from 0, and a label dictionary
+		if nums, ok := dictEntry(ctx, node, "Nums").(types.Array); ok {
+			for i := 0; i+1 < len(nums); i += 2 {
+				index, ok := nums[i].(types.Integer)
+				if !ok {
+					continue
+				}
+				d, _ := ctx.DereferenceDict(nums[i+1])
+				r := LabelRange{Page: index.Value() + 1, Start: 1}
+				if s, ok := dictEntry(ctx, d, "S").(types.Name); ok {
+					r.Style = s.Value()
+				}
+				if p := dictEntry(ctx, d, "P"); p != nil {
+					r.Prefix, _ = model.Text(p)
+				}
+				if st, ok := dictEntry(ctx, d, "St").(types.Integer); ok {
+					r.Start = st.Value()
+				}
+				ranges = append(ranges, r)
+			}
+		}
+		if kids, ok := dictEntry(ctx, node, "Kids").(types.Array); ok {
+			for _, k := range kids {
+				if kd, err := ctx.DereferenceDict(k); err == nil && kd != nil {
+					walk(kd, depth+1)
+				}
+			}
+		}
+	}
+	walk(tree, 0)
+	slices.SortStableFunc(ranges, func(a, b LabelRange) int { return a.Page - b.Page })
+	if len(ranges) == 0 || ranges[0].Page != 1 {
+		// The first page has to be labelled, so this is a broken tree
+		ranges = append(numbers, ranges...)
+	}
+	return ranges
+}
+
+// Runs of page labels only in the first document and only in the second.  A
+// run that changed is in both.
+func diffLabelRanges(r1, r2 []LabelRange) (removed, added []LabelRange) {
+	return diffItems(r1, r2)
+}
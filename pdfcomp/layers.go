@@ -0,0 +1,136 @@
+package pdfcomp
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/pdfcpu/pdfcpu/pkg/api"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/model"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/types"
+)
+
+// An optional content group, shown as a layer by PDF viewers
+type Layer struct {
+	Name string
+	// Whether the layer is shown when the document is opened, which is how
+	// pdftoppm renders it
+	Visible bool
+}
+
+func (l Layer) String() string {
+	if l.Visible {
+		return l.Name + " (visible)"
+	}
+	return l.Name + " (hidden)"
+}
+
+// The layers of a file, in the order the document lists them
+func Layers(filename string) ([]Layer, error) {
+	ctx, err := readContext(filename)
+	if err != nil {
+		return nil, err
+	}
+	return fileLayers(ctx), nil
+}
+
+func fileLayers(ctx *model.Context) []Layer {
+	ocgs, config := optionalContent(ctx)
+	var layers []Layer
+	for _, o := range ocgs {
+		g, err := ctx.DereferenceDict(o)
+		if err != nil || g == nil {
+			continue
+		}
+		l := Layer{Visible: defaultVisible(config, o)}
+		if name := dictEntry(ctx, g, "Name"); name != nil {
+			l.Name, _ = model.Text(name)
+		}
+		layers = append(layers, l)
+	}
+	return layers
+}
+
+// The optional content groups of a document and its default configuration,
+// which says which of them are shown
+func optionalContent(ctx *model.Context) (types.Array, types.Dict) {
+	root, err := ctx.Catalog()
+	if err != nil {
+		return nil, nil
+	}
+	props, _ := dictEntry(ctx, root, "OCProperties").(types.Dict)
+	ocgs, _ := dictEntry(ctx, props, "OCGs").(types.Array)
+	config, _ := dictEntry(ctx, props, "D").(types.Dict)
+	return ocgs, config
+}
+
+// Whether a default configuration shows a group: unless it lists it as off,
+// or only if it lists it as on when everything starts off
+func defaultVisible(config types.Dict, ocg types.Object) bool {
+	ref, _ := ocg.(types.IndirectRef)
+	contains := func(key string) bool {
+		arr, _ := config[key].(types.Array)
+		for _, o := range arr {
+			if r, ok := o.(types.IndirectRef); ok && r == ref {
+				return true
+			}
+		}
+		return false
+	}
+	if base, _ := config["BaseState"].(types.Name); base == "OFF" {
+		return contains("ON")
+	}
+	return !contains("OFF")
+}
+
+// Layers only in the first file and only in the second.  A layer whose
+// visibility changed is in both.
+func diffLayers(l1, l2 []Layer) (removed, added []Layer) {
+	return diffItems(l1, l2)
+}
+
+// Write a copy of a file to dir that shows or hides its layers as given,
+// by name, leaving any others as they were.  pdftoppm only renders the
+// default configuration, so this changes the default.
+func withLayers(filename string, visible map[string]bool, dir string) (string, error) {
+	ctx, err := readContext(filename)
+	if err != nil {
+		return "", err
+	}
+	ocgs, config := optionalContent(ctx)
+	if config == nil {
+		// Without layers there is nothing to change
+		return filename, nil
+	}
+	var on, off types.Array
+	for _, o := range ocgs {
+		show := defaultVisible(config, o)
+		if g, err := ctx.DereferenceDict(o); err == nil && g != nil {
+			if name := dictEntry(ctx, g, "Name"); name != nil {
+				n, _ := model.Text(name)
+				if v, ok := visible[n]; ok {
+					show = v
+				}
+			}
+		}
+		if show {
+			on = append(on, o)
+		} else {
+			off = append(off, o)
+		}
+	}
+	config["BaseState"] = types.Name("ON")
+	config["ON"] = on
+	config["OFF"] = off
+	// Usage rules could show or hide layers again as the page is rendered
+	delete(config, "AS")
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+	out := filepath.Join(dir, filepath.Base(filename))
+	if err := api.WriteContextFile(ctx, out); err != nil {
+		return "", fmt.Errorf("error writing %s with layers changed: %w", filename, err)
+	}
+	return out, nil
+}
@@ -0,0 +1,206 @@
+package pdfcomp
+
+import (
+	"fmt"
+
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/model"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/types"
+)
+
+// A link on a page and where it leads
+type Link struct {
+	// Position on the page in user space, rounded to whole points
+	Rect [4]float64
+	// Where the link leads, such as "uri https://example.com", "page 5",
+	// "destination intro (page 2)" or "file other.pdf page 1".  Broken links
+	// say so, as in "destination intro (missing)".
+	Target string
+}
+
+func (l Link) String() string {
+	return fmt.Sprintf("link [%g %g %g %g] to %s", l.Rect[0], l.Rect[1], l.Rect[2], l.Rect[3], l.Target)
+}
+
+// The links of every page of a file, indexed by page number
+func fileLinks(ctx *model.Context) (map[int][]Link, error) {
+	dests := namedDestinations(ctx)
+	links := map[int][]Link{}
+	for page := 1; page <= ctx.PageCount; page++ {
+		d, _, _, err := ctx.PageDict(page, false)
+		if err != nil {
+			return nil, fmt.Errorf("error reading links of page %d: %w", page, err)
+		}
+		arr, _ := dictEntry(ctx, d, "Annots").(types.Array)
+		for _, o := range arr {
+			ad, err := ctx.DereferenceDict(o)
+			if err != nil || ad == nil {
+				continue
+			}
+			if subtype, _ := dictEntry(ctx, ad, "Subtype").(types.Name); subtype != "Link" {
+				continue
+			}
+			l := Link{Rect: annotationRect(ctx, ad)}
+			if dest := dictEntry(ctx, ad, "Dest"); dest != nil {
+				l.Target = destinationTarget(ctx, dest, dests)
+			} else if action, ok := dictEntry(ctx, ad, "A").(types.Dict); ok {
+				l.Target = actionTarget(ctx, action, dests)
+			} else {
+				l.Target = "nothing"
+			}
+			links[page] = append(links[page], l)
+		}
+	}
+	return links, nil
+}
+
+// Where a link action leads
+func actionTarget(ctx *model.Context, action types.Dict, dests map[string]types.Object) string {
+	s, _ := dictEntry(ctx, action, "S").(types.Name)
+	switch s {
+	case "URI":
+		uri := ""
+		if o := dictEntry(ctx, action, "URI"); o != nil {
+			uri, _ = model.Text(o)
+		}
+		return "uri " + uri
+	case "GoTo":
+		return destinationTarget(ctx, dictEntry(ctx, action, "D"), dests)
+	case "GoToR", "Launch":
+		file := ""
+		switch f := dictEntry(ctx, action, "F").(type) {
+		case types.Dict:
+			if o := dictEntry(ctx, f, "UF"); o != nil {
+				file, _ = model.Text(o)
+			} else if o := dictEntry(ctx, f, "F"); o != nil {
+				file, _ = model.Text(o)
+			}
+		case nil:
+		default:
+			file, _ = model.Text(f)
+		}
+		if s == "Launch" {
+			return "launch " + file
+		}
+		// Destinations in other files can only be given by page index or name
+		switch d := dictEntry(ctx, action, "D").(type) {
+		case types.Array:
+			if len(d) > 0 {
+				if n, ok := d[0].(types.Integer); ok {
+					return fmt.Sprintf("file %s page %d", file, n.Value()+1)
+				}
+			}
+		case nil:
+		default:
+			name, _ := model.Text(d)
+			return fmt.Sprintf("file %s destination %s", file, name)
+		}
+		return "file " + file
+	case "Named":
+		n, _ := dictEntry(ctx, action, "N").(types.Name)
+		return "action " + n.Value()
+	}
+	return "action " + s.Value()
+}
+
+// Where a destination in the same document leads, looking up named
+// destinations
+func destinationTarget(ctx *model.Context, dest types.Object, dests map[string]types.Object) string {
+	var name string
+	switch d := dest.(type) {
+	case types.Name:
+		name = d.Value()
+	case types.StringLiteral, types.HexLiteral:
+		name, _ = model.Text(d)
+	default:
+		if page := destinationPage(ctx, dest); page > 0 {
+			return fmt.Sprintf("page %d", page)
+		}
+		return "page (missing)"
+	}
+	target, ok := dests[name]
+	if !ok {
+		return fmt.Sprintf("destination %s (missing)", name)
+	}
+	if page := destinationPage(ctx, target); page > 0 {
+		return fmt.Sprintf("destination %s (page %d)", name, page)
+	}
+	return fmt.Sprintf("destination %s (page missing)", name)
+}
+
+// The page an explicit destination leads to, or 0 if it leads to no page of
+// the document
+func destinationPage(ctx *model.Context, dest types.Object) int {
+	dest, _ = ctx.Dereference(dest)
+	if d, ok := dest.(types.Dict); ok {
+		// Named destinations may be dictionaries holding the destination
+		dest = dictEntry(ctx, d, "D")
+	}
+	arr, ok := dest.(types.Array)
+	if !ok || len(arr) == 0 {
+		return 0
+	}
+	ref, ok := arr[0].(types.IndirectRef)
+	if !ok {
+		return 0
+	}
+	page, err := ctx.PageNumber(ref.ObjectNumber.Value())
+	if err != nil {
+		return 0
+	}
+	return page
+}
+
+// The named destinations of a document, from the catalog's /Dests and from
+// the /Dests name tree
+func namedDestinations(ctx *model.Context) map[string]types.Object {
+	dests := map[string]types.Object{}
+	root, err := ctx.Catalog()
+	if err != nil {
+		return dests
+	}
+	if old, ok := dictEntry(ctx, root, "Dests").(types.Dict); ok {
+		for name, o := range old {
+			dests[name] = o
+		}
+	}
+	names, _ := dictEntry(ctx, root, "Names").(types.Dict)
+	tree, ok := dictEntry(ctx, names, "Dests").(types.Dict)
+	if !ok {
+		return dests
+	}
+	var walk func(node types.Dict, depth int)
+	walk = func(node types.Dict, depth int) {
+		if depth > maxStructDepth {
+			return
+		}
+		if pairs, ok := dictEntry(ctx, node, "Names").(types.Array); ok {
+			for i := 0; i+1 < len(pairs); i += 2 {
+				key, _ := ctx.Dereference(pairs[i])
+				if name, err := model.Text(key); err == nil {
+					dests[name] = pairs[i+1]
+				}
+			}
+		}
+		if kids, ok := dictEntry(ctx, node, "Kids").(types.Array); ok {
+			for _, k := range kids {
+				if kd, err := ctx.DereferenceDict(k); err == nil && kd != nil {
+					walk(kd, depth+1)
+				}
+			}
+		}
+	}
+	walk(tree, 0)
+	return dests
+}
+
+// Record the links that differ between the two versions of the page, which
+// makes the page different.  Does nothing if links were not read.
+func (pr *PageResult) compareLinks(links1, links2 map[int][]Link) {
+	if links1 == nil || links2 == nil {
+		return
+	}
+	pr.LinksRemoved, pr.LinksAdded = diffItems(links1[pr.Page], links2[pr.Page])
+	if len(pr.LinksRemoved) > 0 || len(pr.LinksAdded) > 0 {
+		pr.Equal = false
+	}
+}
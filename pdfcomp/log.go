@@ -0,0 +1,48 @@
+package pdfcomp
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"sync/atomic"
+)
+
+// Write debug output to stderr.
+//
+// Deprecated: use SetLogger with a handler at debug level, which this only
+// stands in for while no logger is set.
+var GlobDebug = false
+
+// The logger set with SetLogger, if any
+var logger atomic.Pointer[slog.Logger]
+
+var (
+	discardLogger = slog.New(discardHandler{})
+	stderrLogger  = slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelDebug}))
+)
+
+// Log what the package does to l: each step at debug level, and problems it
+// works around, such as an unreachable cache, at warn level.  Nothing is
+// logged until a logger is set.  A nil logger discards everything again.
+func SetLogger(l *slog.Logger) {
+	logger.Store(l)
+}
+
+// The logger to write to
+func log() *slog.Logger {
+	if l := logger.Load(); l != nil {
+		return l
+	}
+	if GlobDebug {
+		return stderrLogger
+	}
+	return discardLogger
+}
+
+// Drops every record without formatting it
+type discardHandler struct{}
+
+func (discardHandler) Enabled(context.Context, slog.Level) bool  { return false }
+func (discardHandler) Handle(context.Context, slog.Record) error { return nil }
+func (h discardHandler) WithAttrs([]slog.Attr) slog.Handler      { return h }
+func (h discardHandler) WithGroup(string) slog.Handler           { return h }
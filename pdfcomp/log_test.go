@@ -0,0 +1,43 @@
+package pdfcomp
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func TestLogger(t *testing.T) {
+	defer SetLogger(nil)
+	defer func(debug bool) { GlobDebug = debug }(GlobDebug)
+	debugOn := func() bool { return log().Enabled(context.Background(), slog.LevelDebug) }
+
+	GlobDebug = false
+	if debugOn() {
+		t.Error("debug output on by default")
+	}
+
+	// Callers from before there was a logger still get debug output
+	GlobDebug = true
+	if !debugOn() {
+		t.Error("GlobDebug did not turn on debug output")
+	}
+
+	// A logger that is set takes over from it
+	var buf bytes.Buffer
+	SetLogger(slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: slog.LevelWarn})))
+	if debugOn() {
+		t.Error("GlobDebug turned on debug output of a logger at warn level")
+	}
+	log().Warn("cache unreachable")
+	if !strings.Contains(buf.String(), "cache unreachable") {
+		t.Errorf("logged %q, want the warning", buf.String())
+	}
+
+	SetLogger(nil)
+	GlobDebug = false
+	if debugOn() {
+		t.Error("debug output still on once the logger was removed")
+	}
+}
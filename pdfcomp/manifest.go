@@ -0,0 +1,156 @@
+package pdfcomp
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// One row of a manifest
+type manifestRow struct {
+	File1 string
+	File2 string
+}
+
+// Compare the pairs of files listed in a manifest, as ReadManifest reads
+// it, with profiles and options applied as CompareDirs applies them.  A
+// profile's pattern is matched against the first file of each pair as the
+// manifest names it.
+func CompareManifest(manifest string, profiles []Profile, opts ...Option) (*BatchResult, error) {
+	pairs, err := ReadManifest(manifest)
+	if err != nil {
+		return nil, err
+	}
+	res := &BatchResult{Pairs: pairs}
+	res.compare(profiles, opts)
+	return res, nil
+}
+
+// Read the pairs of files listed in a manifest, which is either a json array
+// of objects with file1 and file2 members, if its name ends in .json, or csv
+// rows of file1,file2 with an optional header row.  Relative paths are taken
+// from the manifest's directory, so a manifest can be kept beside the files
+// it lists.
+func ReadManifest(manifest string) ([]BatchPair, error) {
+	f, err := os.Open(manifest)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var rows []manifestRow
+	if strings.EqualFold(filepath.Ext(manifest), ".json") {
+		if err := json.NewDecoder(f).Decode(&rows); err != nil {
+			return nil, fmt.Errorf("error reading manifest %s: %w", manifest, err)
+		}
+	} else if rows, err = readCSVManifest(f); err != nil {
+		return nil, fmt.Errorf("error reading manifest %s: %w", manifest, err)
+	}
+
+	dir := filepath.Dir(manifest)
+	var pairs []BatchPair
+	for i, row := range rows {
+		if row.File1 == "" || row.File2 == "" {
+			return nil, fmt.Errorf("manifest %s: entry %d needs both file1 and file2", manifest, i+1)
+		}
+		pair := BatchPair{Path: filepath.ToSlash(row.File1), File1: row.File1, File2: row.File2}
+		if !filepath.IsAbs(pair.File1) {
+			pair.File1 = filepath.Join(dir, pair.File1)
+		}
+		if !filepath.IsAbs(pair.File2) {
+			pair.File2 = filepath.Join(dir, pair.File2)
+		}
+		pair.InDir1, pair.InDir2 = exists(pair.File1), exists(pair.File2)
+		pairs = append(pairs, pair)
+	}
+	return pairs, nil
+}
+
+func readCSVManifest(r io.Reader) ([]manifestRow, error) {
+	cr := csv.NewReader(r)
+	cr.Comment = '#'
+	cr.TrimLeadingSpace = true
+	records, err := cr.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	var rows []manifestRow
+	for i, rec := range records {
+		if len(rec) < 2 {
+			return nil, fmt.Errorf("line %d: expected file1,file2", i+1)
+		}
+		if i == 0 && strings.EqualFold(rec[0], "file1") && strings.EqualFold(rec[1], "file2") {
+			continue
+		}
+		rows = append(rows, manifestRow{File1: rec[0], File2: rec[1]})
+	}
+	return rows, nil
+}
+
+func exists(name string) bool {
+	_, err := os.Stat(name)
+	return err == nil
+}
+
+// Compare the files matching one glob pattern with those matching another,
+// pairing them by their paths below the directory each pattern starts from,
+// as CompareDirs pairs files, so that old/*.pdf and new/*.pdf pair
+// old/a.pdf with new/a.pdf.  Patterns are those of filepath.Match.
+func CompareGlobs(pattern1, pattern2 string, profiles []Profile, opts ...Option) (*BatchResult, error) {
+	base1, files1, err := globFiles(pattern1)
+	if err != nil {
+		return nil, err
+	}
+	base2, files2, err := globFiles(pattern2)
+	if err != nil {
+		return nil, err
+	}
+	res := &BatchResult{Dir1: pattern1, Dir2: pattern2}
+	for _, rel := range mergeNames(files1, files2) {
+		res.Pairs = append(res.Pairs, BatchPair{
+			Path:   rel,
+			File1:  filepath.Join(base1, filepath.FromSlash(rel)),
+			File2:  filepath.Join(base2, filepath.FromSlash(rel)),
+			InDir1: slices.Contains(files1, rel),
+			InDir2: slices.Contains(files2, rel),
+		})
+	}
+	res.compare(profiles, opts)
+	return res, nil
+}
+
+// True if a path is a glob pattern rather than a file name
+func IsGlob(name string) bool {
+	return strings.ContainsAny(name, "*?[")
+}
+
+// The files matching a glob pattern, relative to the directory the pattern
+// starts from, which is the part before the first element with wildcards.
+// Directories are skipped.
+func globFiles(pattern string) (string, []string, error) {
+	matches, err := filepath.Glob(pattern)
+	if err != nil {
+		return "", nil, fmt.Errorf("invalid pattern %q: %w", pattern, err)
+	}
+	base := filepath.Dir(pattern)
+	for IsGlob(base) {
+		base = filepath.Dir(base)
+	}
+	var files []string
+	for _, m := range matches {
+		if fi, err := os.Stat(m); err != nil || fi.IsDir() {
+			continue
+		}
+		rel, err := filepath.Rel(base, m)
+		if err != nil {
+			return "", nil, err
+		}
+		files = append(files, filepath.ToSlash(rel))
+	}
+	slices.Sort(files)
+	return base, files, nil
+}
@@ -0,0 +1,46 @@
+package pdfcomp
+
+import (
+	"runtime/debug"
+	"slices"
+	"sync"
+)
+
+// The memory budgets of the comparisons running now, and the process's soft
+// memory limit from before the first of them started.  The limit is the
+// smallest of the budgets while any is running, and is put back once the
+// last has finished, whichever order they finish in.
+var memoryLimit struct {
+	mu      sync.Mutex
+	budgets []int64
+	saved   int64
+}
+
+// Lower the soft memory limit to budget, if it is lower than it already is,
+// until the returned function is called
+func holdMemoryLimit(budget int64) (release func()) {
+	memoryLimit.mu.Lock()
+	defer memoryLimit.mu.Unlock()
+	if len(memoryLimit.budgets) == 0 {
+		memoryLimit.saved = debug.SetMemoryLimit(-1)
+	}
+	memoryLimit.budgets = append(memoryLimit.budgets, budget)
+	setMemoryLimit()
+	return func() {
+		memoryLimit.mu.Lock()
+		defer memoryLimit.mu.Unlock()
+		i := slices.Index(memoryLimit.budgets, budget)
+		memoryLimit.budgets = slices.Delete(memoryLimit.budgets, i, i+1)
+		setMemoryLimit()
+	}
+}
+
+// Apply the smallest budget, or the saved limit if there are none.  Must be
+// called with memoryLimit.mu held.
+func setMemoryLimit() {
+	limit := memoryLimit.saved
+	if len(memoryLimit.budgets) > 0 {
+		limit = min(limit, slices.Min(memoryLimit.budgets))
+	}
+	debug.SetMemoryLimit(limit)
+}
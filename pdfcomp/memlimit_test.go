@@ -0,0 +1,35 @@
+package pdfcomp
+
+import (
+	"math"
+	"runtime/debug"
+	"testing"
+)
+
+func TestHoldMemoryLimit(t *testing.T) {
+	defer debug.SetMemoryLimit(debug.SetMemoryLimit(math.MaxInt64))
+	limit := func() int64 { return debug.SetMemoryLimit(-1) }
+
+	release1 := holdMemoryLimit(300 << 20)
+	if got := limit(); got != 300<<20 {
+		t.Fatalf("limit %d with one budget, want %d", got, 300<<20)
+	}
+	release2 := holdMemoryLimit(100 << 20)
+	release3 := holdMemoryLimit(200 << 20)
+	if got := limit(); got != 100<<20 {
+		t.Fatalf("limit %d with three budgets, want the smallest, %d", got, 100<<20)
+	}
+	// The comparisons finish in a different order than they started
+	release2()
+	if got := limit(); got != 200<<20 {
+		t.Errorf("limit %d once the smallest finished, want %d", got, 200<<20)
+	}
+	release1()
+	if got := limit(); got != 200<<20 {
+		t.Errorf("limit %d once the first finished, want %d", got, 200<<20)
+	}
+	release3()
+	if got := limit(); got != math.MaxInt64 {
+		t.Errorf("limit %d once all finished, want it put back to %d", got, int64(math.MaxInt64))
+	}
+}
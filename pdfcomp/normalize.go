@@ -0,0 +1,234 @@
+package pdfcomp
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/model"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/types"
+)
+
+// Decimal places numbers in content streams are rounded to by default before
+// they are compared, which hides the noise of regenerating a file
+const DefaultContentPrecision = 2
+
+// Differences between the drawing commands of two files, found without
+// rendering them
+type ContentReport struct {
+	File1  string
+	File2  string
+	Pages1 int
+	Pages2 int
+	Equal  bool
+	// One entry per page in both files
+	Pages []ContentPage
+}
+
+// Differences between the drawing commands of one page
+type ContentPage struct {
+	Page  int
+	Equal bool
+	// Normalised operators only in file1, prefixed with "- ", and only in
+	// file2, prefixed with "+ "
+	Changes []string
+	// True if the fonts, images, forms, annotation appearances or page boxes
+	// differ
+	ResourcesChanged bool
+}
+
+// Compare the content streams of two files page by page, after normalising
+// them so that only changes to what is drawn count: white space, comments and
+// the way numbers and strings are written are ignored, and numbers are rounded
+// to ContentPrecision decimal places.  This finds pages that render the same
+// but were drawn differently, and needs no renderer.
+func CompareContent(file1, file2 string, opts ...Option) (*ContentReport, error) {
+	o := DefaultOptions()
+	for _, opt := range opts {
+		opt(&o)
+	}
+	ctx1, err := readContext(file1)
+	if err != nil {
+		return nil, fmt.Errorf("error reading %s: %w", file1, err)
+	}
+	ctx2, err := readContext(file2)
+	if err != nil {
+		return nil, fmt.Errorf("error reading %s: %w", file2, err)
+	}
+
+	r := &ContentReport{File1: file1, File2: file2, Pages1: ctx1.PageCount, Pages2: ctx2.PageCount}
+	r.Equal = r.Pages1 == r.Pages2
+	for page := 1; page <= min(r.Pages1, r.Pages2); page++ {
+		ops1, err := normalizedContent(ctx1, page, o.ContentPrecision)
+		if err != nil {
+			return nil, fmt.Errorf("error reading page %d of %s: %w", page, file1, err)
+		}
+		ops2, err := normalizedContent(ctx2, page, o.ContentPrecision)
+		if err != nil {
+			return nil, fmt.Errorf("error reading page %d of %s: %w", page, file2, err)
+		}
+		res1, err := pageResourceBytes(ctx1, page)
+		if err != nil {
+			return nil, err
+		}
+		res2, err := pageResourceBytes(ctx2, page)
+		if err != nil {
+			return nil, err
+		}
+		cp := ContentPage{Page: page, Changes: diffSequences(ops1, ops2), ResourcesChanged: string(res1) != string(res2)}
+		cp.Equal = len(cp.Changes) == 0 && !cp.ResourcesChanged
+		r.Equal = r.Equal && cp.Equal
+		r.Pages = append(r.Pages, cp)
+	}
+	return r, nil
+}
+
+// True if two pages draw exactly the same things from the same resources,
+// so that they must render the same
+func samePageContent(ctx1, ctx2 *model.Context, page, precision int) (bool, error) {
+	ops1, err := normalizedContent(ctx1, page, precision)
+	if err != nil {
+		return false, err
+	}
+	ops2, err := normalizedContent(ctx2, page, precision)
+	if err != nil {
+		return false, err
+	}
+	if !slices.Equal(ops1, ops2) {
+		return false, nil
+	}
+	res1, err := pageResourceBytes(ctx1, page)
+	if err != nil {
+		return false, err
+	}
+	res2, err := pageResourceBytes(ctx2, page)
+	if err != nil {
+		return false, err
+	}
+	return string(res1) == string(res2), nil
+}
+
+// The operators of a page's content stream, one per line with their operands
+// normalised
+func normalizedContent(ctx *model.Context, page, precision int) ([]string, error) {
+	content, _, err := pageContent(ctx, page)
+	if err != nil {
+		return nil, err
+	}
+	ops, err := parseContent(content)
+	if err != nil {
+		return nil, err
+	}
+	lines := make([]string, len(ops))
+	for i, op := range ops {
+		var b strings.Builder
+		for _, t := range op.operands {
+			b.WriteString(normalizeToken(t, precision))
+			b.WriteByte(' ')
+		}
+		b.WriteString(op.op)
+		lines[i] = b.String()
+	}
+	return lines, nil
+}
+
+// Write a token in one canonical form
+func normalizeToken(t contentToken, precision int) string {
+	switch t.kind {
+	case tokNumber:
+		scale := math.Pow(10, float64(precision))
+		v := math.Round(t.number()*scale) / scale
+		if v == 0 {
+			// No negative zero
+			v = 0
+		}
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case tokString:
+		return strconv.Quote(t.text)
+	case tokInlineData:
+		sum := sha256.Sum256([]byte(t.text))
+		return "<inline data " + hex.EncodeToString(sum[:8]) + ">"
+	}
+	return t.text
+}
+
+// Everything besides its content stream that affects how a page is drawn: its
+// boxes and rotation, the fonts and XObjects it uses, in name order, and the
+// appearances of its annotations
+func pageResourceBytes(ctx *model.Context, page int) ([]byte, error) {
+	d, _, inh, err := ctx.PageDict(page, false)
+	if err != nil {
+		return nil, err
+	}
+	var out []byte
+	for _, box := range []*types.Rectangle{inh.MediaBox, inh.CropBox} {
+		if box != nil {
+			out = append(out, box.String()...)
+		}
+	}
+	out = append(out, strconv.Itoa(inh.Rotate)...)
+
+	resDict, ok := dictEntry(ctx, d, "Resources").(types.Dict)
+	if !ok {
+		resDict = inh.Resources
+	}
+	if fonts, ok := dictEntry(ctx, resDict, "Font").(types.Dict); ok {
+		for _, name := range sortedKeys(fonts) {
+			font, _ := dictEntry(ctx, fonts, name).(types.Dict)
+			out = append(out, "/"+name...)
+			if base, ok := dictEntry(ctx, font, "BaseFont").(types.Name); ok {
+				out = append(out, " /"+base.Value()...)
+			}
+			out = append(out, fontProgram(ctx, font)...)
+		}
+	}
+	if xobjs, ok := dictEntry(ctx, resDict, "XObject").(types.Dict); ok {
+		for _, name := range sortedKeys(xobjs) {
+			out = append(out, "/"+name...)
+			sd, _, err := ctx.DereferenceStreamDict(xobjs[name])
+			if err != nil || sd == nil {
+				continue
+			}
+			out = append(out, sd.Raw...)
+		}
+	}
+	if annots, ok := dictEntry(ctx, d, "Annots").(types.Array); ok {
+		for _, o := range annots {
+			ad, _ := ctx.Dereference(o)
+			ap, _ := dictEntry(ctx, asDict(ad), "AP").(types.Dict)
+			if sd, _, err := ctx.DereferenceStreamDict(ap["N"]); err == nil && sd != nil {
+				out = append(out, sd.Raw...)
+			}
+		}
+	}
+	return out, nil
+}
+
+// The embedded program of a font, or of the first descendant of a composite
+// font, if there is one
+func fontProgram(ctx *model.Context, font types.Dict) []byte {
+	if desc, ok := dictEntry(ctx, font, "DescendantFonts").(types.Array); ok && len(desc) > 0 {
+		o, _ := ctx.Dereference(desc[0])
+		font = asDict(o)
+	}
+	fd, _ := dictEntry(ctx, font, "FontDescriptor").(types.Dict)
+	for _, key := range []string{"FontFile", "FontFile2", "FontFile3"} {
+		o, found := fd.Find(key)
+		if !found {
+			continue
+		}
+		if sd, _, err := ctx.DereferenceStreamDict(o); err == nil && sd != nil {
+			return sd.Raw
+		}
+	}
+	return nil
+}
+
+func asDict(o types.Object) types.Dict {
+	d, _ := o.(types.Dict)
+	return d
+}
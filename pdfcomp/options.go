@@ -0,0 +1,1037 @@
+package pdfcomp
+
+import (
+	"context"
+	"fmt"
+	"image/color"
+	"io"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Names difference images the same way as earlier versions, for example
+// lorem.pdf-1-diff.png
+const DefaultNameTemplate = "{file1}-{page}-diff.png"
+
+// How differences are shown in images and reports
+type DiffStyle string
+
+const (
+	// Yellow circles around every differing pixel
+	DiffCircles DiffStyle = "circles"
+	// Differing pixels coloured by how much they changed, from blue to red
+	DiffHeatmap DiffStyle = "heatmap"
+	// One rectangle around each region of differences
+	DiffBoxes DiffStyle = "boxes"
+)
+
+// Convert a style name, as given on the command line, to a DiffStyle
+func ParseDiffStyle(s string) (DiffStyle, error) {
+	switch DiffStyle(s) {
+	case DiffCircles, DiffHeatmap, DiffBoxes:
+		return DiffStyle(s), nil
+	}
+	return "", fmt.Errorf("unknown diff style %q", s)
+}
+
+// How the pages of the difference pdf show each differing page
+type PDFLayout string
+
+const (
+	// The two pages side by side, each with its differences marked
+	LayoutSideBySide PDFLayout = "side-by-side"
+	// Three panels on one pdf page: file1's page, file2's page, and file2's
+	// page with the differences marked in the diff style
+	LayoutThreePane PDFLayout = "three-pane"
+	// The same three panels on three pdf pages one after another, each
+	// drawn larger
+	LayoutThreePages PDFLayout = "three-pages"
+)
+
+// Convert a layout name, as given on the command line, to a PDFLayout
+func ParsePDFLayout(s string) (PDFLayout, error) {
+	switch PDFLayout(s) {
+	case LayoutSideBySide, LayoutThreePane, LayoutThreePages:
+		return PDFLayout(s), nil
+	}
+	return "", fmt.Errorf("unknown layout %q, expected side-by-side, three-pane or three-pages", s)
+}
+
+// The kind of animated image written for each differing page to blink
+// between its two renderings
+type BlinkFormat string
+
+const (
+	BlinkGIF BlinkFormat = "gif"
+	// Animated png, which keeps every colour but which some programs show
+	// as a still image of file1's page
+	BlinkAPNG BlinkFormat = "apng"
+)
+
+// Convert a blink format name, as given on the command line, to a
+// BlinkFormat.  The empty string writes no blink images.
+func ParseBlinkFormat(s string) (BlinkFormat, error) {
+	switch BlinkFormat(s) {
+	case "", BlinkGIF, BlinkAPNG:
+		return BlinkFormat(s), nil
+	}
+	return "", fmt.Errorf("unknown blink format %q, expected gif or apng", s)
+}
+
+// Whether comparing stops at the first differing page or goes on to the end
+type ScanMode string
+
+const (
+	// Stop at the first difference unless difference images or reports are
+	// wanted, which need every page
+	ScanAuto ScanMode = ""
+	// Stop at the first difference, even if images or reports are wanted
+	ScanFailFast ScanMode = "fail-fast"
+	// Compare every page, even if nothing but the outcome is wanted
+	ScanFull ScanMode = "full"
+)
+
+// Whether highlights cover the differences or are drawn around them
+type HighlightStyle string
+
+const (
+	HighlightFill    HighlightStyle = "fill"
+	HighlightOutline HighlightStyle = "outline"
+)
+
+// How differences are marked by the circles and boxes diff styles
+type Highlight struct {
+	Color color.RGBA
+	// How much of Color is blended into the page, from 0 to 1
+	Opacity float64
+	// Fill or outline.  If empty, circles are filled and boxes are outlined.
+	Style HighlightStyle
+	// Blend the colour in more strongly the more the pixels underneath
+	// differ, up to Opacity for the largest possible change, so that slight
+	// differences are faint and gross changes stand out
+	Graded bool
+}
+
+// The faintest a graded highlight is, as a fraction of its opacity, so that
+// the slightest difference still shows
+const gradedMinimum = 0.15
+
+// How strongly to highlight a difference of d, out of 255, in a mask
+func (hl Highlight) strength(d byte) byte {
+	if !hl.Graded {
+		return 255
+	}
+	return byte(max(float64(d), 255*gradedMinimum))
+}
+
+// Units the spacing of a Grid is measured in
+type GridUnit string
+
+const (
+	GridPoints      GridUnit = "pt"
+	GridMillimetres GridUnit = "mm"
+)
+
+// What pages are rendered in.  Gray and mono pages take a third of the
+// memory, and leave out the colour noise of recompressed scans.
+type ColorMode string
+
+const (
+	ColorRGB  ColorMode = ""
+	ColorGray ColorMode = "gray"
+	// Black and white only
+	ColorMono ColorMode = "mono"
+)
+
+// Convert a colour mode name, as given on the command line, to a ColorMode
+func ParseColorMode(s string) (ColorMode, error) {
+	switch s {
+	case "", "rgb":
+		return ColorRGB, nil
+	case string(ColorGray), string(ColorMono):
+		return ColorMode(s), nil
+	}
+	return "", fmt.Errorf("unknown color mode %q, expected rgb, gray or mono", s)
+}
+
+// Bytes per pixel of pages rendered in the mode
+func (c ColorMode) channels() int {
+	if c == ColorRGB {
+		return 3
+	}
+	return 1
+}
+
+// The pdftoppm arguments that render in the mode
+func (c ColorMode) args() []string {
+	if c == ColorRGB {
+		return nil
+	}
+	return []string{"-" + string(c)}
+}
+
+// What the renderer writes pages as.  Both give the same pixels, but PNG is
+// decoded by the standard library and is far smaller to pass between
+// processes.
+type RenderFormat string
+
+const (
+	// PNG if the renderer can write it, otherwise PPM
+	RenderAuto RenderFormat = ""
+	RenderPPM  RenderFormat = "ppm"
+	RenderPNG  RenderFormat = "png"
+)
+
+// Convert a render format name, as given on the command line, to a
+// RenderFormat
+func ParseRenderFormat(s string) (RenderFormat, error) {
+	switch RenderFormat(s) {
+	case RenderAuto, "auto":
+		return RenderAuto, nil
+	case RenderPPM, RenderPNG:
+		return RenderFormat(s), nil
+	}
+	return "", fmt.Errorf("unknown render format %q, expected auto, ppm or png", s)
+}
+
+// The format pages are rendered in: RenderAuto becomes PNG or PPM by what the
+// renderer can write
+func (f RenderFormat) resolve() RenderFormat {
+	if f == RenderAuto {
+		if rendererWritesPNG() {
+			return RenderPNG
+		}
+		return RenderPPM
+	}
+	return f
+}
+
+// The pdftoppm arguments that render in the format, which must be resolved
+func (f RenderFormat) args() []string {
+	if f == RenderPNG {
+		return []string{"-png"}
+	}
+	return nil
+}
+
+// Convert a unit name, as given on the command line, to a GridUnit
+func ParseGridUnit(s string) (GridUnit, error) {
+	switch GridUnit(s) {
+	case GridPoints, GridMillimetres:
+		return GridUnit(s), nil
+	}
+	return "", fmt.Errorf("unknown grid unit %q, expected pt or mm", s)
+}
+
+// The size of one unit in points
+func (u GridUnit) points() float64 {
+	if u == GridMillimetres {
+		return 72 / 25.4
+	}
+	return 1
+}
+
+// A light grid drawn over difference images, with rulers along the top and
+// left edges of each page numbered from its top left corner, so that
+// reviewers can say where a difference is
+type Grid struct {
+	// Distance between lines, in Unit.  Zero draws no grid.
+	Spacing float64
+	Unit    GridUnit
+}
+
+// Whether difference images put the renderings of a page next to each other
+// or one above the other
+type JoinDirection string
+
+const (
+	JoinHorizontal JoinDirection = "horizontal"
+	JoinVertical   JoinDirection = "vertical"
+	// Stack pages wider than they are tall, which side by side would make
+	// a very wide image, and put others next to each other
+	JoinAuto JoinDirection = "auto"
+)
+
+// Convert a direction name, as given on the command line, to a JoinDirection
+func ParseJoinDirection(s string) (JoinDirection, error) {
+	switch JoinDirection(s) {
+	case JoinHorizontal, JoinVertical, JoinAuto:
+		return JoinDirection(s), nil
+	}
+	return "", fmt.Errorf("unknown join direction %q, expected horizontal, vertical or auto", s)
+}
+
+// Where the smaller of two joined images is placed across the join
+type JoinAlign string
+
+const (
+	// Level with the top of the taller image, or the left edge of the wider
+	// one when stacked, padded below or to the right
+	JoinTop JoinAlign = "top"
+	// Halfway across the larger image, padded equally on both sides
+	JoinCenter JoinAlign = "center"
+)
+
+// Convert an alignment name, as given on the command line, to a JoinAlign
+func ParseJoinAlign(s string) (JoinAlign, error) {
+	switch JoinAlign(s) {
+	case JoinTop, JoinCenter:
+		return JoinAlign(s), nil
+	}
+	return "", fmt.Errorf("unknown join alignment %q, expected top or center", s)
+}
+
+// How difference images put the renderings of a page together
+type Join struct {
+	Direction JoinDirection
+	// Where the smaller image goes when the pages are different sizes
+	Align JoinAlign
+	// The colour the smaller image is padded with
+	Background color.RGBA
+}
+
+// Whether images of the given size are stacked rather than put side by side
+func (j Join) vertical(w, h int) bool {
+	switch j.Direction {
+	case JoinVertical:
+		return true
+	case JoinAuto:
+		return w > h
+	}
+	return false
+}
+
+// The join with its direction settled for images of the given size, so that
+// joining more than two images goes the same way throughout
+func (j Join) settled(w, h int) Join {
+	j.Direction = JoinHorizontal
+	if j.vertical(w, h) {
+		j.Direction = JoinVertical
+	}
+	return j
+}
+
+// Named colours accepted by ParseColor.  The highlight colours are chosen to
+// stand out on typical documents, including for the common forms of colour
+// blindness; white and black are for backgrounds.
+var namedColors = map[string]color.RGBA{
+	"yellow":  {255, 255, 0, 255},
+	"magenta": {255, 0, 255, 255},
+	"cyan":    {0, 255, 255, 255},
+	"orange":  {230, 159, 0, 255},
+	"blue":    {0, 114, 178, 255},
+	"red":     {255, 0, 0, 255},
+	"white":   {255, 255, 255, 255},
+	"black":   {0, 0, 0, 255},
+}
+
+// Convert a colour name, or hex RGB as in #ff8800, to a colour
+func ParseColor(s string) (color.RGBA, error) {
+	if c, ok := namedColors[strings.ToLower(s)]; ok {
+		return c, nil
+	}
+	hex := strings.TrimPrefix(s, "#")
+	if len(hex) != 6 {
+		return color.RGBA{}, fmt.Errorf("invalid colour %q, expected a name or #rrggbb", s)
+	}
+	v, err := strconv.ParseUint(hex, 16, 32)
+	if err != nil {
+		return color.RGBA{}, fmt.Errorf("invalid colour %q, expected a name or #rrggbb", s)
+	}
+	return color.RGBA{byte(v >> 16), byte(v >> 8), byte(v), 255}, nil
+}
+
+// Convert a highlight style name, as given on the command line, to a HighlightStyle
+func ParseHighlightStyle(s string) (HighlightStyle, error) {
+	switch HighlightStyle(s) {
+	case "", HighlightFill, HighlightOutline:
+		return HighlightStyle(s), nil
+	}
+	return "", fmt.Errorf("unknown highlight style %q", s)
+}
+
+// Options control how a comparison is carried out and what it produces.
+// Start from DefaultOptions, or pass Option values to Compare.
+type Options struct {
+	// Resolution is the dpi used to render pages for comparison
+	Resolution int
+	// Render pages in colour, gray or black and white
+	Color ColorMode
+	// Highlight circles have radius Resolution / Ratio
+	Ratio int
+	// How to show differences
+	DiffStyle DiffStyle
+	// How the difference pdf shows each differing page
+	Layout PDFLayout
+	// How to mark differences in the circles and boxes styles
+	Highlight Highlight
+	// Grid and rulers drawn over difference images, if its spacing is set
+	Grid Grid
+	// How difference images put the two renderings of a page together
+	Join Join
+	// Close-ups of the regions of differences in the html report and the
+	// difference pdf, if its zoom is set
+	Detail Detail
+	// Names for the two files in the Result and in reports, by default their
+	// paths.  Also used for the names of difference images, which are still
+	// written beside file1 unless OutDir is set.
+	Label1 string
+	Label2 string
+	// Write a png for each differing page, highlighting the differences
+	Images bool
+	// Write an animated image for each differing page showing its renderings
+	// in the two files in turn, if set
+	Blink BlinkFormat
+	// Write copies of the two files with an annotation marking each region
+	// that differs, each named after its file but ending -annotated.pdf
+	AnnotateCopies bool
+	// Keep the image highlighting the differences of each differing page in
+	// the Result, so that callers can use it without any files being written,
+	// along with the renderings its Overlay and Heatmap are drawn from
+	KeepImages bool
+	// Directory for difference images, by default the directory of file1
+	OutDir string
+	// Name for difference images, with the placeholders {file1} and {file2}
+	// for the input file names, {base1} and {base2} for the same without
+	// their extension, and {page} for the page number.  If empty,
+	// DefaultNameTemplate is used.
+	NameTemplate string
+	// If more than zero, difference images written as files are kept within
+	// this many bytes, by scaling them down or switching to jpeg
+	MaxArtifactBytes int
+	// If not nil, receives a pdf bundling the difference images together
+	PDF io.Writer
+	// If not nil, receives a self-contained html report of the differences
+	HTML io.Writer
+	// Render each file with a single pdftoppm process, decoding pages as they
+	// are produced, rather than starting one process per page
+	SingleProcess bool
+	// Skip rendering pages whose content streams and resources are the same
+	// in both files, since they must render the same
+	ContentShortcut bool
+	// Decimal places numbers in content streams are rounded to before they
+	// are compared
+	ContentPrecision int
+	// Render each page at this lower resolution first, and only render the
+	// pages that differ at it at Resolution, which is much faster when most
+	// pages are the same.  A change too small to alter any pixel at the lower
+	// resolution is missed.  Zero renders every page at Resolution.
+	Prescreen int
+	// If the pages of one file render at a whole multiple of the size of the
+	// other's, as when the same scan is embedded at different resolutions,
+	// reduce the larger to compare them rather than failing
+	Rescale bool
+	// Count pages whose /Rotate differs between the files as different, even
+	// if they look the same once turned the same way, as they are before
+	// comparing
+	CompareRotation bool
+	// Render pages that are a different size in each file, such as Letter
+	// against A4, at a resolution for file2 that brings it to the same
+	// number of pixels as file1, so that they can be compared
+	MatchSize bool
+	// Crop each rendering to the smallest area holding its content, and
+	// compare the content wherever it is on the page, for receipts and other
+	// pages whose length follows their content.  Content of different sizes
+	// is padded to the larger unless Fit says otherwise.
+	CropToContent bool
+	// How to bring renderings of a page that come out at different sizes to
+	// the same size.  With FitNone, pages of different sizes fail the
+	// comparison with ErrSizeMismatch.
+	Fit SizeFit
+	// Line up the renderings of each page before comparing them, by moving
+	// file2's by up to a quarter of an inch in each direction, for pages from
+	// sources that crop or place them slightly differently
+	Align bool
+	// Pixels whose channels all differ by no more than this, out of 255, count
+	// as the same, to absorb anti-aliasing and colour management noise
+	Tolerance int
+	// Pixels whose colours are no more than this far apart in CIE Lab, by
+	// the CIE76 Delta-E, count as the same, so that colour conversions too
+	// small to see, such as sRGB against an ICC profile, are not differences.
+	// Around 2.3 is the smallest difference most people notice.  Zero
+	// compares the channels exactly.
+	DeltaE float64
+	// Pages where no more than this percentage of the area differs count as
+	// the same, for changes too small to matter such as a moved dot.  Zero
+	// allows no difference at all.
+	MaxDiffPercent float64
+	// Areas left out of the comparison, such as a date or a job number
+	Ignore []IgnoreRegion
+	// Decisions exported from the html report of an earlier comparison.
+	// Accepted regions are left out of the comparison; rejected ones make the
+	// files count as different if they are the files that were reviewed.
+	Review *Review
+	// Limits on the renderer for each page.  If any is set, pages the renderer
+	// fails on are recorded as failed rather than ending the comparison.
+	Limits RenderLimits
+	// If more than zero, the most memory in bytes the comparison should take
+	// up.  The two files are then rendered one after the other rather than at
+	// once, the buffers of each page are reused for the next once it is
+	// reported, and the process's soft memory limit is lowered to this while
+	// comparing.  Middleware and page hooks must copy any image they keep.
+	// Pages kept for KeepImages or an html report are not reused.
+	MemoryBudget int64
+	// What the renderer writes pages as, by default PNG where the renderer
+	// can write it
+	RenderFormat RenderFormat
+	// Arguments passed to the renderer before the file, such as -aa no to
+	// turn off antialiasing, or -cropbox.  They must not change where or in
+	// what format it writes the pages.
+	RendererArgs []string
+	// Have the renderer write each page to a file in a temporary directory,
+	// read from there and removed once read, rather than passing it back in
+	// memory, where the encoded page and the decoded one would be held at
+	// once.  Pages are then always rendered one process per page.  The
+	// directory is removed when the comparison ends, however it ends.
+	RenderToDisk bool
+	// If more than zero, how long the renderer may take over a page before
+	// it is stopped, and the comparison fails with a *RenderError wrapping
+	// ErrRenderTimeout.  With Limits set, the page is recorded as failed
+	// instead, and the comparison carries on.
+	RenderTimeout time.Duration
+	// If not nil, the comparison stops once the context is done, killing any
+	// renderer running and removing its temporary files, and returns the
+	// context's error
+	Context context.Context
+	// Also compare the PDF documents embedded in portfolios, pairing them by name
+	Portfolios bool
+	// If more than zero, compare only this many pages, chosen by SampleMethod
+	// with the random seed SampleSeed, and estimate how many of the rest
+	// differ.  Meant for very long documents.
+	Sample       int
+	SampleMethod Sampling
+	SampleSeed   uint64
+	// If more than zero, files with more pages than this are not compared,
+	// giving an error wrapping ErrTooManyPages
+	MaxPages int
+	// Keep only the pages that differ in Result.Pages, passing the others to
+	// OnPage and Progress as they are compared and then dropping them, so
+	// that memory does not grow with the length of the documents
+	StreamResults bool
+	// Whether comparing stops at the first difference.  StopAfter and
+	// sampling take precedence.
+	Scan ScanMode
+	// If more than zero, stop rendering pages once this many have been found
+	// to differ, even if difference images are wanted, and check the rest
+	// only by their content, estimating how many of them differ.  Ignored
+	// when sampling.
+	StopAfter int
+	// Also compare the annotations of each page, such as links, comments and
+	// stamps, by type, position and contents
+	Annotations bool
+	// Also compare the signature fields of the two documents: which are
+	// signed, by whom and when
+	Signatures bool
+	// Leave the areas where signatures appear out of the visual comparison,
+	// since signing changes them
+	MaskSignatures bool
+	// Note on differing pages the fonts the renderer had to substitute in
+	// each file, so that differences that may come from the fonts installed
+	// rather than from the files can be told apart
+	FontSubstitution bool
+	// Label each differing page with the probable cause of its differences,
+	// guessed from its text, fonts and images and the pattern of the
+	// differences, so that reviewers can see which changes were intended
+	Classify bool
+	// Also compare the layers (optional content groups) of the two documents
+	// and whether each is shown by default
+	Layers bool
+	// Show or hide layers by name before rendering, overriding whether the
+	// documents show them by default.  Layers not named are left as they are.
+	LayerVisibility map[string]bool
+	// Also compare the page labels of the two documents, the numbering that
+	// viewers show and that printed page references follow
+	PageLabels bool
+	// Also compare where the links on each page lead, including whether
+	// links within the document still reach a page
+	Links bool
+	// Steps added around the stages of the pipeline each page goes through
+	Middleware map[Stage][]Middleware
+	// Rules of the caller's own applied to each compared page, in order,
+	// before its verdict is final
+	PageHooks []PageHook
+	// If not nil, rendered pages and page fingerprints are looked up here
+	// before being computed, and stored here afterwards.  Pages are then
+	// rendered one at a time even with SingleProcess, so that cached pages are
+	// never rendered.
+	Cache Cache
+	// If not nil, called as each page is compared with its result and the
+	// number of pages to be compared in all, so that progress can be shown
+	OnPage func(pr PageResult, total int)
+	// If not nil, called as each page is compared with its number, the
+	// number of pages to be compared in all and whether it was the same
+	Progress func(page, total int, equal bool)
+	// If not empty, record each completed page in this directory, so that a
+	// comparison of the same files with the same settings that is interrupted
+	// can be run again and carry on from where it stopped.  Cleared once the
+	// comparison finishes.
+	ResumeDir string
+}
+
+// The settings that change the outcome or the artifacts of a comparison, as
+// recorded in progress and audit logs
+type Settings struct {
+	Resolution       int
+	Color            ColorMode
+	Ratio            int
+	DiffStyle        DiffStyle
+	Highlight        Highlight
+	Grid             Grid
+	Images           bool
+	OutDir           string
+	NameTemplate     string
+	Sample           int
+	SampleMethod     Sampling
+	SampleSeed       uint64
+	StopAfter        int
+	Scan             ScanMode
+	Annotations      bool
+	Signatures       bool
+	MaskSignatures   bool
+	FontSubstitution bool
+	Layers           bool
+	LayerVisibility  map[string]bool
+	PageLabels       bool
+	Links            bool
+	Portfolios       bool
+	MaxArtifactBytes int
+	Limits           RenderLimits
+	ContentShortcut  bool
+	ContentPrecision int
+	Prescreen        int
+	Rescale          bool
+	CompareRotation  bool
+	MatchSize        bool
+	CropToContent    bool
+	Fit              SizeFit
+	Align            bool
+	Tolerance        int
+	DeltaE           float64
+	MaxDiffPercent   float64
+	Ignore           []IgnoreRegion
+	Review           *Review
+	RendererArgs     []string
+	Layout           PDFLayout
+	Join             Join
+	Blink            BlinkFormat
+	Detail           Detail
+}
+
+// How long the renderer may take over a page by default, long enough for the
+// heaviest pages at high resolutions, so that only a renderer that has hung
+// on a corrupt file is stopped
+const DefaultRenderTimeout = 5 * time.Minute
+
+// An Option changes one setting of Options
+type Option func(*Options)
+
+// The settings used by the command line program when no flags are given
+func DefaultOptions() Options {
+	return Options{
+		Resolution:       300,
+		Ratio:            30,
+		DiffStyle:        DiffCircles,
+		Layout:           LayoutSideBySide,
+		Highlight:        Highlight{Color: namedColors["yellow"], Opacity: 0.5},
+		Join:             Join{Direction: JoinHorizontal, Align: JoinTop, Background: namedColors["white"]},
+		Detail:           Detail{Margin: DefaultDetailMargin},
+		SampleMethod:     SampleStratified,
+		SampleSeed:       1,
+		ContentPrecision: DefaultContentPrecision,
+		RenderTimeout:    DefaultRenderTimeout,
+	}
+}
+
+func WithResolution(dpi int) Option {
+	return func(o *Options) { o.Resolution = dpi }
+}
+
+func WithColor(color ColorMode) Option {
+	return func(o *Options) { o.Color = color }
+}
+
+func WithRatio(ratio int) Option {
+	return func(o *Options) { o.Ratio = ratio }
+}
+
+func WithDiffStyle(style DiffStyle) Option {
+	return func(o *Options) { o.DiffStyle = style }
+}
+
+func WithLayout(layout PDFLayout) Option {
+	return func(o *Options) { o.Layout = layout }
+}
+
+func WithHighlight(hl Highlight) Option {
+	return func(o *Options) { o.Highlight = hl }
+}
+
+// Draw a grid with lines spacing units apart, and rulers, over difference
+// images.  A spacing of zero draws none.
+func WithGrid(spacing float64, unit GridUnit) Option {
+	return func(o *Options) { o.Grid = Grid{spacing, unit} }
+}
+
+func WithJoin(join Join) Option {
+	return func(o *Options) { o.Join = join }
+}
+
+// Show each region of differences close up in reports, zoom times larger
+// than the rendering with margin points of the page around it.  A zoom of
+// zero shows none.
+func WithDetail(zoom, margin float64) Option {
+	return func(o *Options) { o.Detail = Detail{zoom, margin} }
+}
+
+func WithImages(images bool) Option {
+	return func(o *Options) { o.Images = images }
+}
+
+func WithBlink(format BlinkFormat) Option {
+	return func(o *Options) { o.Blink = format }
+}
+
+func WithAnnotateCopies(annotate bool) Option {
+	return func(o *Options) { o.AnnotateCopies = annotate }
+}
+
+func WithLabels(label1, label2 string) Option {
+	return func(o *Options) { o.Label1, o.Label2 = label1, label2 }
+}
+
+func WithKeepImages(keep bool) Option {
+	return func(o *Options) { o.KeepImages = keep }
+}
+
+func WithOutDir(dir string) Option {
+	return func(o *Options) { o.OutDir = dir }
+}
+
+func WithNameTemplate(tmpl string) Option {
+	return func(o *Options) { o.NameTemplate = tmpl }
+}
+
+func WithMaxArtifactBytes(n int) Option {
+	return func(o *Options) { o.MaxArtifactBytes = n }
+}
+
+func WithPDF(w io.Writer) Option {
+	return func(o *Options) { o.PDF = w }
+}
+
+func WithHTML(w io.Writer) Option {
+	return func(o *Options) { o.HTML = w }
+}
+
+func WithSingleProcess(single bool) Option {
+	return func(o *Options) { o.SingleProcess = single }
+}
+
+func WithContentShortcut(shortcut bool) Option {
+	return func(o *Options) { o.ContentShortcut = shortcut }
+}
+
+func WithContentPrecision(places int) Option {
+	return func(o *Options) { o.ContentPrecision = places }
+}
+
+func WithPrescreen(resolution int) Option {
+	return func(o *Options) { o.Prescreen = resolution }
+}
+
+func WithRescale(rescale bool) Option {
+	return func(o *Options) { o.Rescale = rescale }
+}
+
+func WithCompareRotation(compare bool) Option {
+	return func(o *Options) { o.CompareRotation = compare }
+}
+
+func WithMatchSize(match bool) Option {
+	return func(o *Options) { o.MatchSize = match }
+}
+
+func WithCropToContent(crop bool) Option {
+	return func(o *Options) { o.CropToContent = crop }
+}
+
+func WithFit(fit SizeFit) Option {
+	return func(o *Options) { o.Fit = fit }
+}
+
+func WithAlign(align bool) Option {
+	return func(o *Options) { o.Align = align }
+}
+
+func WithTolerance(tolerance int) Option {
+	return func(o *Options) { o.Tolerance = tolerance }
+}
+
+func WithDeltaE(threshold float64) Option {
+	return func(o *Options) { o.DeltaE = threshold }
+}
+
+func WithMaxDiffPercent(percent float64) Option {
+	return func(o *Options) { o.MaxDiffPercent = percent }
+}
+
+// Add areas to leave out of the comparison
+func WithIgnore(regions ...IgnoreRegion) Option {
+	return func(o *Options) { o.Ignore = append(o.Ignore, regions...) }
+}
+
+func WithReview(r *Review) Option {
+	return func(o *Options) { o.Review = r }
+}
+
+func WithLimits(limits RenderLimits) Option {
+	return func(o *Options) { o.Limits = limits }
+}
+
+func WithMemoryBudget(bytes int64) Option {
+	return func(o *Options) { o.MemoryBudget = bytes }
+}
+
+func WithRenderFormat(format RenderFormat) Option {
+	return func(o *Options) { o.RenderFormat = format }
+}
+
+func WithRendererArgs(args ...string) Option {
+	return func(o *Options) { o.RendererArgs = args }
+}
+
+func WithRenderToDisk(toDisk bool) Option {
+	return func(o *Options) { o.RenderToDisk = toDisk }
+}
+
+func WithRenderTimeout(timeout time.Duration) Option {
+	return func(o *Options) { o.RenderTimeout = timeout }
+}
+
+func WithContext(ctx context.Context) Option {
+	return func(o *Options) { o.Context = ctx }
+}
+
+func WithPortfolios(portfolios bool) Option {
+	return func(o *Options) { o.Portfolios = portfolios }
+}
+
+func WithSample(pages int, method Sampling, seed uint64) Option {
+	return func(o *Options) { o.Sample, o.SampleMethod, o.SampleSeed = pages, method, seed }
+}
+
+func WithMaxPages(pages int) Option {
+	return func(o *Options) { o.MaxPages = pages }
+}
+
+func WithStreamResults(stream bool) Option {
+	return func(o *Options) { o.StreamResults = stream }
+}
+
+func WithStopAfter(pages int) Option {
+	return func(o *Options) { o.StopAfter = pages }
+}
+
+func WithAnnotations(annotations bool) Option {
+	return func(o *Options) { o.Annotations = annotations }
+}
+
+func WithSignatures(signatures bool) Option {
+	return func(o *Options) { o.Signatures = signatures }
+}
+
+func WithMaskSignatures(mask bool) Option {
+	return func(o *Options) { o.MaskSignatures = mask }
+}
+
+func WithFontSubstitution(check bool) Option {
+	return func(o *Options) { o.FontSubstitution = check }
+}
+
+func WithClassify(classify bool) Option {
+	return func(o *Options) { o.Classify = classify }
+}
+
+func WithLayers(layers bool) Option {
+	return func(o *Options) { o.Layers = layers }
+}
+
+func WithLayerVisibility(visible map[string]bool) Option {
+	return func(o *Options) { o.LayerVisibility = visible }
+}
+
+func WithPageLabels(labels bool) Option {
+	return func(o *Options) { o.PageLabels = labels }
+}
+
+func WithLinks(links bool) Option {
+	return func(o *Options) { o.Links = links }
+}
+
+// Add middleware around a stage of the pipeline, inside any added before
+func WithMiddleware(stage Stage, mw Middleware) Option {
+	return func(o *Options) {
+		if o.Middleware == nil {
+			o.Middleware = map[Stage][]Middleware{}
+		}
+		o.Middleware[stage] = append(o.Middleware[stage], mw)
+	}
+}
+
+// Add a rule applied to each compared page, after any added before
+func WithPageHook(hook PageHook) Option {
+	return func(o *Options) { o.PageHooks = append(o.PageHooks, hook) }
+}
+
+func WithCache(c Cache) Option {
+	return func(o *Options) { o.Cache = c }
+}
+
+func WithOnPage(fn func(pr PageResult, total int)) Option {
+	return func(o *Options) { o.OnPage = fn }
+}
+
+// Report progress as each page is compared.  To receive it on a channel,
+// send from fn.
+func WithProgress(fn func(page, total int, equal bool)) Option {
+	return func(o *Options) { o.Progress = fn }
+}
+
+func WithResumeDir(dir string) Option {
+	return func(o *Options) { o.ResumeDir = dir }
+}
+
+// The settings that affect the outcome, leaving out where output is sent
+func (o *Options) Settings() Settings {
+	return Settings{
+		Resolution:       o.Resolution,
+		Color:            o.Color,
+		Ratio:            o.Ratio,
+		DiffStyle:        o.DiffStyle,
+		Highlight:        o.Highlight,
+		Grid:             o.Grid,
+		Images:           o.Images,
+		OutDir:           o.OutDir,
+		NameTemplate:     o.NameTemplate,
+		Sample:           o.Sample,
+		SampleMethod:     o.SampleMethod,
+		SampleSeed:       o.SampleSeed,
+		StopAfter:        o.StopAfter,
+		Scan:             o.Scan,
+		Annotations:      o.Annotations,
+		Signatures:       o.Signatures,
+		MaskSignatures:   o.MaskSignatures,
+		FontSubstitution: o.FontSubstitution,
+		Layers:           o.Layers,
+		LayerVisibility:  o.LayerVisibility,
+		PageLabels:       o.PageLabels,
+		Links:            o.Links,
+		Portfolios:       o.Portfolios,
+		MaxArtifactBytes: o.MaxArtifactBytes,
+		Limits:           o.Limits,
+		ContentShortcut:  o.ContentShortcut,
+		ContentPrecision: o.ContentPrecision,
+		Prescreen:        o.Prescreen,
+		Rescale:          o.Rescale,
+		CompareRotation:  o.CompareRotation,
+		MatchSize:        o.MatchSize,
+		CropToContent:    o.CropToContent,
+		Fit:              o.Fit,
+		Align:            o.Align,
+		Tolerance:        o.Tolerance,
+		DeltaE:           o.DeltaE,
+		MaxDiffPercent:   o.MaxDiffPercent,
+		Ignore:           o.Ignore,
+		Review:           o.Review,
+		RendererArgs:     o.RendererArgs,
+		Layout:           o.Layout,
+		Join:             o.Join,
+		Blink:            o.Blink,
+		Detail:           o.Detail,
+	}
+}
+
+// Stop at the first differing page if failFast is true, or compare every
+// page if it is false, whether or not images or reports are wanted
+func WithFailFast(failFast bool) Option {
+	return func(o *Options) {
+		o.Scan = ScanFull
+		if failFast {
+			o.Scan = ScanFailFast
+		}
+	}
+}
+
+// True if comparing stops at the first difference found
+func (o *Options) failFast() bool {
+	switch o.Scan {
+	case ScanFailFast:
+		return true
+	case ScanFull:
+		return false
+	}
+	return !o.visualize() && !o.AnnotateCopies
+}
+
+// True if difference images need to be generated for any of the outputs
+func (o *Options) visualize() bool {
+	return o.Images || o.Blink != "" || o.KeepImages || o.PDF != nil || o.HTML != nil
+}
+
+// The context the comparison stops for, which is never done if there is none
+func (o *Options) context() context.Context {
+	if o.Context == nil {
+		return context.Background()
+	}
+	return o.Context
+}
+
+// Whether the buffers of each page are reused for the next, which they can
+// only be if no result keeps them
+func (o *Options) reuseBuffers() bool {
+	return o.MemoryBudget > 0 && !o.KeepImages && o.HTML == nil
+}
+
+// Check that the name template gives every page its own file
+func (o *Options) checkNameTemplate() error {
+	if o.NameTemplate != "" && !strings.Contains(o.NameTemplate, "{page}") {
+		return fmt.Errorf("name template %q must include {page}", o.NameTemplate)
+	}
+	return nil
+}
+
+// The path of the difference image for a page: in OutDir, or else beside
+// file1, named from the labels the files are known by in the result
+func (o *Options) imageName(file1, label1, label2 string, page int) string {
+	tmpl := o.NameTemplate
+	if tmpl == "" {
+		tmpl = DefaultNameTemplate
+	}
+	base1, base2 := filepath.Base(label1), filepath.Base(label2)
+	name := strings.NewReplacer(
+		"{file1}", base1,
+		"{file2}", base2,
+		"{base1}", strings.TrimSuffix(base1, filepath.Ext(base1)),
+		"{base2}", strings.TrimSuffix(base2, filepath.Ext(base2)),
+		"{page}", strconv.Itoa(page),
+	).Replace(tmpl)
+
+	dir := o.OutDir
+	if dir == "" {
+		dir = filepath.Dir(file1)
+	}
+	return filepath.Join(dir, name)
+}
+
+// The filename for the blink image of a page, named as its difference image
+// is but ending -blink.gif or -blink.png in place of -diff.png
+func (o *Options) blinkName(file1, label1, label2 string, page int) string {
+	name := o.imageName(file1, label1, label2, page)
+	name = strings.TrimSuffix(strings.TrimSuffix(name, filepath.Ext(name)), "-diff")
+	if o.Blink == BlinkAPNG {
+		return name + "-blink.png"
+	}
+	return name + "-blink.gif"
+}
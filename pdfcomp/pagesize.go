@@ -0,0 +1,140 @@
+package pdfcomp
+
+import (
+	"fmt"
+	"image"
+	"math"
+
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/model"
+)
+
+// Pages whose widths and heights are within this many points are taken to be
+// the same size
+const sizeTolerance = 0.5
+
+// Common paper sizes in millimetres, portrait
+var paperSizes = []struct {
+	name          string
+	width, height float64
+}{
+	{"A3", 297, 420},
+	{"A4", 210, 297},
+	{"A5", 148, 210},
+	{"B4", 250, 353},
+	{"B5", 176, 250},
+	{"Letter", 215.9, 279.4},
+	{"Legal", 215.9, 355.6},
+	{"Tabloid", 279.4, 431.8},
+}
+
+// The physical size of a page as a viewer shows it
+type PageSize struct {
+	// Width and height of the area rendered in points, turned by Rotate
+	Width  float64
+	Height float64
+	// The page's /Rotate, in degrees clockwise
+	Rotate int
+}
+
+func (s PageSize) WidthMM() float64 {
+	return s.Width * 25.4 / 72
+}
+
+func (s PageSize) HeightMM() float64 {
+	return s.Height * 25.4 / 72
+}
+
+// "portrait", "landscape" or "square"
+func (s PageSize) Orientation() string {
+	switch {
+	case math.Abs(s.Width-s.Height) <= sizeTolerance:
+		return "square"
+	case s.Width > s.Height:
+		return "landscape"
+	}
+	return "portrait"
+}
+
+// Name of the paper size, such as A4 or Letter, in either orientation, or ""
+// if it is not a common one
+func (s PageSize) Paper() string {
+	short, long := min(s.WidthMM(), s.HeightMM()), max(s.WidthMM(), s.HeightMM())
+	for _, p := range paperSizes {
+		if math.Abs(short-p.width) < 1 && math.Abs(long-p.height) < 1 {
+			return p.name
+		}
+	}
+	return ""
+}
+
+// True if two pages are the same size and way round
+func (s PageSize) Same(t PageSize) bool {
+	return math.Abs(s.Width-t.Width) <= sizeTolerance && math.Abs(s.Height-t.Height) <= sizeTolerance
+}
+
+func (s PageSize) String() string {
+	str := fmt.Sprintf("%gx%gpt (%.0fx%.0fmm)", roundPoints(s.Width), roundPoints(s.Height), s.WidthMM(), s.HeightMM())
+	if s.Rotate != 0 {
+		str += fmt.Sprintf(" rotated %d", s.Rotate)
+	}
+	if p := s.Paper(); p != "" {
+		return p + " " + s.Orientation() + ", " + str
+	}
+	return s.Orientation() + ", " + str
+}
+
+// The size of every page of a file
+func pageSizes(ctx *model.Context) ([]PageSize, error) {
+	sizes := make([]PageSize, ctx.PageCount)
+	for i := range sizes {
+		_, _, inh, err := ctx.PageDict(i+1, false)
+		if err != nil {
+			return nil, fmt.Errorf("error reading page %d: %w", i+1, err)
+		}
+		box := renderedBox(inh)
+		rotate := ((inh.Rotate % 360) + 360) % 360
+		sizes[i] = PageSize{Width: box.Width(), Height: box.Height(), Rotate: rotate}
+		if rotate == 90 || rotate == 270 {
+			sizes[i].Width, sizes[i].Height = sizes[i].Height, sizes[i].Width
+		}
+	}
+	return sizes, nil
+}
+
+// The pixel size both files rendered a page at, when the page is a different
+// size in each and MatchSize was set, and the resolution that took in file2.
+// file1 renders at the resolution asked for.
+type MatchedSize struct {
+	Width, Height int
+	// Horizontal and vertical resolution of file2, in dpi
+	XDPI2, YDPI2 float64
+}
+
+func (m *MatchedSize) String() string {
+	return fmt.Sprintf("file2 rendered at %.4gx%.4g dpi to match file1's %dx%d pixels", m.XDPI2, m.YDPI2, m.Width, m.Height)
+}
+
+// The pixel size to render a page of both files at so that they come out the
+// same, which is the size of file1's at the resolution, or nothing if the
+// page is the same size in both
+func matchedSize(size1, size2 PageSize, resolution int) *MatchedSize {
+	if size1.Same(size2) || size2.Width == 0 || size2.Height == 0 {
+		return nil
+	}
+	m := &MatchedSize{
+		Width:  int(math.Ceil(size1.Width * float64(resolution) / 72)),
+		Height: int(math.Ceil(size1.Height * float64(resolution) / 72)),
+	}
+	m.XDPI2 = float64(m.Width) * 72 / size2.Width
+	m.YDPI2 = float64(m.Height) * 72 / size2.Height
+	return m
+}
+
+// The pixel size to render a page at, or the zero point to render it at the
+// resolution
+func (m *MatchedSize) scaleTo() image.Point {
+	if m == nil {
+		return image.Point{}
+	}
+	return image.Pt(m.Width, m.Height)
+}
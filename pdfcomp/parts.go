@@ -0,0 +1,115 @@
+package pdfcomp
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pdfcpu/pdfcpu/pkg/api"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/model"
+)
+
+// One of the files a document split across several is made of
+type DocumentPart struct {
+	File string
+	// The page of the whole document the part's first page is
+	FirstPage int
+	Pages     int
+}
+
+// Compare two documents that are each split across an ordered list of files,
+// as systems that emit documents in chunks make them, as if each list were
+// one file of all their pages in order.  Page numbers in the Result run
+// through the whole document, and Result.Parts1 and Parts2 tell which file
+// each page came from.  Unless WithLabels is used, each document is labelled
+// by the names of its parts joined with +.
+func CompareParts(parts1, parts2 []string, opts ...Option) (*Result, error) {
+	o := DefaultOptions()
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return compareParts(parts1, parts2, o)
+}
+
+func compareParts(parts1, parts2 []string, o Options) (*Result, error) {
+	if len(parts1) == 0 || len(parts2) == 0 {
+		return nil, fmt.Errorf("expected at least one part of each document")
+	}
+	if o.Label1 == "" {
+		o.Label1 = strings.Join(parts1, "+")
+	}
+	if o.Label2 == "" {
+		o.Label2 = strings.Join(parts2, "+")
+	}
+	if o.OutDir == "" {
+		// Beside the first part, not the joined files, which are removed
+		o.OutDir = filepath.Dir(parts1[0])
+	}
+
+	// pdftoppm renders one file at a time, so the parts are joined into
+	// temporary files, which render as the parts do
+	dir, err := os.MkdirTemp("", "pdfcomp-parts-*")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+	file1, info1, err := joinParts(parts1, filepath.Join(dir, "1.pdf"))
+	if err != nil {
+		return nil, err
+	}
+	file2, info2, err := joinParts(parts2, filepath.Join(dir, "2.pdf"))
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := compare(file1, file2, o)
+	if res != nil {
+		res.Parts1, res.Parts2 = info1, info2
+		for _, f := range []string{file1, file2} {
+			if fi, err := os.Stat(f); err == nil && strings.HasPrefix(f, dir) {
+				res.Usage.TempBytes += fi.Size()
+			}
+		}
+	}
+	return res, err
+}
+
+// Join the parts of a document into one file at joined, unless there is only
+// one part, returning the name of the file to compare and where each part's
+// pages are
+func joinParts(parts []string, joined string) (string, []DocumentPart, error) {
+	info := make([]DocumentPart, len(parts))
+	first := 1
+	for i, part := range parts {
+		n, err := PageCount(part)
+		if err != nil {
+			return "", nil, fmt.Errorf("error getting page count for %s: %w", part, err)
+		}
+		info[i] = DocumentPart{File: part, FirstPage: first, Pages: n}
+		first += n
+	}
+	if len(parts) == 1 {
+		return parts[0], info, nil
+	}
+	if err := api.MergeCreateFile(parts, joined, false, model.NewDefaultConfiguration()); err != nil {
+		return "", nil, fmt.Errorf("error joining %s: %w", strings.Join(parts, ", "), err)
+	}
+	return joined, info, nil
+}
+
+// The part a page of a document split across files is in, and the number of
+// the page within it.  file is 1 or 2.  Returns an empty name for documents
+// that were not compared in parts.
+func (r *Result) PartPage(file, page int) (string, int) {
+	parts := r.Parts1
+	if file == 2 {
+		parts = r.Parts2
+	}
+	for _, p := range parts {
+		if page >= p.FirstPage && page < p.FirstPage+p.Pages {
+			return p.File, page - p.FirstPage + 1
+		}
+	}
+	return "", 0
+}
@@ -2,14 +2,19 @@ package pdfcomp
 
 import (
 	"bytes"
+	"context"
 	"errors"
 	"fmt"
+	"image"
 	"image/png"
 	"io"
 	"os"
 	"os/exec"
+	"path/filepath"
 	"runtime"
 	"strconv"
+	"strings"
+	"sync"
 
 	"github.com/pdfcpu/pdfcpu/pkg/api"
 	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu"
@@ -19,122 +24,805 @@ import (
 	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/types"
 )
 
-var GlobDebug = false
-
-// Compare two PDF files, and return true if they are visually the same.  Some messages
-// may be printed to stderr.
+// Compare two PDF files, and return true if they are visually the same.
 // If images is set, will write png files highlighting the differences in each page.
 // If pdf is given, will create PDF file highlighting bundling these images together.
 // Resolution is the dpi to render images fo pages in the pdf for comparison.
 // Highlighting is done with circles radius resolution / ratio.
 // Does not check if resolution and ratio are sensible.  Try 150 and 30.
 func EqualPDFs(file1, file2 string, images bool, pdf io.Writer, resolution, ratio int) (bool, error) {
+	res, err := Compare(file1, file2,
+		WithImages(images), WithPDF(pdf), WithResolution(resolution), WithRatio(ratio))
+	if err != nil {
+		return false, err
+	}
+	return res.Equal, nil
+}
+
+// Compare two PDF files page by page, returning a Result describing which pages
+// differ.  With no options, uses DefaultOptions and produces no output files.
+func Compare(file1, file2 string, opts ...Option) (*Result, error) {
+	o := DefaultOptions()
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return compare(file1, file2, o)
+}
+
+// Compare two PDF files with the options already applied
+func compare(file1, file2 string, o Options) (*Result, error) {
+	if err := o.checkNameTemplate(); err != nil {
+		return nil, err
+	}
+	res := &Result{File1: file1, File2: file2, Equal: true}
+	meter := &usageMeter{}
+	defer func() { res.Usage = meter.total() }()
+	if o.Label1 != "" {
+		res.File1 = o.Label1
+	}
+	if o.Label2 != "" {
+		res.File2 = o.Label2
+	}
 	if file1 == file2 {
-		if GlobDebug {
-			fmt.Fprintf(os.Stderr, "two files are the same: %s\n", file1)
-		}
-		return true, nil
+		log().Debug("files are identical", "file1", file1, "file2", file2)
+		return res, nil
+	}
+	if o.MemoryBudget > 0 {
+		defer holdMemoryLimit(o.MemoryBudget)()
 	}
 
-	pages1, err := PageCount(file1)
+	ctx1, err := readContext(file1)
 	if err != nil {
-		return false, fmt.Errorf("error getting page count for %s: %w", file1, err)
+		return nil, fmt.Errorf("error getting page count for %s: %w", file1, err)
 	}
-	pages2, err := PageCount(file2)
+	ctx2, err := readContext(file2)
 	if err != nil {
-		return false, fmt.Errorf("error getting page count for %s: %w", file2, err)
+		return nil, fmt.Errorf("error getting page count for %s: %w", file2, err)
+	}
+	pages1, pages2 := ctx1.PageCount, ctx2.PageCount
+	res.Pages1, res.Pages2 = pages1, pages2
+	if o.MaxPages > 0 && max(pages1, pages2) > o.MaxPages {
+		return nil, fmt.Errorf("%w: %s has %d pages and %s has %d, more than %d", ErrTooManyPages, file1, pages1, file2, pages2, o.MaxPages)
+	}
+	if res.Sizes1, err = pageSizes(ctx1); err != nil {
+		return nil, fmt.Errorf("error reading page sizes of %s: %w", file1, err)
+	}
+	if res.Sizes2, err = pageSizes(ctx2); err != nil {
+		return nil, fmt.Errorf("error reading page sizes of %s: %w", file2, err)
 	}
 
 	if pages1 != pages2 {
-		if GlobDebug {
-			fmt.Fprintf(os.Stderr, "two files have different numbers of pages, %s: %d, %s: %d\n", file1, pages1, file2, pages2)
-		}
-		if !images {
-			return false, nil
+		log().Debug("files have different numbers of pages", "file1", file1, "pages1", pages1, "file2", file2, "pages2", pages2)
+		res.Equal = false
+		if o.failFast() {
+			return res, nil
 		}
 	}
 
-	same := true
 	pngFiles := []PageFile{}
+	spoolDir := ""
+	// Whether spoolDir was made just for this comparison
+	tempSpool := false
+	defer func() {
+		if tempSpool {
+			os.RemoveAll(spoolDir)
+		}
+	}()
+
+	pages := pageSet{count: min(pages1, pages2)}
+	if o.Sample > 0 {
+		pages.sample = samplePages(pages.count, o.Sample, o.SampleMethod, o.SampleSeed)
+		res.Sample = &SampleResult{Method: o.SampleMethod, Seed: o.SampleSeed, Total: pages.count, Pages: pages.sample}
+	}
 
-	for i := range pages1 {
-		page := i + 1
-		// Get a PPM in memmory to work with
-		ppm1, err := PdfToPPM(file1, page, resolution)
+	var prog *progress
+	if o.ResumeDir != "" {
+		prog, err = openProgress(o.ResumeDir, file1, file2, o)
 		if err != nil {
-			return false, err
+			return nil, fmt.Errorf("error opening progress in %s: %w", o.ResumeDir, err)
 		}
+		defer prog.close()
+		// Spooled images have to survive an interruption too
+		spoolDir = prog.spoolDir()
+	}
 
-		ppm2, err := PdfToPPM(file2, page, resolution)
+	var annots1, annots2 map[int][]Annotation
+	if o.Annotations {
+		if annots1, err = fileAnnotations(file1); err != nil {
+			return nil, err
+		}
+		if annots2, err = fileAnnotations(file2); err != nil {
+			return nil, err
+		}
+	}
+
+	var masks map[int][]Region
+	if o.Signatures || o.MaskSignatures {
+		sigs1, err := fileSignatures(ctx1)
+		if err != nil {
+			return nil, fmt.Errorf("error reading signatures of %s: %w", file1, err)
+		}
+		sigs2, err := fileSignatures(ctx2)
 		if err != nil {
-			return false, err
+			return nil, fmt.Errorf("error reading signatures of %s: %w", file2, err)
 		}
+		if o.Signatures {
+			res.SignaturesRemoved, res.SignaturesAdded = diffSignatures(sigs1, sigs2)
+			if len(res.SignaturesRemoved) > 0 || len(res.SignaturesAdded) > 0 {
+				res.Equal = false
+			}
+		}
+		if o.MaskSignatures {
+			// Blank the areas of both, so a signature on either page is ignored
+			masks = signatureMasks(o.Resolution, sigs1, sigs2)
+		}
+	}
 
-		// Convert to matrices for easier manipulation
-		mat1, err := ppmToMatrix(ppm1)
+	if o.Layers {
+		res.LayersRemoved, res.LayersAdded = diffLayers(fileLayers(ctx1), fileLayers(ctx2))
+		if len(res.LayersRemoved) > 0 || len(res.LayersAdded) > 0 {
+			res.Equal = false
+		}
+	}
+
+	var links1, links2 map[int][]Link
+	if o.Links {
+		if links1, err = fileLinks(ctx1); err != nil {
+			return nil, fmt.Errorf("error reading links of %s: %w", file1, err)
+		}
+		if links2, err = fileLinks(ctx2); err != nil {
+			return nil, fmt.Errorf("error reading links of %s: %w", file2, err)
+		}
+	}
+
+	if o.PageLabels {
+		res.LabelsRemoved, res.LabelsAdded = diffLabelRanges(fileLabelRanges(ctx1), fileLabelRanges(ctx2))
+		if len(res.LabelsRemoved) > 0 || len(res.LabelsAdded) > 0 {
+			res.Equal = false
+		}
+	}
+
+	// Rejections only stand for the files that were reviewed, as any others
+	// may have been fixed
+	if o.Review != nil {
+		match, err := o.Review.Matches(file1, file2)
 		if err != nil {
-			return false, err
+			return nil, err
+		}
+		if match {
+			res.Rejected = o.Review.Decided(ReviewRejected)
+			if len(res.Rejected) > 0 {
+				res.Equal = false
+			}
 		}
+	}
 
-		mat2, err := ppmToMatrix(ppm2)
+	// The files pdftoppm renders, which are copies if layers are to be shown
+	// or hidden
+	render1, render2 := file1, file2
+	if len(o.LayerVisibility) > 0 {
+		dir, err := os.MkdirTemp("", "pdfcomp-layers-*")
 		if err != nil {
-			return false, err
+			return nil, err
+		}
+		defer os.RemoveAll(dir)
+		if render1, err = withLayers(file1, o.LayerVisibility, filepath.Join(dir, "1")); err != nil {
+			return nil, err
+		}
+		if render2, err = withLayers(file2, o.LayerVisibility, filepath.Join(dir, "2")); err != nil {
+			return nil, err
 		}
+		meter.temp(render1)
+		meter.temp(render2)
+	}
 
-		// Finally do some comparing
-		thisSame, diff, err := equalImgMatrix(mat1, mat2, images || (pdf != nil))
-		same = same && thisSame
+	// Pages completed by an interrupted run need not be rendered again
+	first := 1
+	for i := range pages.len() {
+		page := pages.at(i)
+		if _, ok := prog.resumable(page, o); !ok {
+			first = page
+			break
+		}
+	}
+
+	// How file2's rendering of a page is turned to match file1's, if it is
+	rotation := func(page int) *Rotation {
+		if page > len(res.Sizes1) || page > len(res.Sizes2) {
+			return nil
+		}
+		return pageRotation(res.Sizes1[page-1], res.Sizes2[page-1])
+	}
+	// The pixel size to render a page of both files at, if it is to be matched
+	matched := func(page int) *MatchedSize {
+		if !o.MatchSize || page > len(res.Sizes1) || page > len(res.Sizes2) {
+			return nil
+		}
+		return matchedSize(res.Sizes1[page-1], res.Sizes2[page-1].turned(rotation(page)), o.Resolution)
+	}
+	scaleTo1 := func(page int) image.Point { return matched(page).scaleTo() }
+	// file2 is rendered on its side if it is to be turned onto it
+	scaleTo2 := func(page int) image.Point {
+		size := matched(page).scaleTo()
+		if rotation(page).sideways() {
+			size.X, size.Y = size.Y, size.X
+		}
+		return size
+	}
+
+	// Where the renderer writes pages, if not to its output
+	var renderDir string
+	if o.RenderToDisk {
+		if renderDir, err = os.MkdirTemp("", "pdfcomp-render-*"); err != nil {
+			return nil, err
+		}
+		defer os.RemoveAll(renderDir)
+	}
+
+	var src1, src2 pageSource
+	// A single process would render every page between the sampled ones,
+	// limits apply to each page, matched pages each need a size of their own,
+	// and pages written to disk are each read from a file of their own
+	if o.SingleProcess && o.Sample == 0 && !o.Limits.enabled() && o.Cache == nil && !o.MatchSize && !o.RenderToDisk && pages.len() > 0 {
+		s1, err := newStreamSource(o.context(), render1, first, pages.at(pages.len()-1), o.Resolution, o.Color, o.RenderFormat, o.RendererArgs, meter)
+		if err != nil {
+			return nil, err
+		}
+		s1.timeout = o.RenderTimeout
+		defer s1.close()
+		s2, err := newStreamSource(o.context(), render2, first, pages.at(pages.len()-1), o.Resolution, o.Color, o.RenderFormat, o.RendererArgs, meter)
+		if err != nil {
+			return nil, err
+		}
+		s2.timeout = o.RenderTimeout
+		defer s2.close()
+		src1, src2 = s1, s2
+	} else {
+		src1 = &perPageSource{filename: render1, resolution: o.Resolution, scaleTo: scaleTo1, color: o.Color, format: o.RenderFormat, extra: o.RendererArgs, limits: o.Limits, dir: renderDir, timeout: o.RenderTimeout, ctx: o.Context, usage: meter}
+		src2 = &perPageSource{filename: render2, resolution: o.Resolution, scaleTo: scaleTo2, color: o.Color, format: o.RenderFormat, extra: o.RendererArgs, limits: o.Limits, dir: renderDir, timeout: o.RenderTimeout, ctx: o.Context, usage: meter}
+	}
+	// Renderers screening pages at a low resolution before they are rendered
+	// in full
+	var pre1, pre2 pageSource
+	if o.Prescreen > 0 && o.Prescreen < o.Resolution {
+		pre1 = &perPageSource{filename: render1, resolution: o.Prescreen, color: o.Color, format: o.RenderFormat, extra: o.RendererArgs, limits: o.Limits, dir: renderDir, timeout: o.RenderTimeout, ctx: o.Context, usage: meter}
+		pre2 = &perPageSource{filename: render2, resolution: o.Prescreen, color: o.Color, format: o.RenderFormat, extra: o.RendererArgs, limits: o.Limits, dir: renderDir, timeout: o.RenderTimeout, ctx: o.Context, usage: meter}
+	}
+	if o.Cache != nil {
+		// Keyed by the original files, since copies made to show or hide
+		// layers differ every time
+		sum1, err := Checksum(file1)
+		if err != nil {
+			return nil, err
+		}
+		sum2, err := Checksum(file2)
 		if err != nil {
-			return false, err
+			return nil, err
+		}
+		src1 = &cachedSource{pageSource: src1, cache: o.Cache, checksum: sum1, o: o, scaleTo: scaleTo1}
+		src2 = &cachedSource{pageSource: src2, cache: o.Cache, checksum: sum2, o: o, scaleTo: scaleTo2}
+		if pre1 != nil {
+			po := o
+			po.Resolution = o.Prescreen
+			pre1 = &cachedSource{pageSource: pre1, cache: o.Cache, checksum: sum1, o: po}
+			pre2 = &cachedSource{pageSource: pre2, cache: o.Cache, checksum: sum2, o: po}
 		}
+	}
 
-		if !same && (images || (pdf != nil)) {
-			img1 := diffImage(mat1, diff, resolution/ratio)
-			img2 := diffImage(mat2, diff, resolution/ratio)
+	// The areas of a page left out of the comparison
+	pageMasks := func(page int) []Region {
+		regions := append(ignoredRegions(o.Ignore, page, o.Resolution), masks[page]...)
+		return append(regions, o.Review.accepted(page, o.Resolution)...)
+	}
 
-			joined := joinImages(img1, img2, 5)
+	// Compare what the page has besides its appearance
+	compareExtras := func(pr *PageResult) {
+		pr.compareAnnotations(annots1, annots2)
+		pr.compareLinks(links1, links2)
+	}
 
-			filename := file1 + "-" + strconv.Itoa(page) + "-diff.png"
-			file, err := os.Create(filename)
+	// Add a compared page to the result and report it
+	diffs := 0
+	// Equal pages left out of the Result, which an estimate still needs
+	var streamed []PageResult
+	addPage := func(pr PageResult) {
+		log().Debug("compared page", "page", pr.Page, "of", pages.len(), "equal", pr.Equal)
+		switch {
+		case !o.StreamResults || !pr.Equal:
+			res.Pages = append(res.Pages, pr)
+		case o.StopAfter > 0:
+			streamed = append(streamed, PageResult{Page: pr.Page, Equal: true})
+		}
+		res.Equal = res.Equal && pr.Equal
+		if !pr.Equal {
+			diffs++
+			if res.Sample != nil {
+				res.Sample.Different++
+			}
+		}
+		if o.OnPage != nil {
+			o.OnPage(pr, pages.len())
+		}
+		if o.Progress != nil {
+			o.Progress(pr.Page, pages.len(), pr.Equal)
+		}
+	}
+
+	// Whether to stop rendering pages.  A sample has to be compared in full
+	// to estimate the rest.
+	done := func() bool {
+		if res.Sample != nil {
+			return false
+		}
+		if o.StopAfter > 0 {
+			return diffs >= o.StopAfter
+		}
+		return !res.Equal && o.failFast()
+	}
+	// Pages left unrendered when StopAfter was reached
+	var rest []int
+
+	for i := range pages.len() {
+		page := pages.at(i)
+		if err := o.context().Err(); err != nil {
+			return nil, err
+		}
+		if pp, ok := prog.resumable(page, o); ok {
+			pr, err := prog.restore(pp, o.KeepImages)
 			if err != nil {
-				return false, err
+				return nil, err
+			}
+			compareExtras(&pr)
+			addPage(pr)
+			if o.PDF != nil && !pr.Equal && pp.Image != "" {
+				sources := []PageFile{{filename: pp.Image}}
+				for _, f := range pp.Panels {
+					sources = append(sources, PageFile{filename: f})
+				}
+				pngFiles = append(pngFiles, pdfPages(res, &pr, sources)...)
 			}
-			defer file.Close()
+			if done() {
+				rest = pages.after(i)
+				break
+			}
+			continue
+		}
 
-			pngJoined := rgbToPNG(joined)
+		var same, prescreened bool
+		if o.ContentShortcut {
+			same, err = samePageContent(ctx1, ctx2, page, o.ContentPrecision)
+			if err != nil {
+				return nil, err
+			}
+		}
+		// Pages turned or matched in size would not match at a low resolution
+		if !same && pre1 != nil && rotation(page) == nil && matched(page) == nil {
+			same, err = prescreenPage(pre1, pre2, page)
+			if err != nil {
+				return nil, err
+			}
+			prescreened = same
+		}
+		if same {
+			pr := PageResult{Page: page, Equal: true, Prescreened: prescreened}
+			compareExtras(&pr)
+			addPage(pr)
+			if prog != nil {
+				if err := prog.record(pr, "", nil); err != nil {
+					return nil, err
+				}
+			}
+			if done() {
+				rest = pages.after(i)
+				break
+			}
+			continue
+		}
+
+		st := &PageState{File1: file1, File2: file2, Page: page, Channels: o.Color.channels()}
+		// Images made for the page besides those in st, to reuse once it is
+		// reported
+		var spent []*Image
+
+		// Render into images for easier manipulation, both files at once,
+		// each with a renderer of its own, or one after the other to keep
+		// within a memory budget
+		err = o.runStage(StageRender, st, func() error {
+			if o.MemoryBudget > 0 {
+				var err error
+				if st.Image1, err = src1.page(page); err != nil {
+					return err
+				}
+				st.Image2, err = src2.page(page)
+				return err
+			}
+			var err2 error
+			var wg sync.WaitGroup
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				st.Image2, err2 = src2.page(page)
+			}()
+			var err error
+			st.Image1, err = src1.page(page)
+			wg.Wait()
+			if err == nil {
+				err = err2
+			}
+			return err
+		})
+		var rerr *RenderError
+		if errors.As(err, &rerr) && o.Limits.enabled() {
+			// Only this page is lost when the renderer is stopped or crashes
+			pr := PageResult{Page: page, Error: err.Error()}
+			addPage(pr)
+			if prog != nil {
+				if err := prog.record(pr, "", nil); err != nil {
+					return nil, err
+				}
+			}
+			if done() {
+				rest = pages.after(i)
+				break
+			}
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		spent = append(spent, st.Image1, st.Image2)
 
-			err = png.Encode(file, pngJoined)
+		err = o.runStage(StageNormalize, st, func() error {
+			if st.Rotation = rotation(page); st.Rotation != nil {
+				st.Image2 = rotateImage(st.Image2, st.Rotation.turn())
+			}
+			if o.Rescale {
+				st.Image1, st.Image2, st.Rescale = commonGrid(st.Image1, st.Image2)
+			}
+			fit := o.Fit
+			if o.CropToContent {
+				// Masks are placed on the page, so go on before cropping
+				if regions := pageMasks(page); regions != nil {
+					maskRegions(st.Image1, regions)
+					maskRegions(st.Image2, regions)
+				}
+				st.Image1, st.Image2, st.Crop = cropToContent(st.Image1, st.Image2)
+				if fit == FitNone {
+					fit = FitPad
+				}
+			}
+			st.Image1, st.Image2, st.Mismatch = fitPages(st.Image1, st.Image2, fit)
+			if st.Mismatch != nil && st.Mismatch.Fit == FitNone {
+				return fmt.Errorf("page %d: %w: %s; pad, crop or scale them to compare", page, ErrSizeMismatch, st.Mismatch)
+			}
+			if o.Align {
+				// Offsets are measured on file1's rendering, which may have
+				// been reduced
+				dpi := float64(o.Resolution)
+				if st.Rescale != nil && st.Rescale.File == 1 {
+					dpi /= float64(st.Rescale.Factor)
+				}
+				st.Image2, st.Offset = alignPages(st.Image1, st.Image2, dpi)
+			}
+			if regions := pageMasks(page); regions != nil && !o.CropToContent {
+				maskRegions(st.Image1, regions)
+				maskRegions(st.Image2, regions)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		// Finally do some comparing
+		radius := o.Resolution / o.Ratio
+		err = o.runStage(StageCompare, st, func() error {
+			var err error
+			st.Same, st.Diff, err = equalImages(st.Image1, st.Image2, true)
 			if err != nil {
-				return false, fmt.Errorf("error writing %s to png: %w", file1, err)
+				return err
 			}
-			if pdf != nil {
-				pngFiles = append(pngFiles, PageFile{page, filename})
+			meter.images(st.Image1, st.Image2, st.Diff)
+			if !st.Same && o.Tolerance > 0 {
+				st.Same = applyTolerance(st.Diff, o.Tolerance)
 			}
-		} else if !same {
-			break
+			if !st.Same && o.DeltaE > 0 {
+				st.Same = applyDeltaE(st.Diff, st.Image1, st.Image2, o.DeltaE)
+			}
+			var pixels int
+			var percent float64
+			if !st.Same {
+				pixels, percent = diffArea(st.Diff)
+				st.Same = percent <= o.MaxDiffPercent
+			}
+			if st.Same && st.Rotation != nil && o.CompareRotation {
+				// Nothing to highlight, but the page still differs
+				st.Same = false
+				if st.Diff == nil {
+					st.Diff = newMask(st.Image1)
+				}
+			}
+			st.Result = PageResult{Page: page, Equal: st.Same, Rotation: st.Rotation, Rescale: st.Rescale, Matched: matched(page), Crop: st.Crop, Mismatch: st.Mismatch, Offset: st.Offset, DiffPixels: pixels, DiffPercent: percent}
+			compareExtras(&st.Result)
+			if !st.Same {
+				st.Result.Regions = diffRegions(st.Diff, radius)
+				st.Result.UserSpace1, st.Result.UserSpace2, err = userSpaceRegions(ctx1, ctx2, st, o.Resolution)
+				if err != nil {
+					return err
+				}
+				if o.FontSubstitution {
+					st.Result.Fonts = pageSubstitution(ctx1, ctx2, page, src1.messages(), src2.messages())
+				}
+				if o.Classify {
+					fonts := st.Result.Fonts
+					if fonts == nil {
+						fonts = pageSubstitution(ctx1, ctx2, page, src1.messages(), src2.messages())
+					}
+					st.Result.Cause = classifyDiff(ctx1, ctx2, st, fonts, float64(o.Resolution))
+				}
+			}
+			return o.runPageHooks(st, ctx1, ctx2)
+		})
+		if err != nil {
+			return nil, err
 		}
 
+		// File holding the difference image, and any more images of the page
+		// spooled for the pdf, for resuming
+		spooled, panelFiles := "", []string(nil)
+		err = o.runStage(StageVisualize, st, func() error {
+			if st.Same || !o.visualize() {
+				return nil
+			}
+			// Highlights are drawn in color
+			raw1, raw2 := convertChannels(st.Image1, 3), convertChannels(st.Image2, 3)
+			diff, pr := st.Diff, &st.Result
+			var img1, img2 *Image
+			switch o.DiffStyle {
+			case DiffHeatmap:
+				img1 = heatmapImage(raw1, diff)
+				img2 = heatmapImage(raw2, diff)
+			case DiffBoxes:
+				thickness := max(1, radius/3)
+				img1 = boxImage(raw1, diff, pr.Regions, radius, thickness, o.Highlight)
+				img2 = boxImage(raw2, diff, pr.Regions, radius, thickness, o.Highlight)
+			default:
+				img1 = diffImage(raw1, diff, radius, o.Highlight)
+				img2 = diffImage(raw2, diff, radius, o.Highlight)
+			}
+			// Hatch the areas left out and draw the grid over images of the
+			// pages of file1 and file2
+			decorate := func(img1, img2 *Image) {
+				if regions := pageMasks(page); regions != nil {
+					// Show what was left out, not just that it was
+					regions1, regions2 := regions, regions
+					if st.Crop != nil {
+						regions1, regions2 = st.Crop.Bounds1.relative(regions), st.Crop.Bounds2.relative(regions)
+					}
+					hatchRegions(img1, regions1, o.Resolution/15)
+					hatchRegions(img2, regions2, o.Resolution/15)
+				}
+				drawGrid(img1, o.Grid, o.Resolution)
+				drawGrid(img2, o.Grid, o.Resolution)
+			}
+			decorate(img1, img2)
+			if o.HTML != nil || o.KeepImages {
+				pr.raw1, pr.raw2, pr.hl1, pr.hl2 = raw1, raw2, img1, img2
+			}
+			if o.KeepImages {
+				pr.diff = diff
+			}
+
+			// The renderings with only the hatching and grid, for blinking
+			// between and for the layouts that show them as they are
+			var plain1, plain2 *Image
+			if o.Blink != "" || (o.PDF != nil && (o.Layout == LayoutThreePane || o.Layout == LayoutThreePages)) {
+				plain1, plain2 = raw1.clone(), raw2.clone()
+				decorate(plain1, plain2)
+			}
+
+			joined := joinImages(img1, img2, 5, o.Join)
+			spent = append(spent, raw1, raw2, img1, img2, joined)
+			if o.KeepImages {
+				pr.Image = rgbToPNG(joined)
+			}
+
+			if o.Images {
+				filename, adj, err := writeArtifact(o.imageName(file1, res.File1, res.File2, page), joined, o.MaxArtifactBytes)
+				if err != nil {
+					return err
+				}
+				pr.Filename, pr.Artifact = filename, adj
+			}
+			if o.Blink != "" {
+				filename := o.blinkName(file1, res.File1, res.File2, page)
+				if err := writeBlink(filename, plain1, plain2, o.Blink); err != nil {
+					return err
+				}
+				pr.Blink = filename
+			}
+			// Close-ups of the regions with the most differences
+			var details []*Image
+			pr.Details = detailRegions(pr.Regions, o.Detail, img1.W, img1.H, o.Resolution)
+			if o.PDF != nil || o.HTML != nil {
+				for _, r := range pr.Details {
+					details = append(details, detailImage(img1, img2, r, o.Detail, o.Resolution, o.Join))
+				}
+				if o.HTML != nil {
+					pr.details = details
+				}
+			}
+			if o.PDF != nil {
+				// The images the pdf shows the page with
+				var panels []*Image
+				switch o.Layout {
+				case LayoutThreePane, LayoutThreePages:
+					panels = []*Image{plain1, plain2, img2}
+					if o.Layout == LayoutThreePane {
+						join := o.Join.settled(max(img1.W, img2.W), max(img1.H, img2.H))
+						panels = []*Image{joinImages(joinImages(plain1, plain2, 5, join), img2, 5, join)}
+					}
+				default:
+					if pr.Filename != "" {
+						// Already written, so there is no need to spool it
+						break
+					}
+					panels = []*Image{joined}
+				}
+				// The images are kept in memory for the pdf, unless memory is
+				// short or they are wanted for resuming, when they are spooled
+				source := func(img *Image, name string) (PageFile, *ArtifactAdjustment, error) {
+					if prog == nil && o.MemoryBudget == 0 {
+						data, adj, err := encodeImage(img, o.MaxArtifactBytes)
+						if err != nil {
+							return PageFile{}, nil, err
+						}
+						return PageFile{src: bytes.NewReader(data)}, adj, nil
+					}
+					if spoolDir == "" {
+						var err error
+						spoolDir, err = os.MkdirTemp("", "pdfcomp-*")
+						if err != nil {
+							return PageFile{}, nil, err
+						}
+						tempSpool = true
+					}
+					filename, adj, err := writeArtifact(filepath.Join(spoolDir, name+".png"), img, o.MaxArtifactBytes)
+					if err != nil {
+						return PageFile{}, nil, err
+					}
+					meter.temp(filename)
+					return PageFile{filename: filename}, adj, nil
+				}
+				sources := []PageFile{{filename: pr.Filename}}
+				if len(panels) > 0 {
+					sources = nil
+				}
+				for n, panel := range panels {
+					name := strconv.Itoa(page)
+					if n > 0 {
+						name += "-" + strconv.Itoa(n+1)
+					}
+					src, adj, err := source(panel, name)
+					if err != nil {
+						return err
+					}
+					sources = append(sources, src)
+					if panel == joined {
+						pr.Artifact = adj
+					}
+				}
+				for n, detail := range details {
+					src, _, err := source(detail, fmt.Sprintf("%d-detail-%d", page, n+1))
+					if err != nil {
+						return err
+					}
+					sources = append(sources, src)
+				}
+				pngFiles = append(pngFiles, pdfPages(res, pr, sources)...)
+				spooled = sources[0].filename
+				for _, src := range sources[1:] {
+					panelFiles = append(panelFiles, src.filename)
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		err = o.runStage(StageReport, st, func() error {
+			addPage(st.Result)
+			if prog != nil {
+				if spooled == "" {
+					spooled = st.Result.Filename
+				}
+				return prog.record(st.Result, spooled, panelFiles)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		if o.reuseBuffers() {
+			releaseImages(append(spent, st.Image1, st.Image2, st.Diff)...)
+		}
+
+		if done() {
+			rest = pages.after(i)
+			break
+		}
 	} // for all pages
-	if pdf != nil && !same {
-		err = BuildPDF(pngFiles, pdf)
+	if res.Sample != nil {
+		res.Sample.estimate()
+	}
+	if o.StopAfter > 0 && len(rest) > 0 {
+		res.Estimate, err = estimateRest(ctx1, ctx2, append(streamed, res.Pages...), rest, o.ContentPrecision)
 		if err != nil {
-			return false, err
+			return nil, err
 		}
-		for f := range pngFiles {
-			os.Remove(pngFiles[f].filename)
+	}
+	// Embedded documents decide whether the files are the same, and so
+	// whether there is anything to report, before the reports are made
+	if o.Portfolios {
+		res.Embedded, err = comparePortfolios(file1, file2, res.File1, res.File2, o, meter)
+		if err != nil {
+			return nil, err
+		}
+		for _, e := range res.Embedded {
+			res.Equal = res.Equal && e.Equal()
 		}
 	}
-	if same {
-		return true, nil
+	// Files can differ without any page image, in their page counts for
+	// example, but differing embedded documents are listed in the summary
+	if o.PDF != nil && !res.Equal && (len(pngFiles) > 0 || embeddedDiffer(res.Embedded)) {
+		err = buildPDF(newPDFSummary(res, file1, file2, o), pngFiles, o.PDF)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if o.AnnotateCopies {
+		res.Annotated1, res.Annotated2, err = annotateFiles(res, file1, file2, o)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if o.HTML != nil {
+		if err := writeHTMLReport(o.HTML, res, file1, file2, o.Resolution); err != nil {
+			return nil, err
+		}
+	}
+	if prog != nil {
+		if err := prog.finish(); err != nil {
+			return nil, err
+		}
+	}
+	return res, nil
+}
+
+// Write an image to a png file
+func writePNG(filename string, img *Image) error {
+	if err := os.MkdirAll(filepath.Dir(filename), 0755); err != nil {
+		return err
+	}
+	file, err := os.Create(filename)
+	if err != nil {
+		return err
 	}
-	return false, nil
+	defer file.Close()
+
+	err = png.Encode(file, rgbToPNG(img))
+	if err != nil {
+		return fmt.Errorf("error writing %s to png: %w", filename, err)
+	}
+	return nil
 }
 
 func PageCount(filename string) (int, error) {
 
 	rs, err := os.Open(filename)
 	if err != nil {
-		return 0, errors.New("pdfcpu: PDFInfo: missing rs")
+		return 0, err
 	}
 
 	conf := model.NewDefaultConfiguration()
@@ -142,60 +830,278 @@ func PageCount(filename string) (int, error) {
 
 	ctx, err := api.ReadAndValidate(rs, conf)
 	if err != nil {
-		return 0, err
+		return 0, readError(err)
 	}
 	return ctx.PageCount, nil
 }
 
-func PdfToPPM(filename string, page, resolution int) (io.Reader, error) {
-	pdftoppm := "pdftoppm"
+// Name of the pdftoppm executable on this platform, or the path of the one
+// given to UseRenderer
+func pdftoppmCommand() string {
+	if rendererPath != "" {
+		return rendererPath
+	}
 	if runtime.GOOS == "windows" {
-		pdftoppm = "pdftoppm.exe"
+		return "pdftoppm.exe"
 	}
+	return "pdftoppm"
+}
+
+// Whether each renderer command can write PNG, as rendererWritesPNG found it
+var rendererPNG sync.Map
+
+// True if pdftoppm lists -png among its options, as it does when built with
+// libpng.  Found once for each command.
+func rendererWritesPNG() bool {
+	cmd := pdftoppmCommand()
+	if v, ok := rendererPNG.Load(cmd); ok {
+		return v.(bool)
+	}
+	out, _ := exec.Command(cmd, "-h").CombinedOutput()
+	v, _ := rendererPNG.LoadOrStore(cmd, bytes.Contains(out, []byte("-png")))
+	return v.(bool)
+}
+
+func PdfToPPM(filename string, page, resolution int) (io.Reader, error) {
+	src := &perPageSource{filename: filename, resolution: resolution}
+	ppm, _, err := src.render(page, image.Point{}, RenderPPM)
+	return ppm, err
+}
+
+// Render one page of a file as it would be compared, at the resolution and
+// within the limits in the options, using the cache in them if there is one
+func RenderPage(filename string, page int, opts ...Option) (image.Image, error) {
+	o := DefaultOptions()
+	for _, opt := range opts {
+		opt(&o)
+	}
+	var src pageSource = &perPageSource{filename: filename, resolution: o.Resolution, color: o.Color, format: o.RenderFormat, extra: o.RendererArgs, limits: o.Limits, timeout: o.RenderTimeout, ctx: o.Context}
+	if o.Cache != nil {
+		sum, err := Checksum(filename)
+		if err != nil {
+			return nil, err
+		}
+		src = &cachedSource{pageSource: src, cache: o.Cache, checksum: sum, o: o}
+	}
+	img, err := src.page(page)
+	if err != nil {
+		return nil, err
+	}
+	return rgbToPNG(img), nil
+}
+
+// Render a page with pdftoppm in the source's color mode, with its extra
+// arguments and within its limits, in format, which must be resolved, at the
+// source's resolution or if scaleTo is not zero at that many pixels,
+// returning its output and any messages it printed, and recording the
+// process.  The output is in memory, or if the source has a directory, in a
+// file in it that is removed when the output is closed.  If any limit is set,
+// a renderer that fails for any reason gives a *RenderError, as one that
+// takes longer than the source's timeout always does.  A renderer stopped
+// because the source's context is done gives the context's error.
+func (s *perPageSource) render(page int, scaleTo image.Point, format RenderFormat) (io.ReadCloser, string, error) {
 
 	args := []string{
 		"-r",
-		strconv.Itoa(resolution),
+		strconv.Itoa(s.resolution),
 		"-f",
 		strconv.Itoa(page),
 		"-l",
 		strconv.Itoa(page),
-		filename,
-		"-",
 	}
-	cmd := exec.Command(pdftoppm, args...)
+	if scaleTo != (image.Point{}) {
+		// Exactly this many pixels, whatever the resolution gives
+		args = append(args, "-scale-to-x", strconv.Itoa(scaleTo.X), "-scale-to-y", strconv.Itoa(scaleTo.Y))
+	}
+	args = append(args, s.color.args()...)
+	args = append(args, format.args()...)
+	args = append(args, s.extra...)
 
-	var stdoutBuf bytes.Buffer
-	cmd.Stdout = &stdoutBuf
+	// Renderers name the file they write after the root they are given in
+	// ways of their own, so each page has a directory to itself
+	root := "-"
+	var pageDir string
+	if s.dir != "" {
+		var err error
+		if pageDir, err = os.MkdirTemp(s.dir, "page-*"); err != nil {
+			return nil, "", err
+		}
+		root = filepath.Join(pageDir, "page")
+	}
+	args = append(args, s.filename, root)
+	cmd := rendererCommand(pdftoppmCommand(), args, s.limits)
+
+	stdoutBuf := &cappedBuffer{max: s.limits.OutputBytes}
+	cmd.Stdout = stdoutBuf
 
 	var stderrBuf bytes.Buffer
 	cmd.Stderr = &stderrBuf
 
 	// Start the command
 	if err := cmd.Start(); err != nil {
-		return nil, fmt.Errorf("pdftoppm start failed: %w, stderr: %s", err, stderrBuf.String())
+		os.RemoveAll(pageDir)
+		return nil, "", startError(err, stderrBuf.String())
+	}
+	ctx := s.context()
+	if s.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, s.timeout)
+		defer cancel()
 	}
+	stop := context.AfterFunc(ctx, func() { cmd.Process.Kill() })
 
 	// Wait for the command to finish
-	if err := cmd.Wait(); err != nil {
-		return nil, fmt.Errorf("pdftoppm failed: %w, stderr: %s", err, stderrBuf.String())
+	err := cmd.Wait()
+	stop()
+	s.usage.process(cmd.ProcessState)
+	if err == nil && pageDir != "" {
+		var out io.ReadCloser
+		out, err = s.pageFile(pageDir)
+		if err == nil {
+			return out, stderrBuf.String(), nil
+		}
+	}
+	os.RemoveAll(pageDir)
+	if ctxErr := s.context().Err(); ctxErr != nil {
+		return nil, stderrBuf.String(), fmt.Errorf("rendering page %d of %s: %w", page, s.filename, ctxErr)
+	}
+	if err != nil && ctx.Err() != nil {
+		return nil, stderrBuf.String(), &RenderError{File: s.filename, Page: page, Reason: fmt.Sprintf("timed out after %s", s.timeout), Err: ErrRenderTimeout}
+	}
+	if err != nil {
+		if s.limits.enabled() {
+			return nil, stderrBuf.String(), &RenderError{File: s.filename, Page: page, Reason: failureReason(err, stdoutBuf), Err: err}
+		}
+		return nil, stderrBuf.String(), fmt.Errorf("pdftoppm failed: %w, stderr: %s", err, stderrBuf.String())
 	}
 
-	return &stdoutBuf, nil
+	return io.NopCloser(&stdoutBuf.buf), stderrBuf.String(), nil
 }
 
+// An image for a page of the difference pdf.
+//
+// Deprecated: use ReportBuilder, whose pages can be made outside this
+// package.
 type PageFile struct {
 	pageNum  int
 	filename string
+	// The image as png or jpeg, read instead of filename if set, so that
+	// the pdf can be built without writing images to disk
+	src io.Reader
+	// Printed above the image, saying which page it is and how much of it
+	// differs
+	header string
+}
+
+// The image of a page of the difference pdf, from src if it is set and
+// otherwise from the file
+func (pf PageFile) read() ([]byte, error) {
+	if pf.src != nil {
+		return io.ReadAll(pf.src)
+	}
+	return os.ReadFile(pf.filename)
+}
+
+// The header of a page of the difference pdf, such as "Page 3 — a.pdf vs
+// b.pdf, 0.25% differs (1200 pixels)".  The file names are left out if
+// either is not known, and the pixels if they were not counted.
+func pageHeader(file1, file2 string, page int, stats PageStats) string {
+	header := fmt.Sprintf("Page %d", page)
+	if file1 != "" && file2 != "" {
+		header += fmt.Sprintf(" — %s vs %s", filepath.Base(file1), filepath.Base(file2))
+	}
+	header += fmt.Sprintf(", %.3g%% differs", stats.DiffPercent)
+	if stats.DiffPixels > 0 {
+		header += fmt.Sprintf(" (%d pixels)", stats.DiffPixels)
+	}
+	return header
+}
+
+// The pages of the difference pdf for a differing page, one for each of the
+// images made of it for the pdf's layout: the page of file1, the page of
+// file2 and the differences if there are three, and then one for each
+// close-up of its details
+func pdfPages(res *Result, pr *PageResult, sources []PageFile) []PageFile {
+	header := pageHeader(res.File1, res.File2, pr.Page, PageStats{DiffPixels: pr.DiffPixels, DiffPercent: pr.DiffPercent})
+	panels := []string{filepath.Base(res.File1), filepath.Base(res.File2), "differences"}
+	// The close-ups of the page's details come after the images of its layout
+	layout := len(sources) - len(pr.Details)
+	var pages []PageFile
+	for i, pf := range sources {
+		pf.pageNum, pf.header = pr.Page, header
+		switch {
+		case i >= layout:
+			pf.header += ": " + detailCaption(pr.Details[i-layout])
+		case layout > 1:
+			pf.header += ": " + panels[i%len(panels)]
+		}
+		pages = append(pages, pf)
+	}
+	return pages
+}
+
+// Points left above the image on each page of the difference pdf for its
+// header
+const headerHeight = 20.0
+
+// The paper the difference pdf is printed on: A4, on its side to suit
+// images of two pages side by side
+const diffPaper = "A4L"
+
+// An image on a page of the difference pdf, and the size it is drawn at in
+// points
+type placedImage struct {
+	data          []byte
+	width, height float64
 }
 
-// Build a pdf file from a series of image files
+// Place an image, scaled down if need be to fit an area of the given width
+// and height.  If it would be drawn larger turned a quarter turn
+// anticlockwise, as one taller than it is wide is, it is turned.
+func fitImage(data []byte, width, height float64) (placedImage, error) {
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return placedImage{}, err
+	}
+	w, h := float64(cfg.Width), float64(cfg.Height)
+	// Images are drawn no larger than a point to a pixel
+	scale := min(1, width/w, height/h)
+	if turnedScale := min(1, width/h, height/w); turnedScale > scale {
+		src, _, err := image.Decode(bytes.NewReader(data))
+		if err != nil {
+			return placedImage{}, err
+		}
+		img := imageFrom(src)
+		img = rotateImage(img, 270)
+		var buf bytes.Buffer
+		if err := png.Encode(&buf, rgbToPNG(img)); err != nil {
+			return placedImage{}, err
+		}
+		data, w, h, scale = buf.Bytes(), h, w, turnedScale
+	}
+	return placedImage{data: data, width: w * scale, height: h * scale}, nil
+}
+
+// Build a pdf file from a series of image files, one to a page, each under
+// its header, in the order given.
+//
+// Deprecated: use ReportBuilder, whose pages can be made outside this
+// package.
 func BuildPDF(imageFiles []PageFile, w io.Writer) error {
+	return buildPDF(nil, imageFiles, w)
+}
+
+// Build a pdf file from a series of image files, after the pages of a
+// summary if one is given
+func buildPDF(summary *pdfSummary, imageFiles []PageFile, w io.Writer) error {
 
 	conf := model.NewDefaultConfiguration()
 	conf.Cmd = model.CREATE
-	//ctx, err := pdfcpu.CreateContextWithXRefTable(conf, types.PaperSize["A4L"])
-	ctx, err := pdfcpu.CreateContextWithXRefTable(conf, types.PaperSize["A4"])
+	dim, _, err := types.ParsePageFormat(diffPaper)
+	if err != nil {
+		return err
+	}
+	ctx, err := pdfcpu.CreateContextWithXRefTable(conf, dim)
 	if err != nil {
 		return err
 	}
@@ -215,20 +1121,40 @@ func BuildPDF(imageFiles []PageFile, w io.Writer) error {
 		RadioBtnAPs:   map[float64]*primitives.AP{},
 		OldFieldIDs:   types.StringSet{},
 		Margins:       map[string]*primitives.Margin{},
-		Paper:         "A4L",
+		Paper:         diffPaper,
 		Origin:        "UpperLeft",
 		Margin:        &primitives.Margin{Width: margin},
 	}
 
+	if summary != nil {
+		for _, p := range summary.pages(dim.Height - 2*margin) {
+			pdf.Pages[strconv.Itoa(len(pdf.Pages)+1)] = p
+		}
+	}
+	// The image of each page after the summary, by page number.  They are
+	// added once the pages are rendered, since pdfcpu only reads images
+	// from files.
+	images := map[int]placedImage{}
+	// Pages are numbered from one whichever pages of the files differ, so
+	// that there are no blank pages between them
 	for _, pf := range imageFiles {
-		thePage := primitives.PDFPage{}
-		myImages := []*primitives.ImageBox{
-			{Src: pf.filename, PageNr: strconv.Itoa(pf.pageNum), Position: [2]float64{0, 0}},
+		nr := len(pdf.Pages) + 1
+		data, err := pf.read()
+		if err != nil {
+			return err
 		}
-		thePage.Content = &primitives.Content{
-			ImageBoxes: myImages,
+		images[nr], err = fitImage(data, dim.Width-2*margin, dim.Height-2*margin-headerHeight)
+		if err != nil {
+			return fmt.Errorf("error reading the image of page %d: %w", pf.pageNum, err)
+		}
+		var headers []*primitives.TextBox
+		if pf.header != "" {
+			// pdfcpu reads % as the start of a placeholder such as %p
+			value := strings.ReplaceAll(pf.header, "%", "%%")
+			headers = append(headers, &primitives.TextBox{Value: value, Position: [2]float64{0, 0},
+				Font: &primitives.FormFont{Name: "Helvetica", Size: 11}})
 		}
-		pdf.Pages[strconv.Itoa(pf.pageNum)] = &thePage
+		pdf.Pages[strconv.Itoa(nr)] = &primitives.PDFPage{Content: &primitives.Content{TextBoxes: headers}}
 	}
 	// Validate must come before RenderPages, since it adds the pages to the pdf
 	if err := pdf.Validate(); err != nil {
@@ -239,6 +1165,20 @@ func BuildPDF(imageFiles []PageFile, w io.Writer) error {
 	if err != nil {
 		return err
 	}
+	for nr, img := range images {
+		p := pages[nr-1]
+		indRef, _, _, err := model.CreateImageResource(ctx.XRefTable, bytes.NewReader(img.data), false, false)
+		if err != nil {
+			return err
+		}
+		if p.Im == nil {
+			p.Im = model.ImageMap{}
+		}
+		p.Im["diff"] = model.ImageResource{Res: model.Resource{ID: "Im0", IndRef: indRef}}
+		// Below the header, in pdf coordinates from the bottom left
+		top := dim.Height - margin - headerHeight
+		fmt.Fprintf(p.Buf, "q %.5f 0 0 %.5f %.5f %.5f cm /Im0 Do Q ", img.width, img.height, margin, top-img.height)
+	}
 
 	_, _, err = create.UpdatePageTree(ctx, pages, fontMap)
 	if err != nil {
@@ -0,0 +1,126 @@
+package pdfcomp
+
+import "github.com/pdfcpu/pdfcpu/pkg/pdfcpu/model"
+
+// A stage of the pipeline each page goes through.  Middleware can be added
+// around any stage, to change what it is given or what it produces.
+type Stage string
+
+const (
+	// Render both pages with pdftoppm and decode them into PageState.Image1
+	// and Image2
+	StageRender Stage = "render"
+	// Prepare the rendered pages for comparison, for example by bringing them
+	// to the same size, lining them up or blanking the areas of signatures.
+	// Custom steps such as removing a watermark belong here.
+	StageNormalize Stage = "normalize"
+	// Compare the pages, setting PageState.Same, Diff and Result
+	StageCompare Stage = "compare"
+	// Make and write the images highlighting the differences, if the page
+	// differs and any output needs them
+	StageVisualize Stage = "visualize"
+	// Add the page to the Result, call OnPage and record its progress
+	StageReport Stage = "report"
+)
+
+// A page on its way through the pipeline.  Each stage fills in more of it,
+// and middleware may change any of it.
+type PageState struct {
+	File1 string
+	File2 string
+	Page  int
+	// The rendered pages, in RGB, or with a gray or mono color mode, in gray
+	Image1 *Image
+	Image2 *Image
+	// The number of bytes to a pixel in Image1 and Image2
+	Channels int
+	// True if the rendered pages are identical
+	Same bool
+	// How much each pixel differs, as a one channel image
+	Diff *Image
+	// The rotation of the page in each file, if it differs, in which case
+	// Image2 has been turned to match Image1
+	Rotation *Rotation
+	// How the rendered pages were brought to the same size, if they were
+	Rescale *Rescale
+	// Where the content of each page was, if they were cropped to it
+	Crop *ContentCrop
+	// The sizes the pages rendered at and how they were fitted, if they
+	// differed
+	Mismatch *SizeMismatch
+	// How the second page was moved to line up with the first, if it was
+	Offset *Offset
+	// What will be reported for the page
+	Result PageResult
+}
+
+// Middleware wraps a stage of the pipeline.  It is called with the page and
+// a function running the rest of the stage, which it may call with the page
+// changed, follow with changes of its own, or not call at all to skip the
+// stage.  An error ends the comparison.
+type Middleware func(st *PageState, next func() error) error
+
+// Run a stage of the pipeline for a page, inside any middleware added for it.
+// Middleware added first runs outermost.
+func (o *Options) runStage(stage Stage, st *PageState, run func() error) error {
+	mws := o.Middleware[stage]
+	var call func(i int) error
+	call = func(i int) error {
+		if i == len(mws) {
+			return run()
+		}
+		return mws[i](st, func() error { return call(i + 1) })
+	}
+	return call(0)
+}
+
+// What a PageHook is given for a page that was rendered and compared
+type PageCheck struct {
+	File1 string
+	File2 string
+	Page  int
+	// The rendered pages as they were compared, with Channels bytes to a pixel
+	Image1   *Image
+	Image2   *Image
+	Channels int
+	// The words each page shows, as CompareText finds them
+	Text1 []string
+	Text2 []string
+	// The result so far, which the hook may change before it is reported: to
+	// fail a page whose totals line differs however little it shows, or pass
+	// one whose only change is a date, adding a note to say why
+	Result *PageResult
+}
+
+// A PageHook applies a rule of its own to a page, such as a business rule, at
+// the end of the compare stage, before the page's verdict is final.  Pages
+// passed without rendering, by ContentShortcut or Prescreen, are not given
+// to hooks.  An error ends the comparison.
+type PageHook func(pc *PageCheck) error
+
+// Give a compared page to each hook in turn, and take the verdict they leave
+func (o *Options) runPageHooks(st *PageState, ctx1, ctx2 *model.Context) error {
+	if len(o.PageHooks) == 0 {
+		return nil
+	}
+	pc := &PageCheck{File1: st.File1, File2: st.File2, Page: st.Page, Image1: st.Image1, Image2: st.Image2,
+		Channels: st.Channels, Result: &st.Result}
+	var err error
+	if pc.Text1, err = pageWords(ctx1, st.Page); err != nil {
+		return err
+	}
+	if pc.Text2, err = pageWords(ctx2, st.Page); err != nil {
+		return err
+	}
+	for _, hook := range o.PageHooks {
+		if err := hook(pc); err != nil {
+			return err
+		}
+	}
+	if st.Same && !st.Result.Equal && st.Diff == nil {
+		// Nothing to highlight, but the page now differs
+		st.Diff = newMask(st.Image1)
+	}
+	st.Same = st.Result.Equal
+	return nil
+}
@@ -0,0 +1,177 @@
+package pdfcomp
+
+import (
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/model"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/types"
+)
+
+// An affine transformation [a b c d e f], as used by the cm and Tm operators
+type matrix [6]float64
+
+var identity = matrix{1, 0, 0, 1, 0, 0}
+
+// The transformation m followed by n
+func (m matrix) mul(n matrix) matrix {
+	return matrix{
+		m[0]*n[0] + m[1]*n[2],
+		m[0]*n[1] + m[1]*n[3],
+		m[2]*n[0] + m[3]*n[2],
+		m[2]*n[1] + m[3]*n[3],
+		m[4]*n[0] + m[5]*n[2] + n[4],
+		m[4]*n[1] + m[5]*n[3] + n[5],
+	}
+}
+
+func (m matrix) apply(x, y float64) (float64, float64) {
+	return x*m[0] + y*m[2] + m[4], x*m[1] + y*m[3] + m[5]
+}
+
+// Something drawn on a page, with its bounding box in default user space
+type placement struct {
+	// Text shown, or empty for an image
+	text string
+	// Resource name of an image, or "inline" for an inline image
+	image          string
+	x0, y0, x1, y1 float64
+}
+
+// True if the placement overlaps the rectangle
+func (p placement) overlaps(r types.Rectangle) bool {
+	return p.x0 <= r.UR.X && r.LL.X <= p.x1 && p.y0 <= r.UR.Y && r.LL.Y <= p.y1
+}
+
+// Find where text and images are drawn by a page's content.  Without font
+// metrics the extent of text can only be estimated, as half the font size per
+// character, and content drawn inside form XObjects is not seen.
+func pagePlacements(ops []contentOp, images map[string]bool) []placement {
+	var places []placement
+	ctm := identity
+	var stack []matrix
+	tm, tlm := identity, identity
+	leading, size := 0.0, 0.0
+
+	// Bounding box of the unit square under m
+	bbox := func(m matrix) (x0, y0, x1, y1 float64) {
+		x0, y0 = m.apply(0, 0)
+		x1, y1 = x0, y0
+		for _, p := range [][2]float64{{1, 0}, {0, 1}, {1, 1}} {
+			x, y := m.apply(p[0], p[1])
+			x0, y0, x1, y1 = min(x0, x), min(y0, y), max(x1, x), max(y1, y)
+		}
+		return
+	}
+	show := func(s string) {
+		trm := tm.mul(ctm)
+		box := matrix{size * float64(len(s)) / 2, 0, 0, size, 0, 0}.mul(trm)
+		x0, y0, x1, y1 := bbox(box)
+		places = append(places, placement{text: s, x0: x0, y0: y0, x1: x1, y1: y1})
+	}
+	nums := func(operands []contentToken) []float64 {
+		var v []float64
+		for _, t := range operands {
+			if t.kind == tokNumber {
+				v = append(v, t.number())
+			}
+		}
+		return v
+	}
+	move := func(tx, ty float64) {
+		tlm = matrix{1, 0, 0, 1, tx, ty}.mul(tlm)
+		tm = tlm
+	}
+
+	for _, op := range ops {
+		n := nums(op.operands)
+		switch op.op {
+		case "q":
+			stack = append(stack, ctm)
+		case "Q":
+			if len(stack) > 0 {
+				ctm = stack[len(stack)-1]
+				stack = stack[:len(stack)-1]
+			}
+		case "cm":
+			if len(n) == 6 {
+				ctm = matrix(n).mul(ctm)
+			}
+		case "BT":
+			tm, tlm = identity, identity
+		case "Tf":
+			if len(n) == 1 {
+				size = n[0]
+			}
+		case "TL":
+			if len(n) == 1 {
+				leading = n[0]
+			}
+		case "Tm":
+			if len(n) == 6 {
+				tm, tlm = matrix(n), matrix(n)
+			}
+		case "Td":
+			if len(n) == 2 {
+				move(n[0], n[1])
+			}
+		case "TD":
+			if len(n) == 2 {
+				leading = -n[1]
+				move(n[0], n[1])
+			}
+		case "T*":
+			move(0, -leading)
+		case "Tj", "'", "\"":
+			if op.op != "Tj" {
+				move(0, -leading)
+			}
+			for _, t := range op.operands {
+				if t.kind == tokString {
+					show(t.text)
+				}
+			}
+		case "TJ":
+			s := ""
+			for _, t := range op.operands {
+				if t.kind == tokString {
+					s += t.text
+				}
+			}
+			show(s)
+		case "Do":
+			if len(op.operands) == 1 && images[op.operands[0].text[1:]] {
+				x0, y0, x1, y1 := bbox(ctm)
+				places = append(places, placement{image: op.operands[0].text[1:], x0: x0, y0: y0, x1: x1, y1: y1})
+			}
+		case "EI":
+			x0, y0, x1, y1 := bbox(ctm)
+			places = append(places, placement{image: "inline", x0: x0, y0: y0, x1: x1, y1: y1})
+		}
+	}
+	return places
+}
+
+// Names of the image XObjects in a page's resources
+func pageImages(ctx *model.Context, page int) (map[string]bool, error) {
+	d, _, inh, err := ctx.PageDict(page, false)
+	if err != nil {
+		return nil, err
+	}
+	images := map[string]bool{}
+	resDict, ok := dictEntry(ctx, d, "Resources").(types.Dict)
+	if !ok {
+		resDict = inh.Resources
+	}
+	xobjDict, ok := dictEntry(ctx, resDict, "XObject").(types.Dict)
+	if !ok {
+		return images, nil
+	}
+	for name, o := range xobjDict {
+		sd, _, err := ctx.DereferenceStreamDict(o)
+		if err != nil || sd == nil {
+			continue
+		}
+		if subtype := sd.Subtype(); subtype != nil && *subtype == "Image" {
+			images[name] = true
+		}
+	}
+	return images, nil
+}
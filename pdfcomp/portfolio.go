@@ -0,0 +1,152 @@
+package pdfcomp
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+
+	"github.com/pdfcpu/pdfcpu/pkg/api"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/model"
+)
+
+// The comparison of one PDF document embedded in a portfolio
+type EmbeddedResult struct {
+	// File name of the embedded document
+	Name    string
+	InFile1 bool
+	InFile2 bool
+	// Comparison of the two embedded documents, nil unless both files have it
+	Result *Result
+}
+
+// True if the document is embedded in both files and is visually the same
+func (e EmbeddedResult) Equal() bool {
+	return e.Result != nil && e.Result.Equal
+}
+
+// True if any embedded document differs or is only in one file
+func embeddedDiffer(embedded []EmbeddedResult) bool {
+	return slices.ContainsFunc(embedded, func(e EmbeddedResult) bool { return !e.Equal() })
+}
+
+// How an embedded document compared, for summaries
+func (e EmbeddedResult) status() string {
+	switch {
+	case !e.InFile2:
+		return "only in file 1"
+	case !e.InFile1:
+		return "only in file 2"
+	case !e.Equal():
+		return "different"
+	}
+	return "same"
+}
+
+// Compare the PDF documents embedded in two portfolios, pairing them up by
+// file name.  Embedded documents are compared with the same settings, except
+// that no output files are written for them, and portfolios nested inside
+// them are compared in turn.  Embedded documents are labelled by appending
+// their names to label1 and label2.  What they use is added to meter.
+func comparePortfolios(file1, file2, label1, label2 string, o Options, meter *usageMeter) ([]EmbeddedResult, error) {
+	dir, err := os.MkdirTemp("", "pdfcomp-portfolio-*")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+
+	docs1, err := embeddedPDFs(file1, filepath.Join(dir, "1"))
+	if err != nil {
+		return nil, fmt.Errorf("error extracting embedded files from %s: %w", file1, err)
+	}
+	docs2, err := embeddedPDFs(file2, filepath.Join(dir, "2"))
+	if err != nil {
+		return nil, fmt.Errorf("error extracting embedded files from %s: %w", file2, err)
+	}
+
+	var names []string
+	for name := range docs1 {
+		names = append(names, name)
+	}
+	for name := range docs2 {
+		if _, ok := docs1[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	slices.Sort(names)
+	for _, docs := range []map[string]string{docs1, docs2} {
+		for _, path := range docs {
+			meter.temp(path)
+		}
+	}
+
+	// Outputs, progress and resuming belong to the outer comparison
+	o.Images, o.PDF, o.HTML = false, nil, nil
+	o.OnPage, o.Progress, o.ResumeDir = nil, nil, ""
+	var results []EmbeddedResult
+	for _, name := range names {
+		path1, in1 := docs1[name]
+		path2, in2 := docs2[name]
+		e := EmbeddedResult{Name: name, InFile1: in1, InFile2: in2}
+		if in1 && in2 {
+			log().Debug("comparing embedded document", "name", name)
+			o.Label1, o.Label2 = label1+"/"+name, label2+"/"+name
+			e.Result, err = compare(path1, path2, o)
+			if err != nil {
+				return nil, fmt.Errorf("error comparing embedded document %s: %w", name, err)
+			}
+			meter.add(e.Result.Usage)
+		}
+		results = append(results, e)
+	}
+	return results, nil
+}
+
+// Extract the PDF documents embedded in filename into dir, returning their
+// paths by file name.  Attachments that are not PDFs are ignored.
+func embeddedPDFs(filename, dir string) (map[string]string, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	conf := model.NewDefaultConfiguration()
+	conf.Cmd = model.EXTRACTATTACHMENTS
+	ctx, err := api.ReadAndValidate(f, conf)
+	if err != nil {
+		return nil, readError(err)
+	}
+	docs := map[string]string{}
+	stubs, err := ctx.ListAttachments()
+	if err != nil || len(stubs) == 0 {
+		return docs, err
+	}
+	attachments, err := ctx.ExtractAttachments(nil)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+
+	for i, a := range attachments {
+		data, err := io.ReadAll(a)
+		if err != nil {
+			return nil, err
+		}
+		if !bytes.HasPrefix(data, []byte("%PDF")) {
+			continue
+		}
+		// Names inside the portfolio may not be usable as file names
+		path := filepath.Join(dir, strconv.Itoa(i)+".pdf")
+		if err := os.WriteFile(path, data, 0600); err != nil {
+			return nil, err
+		}
+		docs[a.FileName] = path
+	}
+	return docs, nil
+}
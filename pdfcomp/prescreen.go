@@ -0,0 +1,34 @@
+package pdfcomp
+
+import (
+	"errors"
+	"sync"
+)
+
+// True if a page renders the same in both files at the low resolution of the
+// sources, so that it need not be rendered at full resolution.  A page the
+// renderer fails on is left to the full rendering to report.
+func prescreenPage(src1, src2 pageSource, page int) (bool, error) {
+	var img2 *Image
+	var err2 error
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		img2, err2 = src2.page(page)
+	}()
+	img1, err := src1.page(page)
+	wg.Wait()
+	if err == nil {
+		err = err2
+	}
+	var rerr *RenderError
+	if errors.As(err, &rerr) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	same, _, err := equalImages(img1, img2, false)
+	return same, err
+}
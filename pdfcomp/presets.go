@@ -0,0 +1,78 @@
+package pdfcomp
+
+import (
+	"fmt"
+	"path"
+	"slices"
+	"strings"
+)
+
+// A named set of options suited to one kind of document
+type Preset struct {
+	Name        string
+	Description string
+	Options     []Option
+}
+
+// The built in presets, looked up by LookupPreset
+var presets = []Preset{
+	{"strict", "every detail: high resolution, fine highlights, annotations compared",
+		[]Option{WithResolution(300), WithRatio(30), WithAnnotations(true)}},
+	{"print", "what a printed copy would show: print resolution, annotations ignored",
+		[]Option{WithResolution(200), WithRatio(20), WithAnnotations(false)}},
+	{"screen", "what a reader would notice on screen: low resolution, quick",
+		[]Option{WithResolution(96), WithRatio(12), WithAnnotations(true)}},
+}
+
+// The built in presets, in order
+func Presets() []Preset {
+	return slices.Clone(presets)
+}
+
+// Find a built in preset by name
+func LookupPreset(name string) (Preset, error) {
+	for _, p := range presets {
+		if p.Name == name {
+			return p, nil
+		}
+	}
+	return Preset{}, fmt.Errorf("unknown preset %q", name)
+}
+
+// Applies a preset to the files whose path matches a pattern, when comparing
+// directories
+type Profile struct {
+	// Pattern for paths relative to the directories compared, with / between
+	// directories, as in invoices/*.pdf.  Empty matches every file.
+	Pattern string
+	Preset  Preset
+}
+
+// Parse a profile written as pattern=preset, as in invoices/*.pdf=print
+func ParseProfile(s string) (Profile, error) {
+	pattern, name, ok := strings.Cut(s, "=")
+	if !ok {
+		return Profile{}, fmt.Errorf("invalid profile %q, expected pattern=preset", s)
+	}
+	if _, err := path.Match(pattern, ""); err != nil {
+		return Profile{}, fmt.Errorf("invalid pattern in profile %q: %w", s, err)
+	}
+	p, err := LookupPreset(name)
+	if err != nil {
+		return Profile{}, err
+	}
+	return Profile{Pattern: pattern, Preset: p}, nil
+}
+
+// The first profile matching a relative path, if any
+func matchProfile(profiles []Profile, rel string) (Profile, bool) {
+	for _, p := range profiles {
+		if p.Pattern == "" {
+			return p, true
+		}
+		if ok, _ := path.Match(p.Pattern, rel); ok {
+			return p, true
+		}
+	}
+	return Profile{}, false
+}
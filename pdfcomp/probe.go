@@ -0,0 +1,92 @@
+package pdfcomp
+
+import (
+	"fmt"
+	"os/exec"
+	"runtime"
+	"strings"
+)
+
+// A program found on this system that can render PDF pages
+type RendererInfo struct {
+	// pdftoppm, gs or mutool
+	Name string
+	// Where it was found
+	Path string
+	// The first line it prints when asked for its version, if any
+	Version string
+	// True if comparisons can render with it.  Only pdftoppm can for now;
+	// the others are reported so that the error can say what is installed.
+	Usable bool
+}
+
+// The renderers looked for, with the option that prints each one's version
+var knownRenderers = []struct {
+	name, versionArg string
+}{
+	{"pdftoppm", "-v"},
+	{"gs", "--version"},
+	{"mutool", "-v"},
+}
+
+// Look for the renderers comparisons can use, and the others that render PDF
+// pages, with their versions.  pdftoppm is the one UseRenderer gave if it
+// gave one, and otherwise the one on the PATH.
+func FindRenderers() []RendererInfo {
+	var found []RendererInfo
+	for _, r := range knownRenderers {
+		cmd := r.name
+		if r.name == "pdftoppm" {
+			cmd = pdftoppmCommand()
+		} else if runtime.GOOS == "windows" {
+			cmd += ".exe"
+		}
+		path, err := exec.LookPath(cmd)
+		if err != nil {
+			continue
+		}
+		// pdftoppm prints its version to stderr, and exits with an error
+		// status in some versions
+		out, _ := exec.Command(path, r.versionArg).CombinedOutput()
+		version, _, _ := strings.Cut(strings.TrimSpace(string(out)), "\n")
+		found = append(found, RendererInfo{Name: r.name, Path: path, Version: strings.TrimSpace(version), Usable: r.name == "pdftoppm"})
+	}
+	return found
+}
+
+// Find the renderer comparisons will use, or give an error wrapping
+// ErrRendererNotFound that says how to install it, and which other
+// renderers were found instead, if any
+func ProbeRenderer() (RendererInfo, error) {
+	found := FindRenderers()
+	var others []string
+	for _, r := range found {
+		if r.Usable {
+			log().Debug("found renderer", "path", r.Path, "version", r.Version)
+			return r, nil
+		}
+		others = append(others, fmt.Sprintf("%s (%s)", r.Name, r.Path))
+	}
+	msg := fmt.Sprintf("%s is not on the PATH", pdftoppmCommand())
+	if rendererPath != "" {
+		msg = fmt.Sprintf("%s does not exist", rendererPath)
+	}
+	if len(others) > 0 {
+		msg += "; found " + strings.Join(others, " and ") + ", but comparisons need pdftoppm"
+	}
+	return RendererInfo{}, fmt.Errorf("%w: %s.  %s", ErrRendererNotFound, msg, installHint())
+}
+
+// How to install pdftoppm on this platform
+func installHint() string {
+	var how string
+	switch runtime.GOOS {
+	case "darwin":
+		how = "brew install poppler"
+	case "windows":
+		how = "choco install poppler, or unpack the xpdf tools from xpdfreader.com and add their bin64 directory to the PATH"
+	default:
+		how = "apt install poppler-utils, dnf install poppler-utils or apk add poppler-utils"
+	}
+	return fmt.Sprintf("Install it with %s, or set %s to a file of renderer pins to fetch a pinned build", how, RendererPinsEnv)
+}
@@ -0,0 +1,68 @@
+package pdfcomp
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// Compare two PDFs held in memory
+func CompareBytes(pdf1, pdf2 []byte, opts ...Option) (*Result, error) {
+	return CompareReaders(bytes.NewReader(pdf1), bytes.NewReader(pdf2), int64(len(pdf1)), int64(len(pdf2)), opts...)
+}
+
+// Compare two PDFs of size1 and size2 bytes read from r1 and r2.  pdftoppm
+// can only render files, so the PDFs are spooled to a temporary directory
+// which is removed again afterwards.  Unless WithLabels is used, the PDFs
+// are called file1.pdf and file2.pdf in the Result and in any output, and
+// without WithOutDir difference images are written to the current directory.
+func CompareReaders(r1, r2 io.ReaderAt, size1, size2 int64, opts ...Option) (*Result, error) {
+	o := DefaultOptions()
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if o.Label1 == "" {
+		o.Label1 = "file1.pdf"
+	}
+	if o.Label2 == "" {
+		o.Label2 = "file2.pdf"
+	}
+	if o.OutDir == "" {
+		// Not beside the spooled files, which are removed
+		o.OutDir = "."
+	}
+
+	dir, err := os.MkdirTemp("", "pdfcomp-*")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+
+	file1 := filepath.Join(dir, "1.pdf")
+	if err := spool(file1, io.NewSectionReader(r1, 0, size1)); err != nil {
+		return nil, err
+	}
+	file2 := filepath.Join(dir, "2.pdf")
+	if err := spool(file2, io.NewSectionReader(r2, 0, size2)); err != nil {
+		return nil, err
+	}
+	res, err := compare(file1, file2, o)
+	if res != nil {
+		res.Usage.TempBytes += size1 + size2
+	}
+	return res, err
+}
+
+// Copy r to a new file
+func spool(filename string, r io.Reader) error {
+	f, err := os.OpenFile(filename, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(f, r); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,175 @@
+package pdfcomp
+
+import (
+	"fmt"
+
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/model"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/types"
+)
+
+// Fraction of a redacted region that must be a single colour for it to count
+// as covered
+const redactionCoverage = 0.9
+
+// The outcome of checking a redacted PDF against its original
+type RedactionReport struct {
+	Original string
+	Redacted string
+	// One entry for each page with redactions
+	Pages []RedactionPage
+	// True if every redaction is covered and nothing was found underneath
+	OK bool
+}
+
+type RedactionPage struct {
+	Page    int
+	Regions []RedactedRegion
+}
+
+// An area where the redacted file differs from the original
+type RedactedRegion struct {
+	Region
+	// Fraction of the region covered by its most common colour
+	Coverage float64
+	// True if Coverage is high enough for the region to look blacked out
+	Covered bool
+	// Text still drawn under the region in the redacted file
+	LeakedText []string
+	// Names of images still drawn under the region in the redacted file
+	LeakedImages []string
+}
+
+// True if the region is covered and nothing was left underneath it
+func (r RedactedRegion) OK() bool {
+	return r.Covered && len(r.LeakedText) == 0 && len(r.LeakedImages) == 0
+}
+
+// Check that a redacted PDF properly redacts its original.  Every area where
+// the two differ visually is taken to be a redaction, which must be covered by
+// a solid box, and the redacted file's content streams must not still draw any
+// text or images underneath it.  Text extents are estimated, so text that
+// starts well outside a redaction but runs into it may not be noticed.  Page
+// rotation is not taken into account.
+func VerifyRedaction(original, redacted string, opts ...Option) (*RedactionReport, error) {
+	o := DefaultOptions()
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	ctx, err := readContext(redacted)
+	if err != nil {
+		return nil, fmt.Errorf("error reading %s: %w", redacted, err)
+	}
+	pages1, err := PageCount(original)
+	if err != nil {
+		return nil, fmt.Errorf("error getting page count for %s: %w", original, err)
+	}
+	if pages1 != ctx.PageCount {
+		return nil, fmt.Errorf("%w: %s has %d pages but %s has %d", ErrPageCountMismatch, original, pages1, redacted, ctx.PageCount)
+	}
+
+	report := &RedactionReport{Original: original, Redacted: redacted, OK: true}
+	src1 := &perPageSource{filename: original, resolution: o.Resolution, format: o.RenderFormat, extra: o.RendererArgs, limits: o.Limits, timeout: o.RenderTimeout, ctx: o.Context}
+	src2 := &perPageSource{filename: redacted, resolution: o.Resolution, format: o.RenderFormat, extra: o.RendererArgs, limits: o.Limits, timeout: o.RenderTimeout, ctx: o.Context}
+	for page := 1; page <= pages1; page++ {
+		img1, err := src1.page(page)
+		if err != nil {
+			return nil, err
+		}
+		img2, err := src2.page(page)
+		if err != nil {
+			return nil, err
+		}
+		same, diff, err := equalImages(img1, img2, true)
+		if err != nil {
+			return nil, err
+		}
+		if same {
+			continue
+		}
+
+		places, box, err := redactedPagePlacements(ctx, page)
+		if err != nil {
+			return nil, fmt.Errorf("error reading page %d of %s: %w", page, redacted, err)
+		}
+		rp := RedactionPage{Page: page}
+		for _, r := range diffRegions(diff, o.Resolution/o.Ratio) {
+			rr := RedactedRegion{Region: r, Coverage: coverage(img2, r)}
+			rr.Covered = rr.Coverage >= redactionCoverage
+			rect := r.userSpace(box, o.Resolution)
+			for _, p := range places {
+				if !p.overlaps(rect) {
+					continue
+				}
+				if p.image != "" {
+					rr.LeakedImages = append(rr.LeakedImages, p.image)
+				} else {
+					rr.LeakedText = append(rr.LeakedText, p.text)
+				}
+			}
+			report.OK = report.OK && rr.OK()
+			rp.Regions = append(rp.Regions, rr)
+		}
+		log().Debug("found redactions", "page", page, "count", len(rp.Regions))
+		report.Pages = append(report.Pages, rp)
+	}
+	return report, nil
+}
+
+// Where text and images are drawn on a page, and the box pdftoppm renders
+func redactedPagePlacements(ctx *model.Context, page int) ([]placement, types.Rectangle, error) {
+	content, inh, err := pageContent(ctx, page)
+	if err != nil {
+		return nil, types.Rectangle{}, err
+	}
+	ops, err := parseContent(content)
+	if err != nil {
+		return nil, types.Rectangle{}, err
+	}
+	images, err := pageImages(ctx, page)
+	if err != nil {
+		return nil, types.Rectangle{}, err
+	}
+	return pagePlacements(ops, images), renderedBox(inh), nil
+}
+
+// The area of a page that pdftoppm renders, the crop box if there is one
+func renderedBox(inh *model.InheritedPageAttrs) types.Rectangle {
+	if inh.CropBox != nil {
+		return *inh.CropBox
+	}
+	if inh.MediaBox != nil {
+		return *inh.MediaBox
+	}
+	return *types.RectForFormat("Letter")
+}
+
+// Convert a region in pixels, rendered at resolution dpi, to a rectangle in
+// the default user space of a page showing box
+func (r Region) userSpace(box types.Rectangle, resolution int) types.Rectangle {
+	scale := 72 / float64(resolution)
+	return types.Rectangle{
+		LL: types.Point{X: box.LL.X + float64(r.X)*scale, Y: box.UR.Y - float64(r.Y+r.Height)*scale},
+		UR: types.Point{X: box.LL.X + float64(r.X+r.Width)*scale, Y: box.UR.Y - float64(r.Y)*scale},
+	}
+}
+
+// Fraction of the pixels in a region of an RGB image that have its most
+// common colour
+func coverage(img *Image, r Region) float64 {
+	counts := map[[3]byte]int{}
+	most, total := 0, 0
+	for y := r.Y; y < r.Y+r.Height && y < img.H; y++ {
+		row := img.Row(y)
+		for x := r.X; x < r.X+r.Width && x < img.W; x++ {
+			c := [3]byte{row[x*3], row[x*3+1], row[x*3+2]}
+			counts[c]++
+			most = max(most, counts[c])
+			total++
+		}
+	}
+	if total == 0 {
+		return 0
+	}
+	return float64(most) / float64(total)
+}
@@ -0,0 +1,230 @@
+package pdfcomp
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// A rectangular area of a page containing differences, in pixels of the
+// rendered page with the origin at the top left
+type Region struct {
+	X      int
+	Y      int
+	Width  int
+	Height int
+	// Number of differing pixels inside the region
+	Pixels int
+}
+
+// True if r and o overlap once each is grown by pad pixels on every side
+func (r Region) near(o Region, pad int) bool {
+	return r.X-pad < o.X+o.Width+pad && o.X-pad < r.X+r.Width+pad &&
+		r.Y-pad < o.Y+o.Height+pad && o.Y-pad < r.Y+r.Height+pad
+}
+
+// Smallest region containing both r and o
+func (r Region) union(o Region) Region {
+	x0, y0 := min(r.X, o.X), min(r.Y, o.Y)
+	x1, y1 := max(r.X+r.Width, o.X+o.Width), max(r.Y+r.Height, o.Y+o.Height)
+	return Region{X: x0, Y: y0, Width: x1 - x0, Height: y1 - y0, Pixels: r.Pixels + o.Pixels}
+}
+
+// Group the differing pixels of a difference image into regions.  Pixels
+// that touch, including diagonally, form one component, and components closer
+// than gap pixels to each other are merged, so that for example a changed
+// word comes out as one region rather than one per letter.
+func diffRegions(diff *Image, gap int) []Region {
+	width, height := diff.W, diff.H
+	if height == 0 {
+		return nil
+	}
+	seen := make([]bool, width*height)
+
+	var regions []Region
+	var stack []int
+	for y := range height {
+		for x, d := range diff.Row(y) {
+			if d == 0 || seen[y*width+x] {
+				continue
+			}
+			// Flood fill the component starting here
+			x0, y0, x1, y1, n := x, y, x, y, 0
+			seen[y*width+x] = true
+			stack = append(stack[:0], y*width+x)
+			for len(stack) > 0 {
+				i := stack[len(stack)-1]
+				stack = stack[:len(stack)-1]
+				cx, cy := i%width, i/width
+				n++
+				x0, y0, x1, y1 = min(x0, cx), min(y0, cy), max(x1, cx), max(y1, cy)
+				for dy := -1; dy <= 1; dy++ {
+					for dx := -1; dx <= 1; dx++ {
+						nx, ny := cx+dx, cy+dy
+						if nx < 0 || ny < 0 || nx >= width || ny >= height {
+							continue
+						}
+						if diff.Pix[ny*diff.Stride+nx] != 0 && !seen[ny*width+nx] {
+							seen[ny*width+nx] = true
+							stack = append(stack, ny*width+nx)
+						}
+					}
+				}
+			}
+			regions = append(regions, Region{X: x0, Y: y0, Width: x1 - x0 + 1, Height: y1 - y0 + 1, Pixels: n})
+		}
+	}
+	return mergeRegions(regions, gap)
+}
+
+// Merge regions that lie within gap pixels of each other until none do
+func mergeRegions(regions []Region, gap int) []Region {
+	for merged := true; merged; {
+		merged = false
+		for i := 0; i < len(regions); i++ {
+			for j := i + 1; j < len(regions); j++ {
+				if regions[i].near(regions[j], gap) {
+					regions[i] = regions[i].union(regions[j])
+					regions = append(regions[:j], regions[j+1:]...)
+					merged = true
+					j = i
+				}
+			}
+		}
+	}
+	return regions
+}
+
+// Given an RGB image, highlight a rectangle around each region, grown
+// by pad pixels on every side.  Unless hl asks for them to be filled, only
+// the outlines of the rectangles are drawn, thickness pixels wide.  Graded
+// highlights are as strong as the largest difference in diff in each region.
+func boxImage(img, diff *Image, regions []Region, pad, thickness int, hl Highlight) *Image {
+	mask := newMask(img)
+	for _, r := range regions {
+		strength := hl.strength(regionPeak(diff, r))
+		y0, y1 := max(0, r.Y-pad), min(mask.H, r.Y+r.Height+pad)
+		x0, x1 := max(0, r.X-pad), min(mask.W, r.X+r.Width+pad)
+		for y := y0; y < y1; y++ {
+			row := mask.Row(y)
+			for x := x0; x < x1; x++ {
+				if hl.Style != HighlightFill &&
+					x >= x0+thickness && x < x1-thickness && y >= y0+thickness && y < y1-thickness {
+					continue
+				}
+				row[x] = max(row[x], strength)
+			}
+		}
+	}
+	return highlightMask(img, mask, hl)
+}
+
+// The largest difference in a region of a difference image
+func regionPeak(diff *Image, r Region) byte {
+	var peak byte
+	for y := max(r.Y, 0); y < r.Y+r.Height && y < diff.H; y++ {
+		row := diff.Row(y)
+		for x := max(r.X, 0); x < r.X+r.Width && x < diff.W; x++ {
+			peak = max(peak, row[x])
+		}
+	}
+	return peak
+}
+
+// An area of a page to leave out of the comparison, in points from the top
+// left corner of the rendered page, so that it stays put whatever the
+// resolution
+type IgnoreRegion struct {
+	// Page the area is on, or 0 for every page
+	Page   int
+	X      float64
+	Y      float64
+	Width  float64
+	Height float64
+}
+
+func (r IgnoreRegion) String() string {
+	s := fmt.Sprintf("%g,%g,%g,%g", r.X, r.Y, r.Width, r.Height)
+	if r.Page > 0 {
+		s = strconv.Itoa(r.Page) + ":" + s
+	}
+	return s
+}
+
+// Parse an area to ignore written as x,y,width,height in points, optionally
+// preceded by a page number and a colon, as in 2:400,20,150,30
+func ParseIgnoreRegion(s string) (IgnoreRegion, error) {
+	var r IgnoreRegion
+	rect := s
+	if page, rest, ok := strings.Cut(s, ":"); ok {
+		n, err := strconv.Atoi(page)
+		if err != nil || n < 1 {
+			return r, fmt.Errorf("invalid page in region %q", s)
+		}
+		r.Page, rect = n, rest
+	}
+	parts := strings.Split(rect, ",")
+	if len(parts) != 4 {
+		return r, fmt.Errorf("invalid region %q, expected [page:]x,y,width,height", s)
+	}
+	var v [4]float64
+	for i, p := range parts {
+		f, err := strconv.ParseFloat(strings.TrimSpace(p), 64)
+		if err != nil || f < 0 {
+			return r, fmt.Errorf("invalid region %q, expected [page:]x,y,width,height", s)
+		}
+		v[i] = f
+	}
+	r.X, r.Y, r.Width, r.Height = v[0], v[1], v[2], v[3]
+	return r, nil
+}
+
+// The areas to ignore on a page, in pixels at the given resolution
+func ignoredRegions(ignore []IgnoreRegion, page, resolution int) []Region {
+	var regions []Region
+	scale := float64(resolution) / 72
+	for _, r := range ignore {
+		if r.Page != 0 && r.Page != page {
+			continue
+		}
+		x0, y0 := int(math.Floor(r.X*scale)), int(math.Floor(r.Y*scale))
+		x1, y1 := int(math.Ceil((r.X+r.Width)*scale)), int(math.Ceil((r.Y+r.Height)*scale))
+		regions = append(regions, Region{X: x0, Y: y0, Width: x1 - x0, Height: y1 - y0})
+	}
+	return regions
+}
+
+// The number of differing pixels in a difference image, and the percentage
+// of its area they cover
+func diffArea(diff *Image) (int, float64) {
+	pixels, area := 0, diff.W*diff.H
+	for y := range diff.H {
+		for _, d := range diff.Row(y) {
+			if d != 0 {
+				pixels++
+			}
+		}
+	}
+	if area == 0 {
+		return 0, 0
+	}
+	return pixels, float64(pixels) * 100 / float64(area)
+}
+
+// Clear the entries of a difference image that are within tolerance,
+// returning true if none are left
+func applyTolerance(diff *Image, tolerance int) bool {
+	same := true
+	for y := range diff.H {
+		row := diff.Row(y)
+		for x, d := range row {
+			if int(d) <= tolerance {
+				row[x] = 0
+			} else {
+				same = false
+			}
+		}
+	}
+	return same
+}
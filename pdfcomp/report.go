@@ -0,0 +1,68 @@
+package pdfcomp
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/png"
+	"io"
+)
+
+// Builds a difference pdf like the one Compare writes with WithPDF, from
+// images of pages made by the caller, for programs that show differences
+// their own way or compare with something other than Compare.  Each page
+// added becomes a page of the pdf, headed with its page number, the names
+// of the files and how much of it differs.
+//
+//	rb := pdfcomp.NewReportBuilder("old.pdf", "new.pdf")
+//	rb.AddPage(3, img, pdfcomp.PageStats{DiffPercent: 0.25})
+//	err := rb.Write(w)
+type ReportBuilder struct {
+	file1, file2 string
+	pages        []reportPage
+}
+
+// What the header of a page of a ReportBuilder's pdf says about the page
+type PageStats struct {
+	// How many pixels differ, if they were counted
+	DiffPixels int
+	// What percentage of the page differs
+	DiffPercent float64
+}
+
+// A page added to a ReportBuilder
+type reportPage struct {
+	pageNum int
+	img     image.Image
+	stats   PageStats
+}
+
+// A ReportBuilder for differences between two files, whose names head each
+// page.  Either name may be empty if the files have none, such as files
+// compared from memory, and the headers then leave them out.
+func NewReportBuilder(file1, file2 string) *ReportBuilder {
+	return &ReportBuilder{file1: file1, file2: file2}
+}
+
+// Add a page to the pdf, after those already added.  pageNum is the number
+// of the page in the files, for its header; img is what the page shows,
+// which is scaled down to fit, or turned if it is taller than it is wide.
+// The image is kept until Write, so it should not be changed before then.
+func (rb *ReportBuilder) AddPage(pageNum int, img image.Image, stats PageStats) {
+	rb.pages = append(rb.pages, reportPage{pageNum, img, stats})
+}
+
+// Write the pdf of the pages added so far.  Nothing is written if a page
+// cannot be encoded.
+func (rb *ReportBuilder) Write(w io.Writer) error {
+	files := make([]PageFile, 0, len(rb.pages))
+	for _, p := range rb.pages {
+		var buf bytes.Buffer
+		if err := png.Encode(&buf, p.img); err != nil {
+			return fmt.Errorf("error encoding the image of page %d: %w", p.pageNum, err)
+		}
+		files = append(files, PageFile{pageNum: p.pageNum, src: &buf,
+			header: pageHeader(rb.file1, rb.file2, p.pageNum, p.stats)})
+	}
+	return buildPDF(nil, files, w)
+}
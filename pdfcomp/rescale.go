@@ -0,0 +1,62 @@
+package pdfcomp
+
+import "fmt"
+
+// How a page rendered at a whole multiple of the size of the other was
+// reduced so that the two could be compared, as happens when the same scan
+// is embedded at different resolutions
+type Rescale struct {
+	// Which rendering was reduced, 1 or 2
+	File int
+	// How many times larger it was in each direction
+	Factor int
+}
+
+func (r *Rescale) String() string {
+	return fmt.Sprintf("file%d rendered %d times larger and reduced to compare", r.File, r.Factor)
+}
+
+// Bring two renderings to a common size if one is a whole multiple of the
+// other, by reducing the larger.  Renderings of the same size, or whose sizes
+// are not related that way, are returned as they are with a nil Rescale.
+func commonGrid(img1, img2 *Image) (*Image, *Image, *Rescale) {
+	if img1.H == 0 || img2.H == 0 {
+		return img1, img2, nil
+	}
+	h1, w1 := img1.H, img1.W
+	h2, w2 := img2.H, img2.W
+	if h1 == h2 && w1 == w2 {
+		return img1, img2, nil
+	}
+	if h1 >= h2 && w1 >= w2 {
+		if k := wholeFactor(h1, w1, h2, w2); k > 1 {
+			return resizeImage(img1, h2, w2), img2, &Rescale{File: 1, Factor: k}
+		}
+	} else if h2 >= h1 && w2 >= w1 {
+		if k := wholeFactor(h2, w2, h1, w1); k > 1 {
+			return img1, resizeImage(img2, h1, w1), &Rescale{File: 2, Factor: k}
+		}
+	}
+	return img1, img2, nil
+}
+
+// The whole number of times a large rendering is the size of a small one in
+// both directions, or 0 if it is not.  pdftoppm rounds page sizes to whole
+// pixels, so each side may be out by up to the factor.
+func wholeFactor(hl, wl, hs, ws int) int {
+	if hs == 0 || ws == 0 {
+		return 0
+	}
+	k := (hl + hs/2) / hs
+	if k < 2 || abs(hl-k*hs) > k || abs(wl-k*ws) > k {
+		return 0
+	}
+	return k
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
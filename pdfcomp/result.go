@@ -0,0 +1,220 @@
+package pdfcomp
+
+import (
+	"fmt"
+	"image"
+)
+
+// The outcome of comparing two PDF files
+type Result struct {
+	File1  string
+	File2  string
+	Pages1 int
+	Pages2 int
+	// True if the files are visually the same
+	Equal bool
+	// One entry per page compared, in page order
+	Pages []PageResult
+	// Comparisons of the documents embedded in portfolios, sorted by name
+	Embedded []EmbeddedResult
+	// If only a sample of pages was compared, which ones and what they
+	// suggest about the rest.  Equal then only covers the sampled pages.
+	Sample *SampleResult
+	// If rendering stopped after StopAfter differing pages, the pages left
+	// and what their content suggests about them
+	Estimate *EstimateResult
+	// Signatures only in file1 and only in file2, if signatures were
+	// compared.  A signature that changed is in both.
+	SignaturesRemoved []Signature
+	SignaturesAdded   []Signature
+	// Layers only in file1 and only in file2, if layers were compared.  A
+	// layer whose default visibility changed is in both.
+	LayersRemoved []Layer
+	LayersAdded   []Layer
+	// Runs of page labels only in file1 and only in file2, if page labels
+	// were compared.  A run that changed is in both.
+	LabelsRemoved []LabelRange
+	LabelsAdded   []LabelRange
+	// The size of every page of each file.  Pages of different sizes do not
+	// by themselves make the files different, but often explain why they
+	// render differently.
+	Sizes1 []PageSize
+	Sizes2 []PageSize
+	// Regions rejected in the review given with WithReview, if it was made of
+	// these files.  The files then count as different.
+	Rejected []Decision
+	// The copies of file1 and file2 with the differing regions marked, if
+	// AnnotateCopies was set and any page has regions
+	Annotated1 string
+	Annotated2 string
+	// The resources the comparison used
+	Usage ResourceUsage
+	// The files each document was split across, if compared with
+	// CompareParts, in order
+	Parts1 []DocumentPart
+	Parts2 []DocumentPart
+}
+
+// The outcome of comparing a single page
+type PageResult struct {
+	Page  int
+	Equal bool
+	// True if the page was found the same at the Prescreen resolution, and
+	// so was not rendered at full resolution
+	Prescreened bool
+	// Why the page could not be compared, if the renderer failed on it
+	// within RenderLimits.  The page counts as different.
+	Error string
+	// Name of the difference png written for this page, if any
+	Filename string
+	// How the difference image was reduced to fit MaxArtifactBytes, if it was
+	Artifact *ArtifactAdjustment
+	// Name of the animated image blinking between the two renderings, if
+	// Blink was set
+	Blink string
+	// Side-by-side image highlighting the differences, if KeepImages was set
+	Image image.Image
+	// The /Rotate of the page in each file, if it differs.  file2's rendering
+	// was turned to match file1's, and unless CompareRotation was set, the
+	// page is equal if it then looks the same.
+	Rotation *Rotation
+	// How the renderings were brought to the same size, if Rescale was set
+	// and they differed by a whole factor
+	Rescale *Rescale
+	// The size both files rendered the page at, if MatchSize was set and the
+	// page is a different size in each
+	Matched *MatchedSize
+	// Where the content of the page was found in each file, if CropToContent
+	// was set and the page was not blank in both
+	Crop *ContentCrop
+	// The sizes the page rendered at in each file, if they differed, and how
+	// they were brought to the same size as Fit says
+	Mismatch *SizeMismatch
+	// How file2's rendering was moved to line up with file1's, if Align was
+	// set and it was moved
+	Offset *Offset
+	// Areas of the page that differ, in pixels at the rendering resolution
+	Regions []Region
+	// The same areas in the default user space of the page in file1 and in
+	// file2, one for each region, for annotating the files themselves
+	UserSpace1 []PDFRect
+	UserSpace2 []PDFRect
+	// The regions shown close up in the html report and the difference pdf,
+	// if Detail.Zoom was set
+	Details []Region
+	// The probable cause of the differences, if Classify was set and the page
+	// differs
+	Cause DiffCause
+	// What page hooks said about the page, such as a rule it broke
+	Notes []string
+	// How many pixels differ, and what percentage of the page they cover.
+	// Set for pages within MaxDiffPercent too, which count as equal.
+	DiffPixels  int
+	DiffPercent float64
+	// Annotations only on the page in file1, and only on the page in file2,
+	// if annotations were compared
+	AnnotationsRemoved []Annotation
+	AnnotationsAdded   []Annotation
+	// Links only on the page in file1, and only on the page in file2, if
+	// links were compared.  A link whose target changed is in both.
+	LinksRemoved []Link
+	LinksAdded   []Link
+	// Fonts substituted on a differing page, if fonts were checked and any
+	// were substituted
+	Fonts *FontSubstitution
+
+	// Rendered pages and their highlighted versions, kept only for reports
+	// and KeepImages, and the differences between them, kept only for
+	// KeepImages
+	raw1, raw2 *Image
+	hl1, hl2   *Image
+	diff       *Image
+	// Close-ups of Details, kept only for the html report
+	details []*Image
+}
+
+// Everything that was done to the renderings of the page to bring them
+// together before comparing, in the order it was done, so that a page that
+// only moved or was turned can be told from one whose content changed
+func (pr PageResult) Adjustments() []string {
+	var out []string
+	if pr.Rotation != nil {
+		out = append(out, pr.Rotation.String())
+	}
+	if pr.Rescale != nil {
+		out = append(out, pr.Rescale.String())
+	}
+	if pr.Matched != nil {
+		out = append(out, pr.Matched.String())
+	}
+	if pr.Crop != nil {
+		out = append(out, pr.Crop.String())
+	}
+	if pr.Mismatch != nil {
+		out = append(out, pr.Mismatch.String())
+	}
+	if pr.Offset != nil {
+		out = append(out, pr.Offset.String())
+	}
+	return out
+}
+
+// A line for each page present in both files whose sizes differ
+func (r *Result) SizeWarnings() []string {
+	var warnings []string
+	for i := range min(len(r.Sizes1), len(r.Sizes2)) {
+		if s1, s2 := r.Sizes1[i], r.Sizes2[i]; !s1.Same(s2) {
+			warnings = append(warnings, fmt.Sprintf("page %d: size %s against %s", i+1, s1, s2))
+		}
+	}
+	return warnings
+}
+
+// An error wrapping ErrPageCountMismatch if the files have different numbers
+// of pages, for callers that treat that as a failure rather than a
+// difference.  Nil if the page counts are the same.
+func (r *Result) PageCountErr() error {
+	if r.Pages1 == r.Pages2 {
+		return nil
+	}
+	return fmt.Errorf("%w: %s has %d pages but %s has %d", ErrPageCountMismatch, r.File1, r.Pages1, r.File2, r.Pages2)
+}
+
+// The highlighted renderings side by side, file1 on the left, or stacked,
+// file1 on top, as in difference images.  The same as Image: nil unless KeepImages was set and
+// the page differs.
+func (pr PageResult) SideBySide() image.Image {
+	return pr.Image
+}
+
+// The two renderings laid over each other in one image: what is only in
+// file1 in red, what is only in file2 in cyan, and what they share in gray.
+// Nil unless KeepImages was set and the page differs, and for pages carried
+// over from an interrupted comparison with ResumeDir.
+func (pr PageResult) Overlay() image.Image {
+	if pr.raw1 == nil {
+		return nil
+	}
+	return rgbToPNG(overlayImage(pr.raw1, pr.raw2))
+}
+
+// The differences coloured by how much each pixel changed, from blue to red,
+// over a faded copy of file2's rendering, as with DiffHeatmap.  Nil whenever
+// Overlay is.
+func (pr PageResult) Heatmap() image.Image {
+	if pr.raw2 == nil || pr.diff == nil {
+		return nil
+	}
+	return rgbToPNG(heatmapImage(pr.raw2, pr.diff))
+}
+
+// Pages that were found to be different
+func (r *Result) DiffPages() []PageResult {
+	var pages []PageResult
+	for _, p := range r.Pages {
+		if !p.Equal {
+			pages = append(pages, p)
+		}
+	}
+	return pages
+}
@@ -0,0 +1,248 @@
+package pdfcomp
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"image"
+	_ "image/jpeg"
+	_ "image/png"
+	"os"
+	"path/filepath"
+	"reflect"
+)
+
+// Name of the progress log kept in Options.ResumeDir, and of the directory
+// beside it for difference images spooled for the pdf
+const (
+	progressFile = "progress.jsonl"
+	progressPNGs = "pages"
+)
+
+// Identifies the comparison a progress log belongs to, so that progress is
+// only reused for the same files compared with the same settings
+type progressHeader struct {
+	Checksum1 string
+	Checksum2 string
+	Settings  Settings
+}
+
+// One completed page in a progress log
+type progressPage struct {
+	Page       int
+	Equal      bool
+	Filename   string    `json:",omitempty"`
+	Blink      string    `json:",omitempty"`
+	Regions    []Region  `json:",omitempty"`
+	Details    []Region  `json:",omitempty"`
+	UserSpace1 []PDFRect `json:",omitempty"`
+	UserSpace2 []PDFRect `json:",omitempty"`
+	// Difference image for the page, either Filename or an image spooled
+	// into the resume directory for building the pdf
+	Image string `json:",omitempty"`
+	// The other images of the page spooled for the pdf, in layouts that show
+	// it on more than one pdf page
+	Panels   []string            `json:",omitempty"`
+	Artifact *ArtifactAdjustment `json:",omitempty"`
+	Error    string              `json:",omitempty"`
+	Fonts    *FontSubstitution   `json:",omitempty"`
+	Rotation *Rotation           `json:",omitempty"`
+	Rescale  *Rescale            `json:",omitempty"`
+	Matched  *MatchedSize        `json:",omitempty"`
+	Crop     *ContentCrop        `json:",omitempty"`
+	Mismatch *SizeMismatch       `json:",omitempty"`
+	Offset   *Offset             `json:",omitempty"`
+	Notes    []string            `json:",omitempty"`
+	// Set for equal pages found the same at the prescreen resolution
+	Prescreened bool      `json:",omitempty"`
+	Cause       DiffCause `json:",omitempty"`
+	DiffPixels  int       `json:",omitempty"`
+	DiffPercent float64   `json:",omitempty"`
+}
+
+// Records each page of a comparison as it completes, as one json line per
+// page after a header, so that an interrupted run loses at most the page it
+// was working on
+type progress struct {
+	dir  string
+	f    *os.File
+	done map[int]progressPage
+}
+
+// Open the progress log in dir, keeping the pages it records if it belongs to
+// the same comparison, or starting it afresh if not
+func openProgress(dir, file1, file2 string, o Options) (*progress, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	var hdr progressHeader
+	var err error
+	if hdr.Checksum1, err = Checksum(file1); err != nil {
+		return nil, err
+	}
+	if hdr.Checksum2, err = Checksum(file2); err != nil {
+		return nil, err
+	}
+	hdr.Settings = o.Settings()
+
+	p := &progress{dir: dir, done: map[int]progressPage{}}
+	name := filepath.Join(dir, progressFile)
+	if p.load(name, hdr) {
+		p.f, err = os.OpenFile(name, os.O_APPEND|os.O_WRONLY, 0644)
+		if err != nil {
+			return nil, err
+		}
+		log().Debug("resuming", "dir", p.dir, "pages", len(p.done))
+		return p, nil
+	}
+
+	p.f, err = os.Create(name)
+	if err != nil {
+		return nil, err
+	}
+	if err := p.write(hdr); err != nil {
+		p.f.Close()
+		return nil, err
+	}
+	return p, nil
+}
+
+// Read the pages recorded in a progress log, returning false if there is no
+// log for this comparison.  A line cut short by an interruption ends the log.
+func (p *progress) load(name string, hdr progressHeader) bool {
+	f, err := os.Open(name)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+	sc := bufio.NewScanner(f)
+	sc.Buffer(nil, 16*1024*1024)
+	if !sc.Scan() {
+		return false
+	}
+	var got progressHeader
+	if err := json.Unmarshal(sc.Bytes(), &got); err != nil || !reflect.DeepEqual(got, hdr) {
+		log().Debug("progress is for a different comparison, starting again", "dir", p.dir)
+		return false
+	}
+	for sc.Scan() {
+		var pp progressPage
+		if err := json.Unmarshal(sc.Bytes(), &pp); err != nil {
+			break
+		}
+		if !imagesExist(append([]string{pp.Image}, pp.Panels...)) {
+			// The artifact is gone, so the page has to be done again
+			continue
+		}
+		p.done[pp.Page] = pp
+	}
+	return true
+}
+
+// True if none of the images a page was recorded with has gone
+func imagesExist(files []string) bool {
+	for _, f := range files {
+		if f == "" {
+			continue
+		}
+		if _, err := os.Stat(f); err != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// Append one line to the log, flushed to disk before returning
+func (p *progress) write(v any) error {
+	line, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	if _, err := p.f.Write(append(line, '\n')); err != nil {
+		return err
+	}
+	return p.f.Sync()
+}
+
+// Record a completed page, with the file holding its difference image if
+// any, and the other images spooled for the pdf
+func (p *progress) record(pr PageResult, image string, panels []string) error {
+	return p.write(progressPage{Page: pr.Page, Equal: pr.Equal, Filename: pr.Filename, Blink: pr.Blink, Regions: pr.Regions, Details: pr.Details,
+		UserSpace1: pr.UserSpace1, UserSpace2: pr.UserSpace2,
+		Image: image, Panels: panels, Artifact: pr.Artifact, Error: pr.Error, Fonts: pr.Fonts, Rotation: pr.Rotation, Rescale: pr.Rescale, Matched: pr.Matched, Crop: pr.Crop, Mismatch: pr.Mismatch, Offset: pr.Offset, Notes: pr.Notes, Prescreened: pr.Prescreened, Cause: pr.Cause,
+		DiffPixels: pr.DiffPixels, DiffPercent: pr.DiffPercent})
+}
+
+// The record of page if an earlier run completed it and it can be reused.
+// Differing pages are compared again for html reports, which need the
+// rendered pages rather than just the difference image.  Safe on a nil progress.
+func (p *progress) resumable(page int, o Options) (progressPage, bool) {
+	if p == nil {
+		return progressPage{}, false
+	}
+	pp, ok := p.done[page]
+	if !ok || (!pp.Equal && o.HTML != nil) {
+		return progressPage{}, false
+	}
+	if !pp.Equal && (o.PDF != nil || o.KeepImages) && pp.Image == "" {
+		// Compared before without an image, which is now wanted
+		return progressPage{}, false
+	}
+	if !pp.Equal && o.Blink != "" && pp.Blink == "" {
+		// Nor without a blink image
+		return progressPage{}, false
+	}
+	if !pp.Equal && o.PDF != nil && o.Layout != LayoutSideBySide && pp.Image == pp.Filename {
+		// Only the difference image was kept, not the images of the layout
+		return progressPage{}, false
+	}
+	if !pp.Equal && o.PDF != nil && len(pp.Panels) < len(pp.Details) {
+		// Nor the close-ups
+		return progressPage{}, false
+	}
+	return pp, true
+}
+
+// The result of a page completed by an earlier run, reloading its image if
+// the caller wants to keep it
+func (p *progress) restore(pp progressPage, keepImage bool) (PageResult, error) {
+	pr := PageResult{Page: pp.Page, Equal: pp.Equal, Filename: pp.Filename, Blink: pp.Blink, Regions: pp.Regions, Details: pp.Details, Artifact: pp.Artifact,
+		UserSpace1: pp.UserSpace1, UserSpace2: pp.UserSpace2,
+		Error: pp.Error, Fonts: pp.Fonts, Rotation: pp.Rotation, Rescale: pp.Rescale, Matched: pp.Matched, Crop: pp.Crop, Mismatch: pp.Mismatch, Offset: pp.Offset, Notes: pp.Notes, Prescreened: pp.Prescreened, Cause: pp.Cause,
+		DiffPixels: pp.DiffPixels, DiffPercent: pp.DiffPercent}
+	if keepImage && pp.Image != "" {
+		f, err := os.Open(pp.Image)
+		if err != nil {
+			return pr, err
+		}
+		defer f.Close()
+		pr.Image, _, err = image.Decode(f)
+		if err != nil {
+			return pr, fmt.Errorf("error reading %s: %w", pp.Image, err)
+		}
+	}
+	return pr, nil
+}
+
+func (p *progress) close() error {
+	return p.f.Close()
+}
+
+// Directory for spooled difference images
+func (p *progress) spoolDir() string {
+	return filepath.Join(p.dir, progressPNGs)
+}
+
+// Remove the log and any spooled images once the comparison has finished,
+// and the resume directory too if nothing else is in it
+func (p *progress) finish() error {
+	p.f.Close()
+	if err := os.RemoveAll(p.spoolDir()); err != nil {
+		return err
+	}
+	if err := os.Remove(filepath.Join(p.dir, progressFile)); err != nil {
+		return err
+	}
+	os.Remove(p.dir)
+	return nil
+}
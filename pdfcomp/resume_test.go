@@ -0,0 +1,43 @@
+package pdfcomp
+
+import "testing"
+
+func TestResumeSameComparison(t *testing.T) {
+	file1, file2 := "../assets/lorem.pdf", "../assets/lorem2.pdf"
+	tests := []struct {
+		name   string
+		file2  string
+		change Option
+		resume bool
+	}{
+		{"same settings", file2, func(*Options) {}, true},
+		{"progress callback", file2, WithProgress(func(int, int, bool) {}), true},
+		{"other file", "../assets/lorem_copy.pdf", func(*Options) {}, false},
+		{"resolution", file2, WithResolution(150), false},
+		{"tolerance", file2, WithTolerance(10), false},
+		{"portfolios", file2, WithPortfolios(true), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			o := DefaultOptions()
+			p, err := openProgress(dir, file1, file2, o)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := p.record(PageResult{Page: 1, Equal: true}, "", nil); err != nil {
+				t.Fatal(err)
+			}
+			p.close()
+
+			tt.change(&o)
+			if p, err = openProgress(dir, file1, tt.file2, o); err != nil {
+				t.Fatal(err)
+			}
+			defer p.close()
+			if _, ok := p.resumable(1, o); ok != tt.resume {
+				t.Errorf("page 1 resumable %v, want %v", ok, tt.resume)
+			}
+		})
+	}
+}
@@ -0,0 +1,123 @@
+package pdfcomp
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// Whether a reviewer accepted a difference as intended or rejected it as a
+// fault
+type ReviewStatus string
+
+const (
+	ReviewAccepted ReviewStatus = "accepted"
+	ReviewRejected ReviewStatus = "rejected"
+)
+
+// The decisions a reviewer made on the differing regions shown in an html
+// report, as exported from it
+type Review struct {
+	// The files reviewed, as the report named them, and their checksums
+	File1      string
+	File2      string
+	Checksum1  string
+	Checksum2  string
+	Resolution int
+	Decisions  []Decision
+}
+
+// A decision on one region of a page, in pixels at the review's resolution
+type Decision struct {
+	Page int
+	Region
+	Status ReviewStatus
+}
+
+func (d Decision) String() string {
+	return fmt.Sprintf("page %d, %dx%d at %d,%d: %s", d.Page, d.Width, d.Height, d.X, d.Y, d.Status)
+}
+
+// Read a review exported from an html report
+func ReadReview(filename string) (*Review, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	var r Review
+	if err := json.Unmarshal(data, &r); err != nil {
+		return nil, fmt.Errorf("error reading review %s: %w", filename, err)
+	}
+	if r.Resolution <= 0 {
+		return nil, fmt.Errorf("review %s has no resolution", filename)
+	}
+	for _, d := range r.Decisions {
+		if d.Status != ReviewAccepted && d.Status != ReviewRejected {
+			return nil, fmt.Errorf("review %s: unknown status %q", filename, d.Status)
+		}
+	}
+	return &r, nil
+}
+
+// True if the review was made of these two files
+func (r *Review) Matches(file1, file2 string) (bool, error) {
+	sum1, err := Checksum(file1)
+	if err != nil {
+		return false, err
+	}
+	sum2, err := Checksum(file2)
+	if err != nil {
+		return false, err
+	}
+	return sum1 == r.Checksum1 && sum2 == r.Checksum2, nil
+}
+
+// The decisions with a given status
+func (r *Review) Decided(status ReviewStatus) []Decision {
+	var ds []Decision
+	for _, d := range r.Decisions {
+		if d.Status == status {
+			ds = append(ds, d)
+		}
+	}
+	return ds
+}
+
+// True if every region of the page that was decided on was accepted, and
+// there was at least one
+func (r *Review) AcceptsPage(page int) bool {
+	accepted := false
+	for _, d := range r.Decisions {
+		if d.Page == page {
+			if d.Status != ReviewAccepted {
+				return false
+			}
+			accepted = true
+		}
+	}
+	return accepted
+}
+
+// The accepted regions of a page, converted to pixels at resolution
+func (r *Review) accepted(page, resolution int) []Region {
+	if r == nil {
+		return nil
+	}
+	// Rendered at another resolution, anti-aliasing can spread a difference
+	// into the pixels around it
+	pad := 0
+	if resolution != r.Resolution {
+		pad = 1
+	}
+	var regions []Region
+	for _, d := range r.Decisions {
+		if d.Page != page || d.Status != ReviewAccepted {
+			continue
+		}
+		x0, y0 := d.X*resolution/r.Resolution-pad, d.Y*resolution/r.Resolution-pad
+		x1 := ((d.X+d.Width)*resolution+r.Resolution-1)/r.Resolution + pad
+		y1 := ((d.Y+d.Height)*resolution+r.Resolution-1)/r.Resolution + pad
+		regions = append(regions, Region{X: max(0, x0), Y: max(0, y0), Width: x1 - max(0, x0), Height: y1 - max(0, y0)})
+	}
+	return regions
+}
@@ -0,0 +1,77 @@
+package pdfcomp
+
+import "fmt"
+
+// The /Rotate of a page in each file, when they differ.  file2's rendering is
+// turned to file1's orientation before comparing, so that a page that was
+// only rotated looks the same.
+type Rotation struct {
+	// Degrees clockwise
+	Rotate1 int
+	Rotate2 int
+}
+
+func (r *Rotation) String() string {
+	return fmt.Sprintf("rotated %d in file1 and %d in file2, file2 turned %d degrees to compare", r.Rotate1, r.Rotate2, r.turn())
+}
+
+// The rotation of a page in each file, or nil if it is the same
+func pageRotation(size1, size2 PageSize) *Rotation {
+	if size1.Rotate == size2.Rotate {
+		return nil
+	}
+	return &Rotation{Rotate1: size1.Rotate, Rotate2: size2.Rotate}
+}
+
+// Degrees clockwise to turn file2's rendering by to match file1's
+func (r *Rotation) turn() int {
+	if r == nil {
+		return 0
+	}
+	return ((r.Rotate1-r.Rotate2)%360 + 360) % 360
+}
+
+// True if file2's rendering is turned on its side, swapping its width and
+// height
+func (r *Rotation) sideways() bool {
+	return r.turn()%180 == 90
+}
+
+// The size of a page as it would be once its rendering is turned by r
+func (s PageSize) turned(r *Rotation) PageSize {
+	if r.sideways() {
+		s.Width, s.Height = s.Height, s.Width
+	}
+	return s
+}
+
+// A copy of an image turned clockwise by a multiple of 90 degrees
+func rotateImage(img *Image, degrees int) *Image {
+	degrees = (degrees%360 + 360) % 360
+	if degrees == 0 || img.H == 0 {
+		return img
+	}
+	height, width, channels := img.H, img.W, img.Channels
+	outHeight, outWidth := height, width
+	if degrees != 180 {
+		outHeight, outWidth = width, height
+	}
+	out := newImage(outWidth, outHeight, channels)
+	for y := range outHeight {
+		row := out.Row(y)
+		for x := range outWidth {
+			// The pixel of img that lands here
+			var sx, sy int
+			switch degrees {
+			case 90:
+				sx, sy = y, height-1-x
+			case 180:
+				sx, sy = width-1-x, height-1-y
+			case 270:
+				sx, sy = width-1-y, x
+			}
+			copy(row[x*channels:(x+1)*channels], img.Row(sy)[sx*channels:(sx+1)*channels])
+		}
+	}
+	return out
+}
@@ -0,0 +1,137 @@
+package pdfcomp
+
+import (
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"slices"
+)
+
+// How pages are chosen when only a sample of a document is compared
+type Sampling string
+
+const (
+	// Pages chosen at random from the whole document
+	SampleRandom Sampling = "random"
+	// The document split into equal runs of pages, with one page chosen at
+	// random from each, so that every part of the document is represented
+	SampleStratified Sampling = "stratified"
+)
+
+// z score for the confidence intervals given in SampleResult
+const sampleZ = 1.96
+
+// Convert a sampling method name, as given on the command line, to a Sampling
+func ParseSampling(s string) (Sampling, error) {
+	switch Sampling(s) {
+	case SampleRandom, SampleStratified:
+		return Sampling(s), nil
+	}
+	return "", fmt.Errorf("unknown sampling method %q", s)
+}
+
+// What a sampled comparison found, and what it suggests about the whole document
+type SampleResult struct {
+	Method Sampling
+	Seed   uint64
+	// Pages in the documents, and the pages that were compared, in order
+	Total int
+	Pages []int
+	// Number of compared pages that were different
+	Different int
+	// Estimated fraction of all pages that are different
+	Rate float64
+	// Range that the fraction of different pages lies in, with the given
+	// confidence.  Narrows to Rate when every page was compared.
+	RateLow    float64
+	RateHigh   float64
+	Confidence float64
+}
+
+// The pages to compare, in increasing order: every page up to count, or a
+// sample of them.  Only a sample is listed, so that a document of tens of
+// thousands of pages needs no list of them all.
+type pageSet struct {
+	count int
+	// The pages chosen, if only some are compared
+	sample []int
+}
+
+func (s pageSet) len() int {
+	if s.sample != nil {
+		return len(s.sample)
+	}
+	return s.count
+}
+
+// The page at index i
+func (s pageSet) at(i int) int {
+	if s.sample != nil {
+		return s.sample[i]
+	}
+	return i + 1
+}
+
+// The pages after index i, listed
+func (s pageSet) after(i int) []int {
+	if s.sample != nil {
+		return s.sample[i+1:]
+	}
+	rest := make([]int, 0, s.count-i-1)
+	for page := i + 2; page <= s.count; page++ {
+		rest = append(rest, page)
+	}
+	return rest
+}
+
+// Choose n of pages pages to compare, returning page numbers in increasing
+// order.  The same seed always chooses the same pages.
+func samplePages(pages, n int, method Sampling, seed uint64) []int {
+	if n >= pages {
+		all := make([]int, pages)
+		for i := range all {
+			all[i] = i + 1
+		}
+		return all
+	}
+	rnd := rand.New(rand.NewPCG(seed, 0))
+	chosen := make([]int, n)
+	if method == SampleStratified {
+		for k := range n {
+			first, next := k*pages/n, (k+1)*pages/n
+			chosen[k] = first + rnd.IntN(next-first) + 1
+		}
+		return chosen
+	}
+	for i, p := range rnd.Perm(pages)[:n] {
+		chosen[i] = p + 1
+	}
+	slices.Sort(chosen)
+	return chosen
+}
+
+// Extrapolate from the compared pages to the whole document, using the Wilson
+// score interval with a correction for sampling without replacement
+func (s *SampleResult) estimate() {
+	n, total := float64(len(s.Pages)), float64(s.Total)
+	s.Confidence = 0.95
+	if n == 0 {
+		s.RateHigh = 1
+		return
+	}
+	p := float64(s.Different) / n
+	s.Rate = p
+	fpc := 0.0
+	if total > 1 {
+		fpc = (total - n) / (total - 1)
+	}
+	z2 := sampleZ * sampleZ
+	centre := (p + z2/(2*n)) / (1 + z2/n)
+	half := sampleZ / (1 + z2/n) * math.Sqrt(p*(1-p)/n+z2/(4*n*n))
+	// Without replacement the interval shrinks to nothing as the sample
+	// approaches the whole document
+	centre = p + (centre-p)*math.Sqrt(fpc)
+	half *= math.Sqrt(fpc)
+	s.RateLow = max(0, centre-half)
+	s.RateHigh = min(1, centre+half)
+}
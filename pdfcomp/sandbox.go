@@ -0,0 +1,101 @@
+package pdfcomp
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os/exec"
+	"runtime"
+	"strconv"
+)
+
+// Limits on each run of the renderer, to protect a server from documents
+// crafted to exhaust it.  Zero means no limit.  When any limit is set, a page
+// the renderer fails on for any reason, including a crash, is recorded as a
+// failed page rather than ending the comparison.
+type RenderLimits struct {
+	// Processor time for rendering one page
+	CPUSeconds int
+	// Address space of the renderer, which includes its code and libraries.
+	// Not enforced on Windows.
+	MemoryBytes int64
+	// Size of the rendered page as output by the renderer
+	OutputBytes int64
+}
+
+func (l RenderLimits) enabled() bool {
+	return l.CPUSeconds > 0 || l.MemoryBytes > 0 || l.OutputBytes > 0
+}
+
+// A page the renderer could not render within its limits or RenderTimeout,
+// or crashed on
+type RenderError struct {
+	File   string
+	Page   int
+	Reason string
+	Err    error
+}
+
+func (e *RenderError) Error() string {
+	return fmt.Sprintf("rendering page %d of %s failed: %s", e.Page, e.File, e.Reason)
+}
+
+func (e *RenderError) Unwrap() error {
+	return e.Err
+}
+
+// The command to run the renderer within limits.  CPU time and memory are
+// limited with the shell's ulimit, which applies only to the renderer, and is
+// not available on Windows.
+func rendererCommand(name string, args []string, limits RenderLimits) *exec.Cmd {
+	if runtime.GOOS == "windows" || (limits.CPUSeconds <= 0 && limits.MemoryBytes <= 0) {
+		return exec.Command(name, args...)
+	}
+	// A renderer that is not there fails to start, as it does without limits,
+	// rather than leaving the shell to fail
+	if _, err := exec.LookPath(name); err != nil {
+		return exec.Command(name, args...)
+	}
+	script := ""
+	if limits.CPUSeconds > 0 {
+		script += "ulimit -t " + strconv.Itoa(limits.CPUSeconds) + " && "
+	}
+	if limits.MemoryBytes > 0 {
+		script += "ulimit -v " + strconv.FormatInt(max(1, limits.MemoryBytes/1024), 10) + " && "
+	}
+	// The renderer and its arguments are passed as parameters, never
+	// interpreted by the shell
+	script += `exec "$0" "$@"`
+	return exec.Command("/bin/sh", append([]string{"-c", script, name}, args...)...)
+}
+
+// A buffer that refuses to grow past max bytes, if max is more than zero.
+// The buffer is not embedded, so that io.Copy cannot bypass Write through
+// its ReadFrom.
+type cappedBuffer struct {
+	buf  bytes.Buffer
+	max  int64
+	over bool
+}
+
+var errOutputLimit = errors.New("renderer output limit exceeded")
+
+func (b *cappedBuffer) Write(p []byte) (int, error) {
+	if b.max > 0 && int64(b.buf.Len()+len(p)) > b.max {
+		b.over = true
+		return 0, errOutputLimit
+	}
+	return b.buf.Write(p)
+}
+
+// Describe why a renderer run within limits failed
+func failureReason(err error, out *cappedBuffer) string {
+	if out.over || errors.Is(err, errOutputLimit) {
+		return fmt.Sprintf("output over %d bytes", out.max)
+	}
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return exitErr.String()
+	}
+	return err.Error()
+}
@@ -0,0 +1,114 @@
+package pdfcomp
+
+import "fmt"
+
+// Sequences longer than this, multiplied together, are compared position by
+// position rather than with a full longest common subsequence, which would
+// need too much memory
+const maxLCSCells = 25_000_000
+
+// An entry found in only one of two sequences
+type seqEdit struct {
+	// True if the entry is only in the first sequence, false if only in the second
+	removed bool
+	// Index of the entry in its sequence
+	index int
+}
+
+// Diff two sequences of strings, returning the entries only in a prefixed with
+// "- " and those only in b prefixed with "+ ", in order.  Returns nil if the
+// sequences are the same.
+func diffSequences(a, b []string) []string {
+	var changes []string
+	for _, e := range seqEdits(a, b) {
+		if e.removed {
+			changes = append(changes, "- "+a[e.index])
+		} else {
+			changes = append(changes, "+ "+b[e.index])
+		}
+	}
+	return changes
+}
+
+// The items only in a and only in b, in order, comparing items by how they
+// print
+func diffItems[T fmt.Stringer](a, b []T) (removed, added []T) {
+	keys := func(items []T) []string {
+		k := make([]string, len(items))
+		for i, item := range items {
+			k[i] = item.String()
+		}
+		return k
+	}
+	for _, e := range seqEdits(keys(a), keys(b)) {
+		if e.removed {
+			removed = append(removed, a[e.index])
+		} else {
+			added = append(added, b[e.index])
+		}
+	}
+	return removed, added
+}
+
+// The entries that would have to be removed from a and added from b to turn
+// a into b, in order
+func seqEdits(a, b []string) []seqEdit {
+	if len(a)*len(b) > maxLCSCells {
+		return positionalEdits(a, b)
+	}
+
+	// lcs[i][j] is the length of the longest common subsequence of a[i:], b[j:]
+	lcs := make([][]int32, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int32, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	var edits []seqEdit
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		switch {
+		case a[i] == b[j]:
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			edits = append(edits, seqEdit{true, i})
+			i++
+		default:
+			edits = append(edits, seqEdit{false, j})
+			j++
+		}
+	}
+	for ; i < len(a); i++ {
+		edits = append(edits, seqEdit{true, i})
+	}
+	for ; j < len(b); j++ {
+		edits = append(edits, seqEdit{false, j})
+	}
+	return edits
+}
+
+// Compare two sequences entry by entry, for when they are too long for seqEdits
+func positionalEdits(a, b []string) []seqEdit {
+	var edits []seqEdit
+	for i := range max(len(a), len(b)) {
+		if i < len(a) && i < len(b) && a[i] == b[i] {
+			continue
+		}
+		if i < len(a) {
+			edits = append(edits, seqEdit{true, i})
+		}
+		if i < len(b) {
+			edits = append(edits, seqEdit{false, i})
+		}
+	}
+	return edits
+}
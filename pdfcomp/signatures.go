@@ -0,0 +1,240 @@
+package pdfcomp
+
+import (
+	"fmt"
+	"math"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/model"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/types"
+)
+
+// A signature field of a document, signed or waiting to be signed.  Only
+// what the document says about the signature is read; the signature itself
+// is not verified cryptographically.
+type Signature struct {
+	// Full name of the form field
+	Field string
+	// Page the signature appears on, or 0 if it has no widget on any page
+	Page int
+	// Position of the signature's appearance in user space, rounded to whole
+	// points.  Invisible signatures have an empty rectangle.
+	Rect   [4]float64
+	Signed bool
+	// Name of the signer and the time of signing, as the signature dictionary
+	// records them
+	Signer string
+	Time   time.Time
+	Reason string
+	// True if the signed byte range covers the whole file.  If not, the file
+	// was changed after it was signed, by an incremental update.
+	CoversFile bool
+
+	// The area of the page pdftoppm renders, to place the rectangle
+	box types.Rectangle
+}
+
+func (s Signature) String() string {
+	if !s.Signed {
+		return fmt.Sprintf("%s unsigned", s.Field)
+	}
+	str := s.Field + " signed"
+	if s.Signer != "" {
+		str += " by " + s.Signer
+	}
+	if !s.Time.IsZero() {
+		str += " at " + s.Time.Format(time.RFC3339)
+	}
+	if s.Reason != "" {
+		str += fmt.Sprintf(" (%s)", s.Reason)
+	}
+	if !s.CoversFile {
+		str += ", changed since signing"
+	}
+	return str
+}
+
+// The signature fields of a file, sorted by name
+func fileSignatures(ctx *model.Context) ([]Signature, error) {
+	root, err := ctx.Catalog()
+	if err != nil {
+		return nil, err
+	}
+	form, _ := dictEntry(ctx, root, "AcroForm").(types.Dict)
+	fields, ok := dictEntry(ctx, form, "Fields").(types.Array)
+	if !ok {
+		return nil, nil
+	}
+	pages, err := annotationPages(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var sigs []Signature
+	seen := map[int]bool{}
+	var walk func(fields types.Array, prefix, ft string, depth int)
+	walk = func(fields types.Array, prefix, ft string, depth int) {
+		if depth > maxStructDepth {
+			return
+		}
+		for _, o := range fields {
+			if ref, ok := o.(types.IndirectRef); ok {
+				// Guard against fields that are their own ancestors
+				if seen[ref.ObjectNumber.Value()] {
+					continue
+				}
+				seen[ref.ObjectNumber.Value()] = true
+			}
+			fd, err := ctx.DereferenceDict(o)
+			if err != nil || fd == nil {
+				continue
+			}
+			name := prefix
+			if t := dictEntry(ctx, fd, "T"); t != nil {
+				partial, _ := model.Text(t)
+				name = strings.TrimPrefix(prefix+"."+partial, ".")
+			}
+			fieldType := ft
+			if n, ok := dictEntry(ctx, fd, "FT").(types.Name); ok {
+				fieldType = n.Value()
+			}
+			if kids, ok := dictEntry(ctx, fd, "Kids").(types.Array); ok && !hasWidgetKids(ctx, kids) {
+				walk(kids, name, fieldType, depth+1)
+				continue
+			}
+			if fieldType != "Sig" {
+				continue
+			}
+			sig := readSignature(ctx, fd, name)
+			// The field is its own widget unless it has widgets as kids
+			widgets := types.Array{o}
+			if kids, ok := dictEntry(ctx, fd, "Kids").(types.Array); ok {
+				widgets = kids
+			}
+			for _, w := range widgets {
+				if ref, ok := w.(types.IndirectRef); ok && pages[ref.ObjectNumber.Value()] != 0 {
+					sig.Page = pages[ref.ObjectNumber.Value()]
+					wd, _ := ctx.DereferenceDict(w)
+					sig.Rect = annotationRect(ctx, wd)
+					_, _, inh, err := ctx.PageDict(sig.Page, false)
+					if err == nil {
+						sig.box = renderedBox(inh)
+					}
+					break
+				}
+			}
+			sigs = append(sigs, sig)
+		}
+	}
+	walk(fields, "", "", 0)
+	slices.SortFunc(sigs, func(a, b Signature) int { return strings.Compare(a.Field, b.Field) })
+	return sigs, nil
+}
+
+// True if the kids of a field are its widgets rather than fields of their own,
+// which have names
+func hasWidgetKids(ctx *model.Context, kids types.Array) bool {
+	for _, k := range kids {
+		kd, _ := ctx.DereferenceDict(k)
+		if kd != nil && dictEntry(ctx, kd, "T") == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// What the signature dictionary of a field says about who signed it and when
+func readSignature(ctx *model.Context, fd types.Dict, name string) Signature {
+	sig := Signature{Field: name}
+	v, ok := dictEntry(ctx, fd, "V").(types.Dict)
+	if !ok {
+		return sig
+	}
+	sig.Signed = true
+	if s := dictEntry(ctx, v, "Name"); s != nil {
+		sig.Signer, _ = model.Text(s)
+	}
+	if s := dictEntry(ctx, v, "Reason"); s != nil {
+		sig.Reason, _ = model.Text(s)
+	}
+	if s := dictEntry(ctx, v, "M"); s != nil {
+		m, _ := model.Text(s)
+		sig.Time, _ = types.DateTime(m, true)
+	}
+	// The byte range runs from the start of the file to the end, leaving out
+	// only the signature itself
+	if br, ok := dictEntry(ctx, v, "ByteRange").(types.Array); ok && len(br) == 4 {
+		var n [4]int64
+		for i, o := range br {
+			if v, ok := o.(types.Integer); ok {
+				n[i] = int64(v.Value())
+			}
+		}
+		sig.CoversFile = n[0] == 0 && n[2]+n[3] == ctx.Read.FileSize
+	}
+	return sig
+}
+
+// The page each annotation is on, indexed by the object number of the annotation
+func annotationPages(ctx *model.Context) (map[int]int, error) {
+	pages := map[int]int{}
+	for page := 1; page <= ctx.PageCount; page++ {
+		d, _, _, err := ctx.PageDict(page, false)
+		if err != nil {
+			return nil, err
+		}
+		arr, _ := dictEntry(ctx, d, "Annots").(types.Array)
+		for _, o := range arr {
+			if ref, ok := o.(types.IndirectRef); ok {
+				pages[ref.ObjectNumber.Value()] = page
+			}
+		}
+	}
+	return pages, nil
+}
+
+// Signatures only in the first file and only in the second.  A signature
+// that was added, removed, signed or signed differently is in both.
+func diffSignatures(s1, s2 []Signature) (removed, added []Signature) {
+	return diffItems(s1, s2)
+}
+
+// The areas covered by signature appearances on each page, in pixels at the
+// given resolution.  Page rotation is not taken into account.
+func signatureMasks(resolution int, sigs ...[]Signature) map[int][]Region {
+	masks := map[int][]Region{}
+	scale := float64(resolution) / 72
+	for _, list := range sigs {
+		for _, s := range list {
+			if s.Page == 0 || s.Rect[0] == s.Rect[2] || s.Rect[1] == s.Rect[3] {
+				continue
+			}
+			x0, x1 := min(s.Rect[0], s.Rect[2]), max(s.Rect[0], s.Rect[2])
+			y0, y1 := min(s.Rect[1], s.Rect[3]), max(s.Rect[1], s.Rect[3])
+			left := int(math.Floor((x0 - s.box.LL.X) * scale))
+			top := int(math.Floor((s.box.UR.Y - y1) * scale))
+			masks[s.Page] = append(masks[s.Page], Region{
+				X:      left,
+				Y:      top,
+				Width:  int(math.Ceil((x1-s.box.LL.X)*scale)) - left,
+				Height: int(math.Ceil((s.box.UR.Y-y0)*scale)) - top,
+			})
+		}
+	}
+	return masks
+}
+
+// Paint regions of an image white, so that they compare the same
+func maskRegions(img *Image, regions []Region) {
+	for _, r := range regions {
+		for y := max(r.Y, 0); y < r.Y+r.Height && y < img.H; y++ {
+			row := img.Row(y)
+			for x := max(r.X, 0); x < r.X+r.Width && x < img.W; x++ {
+				for c := range img.Channels {
+					row[x*img.Channels+c] = 255
+				}
+			}
+		}
+	}
+}
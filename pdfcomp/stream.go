@@ -0,0 +1,223 @@
+package pdfcomp
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"image"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+// Supplies the rendered pages of one file, in increasing page order
+type pageSource interface {
+	page(n int) (*Image, error)
+	// What the renderer printed while rendering the last page, if known
+	messages() string
+	close() error
+}
+
+// Runs pdftoppm once for every page
+type perPageSource struct {
+	filename   string
+	resolution int
+	// The pixel size to render a page at instead, if any
+	scaleTo func(page int) image.Point
+	color   ColorMode
+	// What the renderer writes pages as
+	format RenderFormat
+	// Arguments of the caller's own for the renderer
+	extra  []string
+	limits RenderLimits
+	// If not empty, the directory the renderer writes pages to instead of
+	// its output
+	dir string
+	// How long the renderer may take over a page, if limited
+	timeout time.Duration
+	ctx     context.Context
+	stderr  string
+	// Where the renderer processes are recorded, if anywhere
+	usage *usageMeter
+}
+
+func (s *perPageSource) page(n int) (*Image, error) {
+	var size image.Point
+	if s.scaleTo != nil {
+		size = s.scaleTo(n)
+	}
+	format := s.format.resolve()
+	out, stderr, err := s.render(n, size, format)
+	s.stderr = stderr
+	if err != nil {
+		return nil, err
+	}
+	defer out.Close()
+	img, err := pageImage(out, format, s.color.channels())
+	if err != nil && s.limits.enabled() {
+		return nil, &RenderError{File: s.filename, Page: n, Reason: "unreadable output", Err: err}
+	}
+	return img, err
+}
+
+// The context rendering stops for, which is never done if there is none
+func (s *perPageSource) context() context.Context {
+	if s.ctx == nil {
+		return context.Background()
+	}
+	return s.ctx
+}
+
+// The page a renderer wrote to a directory of its own, which is removed with
+// the page once it is closed, and is recorded as temporary
+func (s *perPageSource) pageFile(dir string) (io.ReadCloser, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	if len(entries) != 1 {
+		return nil, fmt.Errorf("pdftoppm wrote %d files for a page of %s", len(entries), s.filename)
+	}
+	name := filepath.Join(dir, entries[0].Name())
+	s.usage.temp(name)
+	if max := s.limits.OutputBytes; max > 0 {
+		if fi, err := os.Stat(name); err == nil && fi.Size() > max {
+			return nil, errOutputLimit
+		}
+	}
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	return &tempPage{File: f, dir: dir}, nil
+}
+
+// A rendered page in a file, removed with its directory once it is closed
+type tempPage struct {
+	*os.File
+	dir string
+}
+
+func (p *tempPage) Close() error {
+	err := p.File.Close()
+	os.RemoveAll(p.dir)
+	return err
+}
+
+func (s *perPageSource) messages() string {
+	return s.stderr
+}
+
+func (s *perPageSource) close() error {
+	return nil
+}
+
+// Runs a single pdftoppm for a range of pages, decoding each page from its
+// output as it arrives instead of buffering the whole document.
+type streamSource struct {
+	filename string
+	cmd      *exec.Cmd
+	stderr   bytes.Buffer
+	dec      *pageDecoder
+	next     int
+	done     bool
+	usage    *usageMeter
+	ctx      context.Context
+	// Stops the renderer being killed when ctx is done
+	stop func() bool
+	// How long the renderer may take to write each page, if limited
+	timeout time.Duration
+}
+
+// Start rendering pages first to last of filename in format, passing the
+// renderer the extra arguments, killing it once ctx is done, and recording it
+// in meter once it exits
+func newStreamSource(ctx context.Context, filename string, first, last, resolution int, color ColorMode, format RenderFormat, extra []string, meter *usageMeter) (*streamSource, error) {
+	s := &streamSource{filename: filename, next: first, usage: meter, ctx: ctx}
+	args := []string{
+		"-r",
+		strconv.Itoa(resolution),
+		"-f",
+		strconv.Itoa(first),
+		"-l",
+		strconv.Itoa(last),
+	}
+	format = format.resolve()
+	args = append(args, color.args()...)
+	args = append(args, format.args()...)
+	args = append(args, extra...)
+	args = append(args, filename, "-")
+	s.cmd = exec.Command(pdftoppmCommand(), args...)
+	s.cmd.Stderr = &s.stderr
+	stdout, err := s.cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := s.cmd.Start(); err != nil {
+		return nil, startError(err, s.stderr.String())
+	}
+	s.stop = context.AfterFunc(ctx, func() { s.cmd.Process.Kill() })
+	s.dec = newPageDecoder(stdout, format, color.channels())
+	return s, nil
+}
+
+func (s *streamSource) page(n int) (*Image, error) {
+	if n < s.next {
+		return nil, fmt.Errorf("page %d of %s requested after page %d", n, s.filename, s.next-1)
+	}
+	for {
+		var timedOut atomic.Bool
+		var timer *time.Timer
+		if s.timeout > 0 {
+			timer = time.AfterFunc(s.timeout, func() {
+				timedOut.Store(true)
+				s.cmd.Process.Kill()
+			})
+		}
+		img, err := s.dec.next()
+		if timer != nil {
+			timer.Stop()
+		}
+		if err != nil && s.ctx.Err() != nil {
+			s.close()
+			return nil, fmt.Errorf("rendering page %d of %s: %w", n, s.filename, s.ctx.Err())
+		}
+		if err != nil && timedOut.Load() {
+			s.close()
+			return nil, &RenderError{File: s.filename, Page: s.next, Reason: fmt.Sprintf("timed out after %s", s.timeout), Err: ErrRenderTimeout}
+		}
+		if err == io.EOF {
+			s.close()
+			return nil, fmt.Errorf("pdftoppm output for %s ended before page %d, stderr: %s", s.filename, n, s.stderr.String())
+		}
+		if err != nil {
+			return nil, err
+		}
+		s.next++
+		if s.next > n {
+			return img, nil
+		}
+	}
+}
+
+// The renderer's messages cannot be told apart by page while it runs
+func (s *streamSource) messages() string {
+	return ""
+}
+
+// Stop the renderer, since any pages not yet read are no longer wanted
+func (s *streamSource) close() error {
+	if s.done {
+		return nil
+	}
+	s.done = true
+	s.stop()
+	s.cmd.Process.Kill()
+	s.cmd.Wait()
+	s.usage.process(s.cmd.ProcessState)
+	return nil
+}
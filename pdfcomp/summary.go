@@ -0,0 +1,139 @@
+package pdfcomp
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/primitives"
+)
+
+// The first pages of the difference pdf, saying what was compared, how, and
+// how much of each page differs
+type pdfSummary struct {
+	// Lines under the title, such as the names of the files
+	lines []string
+	// A row of the table for each page compared: its number, how much of it
+	// differs and whether it counts as the same
+	rows [][3]string
+}
+
+// Sizes and positions on summary pages, in points
+const (
+	titleSize   = 16
+	summarySize = 11
+	lineHeight  = 15.0
+	rowHeight   = 14.0
+)
+
+// Where each column of the table starts, from the left margin
+var summaryColumns = [3]float64{0, 60, 160}
+
+// Describe a comparison for the first pages of its difference pdf
+func newPDFSummary(res *Result, file1, file2 string, o Options) *pdfSummary {
+	s := &pdfSummary{}
+	for i, f := range []struct {
+		name, path string
+		pages      int
+	}{
+		{res.File1, file1, res.Pages1}, {res.File2, file2, res.Pages2},
+	} {
+		line := fmt.Sprintf("File %d: %s, %d pages", i+1, f.name, f.pages)
+		if fi, err := os.Stat(f.path); err == nil {
+			line += ", modified " + fi.ModTime().Format(time.RFC3339)
+		}
+		s.lines = append(s.lines, line)
+	}
+	s.lines = append(s.lines, "Compared: "+time.Now().Format(time.RFC3339))
+
+	settings := fmt.Sprintf("Settings: %d dpi, tolerance %d", o.Resolution, o.Tolerance)
+	if o.DeltaE > 0 {
+		settings += fmt.Sprintf(", delta-e %g", o.DeltaE)
+	}
+	if o.MaxDiffPercent > 0 {
+		settings += fmt.Sprintf(", max-diff-percent %g", o.MaxDiffPercent)
+	}
+	s.lines = append(s.lines, settings)
+
+	total := fmt.Sprintf("%d", res.Pages1)
+	if res.Pages1 != res.Pages2 {
+		total = fmt.Sprintf("%d in file 1 and %d in file 2", res.Pages1, res.Pages2)
+	}
+	var differ []string
+	for _, pr := range res.DiffPages() {
+		differ = append(differ, fmt.Sprint(pr.Page))
+	}
+	line := fmt.Sprintf("Pages: %s, of which %d differ", total, len(differ))
+	if len(differ) > 0 {
+		line += ": " + strings.Join(differ, ", ")
+	}
+	s.lines = append(s.lines, line)
+	for _, e := range res.Embedded {
+		if !e.Equal() {
+			s.lines = append(s.lines, fmt.Sprintf("Embedded document %s: %s", e.Name, e.status()))
+		}
+	}
+
+	for _, pr := range res.Pages {
+		row := [3]string{fmt.Sprint(pr.Page), fmt.Sprintf("%.3g%%", pr.DiffPercent), "same"}
+		switch {
+		case pr.Error != "":
+			row[1], row[2] = "", "could not be compared"
+		case !pr.Equal:
+			row[2] = "different"
+		case pr.Prescreened:
+			row[2] = "same at the prescreen resolution"
+		}
+		s.rows = append(s.rows, row)
+	}
+	return s
+}
+
+// Lay the summary out on as many pages of the given height as it needs,
+// repeating the head of the table on each
+func (s *pdfSummary) pages(height float64) []*primitives.PDFPage {
+	var (
+		pages []*primitives.PDFPage
+		boxes []*primitives.TextBox
+	)
+	text := func(value string, x, y float64, size int, bold bool) {
+		font := "Helvetica"
+		if bold {
+			font = "Helvetica-Bold"
+		}
+		// pdfcpu reads % as the start of a placeholder such as %p
+		boxes = append(boxes, &primitives.TextBox{Value: strings.ReplaceAll(value, "%", "%%"),
+			Position: [2]float64{x, y}, Font: &primitives.FormFont{Name: font, Size: size}})
+	}
+	head := func(y float64) float64 {
+		for i, h := range []string{"Page", "Differs", "Result"} {
+			text(h, summaryColumns[i], y, summarySize, true)
+		}
+		return y + rowHeight
+	}
+
+	text("PDF comparison", 0, 0, titleSize, true)
+	y := titleSize + lineHeight/2
+	for _, l := range s.lines {
+		text(l, 0, y, summarySize, false)
+		y += lineHeight
+	}
+	if len(s.rows) > 0 {
+		y = head(y + lineHeight)
+	}
+	for _, row := range s.rows {
+		if y > height {
+			pages = append(pages, &primitives.PDFPage{Content: &primitives.Content{TextBoxes: boxes}})
+			boxes = nil
+			// Text at the very top is placed by its top rather than its
+			// baseline, so the head of the table starts a row down
+			y = head(rowHeight)
+		}
+		for i, v := range row {
+			text(v, summaryColumns[i], y, summarySize, false)
+		}
+		y += rowHeight
+	}
+	return append(pages, &primitives.PDFPage{Content: &primitives.Content{TextBoxes: boxes}})
+}
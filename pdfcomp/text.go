@@ -0,0 +1,248 @@
+package pdfcomp
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf16"
+
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/model"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/types"
+)
+
+// Gaps in TJ arrays wider than this, in thousandths of the font size, are
+// taken as spaces between words
+const wordGap = 200
+
+// Differences between the text of two files, found without rendering them
+type TextReport struct {
+	File1  string
+	File2  string
+	Pages1 int
+	Pages2 int
+	Equal  bool
+	// One entry per page in both files
+	Pages []TextPage
+}
+
+// Differences between the text of one page
+type TextPage struct {
+	Page  int
+	Equal bool
+	// Words only in file1, prefixed with "- ", and only in file2, prefixed
+	// with "+ "
+	Changes []string
+}
+
+// Compare the words shown on each page of two files, ignoring where and how
+// they are drawn, so that reflowed or restyled text counts as the same.  Text
+// is decoded with each font's /ToUnicode map where it has one, and taken as
+// written otherwise.  Text inside form XObjects is not seen.
+func CompareText(file1, file2 string) (*TextReport, error) {
+	ctx1, err := readContext(file1)
+	if err != nil {
+		return nil, fmt.Errorf("error reading %s: %w", file1, err)
+	}
+	ctx2, err := readContext(file2)
+	if err != nil {
+		return nil, fmt.Errorf("error reading %s: %w", file2, err)
+	}
+
+	r := &TextReport{File1: file1, File2: file2, Pages1: ctx1.PageCount, Pages2: ctx2.PageCount}
+	r.Equal = r.Pages1 == r.Pages2
+	for page := 1; page <= min(r.Pages1, r.Pages2); page++ {
+		words1, err := pageWords(ctx1, page)
+		if err != nil {
+			return nil, fmt.Errorf("error reading page %d of %s: %w", page, file1, err)
+		}
+		words2, err := pageWords(ctx2, page)
+		if err != nil {
+			return nil, fmt.Errorf("error reading page %d of %s: %w", page, file2, err)
+		}
+		tp := TextPage{Page: page, Changes: diffSequences(words1, words2)}
+		tp.Equal = len(tp.Changes) == 0
+		r.Equal = r.Equal && tp.Equal
+		r.Pages = append(r.Pages, tp)
+	}
+	return r, nil
+}
+
+// The words a page shows, in the order its content stream draws them
+func pageWords(ctx *model.Context, page int) ([]string, error) {
+	content, inh, err := pageContent(ctx, page)
+	if err != nil {
+		return nil, err
+	}
+	ops, err := parseContent(content)
+	if err != nil {
+		return nil, err
+	}
+	var fonts types.Dict
+	if inh != nil {
+		fonts, _ = dictEntry(ctx, inh.Resources, "Font").(types.Dict)
+	}
+	decoders := map[string]*textDecoder{}
+	var dec *textDecoder
+	var words []string
+	for _, op := range ops {
+		switch op.op {
+		case "Tf":
+			if len(op.operands) == 2 && op.operands[0].kind == tokName {
+				name := op.operands[0].text[1:]
+				if decoders[name] == nil {
+					font, _ := dictEntry(ctx, fonts, name).(types.Dict)
+					decoders[name] = fontDecoder(ctx, font)
+				}
+				dec = decoders[name]
+			}
+		case "Tj", "'", "\"":
+			for _, t := range op.operands {
+				if t.kind == tokString {
+					words = append(words, strings.Fields(dec.decode(t.text))...)
+				}
+			}
+		case "TJ":
+			var sb strings.Builder
+			for _, t := range op.operands {
+				switch t.kind {
+				case tokString:
+					sb.WriteString(dec.decode(t.text))
+				case tokNumber:
+					if t.number() < -wordGap {
+						sb.WriteByte(' ')
+					}
+				}
+			}
+			words = append(words, strings.Fields(sb.String())...)
+		}
+	}
+	return words, nil
+}
+
+// Turns the strings a font shows into text
+type textDecoder struct {
+	// Bytes per character code: 2 for composite fonts, 1 otherwise
+	codeLen int
+	// Text of each character code, from the font's /ToUnicode map
+	codes map[uint32]string
+}
+
+// A decoder for a font, reading its /ToUnicode map if it has one
+func fontDecoder(ctx *model.Context, font types.Dict) *textDecoder {
+	dec := &textDecoder{codeLen: 1}
+	if subtype, _ := dictEntry(ctx, font, "Subtype").(types.Name); subtype == "Type0" {
+		dec.codeLen = 2
+	}
+	o, found := font.Find("ToUnicode")
+	if !found {
+		return dec
+	}
+	sd, _, err := ctx.DereferenceStreamDict(o)
+	if err != nil || sd == nil || sd.Decode() != nil {
+		return dec
+	}
+	dec.readCMap(sd.Content)
+	return dec
+}
+
+// Read the codespace and the bfchar and bfrange mappings of a /ToUnicode
+// CMap, which is written with the same tokens as a content stream
+func (dec *textDecoder) readCMap(data []byte) {
+	tokens, err := lexContent(data)
+	if err != nil {
+		return
+	}
+	dec.codes = map[uint32]string{}
+	// The strings, and arrays of destination strings, since the last begin
+	// keyword
+	type arg struct {
+		s     string
+		array []string
+	}
+	var args []arg
+	var array []string
+	inArray := false
+	for _, t := range tokens {
+		switch {
+		case t.kind == tokArrayStart:
+			inArray, array = true, []string{}
+		case t.kind == tokArrayEnd:
+			inArray = false
+			args = append(args, arg{array: array})
+		case t.kind == tokString && inArray:
+			array = append(array, utf16Text(t.text))
+		case t.kind == tokString:
+			args = append(args, arg{s: t.text})
+		case t.kind == tokKeyword && strings.HasPrefix(t.text, "begin"):
+			args = nil
+		case t.text == "endcodespacerange":
+			if len(args) > 0 && len(args[0].s) > 0 {
+				dec.codeLen = len(args[0].s)
+			}
+		case t.text == "endbfchar":
+			for i := 0; i+1 < len(args); i += 2 {
+				dec.codes[codeValue(args[i].s)] = utf16Text(args[i+1].s)
+			}
+		case t.text == "endbfrange":
+			for i := 0; i+2 < len(args); i += 3 {
+				lo, hi := codeValue(args[i].s), codeValue(args[i+1].s)
+				if hi < lo || hi-lo > 0xffff {
+					continue
+				}
+				if dst := args[i+2]; dst.array != nil {
+					for j, s := range dst.array {
+						dec.codes[lo+uint32(j)] = s
+					}
+				} else {
+					// The last character counts up through the range
+					base := []rune(utf16Text(dst.s))
+					if len(base) == 0 {
+						continue
+					}
+					for c := lo; c <= hi; c++ {
+						r := append([]rune(nil), base...)
+						r[len(r)-1] += rune(c - lo)
+						dec.codes[c] = string(r)
+					}
+				}
+			}
+		}
+	}
+}
+
+// The text a string shows.  Without a /ToUnicode map single byte codes are
+// taken as characters, and codes that cannot be decoded are written as hex.
+func (dec *textDecoder) decode(s string) string {
+	if dec == nil {
+		return s
+	}
+	var sb strings.Builder
+	for i := 0; i+dec.codeLen <= len(s); i += dec.codeLen {
+		code := codeValue(s[i : i+dec.codeLen])
+		if text, ok := dec.codes[code]; ok {
+			sb.WriteString(text)
+		} else if dec.codeLen == 1 {
+			sb.WriteRune(rune(code))
+		} else {
+			fmt.Fprintf(&sb, "<%0*x>", dec.codeLen*2, code)
+		}
+	}
+	return sb.String()
+}
+
+// A character code from its big-endian bytes
+func codeValue(s string) uint32 {
+	var v uint32
+	for i := 0; i < len(s); i++ {
+		v = v<<8 | uint32(s[i])
+	}
+	return v
+}
+
+// Text from the UTF-16BE bytes of a CMap destination
+func utf16Text(s string) string {
+	units := make([]uint16, len(s)/2)
+	for i := range units {
+		units[i] = uint16(s[2*i])<<8 | uint16(s[2*i+1])
+	}
+	return string(utf16.Decode(units))
+}
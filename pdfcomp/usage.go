@@ -0,0 +1,98 @@
+package pdfcomp
+
+import (
+	"os"
+	"sync"
+	"time"
+)
+
+// The resources a comparison used, for services that enforce quotas or bill
+// for each comparison.  The renderer's usage is measured as each of its
+// processes exits; the rest is estimated.
+type ResourceUsage struct {
+	// Renderer processes run
+	RenderProcesses int
+	// Processor time the renderer processes spent in user and in system mode
+	RenderUserTime   time.Duration
+	RenderSystemTime time.Duration
+	// The most memory any one renderer process held, in bytes.  Zero where
+	// the platform does not report it, as on Windows.
+	RenderPeakBytes int64
+	// An estimate of the most memory held at once for the rendered pages of
+	// a pair and the differences between them, in bytes
+	ImagePeakBytes int64
+	// Bytes written to temporary files, such as the files themselves when
+	// compared from memory and difference images spooled for the pdf
+	TempBytes int64
+}
+
+// Collects the usage of one comparison from the goroutines rendering its
+// pages.  A nil meter records nothing.
+type usageMeter struct {
+	mu    sync.Mutex
+	usage ResourceUsage
+}
+
+// Record a renderer process that has exited
+func (m *usageMeter) process(state *os.ProcessState) {
+	if m == nil || state == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.usage.RenderProcesses++
+	m.usage.RenderUserTime += state.UserTime()
+	m.usage.RenderSystemTime += state.SystemTime()
+	m.usage.RenderPeakBytes = max(m.usage.RenderPeakBytes, peakMemory(state))
+}
+
+// Record the page images held together for one page
+func (m *usageMeter) images(imgs ...*Image) {
+	if m == nil {
+		return
+	}
+	var n int64
+	for _, img := range imgs {
+		if img != nil {
+			n += int64(img.H * img.W * img.Channels)
+		}
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.usage.ImagePeakBytes = max(m.usage.ImagePeakBytes, n)
+}
+
+// Record a temporary file that was written, by its size
+func (m *usageMeter) temp(filename string) {
+	if m == nil {
+		return
+	}
+	fi, err := os.Stat(filename)
+	if err != nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.usage.TempBytes += fi.Size()
+}
+
+// Record what a comparison nested in this one used
+func (m *usageMeter) add(u ResourceUsage) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.usage.RenderProcesses += u.RenderProcesses
+	m.usage.RenderUserTime += u.RenderUserTime
+	m.usage.RenderSystemTime += u.RenderSystemTime
+	m.usage.RenderPeakBytes = max(m.usage.RenderPeakBytes, u.RenderPeakBytes)
+	m.usage.ImagePeakBytes = max(m.usage.ImagePeakBytes, u.ImagePeakBytes)
+	m.usage.TempBytes += u.TempBytes
+}
+
+func (m *usageMeter) total() ResourceUsage {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.usage
+}
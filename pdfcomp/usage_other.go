@@ -0,0 +1,10 @@
+//go:build !unix
+
+package pdfcomp
+
+import "os"
+
+// Not reported on this platform
+func peakMemory(state *os.ProcessState) int64 {
+	return 0
+}
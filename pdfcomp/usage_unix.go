@@ -0,0 +1,22 @@
+//go:build unix
+
+package pdfcomp
+
+import (
+	"os"
+	"runtime"
+	"syscall"
+)
+
+// The most memory a process that has exited held, in bytes
+func peakMemory(state *os.ProcessState) int64 {
+	ru, ok := state.SysUsage().(*syscall.Rusage)
+	if !ok {
+		return 0
+	}
+	// Reported in bytes on macOS and in kilobytes elsewhere
+	if runtime.GOOS == "darwin" || runtime.GOOS == "ios" {
+		return int64(ru.Maxrss)
+	}
+	return int64(ru.Maxrss) * 1024
+}
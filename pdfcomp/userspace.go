@@ -0,0 +1,132 @@
+package pdfcomp
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/model"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/types"
+)
+
+// A rectangle in the default user space of a pdf page, in points from the
+// origin of its boxes, y going up, given by its lower left and upper right
+// corners as annotations and other pdf tools give rectangles
+type PDFRect struct {
+	LLX, LLY, URX, URY float64
+}
+
+func (r PDFRect) String() string {
+	round := func(v float64) float64 { return math.Round(v*100) / 100 }
+	return fmt.Sprintf("[%g %g %g %g]", round(r.LLX), round(r.LLY), round(r.URX), round(r.URY))
+}
+
+// How the pixels of the renderings as they were compared lie on the page of
+// one of the files.  Undoing what was done to its rendering, in the reverse
+// order, gives pixels of the page as rendered, and they give points.
+type pageSpace struct {
+	// The area of the page rendered, and the rotation it was shown at
+	box    types.Rectangle
+	rotate int
+	// Pixels to an inch across and down the rendering once turned, and
+	// reduced if it was
+	xdpi, ydpi float64
+	// Where the rendering was cropped to content
+	cropX, cropY int
+	// How much larger the rendering was before it was scaled to fit the
+	// other
+	fitX, fitY float64
+	// How far the rendering was moved to line up with the other
+	offsetX, offsetY int
+}
+
+// How the renderings of a page compared lie on the page in each file
+func pageSpaces(ctx1, ctx2 *model.Context, st *PageState, resolution int) ([2]pageSpace, error) {
+	var spaces [2]pageSpace
+	for i, ctx := range []*model.Context{ctx1, ctx2} {
+		_, _, inh, err := ctx.PageDict(st.Page, false)
+		if err != nil {
+			return spaces, fmt.Errorf("error reading page %d: %w", st.Page, err)
+		}
+		if inh == nil {
+			return spaces, fmt.Errorf("page %d not found", st.Page)
+		}
+		spaces[i] = pageSpace{box: renderedBox(inh), rotate: ((inh.Rotate % 360) + 360) % 360,
+			xdpi: float64(resolution), ydpi: float64(resolution), fitX: 1, fitY: 1}
+	}
+	file2 := &spaces[1]
+	if m := st.Result.Matched; m != nil {
+		file2.xdpi, file2.ydpi = m.XDPI2, m.YDPI2
+	}
+	if st.Rotation != nil {
+		// Turned to show the page as file1's is shown
+		file2.rotate = spaces[0].rotate
+	}
+	if r := st.Rescale; r != nil {
+		spaces[r.File-1].xdpi /= float64(r.Factor)
+		spaces[r.File-1].ydpi /= float64(r.Factor)
+	}
+	if c := st.Crop; c != nil {
+		spaces[0].cropX, spaces[0].cropY = c.Bounds1.X, c.Bounds1.Y
+		file2.cropX, file2.cropY = c.Bounds2.X, c.Bounds2.Y
+	}
+	if m := st.Mismatch; m != nil && m.Fit == FitScale && m.Width > 0 && m.Height > 0 {
+		file2.fitX, file2.fitY = float64(m.Width2)/float64(m.Width), float64(m.Height2)/float64(m.Height)
+	}
+	if off := st.Offset; off != nil {
+		file2.offsetX, file2.offsetY = off.X, off.Y
+	}
+	return spaces, nil
+}
+
+// A region of the renderings compared in the default user space of the page,
+// kept within the area rendered
+func (s pageSpace) rect(r Region) PDFRect {
+	// Points across and down the page as it was shown, from its top left
+	// corner
+	point := func(x, y int) (float64, float64) {
+		px := (float64(x-s.offsetX)*s.fitX + float64(s.cropX)) * 72 / s.xdpi
+		py := (float64(y-s.offsetY)*s.fitY + float64(s.cropY)) * 72 / s.ydpi
+		return px, py
+	}
+	u0, v0 := point(r.X, r.Y)
+	u1, v1 := point(r.X+r.Width, r.Y+r.Height)
+
+	// Turn the page back from the way it was shown.  Turned clockwise by a
+	// quarter, the bottom left corner of the box is shown at the top left,
+	// and so on round.
+	b := s.box
+	toUser := func(u, v float64) (float64, float64) {
+		switch s.rotate {
+		case 90:
+			return b.LL.X + v, b.LL.Y + u
+		case 180:
+			return b.UR.X - u, b.LL.Y + v
+		case 270:
+			return b.UR.X - v, b.UR.Y - u
+		}
+		return b.LL.X + u, b.UR.Y - v
+	}
+	x0, y0 := toUser(u0, v0)
+	x1, y1 := toUser(u1, v1)
+	clamp := func(v, lo, hi float64) float64 { return math.Max(lo, math.Min(hi, v)) }
+	return PDFRect{
+		LLX: clamp(math.Min(x0, x1), b.LL.X, b.UR.X), LLY: clamp(math.Min(y0, y1), b.LL.Y, b.UR.Y),
+		URX: clamp(math.Max(x0, x1), b.LL.X, b.UR.X), URY: clamp(math.Max(y0, y1), b.LL.Y, b.UR.Y),
+	}
+}
+
+// The regions of a page in the default user space of the page in each file
+func userSpaceRegions(ctx1, ctx2 *model.Context, st *PageState, resolution int) (rects1, rects2 []PDFRect, err error) {
+	if len(st.Result.Regions) == 0 {
+		return nil, nil, nil
+	}
+	spaces, err := pageSpaces(ctx1, ctx2, st, resolution)
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, r := range st.Result.Regions {
+		rects1 = append(rects1, spaces[0].rect(r))
+		rects2 = append(rects2, spaces[1].rect(r))
+	}
+	return rects1, rects2, nil
+}
@@ -0,0 +1,134 @@
+// Package pdfcomptest provides helpers for using pdfcomp in Go tests, for
+// example to check generated PDFs against golden files.
+package pdfcomptest
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/mdmcconnell/pdfcomp/pdfcomp"
+)
+
+// If set, the directory difference pdfs are written to, for example one a CI
+// system keeps as build artifacts.  Otherwise each is written to a new
+// temporary directory, which is left in place so it can be looked at after
+// the test.
+const DiffDirEnv = "PDFCOMP_DIFF_DIR"
+
+// If set to anything but empty, CompareGolden copies the file produced over
+// the golden file instead of comparing them, to accept a change
+const UpdateEnv = "PDFCOMP_UPDATE"
+
+// Check that got looks the same as want, and if not mark the test as failed,
+// naming the pages that differ and a pdf highlighting the differences.
+// Options are passed to pdfcomp.Compare.  Returns true if the files are the
+// same.
+func AssertEqualPDFs(t testing.TB, got, want string, opts ...pdfcomp.Option) bool {
+	t.Helper()
+	msg, err := compare(got, want, opts)
+	if err != nil {
+		t.Errorf("comparing %s with %s: %s", got, want, err)
+		return false
+	}
+	if msg != "" {
+		t.Error(msg)
+		return false
+	}
+	return true
+}
+
+// Like AssertEqualPDFs, but stops the test if the files differ
+func RequireEqualPDFs(t testing.TB, got, want string, opts ...pdfcomp.Option) {
+	t.Helper()
+	if !AssertEqualPDFs(t, got, want, opts...) {
+		t.FailNow()
+	}
+}
+
+// Check that got looks the same as the golden file, as AssertEqualPDFs does.
+// If the environment variable PDFCOMP_UPDATE is set, got is copied over the
+// golden file instead, creating it if necessary, so that changes can be
+// accepted by running the tests again with it set.
+func CompareGolden(t testing.TB, got, golden string, opts ...pdfcomp.Option) bool {
+	t.Helper()
+	if os.Getenv(UpdateEnv) != "" {
+		if err := copyFile(got, golden); err != nil {
+			t.Errorf("updating golden file %s: %s", golden, err)
+			return false
+		}
+		return true
+	}
+	if _, err := os.Stat(golden); err != nil {
+		t.Errorf("golden file %s is missing; run with %s=1 to create it", golden, UpdateEnv)
+		return false
+	}
+	return AssertEqualPDFs(t, got, golden, opts...)
+}
+
+// Compare two files, returning a message describing how they differ, or
+// an empty string if they are the same
+func compare(got, want string, opts []pdfcomp.Option) (string, error) {
+	dir := os.Getenv(DiffDirEnv)
+	temp := dir == ""
+	if temp {
+		var err error
+		if dir, err = os.MkdirTemp("", "pdfcomptest-*"); err != nil {
+			return "", err
+		}
+	} else if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+	diffName := filepath.Join(dir, filepath.Base(got)+"-diff.pdf")
+	// Only a pdf that highlights something is kept
+	discard := func() {
+		os.Remove(diffName)
+		if temp {
+			os.Remove(dir)
+		}
+	}
+	f, err := os.Create(diffName)
+	if err != nil {
+		return "", err
+	}
+	res, err := pdfcomp.Compare(got, want, append(opts, pdfcomp.WithPDF(f))...)
+	f.Close()
+	if err != nil {
+		discard()
+		return "", err
+	}
+	if res.Equal {
+		discard()
+		return "", nil
+	}
+
+	msg := fmt.Sprintf("%s does not look the same as %s", got, want)
+	if res.Pages1 != res.Pages2 {
+		msg += fmt.Sprintf(": %d pages instead of %d", res.Pages1, res.Pages2)
+	}
+	var pages []string
+	for _, p := range res.DiffPages() {
+		pages = append(pages, strconv.Itoa(p.Page))
+	}
+	if len(pages) == 0 {
+		// Nothing to highlight, for example if only the page count differs
+		discard()
+		return msg, nil
+	}
+	return msg + fmt.Sprintf("\npages differing: %s\ndifferences highlighted in %s",
+		strings.Join(pages, ", "), diffName), nil
+}
+
+func copyFile(src, dst string) error {
+	data, err := os.ReadFile(src)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(dst, data, 0644)
+}
@@ -0,0 +1,311 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/mdmcconnell/pdfcomp/pdfcomp"
+)
+
+// Largest upload accepted by default, both files together
+const DefaultMaxUpload = 100 << 20
+
+// A Server compares PDF files uploaded over HTTP, queueing comparisons by
+// priority and running identical requests only once.  It serves
+//
+//	POST /compare
+//
+// taking a multipart form with the files as file1 and file2 and any options
+// as form fields, and answering with a CompareResponse as json, and
+//
+//	GET /jobs/
+//
+// listing the comparisons running and recently finished, each with a page
+// under /jobs/{id}/ that follows it live, as a Tracker does.
+type Server struct {
+	queue *Queue
+	group Group[*CompareResponse]
+	jobs  jobs
+	// Settings for every comparison, which those of the request override
+	cfg pdfcomp.Config
+	// Largest request body accepted, in bytes
+	MaxUpload int64
+}
+
+// A server running comparisons on queue with the settings in cfg, which
+// requests may override.  Only the options of a config are used: reports
+// come back in the response, and are not written to files.
+func NewServer(queue *Queue, cfg pdfcomp.Config) *Server {
+	return &Server{queue: queue, cfg: cfg, MaxUpload: DefaultMaxUpload}
+}
+
+// The answer to a comparison request
+type CompareResponse struct {
+	Equal  bool `json:"equal"`
+	Pages1 int  `json:"pages1"`
+	Pages2 int  `json:"pages2"`
+	// Pages found to be different.  Unless a pdf was asked for, comparing
+	// stops at the first.
+	DiffPages []int `json:"diffPages"`
+	// Everything the comparison found, with the files named as uploaded
+	Result *pdfcomp.Result `json:"result"`
+	// The difference pdf, if asked for with pdf=true and the files differ
+	PDF []byte `json:"pdf,omitempty"`
+	// The address of the comparison's progress page on the server, which
+	// is kept for a while after it finishes
+	Job string `json:"job"`
+}
+
+// Form fields that are not options
+var requestFields = []string{"pdf", "priority"}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if strings.HasPrefix(r.URL.Path, "/jobs/") {
+		s.jobs.ServeHTTP(w, r)
+		return
+	}
+	if r.URL.Path != "/compare" {
+		http.NotFound(w, r)
+		return
+	}
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		writeError(w, http.StatusMethodNotAllowed, errors.New("use POST"))
+		return
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, s.MaxUpload)
+	if err := r.ParseMultipartForm(32 << 20); err != nil {
+		status := http.StatusBadRequest
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			status = http.StatusRequestEntityTooLarge
+		}
+		writeError(w, status, err)
+		return
+	}
+	defer r.MultipartForm.RemoveAll()
+
+	form := r.MultipartForm.Value
+	cfg, err := FormConfig(s.cfg, form)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	c, err := pdfcomp.FromConfig(cfg)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	priority, err := ParsePriority(first(form, "priority"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	wantPDF := false
+	if v := first(form, "pdf"); v != "" {
+		if wantPDF, err = strconv.ParseBool(v); err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("invalid pdf %q", v))
+			return
+		}
+	}
+
+	dir, err := os.MkdirTemp("", "pdfcomp-upload-*")
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	defer os.RemoveAll(dir)
+	var files, names [2]string
+	for i, field := range []string{"file1", "file2"} {
+		fhs := r.MultipartForm.File[field]
+		if len(fhs) != 1 {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("expected one file in %s", field))
+			return
+		}
+		names[i] = fhs[0].Filename
+		files[i] = filepath.Join(dir, field+".pdf")
+		if err := saveUpload(fhs[0], files[i]); err != nil {
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+	}
+
+	key, err := KeyFor(files[0], files[1], canonicalForm(form))
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	opts := c.Options()
+	if cfg.FailFast == nil {
+		// Keeping images for the progress page would otherwise compare every
+		// page
+		opts = append(opts, pdfcomp.WithFailFast(!wantPDF))
+	}
+	resp, err, shared := s.group.Do(r.Context(), key, priority, func(ctx context.Context, promote <-chan Priority) (*CompareResponse, error) {
+		return s.compare(ctx, priority, promote, files, names, wantPDF, opts)
+	})
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		writeError(w, http.StatusServiceUnavailable, err)
+		return
+	}
+	if err != nil {
+		// The files could not be read as pdfs, or the renderer failed
+		writeError(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	if shared {
+		// Another request with the same files may have named them differently
+		res := *resp.Result
+		res.File1, res.File2 = names[0], names[1]
+		copied := *resp
+		copied.Result = &res
+		resp = &copied
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// Run one comparison once a worker is free, moving it to the priorities
+// received from promote while it waits, and stopping it once ctx is done.
+// Its progress is published as a job.
+func (s *Server) compare(ctx context.Context, p Priority, promote <-chan Priority, files, names [2]string, wantPDF bool, opts []pdfcomp.Option) (*CompareResponse, error) {
+	id, t := s.jobs.start(names[0], names[1])
+	defer s.jobs.finish(id)
+	var buf bytes.Buffer
+	all := append(slices.Clone(opts), pdfcomp.WithLabels(names[0], names[1]), pdfcomp.WithContext(ctx))
+	all = append(all, t.Options()...)
+	if wantPDF {
+		all = append(all, pdfcomp.WithPDF(&buf))
+	}
+	var res *pdfcomp.Result
+	var err error
+	if qerr := s.queue.DoPromotable(ctx, p, promote, func() { res, err = pdfcomp.Compare(files[0], files[1], all...) }); qerr != nil {
+		t.Finish(nil, qerr)
+		return nil, qerr
+	}
+	t.Finish(res, err)
+	if err != nil {
+		return nil, err
+	}
+	// The images were kept for the progress page, and are not sent
+	for i := range res.Pages {
+		res.Pages[i].Image = nil
+	}
+	resp := &CompareResponse{Equal: res.Equal, Pages1: res.Pages1, Pages2: res.Pages2, DiffPages: []int{}, Result: res, Job: "/jobs/" + id + "/"}
+	for _, pr := range res.DiffPages() {
+		resp.DiffPages = append(resp.DiffPages, pr.Page)
+	}
+	if buf.Len() > 0 {
+		resp.PDF = buf.Bytes()
+	}
+	return resp, nil
+}
+
+// Apply the option fields of a request to a copy of base.  Fields are named as
+// the command line flags and config keys are, and take the same values:
+// preset, resolution, color-mode, ratio, tolerance, delta-e, max-diff-percent,
+// diff-style, layout, highlight-color, highlight-opacity, highlight-style,
+// grid, grid-unit, detail-zoom, detail-margin, join-direction, join-align,
+// join-background, fit, sample, sample-method, seed, stop-after,
+// content-precision, prescreen, ignore (repeated), and the booleans
+// highlight-graded, fail-fast,
+// annotations, signatures, mask-signatures, fonts, classify, layers,
+// page-labels, links, content-shortcut, rescale, compare-rotation, match-size,
+// crop-to-content and align.  Settings that name files on the server are not
+// accepted.
+func FormConfig(base pdfcomp.Config, form url.Values) (pdfcomp.Config, error) {
+	cfg := base
+	cfg.Ignore = slices.Clone(base.Ignore)
+	keys := make([]string, 0, len(form))
+	for k := range form {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	for _, k := range keys {
+		if slices.Contains(requestFields, k) {
+			continue
+		}
+		if !slices.Contains(formSettings, k) {
+			return cfg, fmt.Errorf("unknown option %q", k)
+		}
+		values := form[k]
+		if k != "ignore" {
+			values = values[:1]
+		}
+		for _, v := range values {
+			if err := cfg.Set(k, strings.TrimSpace(v)); err != nil {
+				return cfg, err
+			}
+		}
+	}
+	return cfg, nil
+}
+
+// Settings a request may make
+var formSettings = []string{
+	"preset", "resolution", "color-mode", "ratio", "tolerance", "delta-e", "max-diff-percent", "diff-style",
+	"layout", "highlight-color", "highlight-opacity", "highlight-style", "highlight-graded", "grid", "grid-unit",
+	"detail-zoom", "detail-margin", "join-direction", "join-align", "join-background", "fit",
+	"sample", "sample-method", "seed", "stop-after", "fail-fast", "content-precision", "prescreen", "ignore",
+	"annotations", "signatures", "mask-signatures", "fonts", "classify", "layers",
+	"page-labels", "links", "content-shortcut", "rescale", "compare-rotation",
+	"match-size", "crop-to-content", "align",
+}
+
+// The form fields in sorted order, for keys that are the same for the same
+// settings however they were sent.  The priority is left out, so that the
+// same comparison asked for at different priorities is run once.
+func canonicalForm(form url.Values) string {
+	settings := url.Values{}
+	for k, v := range form {
+		if k != "priority" {
+			settings[k] = v
+		}
+	}
+	return settings.Encode()
+}
+
+// The first value of a form field, or "" if it is missing
+func first(form url.Values, key string) string {
+	if v := form[key]; len(v) > 0 {
+		return strings.TrimSpace(v[0])
+	}
+	return ""
+}
+
+func saveUpload(fh *multipart.FileHeader, name string) error {
+	src, err := fh.Open()
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	dst, err := os.Create(name)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(dst, src); err != nil {
+		dst.Close()
+		return err
+	}
+	return dst.Close()
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(struct {
+		Error string `json:"error"`
+	}{err.Error()})
+}
@@ -0,0 +1,134 @@
+package server
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"sync"
+
+	"github.com/mdmcconnell/pdfcomp/pdfcomp"
+)
+
+// Identifies a comparison by the content of its two inputs and its settings,
+// so that requests uploading the same files get the same key
+type Key string
+
+// Build the key for comparing file1 with file2.  Settings must describe the
+// comparison options canonically, for example with form values in sorted order.
+func KeyFor(file1, file2, settings string) (Key, error) {
+	sum1, err := pdfcomp.Checksum(file1)
+	if err != nil {
+		return "", err
+	}
+	sum2, err := pdfcomp.Checksum(file2)
+	if err != nil {
+		return "", err
+	}
+	h := sha256.New()
+	for _, s := range []string{sum1, sum2, settings} {
+		h.Write([]byte(s))
+		h.Write([]byte{0})
+	}
+	return Key(hex.EncodeToString(h.Sum(nil))), nil
+}
+
+// A Group coalesces identical requests: while a job for a key is pending or
+// running, further requests for the same key wait for it and share its result
+// instead of starting another execution.  The job belongs to no one request:
+// it runs until every request waiting for it has gone, and at the priority of
+// the most urgent of them.
+type Group[T any] struct {
+	mu    sync.Mutex
+	calls map[Key]*call[T]
+}
+
+type call[T any] struct {
+	done chan struct{}
+	val  T
+	err  error
+	dups int
+	// Requests still waiting for the job, which is cancelled when none are
+	waiting int
+	cancel  context.CancelFunc
+	// The most urgent priority of the requests, sent on promote when it
+	// becomes more urgent
+	priority Priority
+	promote  chan Priority
+}
+
+// Run fn for key at priority p unless an identical request is already in
+// flight, in which case wait for that one, making it as urgent as p.  Fn is
+// given a context that is done once every request waiting for it has gone,
+// and the more urgent priorities it should move to.  The request that starts
+// fn waits for it to finish even if ctx is done first, so what fn uses may
+// belong to that request.  Shared is true if the result came from another
+// request, or went to others too.
+func (g *Group[T]) Do(ctx context.Context, key Key, p Priority, fn func(ctx context.Context, promote <-chan Priority) (T, error)) (val T, err error, shared bool) {
+	g.mu.Lock()
+	if g.calls == nil {
+		g.calls = map[Key]*call[T]{}
+	}
+	if c, ok := g.calls[key]; ok {
+		c.dups++
+		c.waiting++
+		if p < c.priority {
+			c.priority = p
+			// Only the latest priority matters
+			select {
+			case <-c.promote:
+			default:
+			}
+			c.promote <- p
+		}
+		g.mu.Unlock()
+		select {
+		case <-c.done:
+			return c.val, c.err, true
+		case <-ctx.Done():
+			g.leave(key, c)
+			return val, ctx.Err(), true
+		}
+	}
+	jobCtx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	c := &call[T]{done: make(chan struct{}), waiting: 1, cancel: cancel, priority: p, promote: make(chan Priority, 1)}
+	g.calls[key] = c
+	g.mu.Unlock()
+
+	stop := context.AfterFunc(ctx, func() { g.leave(key, c) })
+	c.val, c.err = fn(jobCtx, c.promote)
+	stop()
+
+	g.mu.Lock()
+	if g.calls[key] == c {
+		delete(g.calls, key)
+	}
+	shared = c.dups > 0
+	g.mu.Unlock()
+	close(c.done)
+	if err := ctx.Err(); err != nil {
+		return val, err, shared
+	}
+	return c.val, c.err, shared
+}
+
+// A request stops waiting for a job, cancelling it if it was the last.  A
+// cancelled job is forgotten at once, so that later requests start afresh.
+func (g *Group[T]) leave(key Key, c *call[T]) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	c.waiting--
+	if c.waiting == 0 {
+		c.cancel()
+		if g.calls[key] == c {
+			delete(g.calls, key)
+		}
+	}
+}
+
+// Number of requests currently in flight, not counting duplicates
+func (g *Group[T]) InFlight() int {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return len(g.calls)
+}
@@ -0,0 +1,123 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// Wait until n requests are waiting for key
+func waitFor(t *testing.T, g *Group[int], key Key, n int) {
+	t.Helper()
+	for range 1000 {
+		g.mu.Lock()
+		c := g.calls[key]
+		ok := c != nil && c.waiting == n
+		g.mu.Unlock()
+		if ok {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Fatalf("%d requests never waited for %s", n, key)
+}
+
+func TestGroupOutlivesFirstRequest(t *testing.T) {
+	var g Group[int]
+	release := make(chan struct{})
+	started := make(chan struct{})
+	ctx1, cancel1 := context.WithCancel(context.Background())
+	first := make(chan error)
+	go func() {
+		_, err, _ := g.Do(ctx1, "k", Batch, func(ctx context.Context, promote <-chan Priority) (int, error) {
+			close(started)
+			select {
+			case <-release:
+				return 42, nil
+			case <-ctx.Done():
+				return 0, ctx.Err()
+			}
+		})
+		first <- err
+	}()
+	<-started
+
+	second := make(chan int)
+	go func() {
+		val, err, shared := g.Do(context.Background(), "k", Interactive, func(context.Context, <-chan Priority) (int, error) {
+			t.Error("duplicate request ran its own job")
+			return 0, nil
+		})
+		if err != nil || !shared {
+			t.Errorf("second request got err %v, shared %v", err, shared)
+		}
+		second <- val
+	}()
+	waitFor(t, &g, "k", 2)
+
+	// The job moves to the priority of the more urgent request
+	g.mu.Lock()
+	p := <-g.calls["k"].promote
+	g.mu.Unlock()
+	if p != Interactive {
+		t.Errorf("promoted to %s, want %s", p, Interactive)
+	}
+
+	// The first request leaving must not stop the job the second waits for
+	cancel1()
+	close(release)
+	if err := <-first; !errors.Is(err, context.Canceled) {
+		t.Errorf("first request got %v, want %v", err, context.Canceled)
+	}
+	if val := <-second; val != 42 {
+		t.Errorf("second request got %d, want 42", val)
+	}
+	if n := g.InFlight(); n != 0 {
+		t.Errorf("%d still in flight", n)
+	}
+}
+
+func TestGroupCancelledWhenAllLeave(t *testing.T) {
+	var g Group[int]
+	started := make(chan struct{})
+	jobErr := make(chan error, 1)
+	ctx1, cancel1 := context.WithCancel(context.Background())
+	ctx2, cancel2 := context.WithCancel(context.Background())
+	first := make(chan struct{})
+	go func() {
+		g.Do(ctx1, "k", Batch, func(ctx context.Context, promote <-chan Priority) (int, error) {
+			close(started)
+			<-ctx.Done()
+			jobErr <- ctx.Err()
+			return 0, ctx.Err()
+		})
+		close(first)
+	}()
+	<-started
+	second := make(chan error)
+	go func() {
+		_, err, _ := g.Do(ctx2, "k", Batch, nil)
+		second <- err
+	}()
+	waitFor(t, &g, "k", 2)
+
+	cancel2()
+	if err := <-second; !errors.Is(err, context.Canceled) {
+		t.Errorf("second request got %v, want %v", err, context.Canceled)
+	}
+	select {
+	case err := <-jobErr:
+		t.Fatalf("job stopped with %v while a request still waited", err)
+	case <-time.After(10 * time.Millisecond):
+	}
+
+	cancel1()
+	<-first
+	if err := <-jobErr; !errors.Is(err, context.Canceled) {
+		t.Errorf("job stopped with %v, want %v", err, context.Canceled)
+	}
+	if n := g.InFlight(); n != 0 {
+		t.Errorf("%d still in flight", n)
+	}
+}
@@ -0,0 +1,142 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+
+	"github.com/mdmcconnell/pdfcomp/pdfcomp"
+	"github.com/mdmcconnell/pdfcomp/server/pdfcomppb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Size of the chunks the difference pdf is sent in
+const pdfChunkSize = 64 << 10
+
+// A GRPCServer implements the Comparer service of pdfcomppb, the gRPC
+// counterpart of POST /compare.  Each comparison streams its progress page by
+// page, then the result, then the difference pdf if one was asked for.
+// Requests are not shared with identical ones, as each has its own progress.
+type GRPCServer struct {
+	pdfcomppb.UnimplementedComparerServer
+	queue *Queue
+	// Settings for every comparison, which those of the request override
+	cfg pdfcomp.Config
+}
+
+// A gRPC service running comparisons on queue with the settings in cfg, which
+// requests may override.  The queue may be shared with a Server.
+func NewGRPCServer(queue *Queue, cfg pdfcomp.Config) *GRPCServer {
+	return &GRPCServer{queue: queue, cfg: cfg}
+}
+
+// Register the service with a grpc.Server.  Files are sent whole in the
+// request, so the server's grpc.MaxRecvMsgSize should allow for them.
+func (s *GRPCServer) Register(r grpc.ServiceRegistrar) {
+	pdfcomppb.RegisterComparerServer(r, s)
+}
+
+func (s *GRPCServer) Compare(req *pdfcomppb.CompareRequest, stream grpc.ServerStreamingServer[pdfcomppb.CompareEvent]) error {
+	form := url.Values{}
+	for _, st := range req.Settings {
+		if slices.Contains(requestFields, st.Key) {
+			return status.Errorf(codes.InvalidArgument, "%s is a field of the request, not a setting", st.Key)
+		}
+		form.Add(st.Key, st.Value)
+	}
+	cfg, err := FormConfig(s.cfg, form)
+	if err != nil {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+	c, err := pdfcomp.FromConfig(cfg)
+	if err != nil {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+	priority := Interactive
+	if req.Priority == pdfcomppb.Priority_BATCH {
+		priority = Batch
+	}
+	if len(req.File1) == 0 || len(req.File2) == 0 {
+		return status.Error(codes.InvalidArgument, "expected two files")
+	}
+
+	dir, err := os.MkdirTemp("", "pdfcomp-grpc-*")
+	if err != nil {
+		return status.Error(codes.Internal, err.Error())
+	}
+	defer os.RemoveAll(dir)
+	files := [2]string{filepath.Join(dir, "file1.pdf"), filepath.Join(dir, "file2.pdf")}
+	names := [2]string{req.Name1, req.Name2}
+	for i, data := range [][]byte{req.File1, req.File2} {
+		if names[i] == "" {
+			names[i] = fmt.Sprintf("file%d.pdf", i+1)
+		}
+		if err := os.WriteFile(files[i], data, 0600); err != nil {
+			return status.Error(codes.Internal, err.Error())
+		}
+	}
+
+	progress := func(pr pdfcomp.PageResult, total int) {
+		// A failed send means the client has gone, and the comparison stops
+		// with the stream's context
+		stream.Send(&pdfcomppb.CompareEvent{Event: &pdfcomppb.CompareEvent_Progress{Progress: &pdfcomppb.Progress{
+			Page: int32(pr.Page), Total: int32(total), Equal: pr.Equal}}})
+	}
+	var buf bytes.Buffer
+	opts := append(slices.Clone(c.Options()), pdfcomp.WithLabels(names[0], names[1]), pdfcomp.WithOnPage(progress),
+		pdfcomp.WithContext(stream.Context()))
+	if req.Pdf {
+		opts = append(opts, pdfcomp.WithPDF(&buf))
+	}
+	var res *pdfcomp.Result
+	if qerr := s.queue.Do(stream.Context(), priority, func() { res, err = pdfcomp.Compare(files[0], files[1], opts...) }); qerr != nil {
+		return statusError(qerr)
+	}
+	if err != nil {
+		return statusError(err)
+	}
+
+	data, err := json.Marshal(res)
+	if err != nil {
+		return status.Error(codes.Internal, err.Error())
+	}
+	result := &pdfcomppb.Result{Equal: res.Equal, Pages1: int32(res.Pages1), Pages2: int32(res.Pages2), Json: data}
+	for _, pr := range res.DiffPages() {
+		result.DiffPages = append(result.DiffPages, int32(pr.Page))
+	}
+	if err := stream.Send(&pdfcomppb.CompareEvent{Event: &pdfcomppb.CompareEvent_Result{Result: result}}); err != nil {
+		return err
+	}
+	for pdf := buf.Bytes(); len(pdf) > 0; {
+		n := min(len(pdf), pdfChunkSize)
+		if err := stream.Send(&pdfcomppb.CompareEvent{Event: &pdfcomppb.CompareEvent_Pdf{Pdf: &pdfcomppb.PDFChunk{Data: pdf[:n]}}}); err != nil {
+			return err
+		}
+		pdf = pdf[n:]
+	}
+	return nil
+}
+
+// The status for a comparison that failed, by what kind of failure it was
+func statusError(err error) error {
+	code := codes.Internal
+	switch {
+	case errors.Is(err, context.Canceled):
+		code = codes.Canceled
+	case errors.Is(err, context.DeadlineExceeded):
+		code = codes.DeadlineExceeded
+	case errors.Is(err, pdfcomp.ErrRendererNotFound):
+		code = codes.Unavailable
+	case errors.Is(err, pdfcomp.ErrInvalidPDF), errors.Is(err, pdfcomp.ErrEncrypted):
+		code = codes.InvalidArgument
+	}
+	return status.Error(code, err.Error())
+}
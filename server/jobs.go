@@ -0,0 +1,122 @@
+package server
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"html/template"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// How many finished comparisons keep their progress pages
+const keptJobs = 100
+
+// The comparisons a Server has run, each with a progress page under
+// /jobs/{id}/, and a list of them at /jobs/
+type jobs struct {
+	mu       sync.Mutex
+	trackers map[string]*Tracker
+	// Running jobs, and finished ones oldest first, which are forgotten once
+	// there are more than keptJobs
+	running  []string
+	finished []string
+}
+
+// Start following a comparison, returning its id and its tracker
+func (j *jobs) start(file1, file2 string) (string, *Tracker) {
+	var b [8]byte
+	rand.Read(b[:])
+	id := hex.EncodeToString(b[:])
+	t := NewTracker(file1, file2)
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.trackers == nil {
+		j.trackers = map[string]*Tracker{}
+	}
+	j.trackers[id] = t
+	j.running = append(j.running, id)
+	return id, t
+}
+
+// Record the end of a comparison, forgetting the oldest finished one if
+// there are too many
+func (j *jobs) finish(id string) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if i := slices.Index(j.running, id); i >= 0 {
+		j.running = slices.Delete(j.running, i, i+1)
+	}
+	j.finished = append(j.finished, id)
+	if len(j.finished) > keptJobs {
+		delete(j.trackers, j.finished[0])
+		j.finished = j.finished[1:]
+	}
+}
+
+// Serve the list of jobs at /jobs/ and each job's progress page below it
+func (j *jobs) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	rest := strings.TrimPrefix(r.URL.Path, "/jobs/")
+	if rest == "" {
+		j.serveList(w)
+		return
+	}
+	id, _, nested := strings.Cut(rest, "/")
+	j.mu.Lock()
+	t, ok := j.trackers[id]
+	j.mu.Unlock()
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	if !nested {
+		http.Redirect(w, r, id+"/", http.StatusMovedPermanently)
+		return
+	}
+	t.ServeHTTP(w, r)
+}
+
+// A job as listed at /jobs/
+type jobEntry struct {
+	ID     string
+	File1  string
+	File2  string
+	Status string
+}
+
+// List the running jobs, then the finished ones, most recent first
+func (j *jobs) serveList(w http.ResponseWriter) {
+	j.mu.Lock()
+	var entries []jobEntry
+	for _, ids := range [][]string{j.running, j.finished} {
+		for i := len(ids) - 1; i >= 0; i-- {
+			t := j.trackers[ids[i]]
+			entries = append(entries, jobEntry{ID: ids[i], File1: t.File1, File2: t.File2, Status: t.status()})
+		}
+	}
+	j.mu.Unlock()
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	jobsTemplate.Execute(w, entries)
+}
+
+var jobsTemplate = template.Must(template.New("jobs").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>pdfcomp: comparisons</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+td { padding: 0.2em 1em 0.2em 0; }
+</style>
+</head>
+<body>
+<h1>Comparisons</h1>
+{{if .}}<table>
+{{range .}}<tr><td><a href="{{.ID}}/">{{.File1}} vs {{.File2}}</a></td><td>{{.Status}}</td></tr>
+{{end}}</table>
+{{else}}<p>No comparisons yet.</p>
+{{end}}</body>
+</html>
+`))
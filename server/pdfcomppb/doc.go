@@ -0,0 +1,5 @@
+// Package pdfcomppb holds the gRPC definition of the comparison service,
+// generated from pdfcomp.proto, for servers and for clients in Go.
+package pdfcomppb
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative pdfcomp.proto
@@ -0,0 +1,611 @@
+// The comparison service, for programs that would rather call pdf-comp over
+// gRPC than post forms to it
+
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.6
+// 	protoc        v5.29.3
+// source: pdfcomp.proto
+
+package pdfcomppb
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+type Priority int32
+
+const (
+	Priority_INTERACTIVE Priority = 0
+	Priority_BATCH       Priority = 1
+)
+
+// Enum value maps for Priority.
+var (
+	Priority_name = map[int32]string{
+		0: "INTERACTIVE",
+		1: "BATCH",
+	}
+	Priority_value = map[string]int32{
+		"INTERACTIVE": 0,
+		"BATCH":       1,
+	}
+)
+
+func (x Priority) Enum() *Priority {
+	p := new(Priority)
+	*p = x
+	return p
+}
+
+func (x Priority) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (Priority) Descriptor() protoreflect.EnumDescriptor {
+	return file_pdfcomp_proto_enumTypes[0].Descriptor()
+}
+
+func (Priority) Type() protoreflect.EnumType {
+	return &file_pdfcomp_proto_enumTypes[0]
+}
+
+func (x Priority) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use Priority.Descriptor instead.
+func (Priority) EnumDescriptor() ([]byte, []int) {
+	return file_pdfcomp_proto_rawDescGZIP(), []int{0}
+}
+
+type CompareRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// The contents of the two files, and the names to report them by
+	File1 []byte `protobuf:"bytes,1,opt,name=file1,proto3" json:"file1,omitempty"`
+	File2 []byte `protobuf:"bytes,2,opt,name=file2,proto3" json:"file2,omitempty"`
+	Name1 string `protobuf:"bytes,3,opt,name=name1,proto3" json:"name1,omitempty"`
+	Name2 string `protobuf:"bytes,4,opt,name=name2,proto3" json:"name2,omitempty"`
+	// Settings named as the command line flags are, with the same values, as
+	// for the form fields of POST /compare.  ignore may be repeated.
+	Settings []*Setting `protobuf:"bytes,5,rep,name=settings,proto3" json:"settings,omitempty"`
+	// Carry on past the first difference and send the difference pdf
+	Pdf           bool     `protobuf:"varint,6,opt,name=pdf,proto3" json:"pdf,omitempty"`
+	Priority      Priority `protobuf:"varint,7,opt,name=priority,proto3,enum=pdfcomp.v1.Priority" json:"priority,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *CompareRequest) Reset() {
+	*x = CompareRequest{}
+	mi := &file_pdfcomp_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *CompareRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CompareRequest) ProtoMessage() {}
+
+func (x *CompareRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_pdfcomp_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CompareRequest.ProtoReflect.Descriptor instead.
+func (*CompareRequest) Descriptor() ([]byte, []int) {
+	return file_pdfcomp_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *CompareRequest) GetFile1() []byte {
+	if x != nil {
+		return x.File1
+	}
+	return nil
+}
+
+func (x *CompareRequest) GetFile2() []byte {
+	if x != nil {
+		return x.File2
+	}
+	return nil
+}
+
+func (x *CompareRequest) GetName1() string {
+	if x != nil {
+		return x.Name1
+	}
+	return ""
+}
+
+func (x *CompareRequest) GetName2() string {
+	if x != nil {
+		return x.Name2
+	}
+	return ""
+}
+
+func (x *CompareRequest) GetSettings() []*Setting {
+	if x != nil {
+		return x.Settings
+	}
+	return nil
+}
+
+func (x *CompareRequest) GetPdf() bool {
+	if x != nil {
+		return x.Pdf
+	}
+	return false
+}
+
+func (x *CompareRequest) GetPriority() Priority {
+	if x != nil {
+		return x.Priority
+	}
+	return Priority_INTERACTIVE
+}
+
+type Setting struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Key           string                 `protobuf:"bytes,1,opt,name=key,proto3" json:"key,omitempty"`
+	Value         string                 `protobuf:"bytes,2,opt,name=value,proto3" json:"value,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Setting) Reset() {
+	*x = Setting{}
+	mi := &file_pdfcomp_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Setting) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Setting) ProtoMessage() {}
+
+func (x *Setting) ProtoReflect() protoreflect.Message {
+	mi := &file_pdfcomp_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Setting.ProtoReflect.Descriptor instead.
+func (*Setting) Descriptor() ([]byte, []int) {
+	return file_pdfcomp_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *Setting) GetKey() string {
+	if x != nil {
+		return x.Key
+	}
+	return ""
+}
+
+func (x *Setting) GetValue() string {
+	if x != nil {
+		return x.Value
+	}
+	return ""
+}
+
+type CompareEvent struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Types that are valid to be assigned to Event:
+	//
+	//	*CompareEvent_Progress
+	//	*CompareEvent_Result
+	//	*CompareEvent_Pdf
+	Event         isCompareEvent_Event `protobuf_oneof:"event"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *CompareEvent) Reset() {
+	*x = CompareEvent{}
+	mi := &file_pdfcomp_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *CompareEvent) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CompareEvent) ProtoMessage() {}
+
+func (x *CompareEvent) ProtoReflect() protoreflect.Message {
+	mi := &file_pdfcomp_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CompareEvent.ProtoReflect.Descriptor instead.
+func (*CompareEvent) Descriptor() ([]byte, []int) {
+	return file_pdfcomp_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *CompareEvent) GetEvent() isCompareEvent_Event {
+	if x != nil {
+		return x.Event
+	}
+	return nil
+}
+
+func (x *CompareEvent) GetProgress() *Progress {
+	if x != nil {
+		if x, ok := x.Event.(*CompareEvent_Progress); ok {
+			return x.Progress
+		}
+	}
+	return nil
+}
+
+func (x *CompareEvent) GetResult() *Result {
+	if x != nil {
+		if x, ok := x.Event.(*CompareEvent_Result); ok {
+			return x.Result
+		}
+	}
+	return nil
+}
+
+func (x *CompareEvent) GetPdf() *PDFChunk {
+	if x != nil {
+		if x, ok := x.Event.(*CompareEvent_Pdf); ok {
+			return x.Pdf
+		}
+	}
+	return nil
+}
+
+type isCompareEvent_Event interface {
+	isCompareEvent_Event()
+}
+
+type CompareEvent_Progress struct {
+	Progress *Progress `protobuf:"bytes,1,opt,name=progress,proto3,oneof"`
+}
+
+type CompareEvent_Result struct {
+	Result *Result `protobuf:"bytes,2,opt,name=result,proto3,oneof"`
+}
+
+type CompareEvent_Pdf struct {
+	Pdf *PDFChunk `protobuf:"bytes,3,opt,name=pdf,proto3,oneof"`
+}
+
+func (*CompareEvent_Progress) isCompareEvent_Event() {}
+
+func (*CompareEvent_Result) isCompareEvent_Event() {}
+
+func (*CompareEvent_Pdf) isCompareEvent_Event() {}
+
+// One page compared, of total pages to compare
+type Progress struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Page          int32                  `protobuf:"varint,1,opt,name=page,proto3" json:"page,omitempty"`
+	Total         int32                  `protobuf:"varint,2,opt,name=total,proto3" json:"total,omitempty"`
+	Equal         bool                   `protobuf:"varint,3,opt,name=equal,proto3" json:"equal,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Progress) Reset() {
+	*x = Progress{}
+	mi := &file_pdfcomp_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Progress) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Progress) ProtoMessage() {}
+
+func (x *Progress) ProtoReflect() protoreflect.Message {
+	mi := &file_pdfcomp_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Progress.ProtoReflect.Descriptor instead.
+func (*Progress) Descriptor() ([]byte, []int) {
+	return file_pdfcomp_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *Progress) GetPage() int32 {
+	if x != nil {
+		return x.Page
+	}
+	return 0
+}
+
+func (x *Progress) GetTotal() int32 {
+	if x != nil {
+		return x.Total
+	}
+	return 0
+}
+
+func (x *Progress) GetEqual() bool {
+	if x != nil {
+		return x.Equal
+	}
+	return false
+}
+
+type Result struct {
+	state  protoimpl.MessageState `protogen:"open.v1"`
+	Equal  bool                   `protobuf:"varint,1,opt,name=equal,proto3" json:"equal,omitempty"`
+	Pages1 int32                  `protobuf:"varint,2,opt,name=pages1,proto3" json:"pages1,omitempty"`
+	Pages2 int32                  `protobuf:"varint,3,opt,name=pages2,proto3" json:"pages2,omitempty"`
+	// Pages found to be different.  Unless a pdf was asked for, comparing
+	// stops at the first.
+	DiffPages []int32 `protobuf:"varint,4,rep,packed,name=diff_pages,json=diffPages,proto3" json:"diff_pages,omitempty"`
+	// Everything the comparison found as json, as POST /compare answers it
+	Json          []byte `protobuf:"bytes,5,opt,name=json,proto3" json:"json,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Result) Reset() {
+	*x = Result{}
+	mi := &file_pdfcomp_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Result) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Result) ProtoMessage() {}
+
+func (x *Result) ProtoReflect() protoreflect.Message {
+	mi := &file_pdfcomp_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Result.ProtoReflect.Descriptor instead.
+func (*Result) Descriptor() ([]byte, []int) {
+	return file_pdfcomp_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *Result) GetEqual() bool {
+	if x != nil {
+		return x.Equal
+	}
+	return false
+}
+
+func (x *Result) GetPages1() int32 {
+	if x != nil {
+		return x.Pages1
+	}
+	return 0
+}
+
+func (x *Result) GetPages2() int32 {
+	if x != nil {
+		return x.Pages2
+	}
+	return 0
+}
+
+func (x *Result) GetDiffPages() []int32 {
+	if x != nil {
+		return x.DiffPages
+	}
+	return nil
+}
+
+func (x *Result) GetJson() []byte {
+	if x != nil {
+		return x.Json
+	}
+	return nil
+}
+
+// The next part of the difference pdf
+type PDFChunk struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Data          []byte                 `protobuf:"bytes,1,opt,name=data,proto3" json:"data,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *PDFChunk) Reset() {
+	*x = PDFChunk{}
+	mi := &file_pdfcomp_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *PDFChunk) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*PDFChunk) ProtoMessage() {}
+
+func (x *PDFChunk) ProtoReflect() protoreflect.Message {
+	mi := &file_pdfcomp_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use PDFChunk.ProtoReflect.Descriptor instead.
+func (*PDFChunk) Descriptor() ([]byte, []int) {
+	return file_pdfcomp_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *PDFChunk) GetData() []byte {
+	if x != nil {
+		return x.Data
+	}
+	return nil
+}
+
+var File_pdfcomp_proto protoreflect.FileDescriptor
+
+const file_pdfcomp_proto_rawDesc = "" +
+	"\n" +
+	"\rpdfcomp.proto\x12\n" +
+	"pdfcomp.v1\"\xdd\x01\n" +
+	"\x0eCompareRequest\x12\x14\n" +
+	"\x05file1\x18\x01 \x01(\fR\x05file1\x12\x14\n" +
+	"\x05file2\x18\x02 \x01(\fR\x05file2\x12\x14\n" +
+	"\x05name1\x18\x03 \x01(\tR\x05name1\x12\x14\n" +
+	"\x05name2\x18\x04 \x01(\tR\x05name2\x12/\n" +
+	"\bsettings\x18\x05 \x03(\v2\x13.pdfcomp.v1.SettingR\bsettings\x12\x10\n" +
+	"\x03pdf\x18\x06 \x01(\bR\x03pdf\x120\n" +
+	"\bpriority\x18\a \x01(\x0e2\x14.pdfcomp.v1.PriorityR\bpriority\"1\n" +
+	"\aSetting\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\x12\x14\n" +
+	"\x05value\x18\x02 \x01(\tR\x05value\"\xa3\x01\n" +
+	"\fCompareEvent\x122\n" +
+	"\bprogress\x18\x01 \x01(\v2\x14.pdfcomp.v1.ProgressH\x00R\bprogress\x12,\n" +
+	"\x06result\x18\x02 \x01(\v2\x12.pdfcomp.v1.ResultH\x00R\x06result\x12(\n" +
+	"\x03pdf\x18\x03 \x01(\v2\x14.pdfcomp.v1.PDFChunkH\x00R\x03pdfB\a\n" +
+	"\x05event\"J\n" +
+	"\bProgress\x12\x12\n" +
+	"\x04page\x18\x01 \x01(\x05R\x04page\x12\x14\n" +
+	"\x05total\x18\x02 \x01(\x05R\x05total\x12\x14\n" +
+	"\x05equal\x18\x03 \x01(\bR\x05equal\"\x81\x01\n" +
+	"\x06Result\x12\x14\n" +
+	"\x05equal\x18\x01 \x01(\bR\x05equal\x12\x16\n" +
+	"\x06pages1\x18\x02 \x01(\x05R\x06pages1\x12\x16\n" +
+	"\x06pages2\x18\x03 \x01(\x05R\x06pages2\x12\x1d\n" +
+	"\n" +
+	"diff_pages\x18\x04 \x03(\x05R\tdiffPages\x12\x12\n" +
+	"\x04json\x18\x05 \x01(\fR\x04json\"\x1e\n" +
+	"\bPDFChunk\x12\x12\n" +
+	"\x04data\x18\x01 \x01(\fR\x04data*&\n" +
+	"\bPriority\x12\x0f\n" +
+	"\vINTERACTIVE\x10\x00\x12\t\n" +
+	"\x05BATCH\x10\x012M\n" +
+	"\bComparer\x12A\n" +
+	"\aCompare\x12\x1a.pdfcomp.v1.CompareRequest\x1a\x18.pdfcomp.v1.CompareEvent0\x01B1Z/github.com/mdmcconnell/pdfcomp/server/pdfcomppbb\x06proto3"
+
+var (
+	file_pdfcomp_proto_rawDescOnce sync.Once
+	file_pdfcomp_proto_rawDescData []byte
+)
+
+func file_pdfcomp_proto_rawDescGZIP() []byte {
+	file_pdfcomp_proto_rawDescOnce.Do(func() {
+		file_pdfcomp_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_pdfcomp_proto_rawDesc), len(file_pdfcomp_proto_rawDesc)))
+	})
+	return file_pdfcomp_proto_rawDescData
+}
+
+var file_pdfcomp_proto_enumTypes = make([]protoimpl.EnumInfo, 1)
+var file_pdfcomp_proto_msgTypes = make([]protoimpl.MessageInfo, 6)
+var file_pdfcomp_proto_goTypes = []any{
+	(Priority)(0),          // 0: pdfcomp.v1.Priority
+	(*CompareRequest)(nil), // 1: pdfcomp.v1.CompareRequest
+	(*Setting)(nil),        // 2: pdfcomp.v1.Setting
+	(*CompareEvent)(nil),   // 3: pdfcomp.v1.CompareEvent
+	(*Progress)(nil),       // 4: pdfcomp.v1.Progress
+	(*Result)(nil),         // 5: pdfcomp.v1.Result
+	(*PDFChunk)(nil),       // 6: pdfcomp.v1.PDFChunk
+}
+var file_pdfcomp_proto_depIdxs = []int32{
+	2, // 0: pdfcomp.v1.CompareRequest.settings:type_name -> pdfcomp.v1.Setting
+	0, // 1: pdfcomp.v1.CompareRequest.priority:type_name -> pdfcomp.v1.Priority
+	4, // 2: pdfcomp.v1.CompareEvent.progress:type_name -> pdfcomp.v1.Progress
+	5, // 3: pdfcomp.v1.CompareEvent.result:type_name -> pdfcomp.v1.Result
+	6, // 4: pdfcomp.v1.CompareEvent.pdf:type_name -> pdfcomp.v1.PDFChunk
+	1, // 5: pdfcomp.v1.Comparer.Compare:input_type -> pdfcomp.v1.CompareRequest
+	3, // 6: pdfcomp.v1.Comparer.Compare:output_type -> pdfcomp.v1.CompareEvent
+	6, // [6:7] is the sub-list for method output_type
+	5, // [5:6] is the sub-list for method input_type
+	5, // [5:5] is the sub-list for extension type_name
+	5, // [5:5] is the sub-list for extension extendee
+	0, // [0:5] is the sub-list for field type_name
+}
+
+func init() { file_pdfcomp_proto_init() }
+func file_pdfcomp_proto_init() {
+	if File_pdfcomp_proto != nil {
+		return
+	}
+	file_pdfcomp_proto_msgTypes[2].OneofWrappers = []any{
+		(*CompareEvent_Progress)(nil),
+		(*CompareEvent_Result)(nil),
+		(*CompareEvent_Pdf)(nil),
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_pdfcomp_proto_rawDesc), len(file_pdfcomp_proto_rawDesc)),
+			NumEnums:      1,
+			NumMessages:   6,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_pdfcomp_proto_goTypes,
+		DependencyIndexes: file_pdfcomp_proto_depIdxs,
+		EnumInfos:         file_pdfcomp_proto_enumTypes,
+		MessageInfos:      file_pdfcomp_proto_msgTypes,
+	}.Build()
+	File_pdfcomp_proto = out.File
+	file_pdfcomp_proto_goTypes = nil
+	file_pdfcomp_proto_depIdxs = nil
+}
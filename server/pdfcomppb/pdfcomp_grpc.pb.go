@@ -0,0 +1,133 @@
+// The comparison service, for programs that would rather call pdf-comp over
+// gRPC than post forms to it
+
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.6.2
+// - protoc             v5.29.3
+// source: pdfcomp.proto
+
+package pdfcomppb
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.64.0 or later.
+const _ = grpc.SupportPackageIsVersion9
+
+const (
+	Comparer_Compare_FullMethodName = "/pdfcomp.v1.Comparer/Compare"
+)
+
+// ComparerClient is the client API for Comparer service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type ComparerClient interface {
+	// Compare two files.  The stream carries a Progress event as each page is
+	// compared, then the Result, then the difference pdf in chunks if one was
+	// asked for and the files differ.
+	Compare(ctx context.Context, in *CompareRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[CompareEvent], error)
+}
+
+type comparerClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewComparerClient(cc grpc.ClientConnInterface) ComparerClient {
+	return &comparerClient{cc}
+}
+
+func (c *comparerClient) Compare(ctx context.Context, in *CompareRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[CompareEvent], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &Comparer_ServiceDesc.Streams[0], Comparer_Compare_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[CompareRequest, CompareEvent]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Comparer_CompareClient = grpc.ServerStreamingClient[CompareEvent]
+
+// ComparerServer is the server API for Comparer service.
+// All implementations must embed UnimplementedComparerServer
+// for forward compatibility.
+type ComparerServer interface {
+	// Compare two files.  The stream carries a Progress event as each page is
+	// compared, then the Result, then the difference pdf in chunks if one was
+	// asked for and the files differ.
+	Compare(*CompareRequest, grpc.ServerStreamingServer[CompareEvent]) error
+	mustEmbedUnimplementedComparerServer()
+}
+
+// UnimplementedComparerServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedComparerServer struct{}
+
+func (UnimplementedComparerServer) Compare(*CompareRequest, grpc.ServerStreamingServer[CompareEvent]) error {
+	return status.Error(codes.Unimplemented, "method Compare not implemented")
+}
+func (UnimplementedComparerServer) mustEmbedUnimplementedComparerServer() {}
+func (UnimplementedComparerServer) testEmbeddedByValue()                  {}
+
+// UnsafeComparerServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to ComparerServer will
+// result in compilation errors.
+type UnsafeComparerServer interface {
+	mustEmbedUnimplementedComparerServer()
+}
+
+func RegisterComparerServer(s grpc.ServiceRegistrar, srv ComparerServer) {
+	// If the following call panics, it indicates UnimplementedComparerServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&Comparer_ServiceDesc, srv)
+}
+
+func _Comparer_Compare_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(CompareRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(ComparerServer).Compare(m, &grpc.GenericServerStream[CompareRequest, CompareEvent]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Comparer_CompareServer = grpc.ServerStreamingServer[CompareEvent]
+
+// Comparer_ServiceDesc is the grpc.ServiceDesc for Comparer service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var Comparer_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "pdfcomp.v1.Comparer",
+	HandlerType: (*ComparerServer)(nil),
+	Methods:     []grpc.MethodDesc{},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "Compare",
+			Handler:       _Comparer_Compare_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "pdfcomp.proto",
+}
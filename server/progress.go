@@ -0,0 +1,280 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"image"
+	"image/png"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/mdmcconnell/pdfcomp/pdfcomp"
+)
+
+// Width of the difference thumbnails streamed to progress pages
+const thumbWidth = 480
+
+// Progress of a comparison as one page completes
+type PageEvent struct {
+	Page  int  `json:"page"`
+	Equal bool `json:"equal"`
+	// Pages compared so far, and in all
+	Done  int `json:"done"`
+	Total int `json:"total"`
+	// Address of a thumbnail of the differences, relative to the progress
+	// page, for pages that differ
+	Thumb string `json:"thumb,omitempty"`
+}
+
+// The outcome of a comparison, sent once it is over
+type DoneEvent struct {
+	Equal bool   `json:"equal"`
+	Error string `json:"error,omitempty"`
+}
+
+// A Tracker follows one running comparison and serves a live progress page
+// for it, so that long comparisons can be watched as they run.  Pass the
+// result of Options to Compare, call Finish with its result, and mount the
+// Tracker under a path ending in / such as /jobs/42/, where it serves the
+// page itself, a stream of server-sent events at events, and difference
+// thumbnails under thumbs/.
+type Tracker struct {
+	File1 string
+	File2 string
+
+	mu     sync.Mutex
+	events []PageEvent
+	thumbs map[int][]byte
+	done   *DoneEvent
+	// Closed and replaced whenever something changes, to wake watchers
+	changed chan struct{}
+}
+
+func NewTracker(file1, file2 string) *Tracker {
+	return &Tracker{File1: file1, File2: file2, thumbs: map[int][]byte{}, changed: make(chan struct{})}
+}
+
+// Options that report each page to the tracker, keeping the difference
+// images so that thumbnails can be made of them
+func (t *Tracker) Options() []pdfcomp.Option {
+	return []pdfcomp.Option{pdfcomp.WithOnPage(t.page), pdfcomp.WithKeepImages(true)}
+}
+
+// Record the outcome of the comparison and tell watchers it is over
+func (t *Tracker) Finish(res *pdfcomp.Result, err error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.done = &DoneEvent{}
+	if err != nil {
+		t.done.Error = err.Error()
+	} else {
+		t.done.Equal = res.Equal
+	}
+	t.notify()
+}
+
+// Called by the comparison as each page completes
+func (t *Tracker) page(pr pdfcomp.PageResult, total int) {
+	var thumb []byte
+	if !pr.Equal && pr.Image != nil {
+		var buf bytes.Buffer
+		if err := png.Encode(&buf, thumbnail(pr.Image, thumbWidth)); err == nil {
+			thumb = buf.Bytes()
+		}
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	ev := PageEvent{Page: pr.Page, Equal: pr.Equal, Done: len(t.events) + 1, Total: total}
+	if thumb != nil {
+		t.thumbs[pr.Page] = thumb
+		ev.Thumb = "thumbs/" + strconv.Itoa(pr.Page) + ".png"
+	}
+	t.events = append(t.events, ev)
+	t.notify()
+}
+
+// How far the comparison has got, for lists of comparisons
+func (t *Tracker) status() string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	switch {
+	case t.done == nil && len(t.events) == 0:
+		return "waiting"
+	case t.done == nil:
+		last := t.events[len(t.events)-1]
+		return fmt.Sprintf("%d of %d pages compared", last.Done, last.Total)
+	case t.done.Error != "":
+		return "failed"
+	case t.done.Equal:
+		return "same"
+	}
+	return "different"
+}
+
+// Wake everyone waiting for a change.  Must be called with mu held.
+func (t *Tracker) notify() {
+	close(t.changed)
+	t.changed = make(chan struct{})
+}
+
+func (t *Tracker) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	path := r.URL.Path
+	dir, name := path[:strings.LastIndex(path, "/")+1], path[strings.LastIndex(path, "/")+1:]
+	switch {
+	case name == "events":
+		t.serveEvents(w, r)
+	case strings.HasSuffix(dir, "/thumbs/") || dir == "thumbs/":
+		page, err := strconv.Atoi(strings.TrimSuffix(name, ".png"))
+		t.mu.Lock()
+		thumb, ok := t.thumbs[page]
+		t.mu.Unlock()
+		if err != nil || !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "image/png")
+		w.Write(thumb)
+	case name == "":
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		progressTemplate.Execute(w, t)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// Stream every page event so far and then each new one as it happens, ending
+// with a done event
+func (t *Tracker) serveEvents(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming not supported", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+
+	sent := 0
+	for {
+		t.mu.Lock()
+		events := t.events[sent:]
+		done := t.done
+		changed := t.changed
+		t.mu.Unlock()
+
+		for _, ev := range events {
+			writeEvent(w, "page", ev)
+		}
+		sent += len(events)
+		if done != nil {
+			writeEvent(w, "done", done)
+			flusher.Flush()
+			return
+		}
+		flusher.Flush()
+
+		select {
+		case <-changed:
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+func writeEvent(w http.ResponseWriter, name string, v any) {
+	data, _ := json.Marshal(v)
+	fmt.Fprintf(w, "event: %s\ndata: %s\n\n", name, data)
+}
+
+// Scale an image down to the given width, averaging the pixels each output
+// pixel covers
+func thumbnail(img image.Image, width int) image.Image {
+	b := img.Bounds()
+	if b.Dx() <= width {
+		return img
+	}
+	height := max(1, b.Dy()*width/b.Dx())
+	out := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := range height {
+		y0, y1 := b.Min.Y+y*b.Dy()/height, b.Min.Y+(y+1)*b.Dy()/height
+		for x := range width {
+			x0, x1 := b.Min.X+x*b.Dx()/width, b.Min.X+(x+1)*b.Dx()/width
+			var r, g, bl, n uint32
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					cr, cg, cb, _ := img.At(sx, sy).RGBA()
+					r, g, bl, n = r+cr>>8, g+cg>>8, bl+cb>>8, n+1
+				}
+			}
+			i := out.PixOffset(x, y)
+			out.Pix[i], out.Pix[i+1], out.Pix[i+2], out.Pix[i+3] = byte(r/n), byte(g/n), byte(bl/n), 255
+		}
+	}
+	return out
+}
+
+var progressTemplate = template.Must(template.New("progress").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>pdfcomp: {{.File1}} vs {{.File2}}</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+progress { width: 40em; }
+.same { color: #070; }
+.different { color: #b00; font-weight: bold; }
+.page img { max-width: 100%; border: 1px solid #999; }
+</style>
+</head>
+<body>
+<h1>{{.File1}} vs {{.File2}}</h1>
+<p><progress id="bar" value="0" max="1"></progress> <span id="count">starting</span></p>
+<p id="status">comparing&hellip;</p>
+<div id="pages"></div>
+<script>
+var src = new EventSource("events");
+src.addEventListener("page", function(e) {
+	var ev = JSON.parse(e.data);
+	document.getElementById("bar").max = ev.total;
+	document.getElementById("bar").value = ev.done;
+	document.getElementById("count").textContent = ev.done + " of " + ev.total + " pages";
+	if (ev.equal) {
+		return;
+	}
+	var div = document.createElement("div");
+	div.className = "page";
+	var h = document.createElement("h2");
+	h.className = "different";
+	h.textContent = "Page " + ev.page + " is different";
+	div.appendChild(h);
+	if (ev.thumb) {
+		var img = document.createElement("img");
+		img.src = ev.thumb;
+		img.alt = "differences on page " + ev.page;
+		div.appendChild(img);
+	}
+	document.getElementById("pages").appendChild(div);
+});
+src.addEventListener("done", function(e) {
+	var ev = JSON.parse(e.data);
+	var status = document.getElementById("status");
+	if (ev.error) {
+		status.className = "different";
+		status.textContent = "failed: " + ev.error;
+	} else if (ev.equal) {
+		status.className = "same";
+		status.textContent = "finished: the files are the same";
+	} else {
+		status.className = "different";
+		status.textContent = "finished: the files are different";
+	}
+	src.close();
+});
+</script>
+</body>
+</html>
+`))
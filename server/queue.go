@@ -0,0 +1,171 @@
+// Package server contains the pieces used to run pdfcomp comparisons as a
+// long lived service on behalf of many clients.
+package server
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+// Priority of a job.  Lower values are more urgent.
+type Priority int
+
+const (
+	// On-demand requests where someone is waiting for the answer
+	Interactive Priority = iota
+	// Backfills and nightly runs that can wait
+	Batch
+	numPriorities
+)
+
+func (p Priority) String() string {
+	switch p {
+	case Interactive:
+		return "interactive"
+	case Batch:
+		return "batch"
+	}
+	return fmt.Sprintf("Priority(%d)", int(p))
+}
+
+// Convert a priority name, as used in requests and flags, to a Priority
+func ParsePriority(s string) (Priority, error) {
+	switch s {
+	case "", "interactive":
+		return Interactive, nil
+	case "batch":
+		return Batch, nil
+	}
+	return 0, fmt.Errorf("unknown priority %q", s)
+}
+
+// A Queue runs jobs on a fixed number of workers, divided between priorities
+// by their shares.  A priority may borrow idle workers from the shares of less
+// urgent priorities but never from more urgent ones, so a flood of batch jobs
+// always leaves the interactive share free for on-demand comparisons.
+type Queue struct {
+	mu      sync.Mutex
+	shares  [numPriorities]int
+	running [numPriorities]int
+	pending [numPriorities][]chan struct{}
+}
+
+// Create a queue with the given number of workers reserved for each priority.
+// Every priority must have a share of at least one.
+func NewQueue(shares map[Priority]int) (*Queue, error) {
+	q := &Queue{}
+	for p := range numPriorities {
+		if shares[p] < 1 {
+			return nil, fmt.Errorf("priority %s needs a share of at least one worker", p)
+		}
+		q.shares[p] = shares[p]
+	}
+	return q, nil
+}
+
+// Run fn as a job at priority p, waiting for a worker to become available.
+// Returns ctx.Err() without running fn if ctx is done first.
+func (q *Queue) Do(ctx context.Context, p Priority, fn func()) error {
+	return q.DoPromotable(ctx, p, nil, fn)
+}
+
+// Run fn as Do does, moving the job to a more urgent priority whenever one is
+// received from promote while it is still waiting.  It runs at the priority
+// it had when it started.
+func (q *Queue) DoPromotable(ctx context.Context, p Priority, promote <-chan Priority, fn func()) error {
+	if p < 0 || p >= numPriorities {
+		return fmt.Errorf("invalid priority %d", p)
+	}
+	ticket := make(chan struct{})
+	q.mu.Lock()
+	q.pending[p] = append(q.pending[p], ticket)
+	q.dispatch()
+	q.mu.Unlock()
+
+wait:
+	for {
+		select {
+		case <-ticket:
+			break wait
+		case np := <-promote:
+			q.mu.Lock()
+			select {
+			case <-ticket:
+				// Already granted at p
+			default:
+				if np >= 0 && np < p {
+					q.remove(p, ticket)
+					p = np
+					q.pending[p] = append(q.pending[p], ticket)
+					q.dispatch()
+				}
+			}
+			q.mu.Unlock()
+		case <-ctx.Done():
+			q.mu.Lock()
+			defer q.mu.Unlock()
+			select {
+			case <-ticket:
+				// Granted at the same moment, so hand the worker back
+				q.running[p]--
+				q.dispatch()
+			default:
+				q.remove(p, ticket)
+			}
+			return ctx.Err()
+		}
+	}
+
+	defer func() {
+		q.mu.Lock()
+		q.running[p]--
+		q.dispatch()
+		q.mu.Unlock()
+	}()
+	fn()
+	return nil
+}
+
+// Number of jobs waiting and running at each priority
+func (q *Queue) Len(p Priority) (pending, running int) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.pending[p]), q.running[p]
+}
+
+// Start as many pending jobs as there are workers for, most urgent first.
+// Must be called with q.mu held.
+func (q *Queue) dispatch() {
+	for p := range numPriorities {
+		for len(q.pending[p]) > 0 && q.available(p) {
+			close(q.pending[p][0])
+			q.pending[p] = q.pending[p][1:]
+			q.running[p]++
+		}
+	}
+}
+
+// True if a job at priority p may start, counting the idle workers in its own
+// share and in the shares of all less urgent priorities.  A more urgent
+// priority may have borrowed from those shares, so the total is checked too.
+func (q *Queue) available(p Priority) bool {
+	free, total := 0, 0
+	for l := range numPriorities {
+		total += q.shares[l] - q.running[l]
+		if l >= p {
+			free += q.shares[l] - q.running[l]
+		}
+	}
+	return free > 0 && total > 0
+}
+
+// Drop a waiting job.  Must be called with q.mu held.
+func (q *Queue) remove(p Priority, ticket chan struct{}) {
+	for i, t := range q.pending[p] {
+		if t == ticket {
+			q.pending[p] = append(q.pending[p][:i], q.pending[p][i+1:]...)
+			return
+		}
+	}
+}
@@ -0,0 +1,32 @@
+package server
+
+import "testing"
+
+func TestQueueAvailable(t *testing.T) {
+	// One interactive worker and two batch workers
+	shares := [numPriorities]int{Interactive: 1, Batch: 2}
+	tests := []struct {
+		name               string
+		running            [numPriorities]int
+		interactive, batch bool
+	}{
+		{"idle", [numPriorities]int{}, true, true},
+		{"interactive share busy", [numPriorities]int{Interactive: 1}, true, true},
+		{"batch share busy", [numPriorities]int{Batch: 2}, true, false},
+		{"one batch worker busy", [numPriorities]int{Batch: 1}, true, true},
+		{"interactive borrowed a batch worker", [numPriorities]int{Interactive: 2, Batch: 1}, false, false},
+		{"interactive borrowed every batch worker", [numPriorities]int{Interactive: 3}, false, false},
+		{"all busy", [numPriorities]int{Interactive: 1, Batch: 2}, false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q := &Queue{shares: shares, running: tt.running}
+			if got := q.available(Interactive); got != tt.interactive {
+				t.Errorf("available(Interactive) = %v, want %v", got, tt.interactive)
+			}
+			if got := q.available(Batch); got != tt.batch {
+				t.Errorf("available(Batch) = %v, want %v", got, tt.batch)
+			}
+		})
+	}
+}